@@ -2,17 +2,52 @@ package main
 
 import (
 	"context"
+	"flag"
 	"fmt"
+	"io/fs"
 	"log"
 	"os"
+	"strconv"
 
 	"taskbot/internal/config"
+	"taskbot/internal/migrate"
+	"taskbot/migrations"
 
 	"github.com/jackc/pgx/v5/pgxpool"
 	"github.com/joho/godotenv"
 )
 
+func usage() {
+	fmt.Fprintf(os.Stderr, `Usage: %s [-dir path] <command> [n]
+
+Commands:
+  up [n]     Apply all pending migrations, or the next n
+  down [n]   Roll back the last migration, or the last n
+  status     Show applied and pending migrations
+  redo       Roll back and re-apply the last migration
+`, os.Args[0])
+	os.Exit(2)
+}
+
 func main() {
+	dir := flag.String("dir", "", "directory containing migration files (defaults to the migrations built into the binary)")
+	flag.Usage = usage
+	flag.Parse()
+
+	command := "up"
+	if flag.NArg() > 0 {
+		command = flag.Arg(0)
+	}
+
+	count := 0
+	if flag.NArg() > 1 {
+		n, err := strconv.Atoi(flag.Arg(1))
+		if err != nil || n < 1 {
+			log.Fatalf("Invalid migration count: %s", flag.Arg(1))
+		}
+		count = n
+	}
+
 	if err := godotenv.Load(); err != nil {
 		log.Println("No .env file found")
 	}
@@ -33,32 +68,82 @@ func main() {
 		cfg.Database.SSLMode,
 	)
 
-	pool, err := pgxpool.New(context.Background(), connStr)
+	ctx := context.Background()
+	pool, err := pgxpool.New(ctx, connStr)
 	if err != nil {
 		log.Fatalf("Unable to connect to database: %v", err)
 	}
 	defer pool.Close()
 
-	// Read and execute migration file
-	migrations := []string{
-		"migrations/001_initial_schema.sql",
-		"migrations/002_add_active_status.sql",
-		"migrations/003_add_server_id.sql",
-		"migrations/004_add_guild_users.sql",
+	var source fs.FS = migrations.FS
+	if *dir != "" {
+		source = os.DirFS(*dir)
+	}
+
+	migrator, err := migrate.New(pool, source)
+	if err != nil {
+		log.Fatalf("Error loading migrations: %v", err)
 	}
 
-	for _, migrationFile := range migrations {
-		migration, err := os.ReadFile(migrationFile)
+	switch command {
+	case "up":
+		applied, err := migrator.Up(ctx, count)
+		for _, m := range applied {
+			log.Printf("Successfully applied migration: %03d_%s", m.Version, m.Name)
+		}
+		if err != nil {
+			log.Fatalf("Migration failed: %v", err)
+		}
+		if len(applied) == 0 {
+			log.Println("No pending migrations")
+			return
+		}
+		log.Println("Migration completed successfully")
+
+	case "down":
+		if count == 0 {
+			count = 1
+		}
+		rolledBack, err := migrator.Down(ctx, count)
+		for _, m := range rolledBack {
+			log.Printf("Successfully rolled back migration: %03d_%s", m.Version, m.Name)
+		}
 		if err != nil {
-			log.Fatalf("Error reading migration file %s: %v", migrationFile, err)
+			log.Fatalf("Rollback failed: %v", err)
+		}
+		if len(rolledBack) == 0 {
+			log.Println("No applied migrations to roll back")
 		}
 
-		_, err = pool.Exec(context.Background(), string(migration))
+	case "redo":
+		m, err := migrator.Redo(ctx)
 		if err != nil {
-			log.Fatalf("Error executing migration %s: %v", migrationFile, err)
+			log.Fatalf("Redo failed: %v", err)
+		}
+		log.Printf("Successfully re-applied migration: %03d_%s", m.Version, m.Name)
+
+	case "status":
+		statuses, err := migrator.Status(ctx)
+		if err != nil {
+			log.Fatalf("Error getting migration status: %v", err)
+		}
+		fmt.Printf("%-8s %-40s %-10s %s\n", "VERSION", "NAME", "STATE", "APPLIED AT")
+		for _, s := range statuses {
+			state, appliedAt := "pending", "-"
+			if s.Applied {
+				state = "applied"
+				appliedAt = s.AppliedAt.Format("2006-01-02 15:04:05")
+			}
+			if s.Modified {
+				state = "modified"
+			}
+			if s.Missing {
+				state = "missing"
+			}
+			fmt.Printf("%03d      %-40s %-10s %s\n", s.Version, s.Name, state, appliedAt)
 		}
-		log.Printf("Successfully applied migration: %s", migrationFile)
-	}
 
-	log.Println("Migration completed successfully")
+	default:
+		usage()
+	}
 }
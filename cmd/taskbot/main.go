@@ -2,19 +2,37 @@ package main
 
 import (
 	"context"
+	"flag"
 	"log"
+	"log/slog"
 	"os"
 	"os/signal"
 	"syscall"
 
+	"taskbot/internal/api"
 	"taskbot/internal/bot"
 	"taskbot/internal/config"
 	"taskbot/internal/db"
+	"taskbot/internal/db/memstore"
+	"taskbot/internal/logging"
+	"taskbot/internal/metrics"
+	"taskbot/internal/migrate"
+	"taskbot/internal/server"
+	"taskbot/migrations"
 
 	"github.com/joho/godotenv"
 )
 
 func main() {
+	runMigrations := flag.Bool("migrate", false, "apply pending database migrations before starting")
+	inMemory := flag.Bool("memstore", false, "keep all data in memory instead of Postgres; data is lost on exit")
+	flag.Parse()
+
+	// The in-memory store has no schema, so there is nothing to migrate
+	if *inMemory && *runMigrations {
+		log.Fatal("--migrate cannot be used with --memstore")
+	}
+
 	if err := godotenv.Load(); err != nil {
 		log.Println("No .env file found")
 	}
@@ -25,19 +43,16 @@ func main() {
 		log.Fatalf("Failed to load config: %v", err)
 	}
 
-	// Connect to database
-	database, err := db.New(cfg.Database)
-	if err != nil {
-		log.Fatalf("Failed to connect to database: %v", err)
-	}
-
-	// Create bot instance
-	bot, err := bot.New(cfg, database)
+	// Switch to structured logging; the standard logger writes through it too
+	logger, err := logging.New(os.Stderr, cfg.Logging.Level, cfg.Logging.Format,
+		cfg.Discord.Token, cfg.Database.Password, cfg.HTTP.APIKey)
 	if err != nil {
-		log.Fatalf("Failed to create bot: %v", err)
+		log.Fatalf("Failed to configure logging: %v", err)
 	}
+	slog.SetDefault(logger)
 
-	// Set up signal handling for graceful shutdown
+	// Set up signal handling for graceful shutdown; the root context
+	// is cancelled on shutdown and bounds all database work
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
 
@@ -45,12 +60,75 @@ func main() {
 		sigCh := make(chan os.Signal, 1)
 		signal.Notify(sigCh, os.Interrupt, syscall.SIGTERM)
 		<-sigCh
-		log.Println("Received shutdown signal")
+		slog.Info("Received shutdown signal")
 		cancel()
 	}()
 
+	// Connect to database, or keep everything in memory for local demos
+	var store db.Store
+	if *inMemory {
+		slog.Warn("Using in-memory store; data will be lost on exit")
+		store = memstore.New()
+	} else {
+		database, err := db.New(cfg.Database)
+		if err != nil {
+			fatal("Failed to connect to database", err)
+		}
+		store = database
+
+		// Apply pending migrations if requested
+		if *runMigrations {
+			migrator, err := migrate.New(database.Pool, migrations.FS)
+			if err != nil {
+				fatal("Failed to load migrations", err)
+			}
+			applied, err := migrator.Up(ctx, 0)
+			for _, m := range applied {
+				slog.Info("Applied migration", "version", m.Version, "name", m.Name)
+			}
+			if err != nil {
+				fatal("Failed to apply migrations", err)
+			}
+		}
+	}
+
+	// Create bot instance
+	bot, err := bot.New(cfg, store)
+	if err != nil {
+		fatal("Failed to create bot", err)
+	}
+
+	// Serve health checks, metrics and the REST API if a listen address is configured
+	httpDone := make(chan struct{})
+	if cfg.HTTP.Addr != "" {
+		registry := metrics.NewRegistry()
+		bot.RegisterMetrics(registry)
+
+		srv := server.New(cfg.HTTP.Addr)
+		srv.Handle("GET /healthz", server.HealthHandler(bot.HealthChecks()))
+		srv.Handle("GET /metrics", registry.Handler())
+		api.New(store, cfg.HTTP.APIKey, bot.MemberRole).Register(srv)
+		go func() {
+			defer close(httpDone)
+			if err := srv.Run(ctx); err != nil {
+				slog.Error("HTTP server error", "error", err)
+			}
+		}()
+	} else {
+		close(httpDone)
+	}
+
 	// Start bot
 	if err := bot.Start(ctx); err != nil {
-		log.Fatalf("Bot error: %v", err)
+		fatal("Bot error", err)
 	}
+
+	cancel()
+	<-httpDone
+}
+
+// fatal logs an error and exits
+func fatal(msg string, err error) {
+	slog.Error(msg, "error", err)
+	os.Exit(1)
 }
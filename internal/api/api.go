@@ -0,0 +1,283 @@
+// Package api serves the bot's tasks, check-ins, users and reports as read-only
+// JSON for other systems, such as billing, and check-ins as calendar feeds.
+package api
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"taskbot/internal/db"
+	"taskbot/internal/db/models"
+	"taskbot/internal/server"
+)
+
+const (
+	// requestTimeout bounds the store queries run for a single request
+	requestTimeout = 30 * time.Second
+
+	// Pagination defaults and bounds for list endpoints
+	defaultPerPage = 50
+	maxPerPage     = 200
+
+	// defaultRange is the date range used when a request gives no from date
+	defaultRange = 30 * 24 * time.Hour
+
+	// calendarRange is the default date range of calendar feeds
+	calendarRange = 90 * 24 * time.Hour
+)
+
+// RoleFunc returns the current bot role of a Discord user in a guild
+type RoleFunc func(ctx context.Context, guildID, discordID string) models.BotRole
+
+// API serves the REST endpoints under /api/v1
+type API struct {
+	store   db.Store
+	roles   RoleFunc
+	hasKey  bool
+	keyHash [sha256.Size]byte
+}
+
+// New creates an API that accepts tokens issued with /apitoken and, when
+// apiKey is set, that key with read access to every guild. roles looks up the
+// role of a token's owner on every request, so that tokens lose access along
+// with their owner.
+func New(store db.Store, apiKey string, roles RoleFunc) *API {
+	return &API{
+		store:   store,
+		roles:   roles,
+		hasKey:  apiKey != "",
+		keyHash: sha256.Sum256([]byte(apiKey)),
+	}
+}
+
+// Register adds the API routes to a server
+func (a *API) Register(srv *server.Server) {
+	srv.Handle("GET /api/v1/guilds/{guildID}/users", a.handler(a.handleUsers))
+	srv.Handle("GET /api/v1/guilds/{guildID}/tasks", a.handler(a.handleTasks))
+	srv.Handle("GET /api/v1/guilds/{guildID}/checkins", a.handler(a.handleCheckIns))
+	srv.Handle("GET /api/v1/guilds/{guildID}/reports", a.handler(a.handleReport))
+	srv.Handle("GET /api/v1/guilds/{guildID}/calendar.ics", a.feedHandler(a.handleCalendar))
+}
+
+// apiError is an error reported to the caller with an HTTP status
+type apiError struct {
+	status  int
+	message string
+}
+
+func (e *apiError) Error() string {
+	return e.message
+}
+
+func badRequest(format string, args ...interface{}) error {
+	return &apiError{status: http.StatusBadRequest, message: fmt.Sprintf(format, args...)}
+}
+
+func notFound(format string, args ...interface{}) error {
+	return &apiError{status: http.StatusNotFound, message: fmt.Sprintf(format, args...)}
+}
+
+func forbidden(format string, args ...interface{}) error {
+	return &apiError{status: http.StatusForbidden, message: fmt.Sprintf(format, args...)}
+}
+
+var errUnauthorized = &apiError{status: http.StatusUnauthorized, message: "missing, invalid or expired API token"}
+
+// caller is who a request is made by: the holder of an API token, or of the
+// API key when token is nil
+type caller struct {
+	token *models.APIToken
+}
+
+// readAll reports whether the caller may read everyone's data in the guild
+func (c *caller) readAll() bool {
+	return c.token == nil || c.token.Has(models.APIReadAll)
+}
+
+// handlerFunc serves one endpoint for a guild, writing its response with writeJSON
+type handlerFunc func(ctx context.Context, w http.ResponseWriter, r *http.Request, guildID string, c *caller) error
+
+// handler authenticates the request, checks that the caller may read the guild
+// and turns handler errors into JSON responses
+func (a *API) handler(h handlerFunc) http.Handler {
+	return a.serve(h, false)
+}
+
+// feedHandler is like handler, but also accepts the token in the token query
+// parameter since calendar apps cannot send headers when subscribing to a feed
+func (a *API) feedHandler(h handlerFunc) http.Handler {
+	return a.serve(h, true)
+}
+
+func (a *API) serve(h handlerFunc, allowQueryToken bool) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx, cancel := context.WithTimeout(r.Context(), requestTimeout)
+		defer cancel()
+
+		guildID := r.PathValue("guildID")
+		c, err := a.authenticate(ctx, r, allowQueryToken)
+		if err == nil {
+			err = a.authorize(ctx, c, guildID)
+		}
+		if err == nil {
+			err = h(ctx, w, r, guildID, c)
+		}
+		if err == nil {
+			return
+		}
+
+		var apiErr *apiError
+		if !errors.As(err, &apiErr) {
+			slog.Error("API request failed", "method", r.Method, "path", r.URL.Path, "error", err)
+			apiErr = &apiError{status: http.StatusInternalServerError, message: "internal error"}
+		}
+		writeJSON(w, apiErr.status, map[string]string{"error": apiErr.message})
+	})
+}
+
+// authenticate resolves the bearer token, or the token query parameter when
+// allowed, to the API key or an unexpired API token
+func (a *API) authenticate(ctx context.Context, r *http.Request, allowQueryToken bool) (*caller, error) {
+	bearer, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if !ok && allowQueryToken {
+		bearer, ok = r.URL.Query().Get("token"), true
+	}
+	if !ok || bearer == "" {
+		return nil, errUnauthorized
+	}
+
+	if a.hasKey {
+		hash := sha256.Sum256([]byte(bearer))
+		if subtle.ConstantTimeCompare(hash[:], a.keyHash[:]) == 1 {
+			return &caller{}, nil
+		}
+	}
+
+	token, err := a.store.UseAPIToken(ctx, HashToken(bearer), time.Now())
+	if err != nil {
+		return nil, err
+	}
+	if token == nil {
+		return nil, errUnauthorized
+	}
+	return &caller{token: token}, nil
+}
+
+// authorize checks that the caller may read data of a guild. A token works only
+// while its owner may still use the bot there, and reads everyone's data only
+// while its owner is still an admin.
+func (a *API) authorize(ctx context.Context, c *caller, guildID string) error {
+	if c.token == nil {
+		return nil
+	}
+	if c.token.ServerID != guildID {
+		return forbidden("token is not valid for this guild")
+	}
+	if !c.token.Has(models.APIReadOwn) && !c.token.Has(models.APIReadAll) {
+		return forbidden("token cannot read data")
+	}
+
+	role := a.roles(ctx, guildID, c.token.DiscordID)
+	if !role.AtLeast(models.RoleMember) {
+		return forbidden("token owner can no longer use the bot in this guild")
+	}
+	if c.token.Has(models.APIReadAll) && !role.AtLeast(models.RoleAdmin) {
+		return forbidden("token owner is no longer an admin; create a token that reads only their own data")
+	}
+	return nil
+}
+
+func writeJSON(w http.ResponseWriter, status int, body interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(body); err != nil {
+		slog.Debug("Error writing API response", "error", err)
+	}
+}
+
+// page is the response envelope of list endpoints
+type page[T any] struct {
+	Data    []T `json:"data"`
+	Page    int `json:"page"`
+	PerPage int `json:"per_page"`
+	Total   int `json:"total"`
+}
+
+// pagination reads the 1-based page and per_page query parameters
+func pagination(r *http.Request) (pageNum, perPage int, err error) {
+	pageNum, perPage = 1, defaultPerPage
+	if value := r.URL.Query().Get("page"); value != "" {
+		pageNum, err = strconv.Atoi(value)
+		if err != nil || pageNum < 1 {
+			return 0, 0, badRequest("page must be a positive number")
+		}
+	}
+	if value := r.URL.Query().Get("per_page"); value != "" {
+		perPage, err = strconv.Atoi(value)
+		if err != nil || perPage < 1 || perPage > maxPerPage {
+			return 0, 0, badRequest("per_page must be between 1 and %d", maxPerPage)
+		}
+	}
+	return pageNum, perPage, nil
+}
+
+// paginate returns one page of items in the response envelope
+func paginate[T any](items []T, pageNum, perPage int) page[T] {
+	start := (pageNum - 1) * perPage
+	if start > len(items) {
+		start = len(items)
+	}
+	end := start + perPage
+	if end > len(items) {
+		end = len(items)
+	}
+	data := items[start:end]
+	if data == nil {
+		data = []T{}
+	}
+	return page[T]{Data: data, Page: pageNum, PerPage: perPage, Total: len(items)}
+}
+
+// dateRange reads the from and to query parameters as RFC 3339 times or
+// YYYY-MM-DD dates in UTC; a date for to includes that whole day. Without a
+// from date the range starts defaultDuration before now.
+func dateRange(r *http.Request, defaultDuration time.Duration) (from, to time.Time, err error) {
+	to = time.Now()
+	from = to.Add(-defaultDuration)
+	if value := r.URL.Query().Get("from"); value != "" {
+		if from, _, err = parseTime(value); err != nil {
+			return from, to, badRequest("invalid from: %s", value)
+		}
+	}
+	if value := r.URL.Query().Get("to"); value != "" {
+		var dateOnly bool
+		if to, dateOnly, err = parseTime(value); err != nil {
+			return from, to, badRequest("invalid to: %s", value)
+		}
+		if dateOnly {
+			to = to.AddDate(0, 0, 1)
+		}
+	}
+	if !from.Before(to) {
+		return from, to, badRequest("from must be before to")
+	}
+	return from, to, nil
+}
+
+func parseTime(value string) (t time.Time, dateOnly bool, err error) {
+	if t, err = time.Parse(time.RFC3339, value); err == nil {
+		return t, false, nil
+	}
+	t, err = time.Parse("2006-01-02", value)
+	return t, true, err
+}
@@ -0,0 +1,216 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"taskbot/internal/db/memstore"
+	"taskbot/internal/db/models"
+
+	"github.com/google/uuid"
+)
+
+const (
+	guildID = "guild-1"
+	apiKey  = "master-key"
+)
+
+type apiHarness struct {
+	api   *API
+	store *memstore.Store
+	roles map[string]models.BotRole
+}
+
+func newAPIHarness(t *testing.T) *apiHarness {
+	t.Helper()
+
+	h := &apiHarness{store: memstore.New(), roles: make(map[string]models.BotRole)}
+	h.api = New(h.store, apiKey, func(ctx context.Context, guildID, discordID string) models.BotRole {
+		return h.roles[discordID]
+	})
+	return h
+}
+
+// user creates a guild member with a bot role
+func (h *apiHarness) user(t *testing.T, discordID string, role models.BotRole) *models.User {
+	t.Helper()
+
+	ctx := context.Background()
+	user, err := h.store.GetOrCreateUser(ctx, discordID, discordID)
+	if err != nil {
+		t.Fatalf("creating user: %v", err)
+	}
+	if err := h.store.AddUserToGuild(ctx, user.ID, guildID); err != nil {
+		t.Fatalf("adding user to guild: %v", err)
+	}
+	h.roles[discordID] = role
+	return user
+}
+
+// token issues an API token for a user and returns it
+func (h *apiHarness) token(t *testing.T, user *models.User, serverID string, expiresAt time.Time, permissions ...models.APIPermission) string {
+	t.Helper()
+
+	token, prefix, hash, err := GenerateToken()
+	if err != nil {
+		t.Fatalf("generating token: %v", err)
+	}
+	err = h.store.CreateAPIToken(context.Background(), &models.APIToken{
+		ID:          uuid.New(),
+		ServerID:    serverID,
+		UserID:      user.ID,
+		Name:        "test",
+		Prefix:      prefix,
+		TokenHash:   hash,
+		Permissions: permissions,
+		ExpiresAt:   expiresAt,
+	})
+	if err != nil {
+		t.Fatalf("creating token: %v", err)
+	}
+	return token
+}
+
+// get sends a request for the guild to handler and returns the status and decoded body
+func (h *apiHarness) get(t *testing.T, handler http.Handler, target, bearer string) (int, map[string]interface{}) {
+	t.Helper()
+
+	r := httptest.NewRequest(http.MethodGet, target, nil)
+	r.SetPathValue("guildID", guildID)
+	if bearer != "" {
+		r.Header.Set("Authorization", "Bearer "+bearer)
+	}
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, r)
+
+	var body map[string]interface{}
+	if err := json.NewDecoder(w.Body).Decode(&body); err != nil {
+		t.Fatalf("decoding response: %v", err)
+	}
+	return w.Code, body
+}
+
+func TestAuthorization(t *testing.T) {
+	h := newAPIHarness(t)
+	admin := h.user(t, "user-admin", models.RoleAdmin)
+	member := h.user(t, "user-member", models.RoleMember)
+	demoted := h.user(t, "user-demoted", models.RoleMember)
+	removed := h.user(t, "user-removed", models.RoleNone)
+
+	later := time.Now().Add(time.Hour)
+	tests := []struct {
+		name   string
+		target string
+		bearer string
+		status int
+		users  int
+	}{
+		{"no token", "/users", "", http.StatusUnauthorized, 0},
+		{"unknown token", "/users", "tbk_unknown", http.StatusUnauthorized, 0},
+		{"query token on a JSON endpoint", "/users?token=" + apiKey, "", http.StatusUnauthorized, 0},
+		{"api key", "/users", apiKey, http.StatusOK, 4},
+		{"admin reads all", "/users", h.token(t, admin, guildID, later, models.APIReadAll), http.StatusOK, 4},
+		{"member reads own", "/users", h.token(t, member, guildID, later, models.APIReadOwn), http.StatusOK, 1},
+		{"member asks for someone else", "/users?user=user-admin", h.token(t, member, guildID, later, models.APIReadOwn), http.StatusForbidden, 0},
+		{"expired", "/users", h.token(t, admin, guildID, time.Now().Add(-time.Minute), models.APIReadAll), http.StatusUnauthorized, 0},
+		{"other guild", "/users", h.token(t, admin, "guild-2", later, models.APIReadAll), http.StatusForbidden, 0},
+		{"no read permission", "/users", h.token(t, admin, guildID, later), http.StatusForbidden, 0},
+		{"read-all owner no longer admin", "/users", h.token(t, demoted, guildID, later, models.APIReadAll), http.StatusForbidden, 0},
+		{"owner lost access", "/users", h.token(t, removed, guildID, later, models.APIReadOwn), http.StatusForbidden, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			status, body := h.get(t, h.api.handler(h.api.handleUsers), tt.target, tt.bearer)
+			if status != tt.status {
+				t.Fatalf("status = %d, want %d (%v)", status, tt.status, body)
+			}
+			if status != http.StatusOK {
+				if body["error"] == "" {
+					t.Fatal("error response has no message")
+				}
+				return
+			}
+			if data := body["data"].([]interface{}); len(data) != tt.users {
+				t.Fatalf("got %d users, want %d", len(data), tt.users)
+			}
+		})
+	}
+}
+
+func TestRoleCheckedOnEveryRequest(t *testing.T) {
+	h := newAPIHarness(t)
+	admin := h.user(t, "user-admin", models.RoleAdmin)
+	token := h.token(t, admin, guildID, time.Now().Add(time.Hour), models.APIReadAll)
+	handler := h.api.handler(h.api.handleUsers)
+
+	if status, body := h.get(t, handler, "/users", token); status != http.StatusOK {
+		t.Fatalf("status = %d, want 200 (%v)", status, body)
+	}
+	h.roles["user-admin"] = models.RoleMember
+	if status, _ := h.get(t, handler, "/users", token); status != http.StatusForbidden {
+		t.Fatalf("status after demotion = %d, want 403", status)
+	}
+}
+
+func TestPagination(t *testing.T) {
+	tests := []struct {
+		query   string
+		page    int
+		perPage int
+		valid   bool
+	}{
+		{"", 1, defaultPerPage, true},
+		{"page=3&per_page=10", 3, 10, true},
+		{"per_page=200", 1, maxPerPage, true},
+		{"page=0", 0, 0, false},
+		{"page=-1", 0, 0, false},
+		{"page=two", 0, 0, false},
+		{"per_page=0", 0, 0, false},
+		{"per_page=201", 0, 0, false},
+	}
+	for _, tt := range tests {
+		r := httptest.NewRequest(http.MethodGet, "/users?"+tt.query, nil)
+		pageNum, perPage, err := pagination(r)
+		if (err == nil) != tt.valid {
+			t.Errorf("pagination(%q) error = %v, want valid %v", tt.query, err, tt.valid)
+			continue
+		}
+		if pageNum != tt.page || perPage != tt.perPage {
+			t.Errorf("pagination(%q) = %d, %d, want %d, %d", tt.query, pageNum, perPage, tt.page, tt.perPage)
+		}
+	}
+}
+
+func TestPaginate(t *testing.T) {
+	items := []int{1, 2, 3, 4, 5}
+	tests := []struct {
+		page    int
+		perPage int
+		want    []int
+	}{
+		{1, 2, []int{1, 2}},
+		{3, 2, []int{5}},
+		{4, 2, []int{}},
+		{1, 10, []int{1, 2, 3, 4, 5}},
+	}
+	for _, tt := range tests {
+		got := paginate(items, tt.page, tt.perPage)
+		if got.Total != len(items) || got.Page != tt.page || got.PerPage != tt.perPage {
+			t.Errorf("paginate(%d, %d) envelope = %+v", tt.page, tt.perPage, got)
+		}
+		if got.Data == nil || len(got.Data) != len(tt.want) {
+			t.Errorf("paginate(%d, %d) data = %v, want %v", tt.page, tt.perPage, got.Data, tt.want)
+			continue
+		}
+		for i := range tt.want {
+			if got.Data[i] != tt.want[i] {
+				t.Errorf("paginate(%d, %d) data = %v, want %v", tt.page, tt.perPage, got.Data, tt.want)
+				break
+			}
+		}
+	}
+}
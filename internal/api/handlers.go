@@ -0,0 +1,390 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"log/slog"
+	"net/http"
+	"sort"
+	"time"
+
+	"taskbot/internal/db/models"
+	"taskbot/internal/ical"
+
+	"github.com/google/uuid"
+)
+
+type userJSON struct {
+	ID        uuid.UUID `json:"id"`
+	DiscordID string    `json:"discord_id"`
+	Username  string    `json:"username"`
+	Timezone  string    `json:"timezone"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+func newUserJSON(user *models.User) userJSON {
+	return userJSON{
+		ID:        user.ID,
+		DiscordID: user.DiscordID,
+		Username:  user.Username,
+		Timezone:  user.Timezone,
+		CreatedAt: user.CreatedAt,
+	}
+}
+
+type taskJSON struct {
+	ID               uuid.UUID  `json:"id"`
+	OwnerID          uuid.UUID  `json:"owner_id"`
+	OwnerName        string     `json:"owner_name"`
+	ParentID         *uuid.UUID `json:"parent_id"`
+	Name             string     `json:"name"`
+	Description      string     `json:"description"`
+	Tags             []string   `json:"tags"`
+	Completed        bool       `json:"completed"`
+	Global           bool       `json:"global"`
+	CreatedAt        time.Time  `json:"created_at"`
+	ArchivedAt       *time.Time `json:"archived_at"`
+	TimeSpentSeconds int64      `json:"time_spent_seconds"`
+}
+
+type checkInJSON struct {
+	ID              uuid.UUID  `json:"id"`
+	UserID          uuid.UUID  `json:"user_id"`
+	DiscordID       string     `json:"discord_id"`
+	Username        string     `json:"username"`
+	TaskID          uuid.UUID  `json:"task_id"`
+	TaskName        string     `json:"task_name"`
+	ParentTaskID    *uuid.UUID `json:"parent_task_id"`
+	ParentTaskName  string     `json:"parent_task_name,omitempty"`
+	Tags            []string   `json:"tags"`
+	StartTime       time.Time  `json:"start_time"`
+	EndTime         *time.Time `json:"end_time"`
+	Active          bool       `json:"active"`
+	DurationSeconds int64      `json:"duration_seconds"`
+}
+
+type reportTaskJSON struct {
+	TaskID  uuid.UUID `json:"task_id"`
+	Name    string    `json:"name"`
+	Seconds int64     `json:"seconds"`
+}
+
+type reportUserJSON struct {
+	UserID       uuid.UUID        `json:"user_id"`
+	DiscordID    string           `json:"discord_id"`
+	Username     string           `json:"username"`
+	TotalSeconds int64            `json:"total_seconds"`
+	Tasks        []reportTaskJSON `json:"tasks"`
+}
+
+type reportJSON struct {
+	From  time.Time        `json:"from"`
+	To    time.Time        `json:"to"`
+	Users []reportUserJSON `json:"users"`
+}
+
+// userFilter resolves the optional user query parameter, a Discord user ID, to
+// the user whose data is returned. Callers that may only read their own data
+// are always limited to themselves.
+func (a *API) userFilter(ctx context.Context, r *http.Request, c *caller) (*uuid.UUID, error) {
+	var userID *uuid.UUID
+	if discordID := r.URL.Query().Get("user"); discordID != "" {
+		user, err := a.store.GetUserByDiscordID(ctx, discordID)
+		if err != nil {
+			return nil, err
+		}
+		if user == nil {
+			return nil, notFound("user %s not found", discordID)
+		}
+		userID = &user.ID
+	}
+
+	if c.readAll() {
+		return userID, nil
+	}
+	if userID != nil && *userID != c.token.UserID {
+		return nil, forbidden("token can only read its owner's data")
+	}
+	return &c.token.UserID, nil
+}
+
+func (a *API) handleUsers(ctx context.Context, w http.ResponseWriter, r *http.Request, guildID string, c *caller) error {
+	pageNum, perPage, err := pagination(r)
+	if err != nil {
+		return err
+	}
+
+	userID, err := a.userFilter(ctx, r, c)
+	if err != nil {
+		return err
+	}
+
+	users, err := a.store.GetGuildUsers(ctx, guildID)
+	if err != nil {
+		return err
+	}
+
+	result := make([]userJSON, 0, len(users))
+	for _, user := range users {
+		if userID != nil && user.ID != *userID {
+			continue
+		}
+		result = append(result, newUserJSON(user))
+	}
+	writeJSON(w, http.StatusOK, paginate(result, pageNum, perPage))
+	return nil
+}
+
+// handleTasks lists a guild's tasks, newest first. Filters: user (owner), status
+// (open, completed or all), q (full-text search), tag, and from/to on the
+// creation time, which only apply when given.
+func (a *API) handleTasks(ctx context.Context, w http.ResponseWriter, r *http.Request, guildID string, c *caller) error {
+	pageNum, perPage, err := pagination(r)
+	if err != nil {
+		return err
+	}
+
+	query := r.URL.Query()
+	filter := models.TaskSearchFilter{
+		ServerID: guildID,
+		Query:    query.Get("q"),
+		Tag:      query.Get("tag"),
+		Limit:    perPage,
+		Offset:   (pageNum - 1) * perPage,
+	}
+
+	filter.OwnerID, err = a.userFilter(ctx, r, c)
+	if err != nil {
+		return err
+	}
+	if !c.readAll() {
+		// Global tasks also collect other users' time, which is not theirs to see
+		filter.VisibleUserIDs = []uuid.UUID{c.token.UserID}
+	}
+
+	switch status := query.Get("status"); status {
+	case "", "all":
+	case "open", "completed":
+		completed := status == "completed"
+		filter.Completed = &completed
+	default:
+		return badRequest("status must be open, completed or all")
+	}
+
+	if query.Get("from") != "" || query.Get("to") != "" {
+		from, to, err := dateRange(r, defaultRange)
+		if err != nil {
+			return err
+		}
+		if query.Get("from") != "" {
+			filter.Since = from
+		}
+		filter.Until = to
+	}
+
+	results, total, err := a.store.SearchTasks(ctx, filter)
+	if err != nil {
+		return err
+	}
+
+	tasks := make([]taskJSON, 0, len(results))
+	for _, result := range results {
+		task := result.Task
+		tags := task.Tags
+		if tags == nil {
+			tags = []string{}
+		}
+		tasks = append(tasks, taskJSON{
+			ID:               task.ID,
+			OwnerID:          task.UserID,
+			OwnerName:        result.OwnerName,
+			ParentID:         task.ParentID,
+			Name:             task.Name,
+			Description:      task.Description,
+			Tags:             tags,
+			Completed:        task.Completed,
+			Global:           task.Global,
+			CreatedAt:        task.CreatedAt,
+			ArchivedAt:       task.ArchivedAt,
+			TimeSpentSeconds: int64(result.TimeSpent.Seconds()),
+		})
+	}
+	writeJSON(w, http.StatusOK, page[taskJSON]{Data: tasks, Page: pageNum, PerPage: perPage, Total: total})
+	return nil
+}
+
+// history returns the guild's check-ins between from and to, optionally for one user
+func (a *API) history(ctx context.Context, guildID string, from, to time.Time, userID *uuid.UUID) ([]*models.CheckInWithTask, error) {
+	history, err := a.store.GetAllTaskHistory(ctx, guildID, from, to)
+	if err != nil {
+		return nil, err
+	}
+	if userID == nil {
+		return history, nil
+	}
+
+	var filtered []*models.CheckInWithTask
+	for _, ci := range history {
+		if ci.CheckIn.UserID == *userID {
+			filtered = append(filtered, ci)
+		}
+	}
+	return filtered, nil
+}
+
+// handleCheckIns lists check-ins started between from and to, newest first.
+// Active check-ins report their duration so far.
+func (a *API) handleCheckIns(ctx context.Context, w http.ResponseWriter, r *http.Request, guildID string, c *caller) error {
+	pageNum, perPage, err := pagination(r)
+	if err != nil {
+		return err
+	}
+	from, to, err := dateRange(r, defaultRange)
+	if err != nil {
+		return err
+	}
+	userID, err := a.userFilter(ctx, r, c)
+	if err != nil {
+		return err
+	}
+
+	history, err := a.history(ctx, guildID, from, to, userID)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	checkIns := make([]checkInJSON, 0, len(history))
+	for _, ci := range history {
+		end := now
+		if ci.CheckIn.EndTime != nil {
+			end = *ci.CheckIn.EndTime
+		}
+		tags := ci.Task.Tags
+		if tags == nil {
+			tags = []string{}
+		}
+		item := checkInJSON{
+			ID:              ci.CheckIn.ID,
+			UserID:          ci.User.ID,
+			DiscordID:       ci.User.DiscordID,
+			Username:        ci.User.Username,
+			TaskID:          ci.Task.ID,
+			TaskName:        ci.Task.Name,
+			ParentTaskID:    ci.Task.ParentID,
+			Tags:            tags,
+			StartTime:       ci.CheckIn.StartTime,
+			EndTime:         ci.CheckIn.EndTime,
+			Active:          ci.CheckIn.Active,
+			DurationSeconds: int64(end.Sub(ci.CheckIn.StartTime).Seconds()),
+		}
+		if ci.Parent != nil {
+			item.ParentTaskName = ci.Parent.Name
+		}
+		checkIns = append(checkIns, item)
+	}
+	writeJSON(w, http.StatusOK, paginate(checkIns, pageNum, perPage))
+	return nil
+}
+
+// handleReport totals completed check-ins between from and to per user and task,
+// rolling subtask time up into the parent task like /report does
+func (a *API) handleReport(ctx context.Context, w http.ResponseWriter, r *http.Request, guildID string, c *caller) error {
+	from, to, err := dateRange(r, defaultRange)
+	if err != nil {
+		return err
+	}
+	userID, err := a.userFilter(ctx, r, c)
+	if err != nil {
+		return err
+	}
+
+	history, err := a.history(ctx, guildID, from, to, userID)
+	if err != nil {
+		return err
+	}
+
+	users := make(map[uuid.UUID]*reportUserJSON)
+	taskIndex := make(map[uuid.UUID]map[uuid.UUID]int)
+	for _, ci := range history {
+		if ci.CheckIn.EndTime == nil {
+			continue
+		}
+		seconds := int64(ci.CheckIn.EndTime.Sub(ci.CheckIn.StartTime).Seconds())
+
+		entry, ok := users[ci.User.ID]
+		if !ok {
+			entry = &reportUserJSON{
+				UserID:    ci.User.ID,
+				DiscordID: ci.User.DiscordID,
+				Username:  ci.User.Username,
+				Tasks:     []reportTaskJSON{},
+			}
+			users[ci.User.ID] = entry
+			taskIndex[ci.User.ID] = make(map[uuid.UUID]int)
+		}
+		entry.TotalSeconds += seconds
+
+		taskID, taskName := ci.Task.ID, ci.Task.Name
+		if ci.Parent != nil {
+			taskID, taskName = ci.Parent.ID, ci.Parent.Name
+		}
+		idx, ok := taskIndex[ci.User.ID][taskID]
+		if !ok {
+			idx = len(entry.Tasks)
+			taskIndex[ci.User.ID][taskID] = idx
+			entry.Tasks = append(entry.Tasks, reportTaskJSON{TaskID: taskID, Name: taskName})
+		}
+		entry.Tasks[idx].Seconds += seconds
+	}
+
+	report := reportJSON{From: from, To: to, Users: make([]reportUserJSON, 0, len(users))}
+	for _, entry := range users {
+		sort.Slice(entry.Tasks, func(x, y int) bool {
+			return entry.Tasks[x].Seconds > entry.Tasks[y].Seconds
+		})
+		report.Users = append(report.Users, *entry)
+	}
+	sort.Slice(report.Users, func(x, y int) bool {
+		return report.Users[x].Username < report.Users[y].Username
+	})
+	writeJSON(w, http.StatusOK, report)
+	return nil
+}
+
+// handleCalendar serves ended check-ins between from and to as an iCalendar
+// feed, each in its user's timezone. Without from, the last 90 days are included.
+func (a *API) handleCalendar(ctx context.Context, w http.ResponseWriter, r *http.Request, guildID string, c *caller) error {
+	from, to, err := dateRange(r, calendarRange)
+	if err != nil {
+		return err
+	}
+	userID, err := a.userFilter(ctx, r, c)
+	if err != nil {
+		return err
+	}
+
+	history, err := a.history(ctx, guildID, from, to, userID)
+	if err != nil {
+		return err
+	}
+
+	var buf bytes.Buffer
+	err = ical.Write(&buf, ical.Calendar{
+		Name:    "Time entries",
+		Created: time.Now(),
+		Events:  ical.CheckInEvents(history),
+	})
+	if err != nil {
+		return err
+	}
+
+	w.Header().Set("Content-Type", "text/calendar; charset=utf-8")
+	w.Header().Set("Content-Disposition", `inline; filename="calendar.ics"`)
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(http.StatusOK)
+	if _, err := buf.WriteTo(w); err != nil {
+		slog.Debug("Error writing calendar response", "error", err)
+	}
+	return nil
+}
@@ -0,0 +1,34 @@
+package api
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+)
+
+const (
+	// tokenPrefix marks API tokens so they are easy to recognise, e.g. in secret scanners
+	tokenPrefix = "tbk_"
+
+	// displayPrefixLength is how much of a token is kept to identify it in listings
+	displayPrefixLength = len(tokenPrefix) + 6
+)
+
+// GenerateToken returns a new random API token, the prefix shown in token
+// listings and the hash to store
+func GenerateToken() (token, prefix, hash string, err error) {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", "", "", fmt.Errorf("error generating API token: %w", err)
+	}
+	token = tokenPrefix + base64.RawURLEncoding.EncodeToString(buf)
+	return token, token[:displayPrefixLength], HashToken(token), nil
+}
+
+// HashToken returns the hex SHA-256 hash under which a token is stored
+func HashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,272 @@
+package bot
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"taskbot/internal/api"
+	"taskbot/internal/db"
+	"taskbot/internal/db/models"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/google/uuid"
+)
+
+// apiTokenDefaultDays is the lifetime of a token created without choosing one
+const apiTokenDefaultDays = 90
+
+// apiTokenAccess maps the access choices of /apitoken create to the permissions
+// they grant. Tokens that read everyone's data are admin only.
+var apiTokenAccess = []struct {
+	name        string
+	value       string
+	permissions []models.APIPermission
+}{
+	{"Read my own data", "read-own", []models.APIPermission{models.APIReadOwn}},
+	{"Read all server data (admin)", "read-all", []models.APIPermission{models.APIReadAll}},
+}
+
+// Token lifetimes offered by /apitoken create, in days
+var apiTokenLifetimes = []*discordgo.ApplicationCommandOptionChoice{
+	{Name: "7 days", Value: 7},
+	{Name: "30 days", Value: 30},
+	{Name: "90 days", Value: apiTokenDefaultDays},
+	{Name: "1 year", Value: 365},
+}
+
+func apiTokenAccessChoices() []*discordgo.ApplicationCommandOptionChoice {
+	choices := make([]*discordgo.ApplicationCommandOptionChoice, 0, len(apiTokenAccess))
+	for _, access := range apiTokenAccess {
+		choices = append(choices, &discordgo.ApplicationCommandOptionChoice{Name: access.name, Value: access.value})
+	}
+	return choices
+}
+
+// formatPermissions renders token permissions as a comma separated list
+func formatPermissions(permissions []models.APIPermission) string {
+	names := make([]string, 0, len(permissions))
+	for _, p := range permissions {
+		names = append(names, string(p))
+	}
+	return strings.Join(names, ", ")
+}
+
+// visibleAPITokens returns the tokens the caller may list and revoke: every
+// token in the guild for admins, otherwise their own
+func (b *Bot) visibleAPITokens(ctx context.Context, s Session, i *discordgo.InteractionCreate, user *models.User) ([]*models.APIToken, error) {
+	if b.isAdmin(ctx, s, i) {
+		return b.db.GetAPITokens(ctx, i.GuildID, nil)
+	}
+	return b.db.GetAPITokens(ctx, i.GuildID, &user.ID)
+}
+
+func (b *Bot) handleAPIToken(ctx context.Context, s Session, i *discordgo.InteractionCreate) {
+	logCommand(i, "apitoken")
+
+	if len(i.ApplicationCommandData().Options) == 0 {
+		respondWithError(s, i, "Invalid command options")
+		return
+	}
+
+	user, err := b.getUserFromInteraction(ctx, s, i)
+	if err != nil || user == nil {
+		return
+	}
+
+	subcommand := i.ApplicationCommandData().Options[0]
+	switch subcommand.Name {
+	case "create":
+		b.createAPIToken(ctx, s, i, user, subcommand.Options)
+
+	case "list":
+		tokens, err := b.visibleAPITokens(ctx, s, i, user)
+		if err != nil {
+			respondWithError(s, i, "Error retrieving API tokens: "+err.Error())
+			return
+		}
+		if len(tokens) == 0 {
+			respondWithSuccess(s, i, "No API tokens. Create one with `/apitoken create`.")
+			return
+		}
+
+		now := time.Now()
+		var rows [][]string
+		for _, token := range tokens {
+			expires := token.ExpiresAt.Format("2006-01-02")
+			if !token.ExpiresAt.After(now) {
+				expires = "expired"
+			}
+			lastUsed := "never"
+			if token.LastUsedAt != nil {
+				lastUsed = token.LastUsedAt.Format("2006-01-02")
+			}
+			rows = append(rows, []string{
+				truncateString(token.Name, 20),
+				truncateString(token.Username, 15),
+				token.Prefix + "…",
+				formatPermissions(token.Permissions),
+				expires,
+				lastUsed,
+			})
+		}
+		respondWithSuccess(s, i, "# API tokens\n"+formatTable(
+			[]string{"NAME", "OWNER", "TOKEN", "ACCESS", "EXPIRES", "LAST USED"}, rows))
+
+	case "revoke":
+		var value string
+		for _, opt := range subcommand.Options {
+			if opt.Name == "token" {
+				value = opt.StringValue()
+			}
+		}
+
+		tokens, err := b.visibleAPITokens(ctx, s, i, user)
+		if err != nil {
+			respondWithError(s, i, "Error retrieving API tokens: "+err.Error())
+			return
+		}
+		var token *models.APIToken
+		if tokenID, err := uuid.Parse(value); err == nil {
+			for _, t := range tokens {
+				if t.ID == tokenID {
+					token = t
+				}
+			}
+		}
+		if token == nil {
+			respondWithError(s, i, "API token not found")
+			return
+		}
+
+		err = b.db.RevokeAPIToken(ctx, token.ID, i.GuildID, user.ID)
+		if errors.Is(err, db.ErrAPITokenNotFound) {
+			respondWithError(s, i, "API token not found")
+			return
+		}
+		if err != nil {
+			respondWithError(s, i, "Error revoking API token: "+err.Error())
+			return
+		}
+		respondWithSuccess(s, i, fmt.Sprintf("Revoked API token **%s** (`%s…`)", token.Name, token.Prefix))
+
+	default:
+		respondWithError(s, i, "Invalid subcommand")
+	}
+}
+
+func (b *Bot) createAPIToken(ctx context.Context, s Session, i *discordgo.InteractionCreate, user *models.User, options []*discordgo.ApplicationCommandInteractionDataOption) {
+	name := ""
+	accessValue := apiTokenAccess[0].value
+	days := int64(apiTokenDefaultDays)
+	for _, opt := range options {
+		switch opt.Name {
+		case "name":
+			name = strings.TrimSpace(opt.StringValue())
+		case "access":
+			accessValue = opt.StringValue()
+		case "expires":
+			days = opt.IntValue()
+		}
+	}
+	if name == "" {
+		respondWithError(s, i, "Token name cannot be empty")
+		return
+	}
+
+	var permissions []models.APIPermission
+	for _, access := range apiTokenAccess {
+		if access.value == accessValue {
+			permissions = access.permissions
+		}
+	}
+	if permissions == nil {
+		respondWithError(s, i, "Invalid access level")
+		return
+	}
+	readAll := false
+	for _, p := range permissions {
+		if p == models.APIReadAll {
+			readAll = true
+		}
+	}
+	if readAll && !b.isAdmin(ctx, s, i) {
+		respondWithError(s, i, "Only admins can create tokens that read all server data")
+		return
+	}
+
+	secret, prefix, hash, err := api.GenerateToken()
+	if err != nil {
+		b.logError(i, "GenerateToken", err)
+		respondWithError(s, i, "Error creating API token")
+		return
+	}
+
+	now := time.Now()
+	token := &models.APIToken{
+		ID:          uuid.New(),
+		ServerID:    i.GuildID,
+		UserID:      user.ID,
+		Name:        name,
+		Prefix:      prefix,
+		TokenHash:   hash,
+		Permissions: permissions,
+		CreatedAt:   now,
+		ExpiresAt:   now.AddDate(0, 0, int(days)),
+	}
+	if err := b.db.CreateAPIToken(ctx, token); err != nil {
+		b.logError(i, "CreateAPIToken", err)
+		respondWithError(s, i, "Error creating API token: "+err.Error())
+		return
+	}
+
+	respondWithSuccess(s, i, fmt.Sprintf("Created API token **%s** with %s access, valid until %s.\n"+
+		"Copy it now, it will not be shown again:\n```\n%s\n```\n"+
+		"Send it as `Authorization: Bearer <token>`. Use it for server `%s`.",
+		name, formatPermissions(permissions), formatTime(token.ExpiresAt, user.Timezone), secret, i.GuildID))
+}
+
+func (b *Bot) handleAPITokenAutocomplete(ctx context.Context, s Session, i *discordgo.InteractionCreate) {
+	focused := focusedOption(i.ApplicationCommandData().Options)
+	if focused == nil {
+		return
+	}
+
+	user, err := b.db.GetUserByDiscordID(ctx, interactionUserID(i))
+	if err != nil || user == nil {
+		return
+	}
+	tokens, err := b.visibleAPITokens(ctx, s, i, user)
+	if err != nil {
+		interactionLogger(i).Error("Error getting API tokens for autocomplete", "error", err)
+		return
+	}
+
+	input := strings.ToLower(focused.StringValue())
+	var choices []*discordgo.ApplicationCommandOptionChoice
+	for _, token := range tokens {
+		label := fmt.Sprintf("%s (%s…, %s)", token.Name, token.Prefix, token.Username)
+		if !strings.Contains(strings.ToLower(label), input) {
+			continue
+		}
+		choices = append(choices, &discordgo.ApplicationCommandOptionChoice{
+			Name:  choiceLabel(label),
+			Value: token.ID.String(),
+		})
+		if len(choices) >= 25 { // Discord limit
+			break
+		}
+	}
+
+	err = s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
+		Type: discordgo.InteractionApplicationCommandAutocompleteResult,
+		Data: &discordgo.InteractionResponseData{
+			Choices: choices,
+		},
+	})
+	if err != nil {
+		interactionLogger(i).Error("Error responding to autocomplete", "error", err)
+	}
+}
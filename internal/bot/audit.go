@@ -0,0 +1,160 @@
+package bot
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"taskbot/internal/db/models"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/google/uuid"
+)
+
+const (
+	auditDefaultLimit = 25
+	auditMaxLimit     = 50
+
+	// Leave room for the title and code block markers in a 2000 character message
+	auditMaxTableLength = 1800
+)
+
+func (b *Bot) handleAudit(ctx context.Context, s Session, i *discordgo.InteractionCreate) {
+	logCommand(i, "audit")
+
+	if i.GuildID == "" {
+		respondWithError(s, i, "This command must be used in a server")
+		return
+	}
+
+	admin, err := b.getUserFromInteraction(ctx, s, i)
+	if err != nil || admin == nil {
+		return
+	}
+
+	loc, err := time.LoadLocation(admin.Timezone)
+	if err != nil {
+		loc = time.UTC
+	}
+
+	filter := models.AuditFilter{
+		ServerID: i.GuildID,
+		Limit:    auditDefaultLimit,
+	}
+
+	for _, opt := range i.ApplicationCommandData().Options {
+		switch opt.Name {
+		case "username":
+			user, err := b.db.GetUserByDiscordID(ctx, opt.StringValue())
+			if err != nil {
+				respondWithError(s, i, "Error getting user: "+err.Error())
+				return
+			}
+			if user == nil {
+				respondWithError(s, i, "User not found")
+				return
+			}
+			filter.UserID = &user.ID
+		case "task":
+			taskID, err := uuid.Parse(opt.StringValue())
+			if err != nil {
+				respondWithError(s, i, "Invalid task ID")
+				return
+			}
+			filter.TaskID = &taskID
+		case "from":
+			since, err := parseDate(opt.StringValue(), loc)
+			if err != nil {
+				respondWithError(s, i, "Invalid start date. Please use YYYY-MM-DD")
+				return
+			}
+			filter.Since = since
+		case "to":
+			until, err := parseDate(opt.StringValue(), loc)
+			if err != nil {
+				respondWithError(s, i, "Invalid end date. Please use YYYY-MM-DD")
+				return
+			}
+			filter.Until = until.AddDate(0, 0, 1)
+		case "limit":
+			filter.Limit = int(opt.IntValue())
+		}
+	}
+
+	if filter.Limit > auditMaxLimit {
+		filter.Limit = auditMaxLimit
+	}
+
+	events, err := b.db.GetAuditEvents(ctx, filter)
+	if err != nil {
+		b.logError(i, "GetAuditEvents", err)
+		respondWithError(s, i, "Error retrieving audit log: "+err.Error())
+		return
+	}
+
+	if len(events) == 0 {
+		respondWithSuccess(s, i, "No audit events found")
+		return
+	}
+
+	taskNames := make(map[uuid.UUID]string)
+	var rows [][]string
+	for _, event := range events {
+		taskName := "-"
+		if event.TaskID != nil {
+			name, ok := taskNames[*event.TaskID]
+			if !ok {
+				name = event.TaskID.String()[:8]
+				if task, err := b.db.GetTaskByID(ctx, *event.TaskID); err == nil && task != nil {
+					name = task.Name
+				}
+				taskNames[*event.TaskID] = name
+			}
+			taskName = name
+		}
+
+		actor := event.ActorName
+		if actor == "" {
+			actor = "system"
+		}
+
+		rows = append(rows, []string{
+			event.CreatedAt.In(loc).Format("2006-01-02 15:04"),
+			truncateString(actor, 16),
+			event.Action,
+			truncateString(taskName, 24),
+			formatAuditDetails(event.Details),
+		})
+	}
+
+	headers := []string{"TIME", "USER", "ACTION", "TASK", "DETAILS"}
+	table := formatTable(headers, rows)
+	shown := len(rows)
+	for len(table) > auditMaxTableLength && shown > 1 {
+		shown--
+		table = formatTable(headers, rows[:shown])
+	}
+
+	title := fmt.Sprintf("# Audit log (%s)\n", loc.String())
+	if shown < len(rows) {
+		title = fmt.Sprintf("# Audit log (%s, showing %d of %d)\n", loc.String(), shown, len(rows))
+	}
+	respondWithSuccess(s, i, title+table)
+}
+
+// formatAuditDetails renders audit details as sorted key=value pairs
+func formatAuditDetails(details map[string]string) string {
+	keys := make([]string, 0, len(details))
+	for k := range details {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	parts := make([]string, 0, len(keys))
+	for _, k := range keys {
+		parts = append(parts, fmt.Sprintf("%s=%s", k, details[k]))
+	}
+	return strings.Join(parts, " ")
+}
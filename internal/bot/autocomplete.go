@@ -0,0 +1,117 @@
+package bot
+
+import (
+	"sort"
+	"strings"
+	"time"
+
+	"taskbot/internal/db/models"
+)
+
+// Match quality tiers for autocomplete input, best first
+const (
+	matchExact       = 4
+	matchPrefix      = 3
+	matchWordPrefix  = 2
+	matchSubstring   = 1
+	matchSubsequence = 0
+	matchNone        = -1
+)
+
+// rankTaskSuggestions filters tasks matching the input and orders them by a score
+// combining how recently and how often the user checked in to each task with how
+// well its label matches. Usages must already be sorted most recently used first,
+// which is kept as the tie breaker, so empty input lists recently used tasks first.
+func rankTaskSuggestions(usages []*models.TaskUsage, input string, now time.Time) []*models.TaskUsage {
+	input = strings.ToLower(strings.TrimSpace(input))
+
+	maxUseCount := 0
+	for _, usage := range usages {
+		if usage.UseCount > maxUseCount {
+			maxUseCount = usage.UseCount
+		}
+	}
+
+	type scoredTask struct {
+		usage *models.TaskUsage
+		score float64
+	}
+
+	var scored []scoredTask
+	for _, usage := range usages {
+		match := matchQuality(strings.ToLower(taskLabel(usage)), input)
+		if match == matchNone {
+			continue
+		}
+
+		score := float64(match) / matchExact
+		if usage.LastUsed != nil {
+			days := now.Sub(*usage.LastUsed).Hours() / 24
+			if days < 0 {
+				days = 0
+			}
+			score += 1 / (1 + days)
+		}
+		if maxUseCount > 0 {
+			score += float64(usage.UseCount) / float64(maxUseCount)
+		}
+
+		scored = append(scored, scoredTask{usage: usage, score: score})
+	}
+
+	sort.SliceStable(scored, func(i, j int) bool {
+		return scored[i].score > scored[j].score
+	})
+
+	ranked := make([]*models.TaskUsage, len(scored))
+	for i, st := range scored {
+		ranked[i] = st.usage
+	}
+	return ranked
+}
+
+// taskLabel names a task for display, prefixing subtasks with their parent
+func taskLabel(usage *models.TaskUsage) string {
+	if usage.ParentName != "" {
+		return usage.ParentName + " › " + usage.Task.Name
+	}
+	return usage.Task.Name
+}
+
+// matchQuality grades how well a lower-cased name matches lower-cased input
+func matchQuality(name, input string) int {
+	switch {
+	case input == "":
+		return matchSubsequence
+	case name == input:
+		return matchExact
+	case strings.HasPrefix(name, input):
+		return matchPrefix
+	}
+
+	for _, word := range strings.FieldsFunc(name, isWordSeparator) {
+		if strings.HasPrefix(word, input) {
+			return matchWordPrefix
+		}
+	}
+
+	if strings.Contains(name, input) {
+		return matchSubstring
+	}
+
+	// Fuzzy match: every input character appears in order, e.g. "cdrv" in "code review"
+	remaining := []rune(input)
+	for _, r := range name {
+		if len(remaining) > 0 && r == remaining[0] {
+			remaining = remaining[1:]
+		}
+	}
+	if len(remaining) == 0 {
+		return matchSubsequence
+	}
+	return matchNone
+}
+
+func isWordSeparator(r rune) bool {
+	return r == ' ' || r == '-' || r == '_' || r == '/' || r == '.'
+}
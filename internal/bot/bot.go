@@ -3,35 +3,49 @@ package bot
 import (
 	"context"
 	"fmt"
-	"log"
+	"log/slog"
 	"runtime"
 	"sync"
 	"time"
 
 	"taskbot/internal/config"
 	"taskbot/internal/db"
+	"taskbot/internal/db/models"
+	"taskbot/internal/events"
 
 	"github.com/bwmarrin/discordgo"
 )
 
-var (
-	dmAllowedCommands = map[string]bool{
-		"help": true, // Keep only essential commands in DMs
-	}
+const (
+	// commandTimeout bounds the work done for a single slash command, well within
+	// the 15 minute lifetime of the interaction token
+	commandTimeout = 2 * time.Minute
+
+	// autocompleteTimeout bounds autocomplete lookups, which Discord expects
+	// to be answered within 3 seconds
+	autocompleteTimeout = 2 * time.Second
+
+	// eventTimeout bounds the work done for gateway events such as guild joins
+	eventTimeout = time.Minute
 )
 
 type Bot struct {
-	config     *config.Config
-	db         *db.DB
-	session    *discordgo.Session
-	commands   []*discordgo.ApplicationCommand
-	shutdownCh chan struct{}
-	isShutdown bool
-	mu         sync.Mutex
-	wg         sync.WaitGroup
+	config      *config.Config
+	db          db.Store
+	session     *discordgo.Session
+	lookups     *lookupCache
+	serverLogs  *serverLogQueue
+	events      *events.Bus
+	webhookWake chan struct{}
+	shutdownCh  chan struct{}
+	ctx         context.Context
+	cancel      context.CancelFunc
+	isShutdown  bool
+	mu          sync.Mutex
+	wg          sync.WaitGroup
 }
 
-func New(config *config.Config, database *db.DB) (*Bot, error) {
+func New(config *config.Config, database db.Store) (*Bot, error) {
 	session, err := discordgo.New("Bot " + config.Discord.Token)
 	if err != nil {
 		return nil, fmt.Errorf("error creating Discord session: %w", err)
@@ -55,141 +69,114 @@ func New(config *config.Config, database *db.DB) (*Bot, error) {
 	config.Discord.Permissions = requiredPermissions
 
 	// Log configuration details
-	log.Printf("Bot intents: %d", session.Identify.Intents)
-	log.Printf("Bot permissions: %d", config.Discord.Permissions)
-
-	return &Bot{
-		db:         database,
-		session:    session,
-		config:     config,
-		shutdownCh: make(chan struct{}),
-		isShutdown: false,
-	}, nil
+	slog.Info("Bot configured", "intents", session.Identify.Intents, "permissions", config.Discord.Permissions)
+
+	// Start replaces the root context; until then handlers run against this one
+	ctx, cancel := context.WithCancel(context.Background())
+
+	b := &Bot{
+		db:          database,
+		session:     session,
+		lookups:     newLookupCache(lookupCacheTTL),
+		serverLogs:  newServerLogQueue(),
+		events:      events.NewBus(),
+		webhookWake: make(chan struct{}, 1),
+		config:      config,
+		shutdownCh:  make(chan struct{}),
+		isShutdown:  false,
+		ctx:         ctx,
+		cancel:      cancel,
+	}
+	b.events.Subscribe(b.wakeWebhooksOnEvent)
+	return b, nil
 }
 
-// Helper function to register commands for a guild
+// registerGuildCommands syncs a guild's commands with the registry. When commands
+// are registered globally, the guild's own commands are removed instead so that
+// they do not show up twice.
 func (b *Bot) registerGuildCommands(guildID string) error {
-	maxRetries := 3
-	var lastErr error
-
-	for i := 0; i < maxRetries; i++ {
-		err := b.registerGuildCommandsOnce(guildID)
-		if err == nil {
-			return nil
-		}
-		lastErr = err
-		log.Printf("Attempt %d to register commands failed: %v", i+1, err)
-		time.Sleep(time.Second * time.Duration(i+1))
+	if b.config.Discord.GlobalCommands {
+		return b.syncCommands(guildID, nil)
 	}
-	return fmt.Errorf("failed to register commands after %d attempts: %v", maxRetries, lastErr)
+	return b.syncCommands(guildID, commandDefinitions())
 }
 
-func (b *Bot) registerGuildCommandsOnce(guildID string) error {
-	serverName := getServerName(b.session, guildID)
-
-	log.Printf(formatLogMessage(
-		guildID,
-		"Registering commands",
-		"BOT",
-		serverName,
-	))
-
-	// Clear existing commands
-	existing, err := b.session.ApplicationCommands(b.config.Discord.ClientID, guildID)
-	if err != nil {
-		return fmt.Errorf("error getting existing commands: %w", err)
+// registerGlobalCommands syncs the application's global commands with the
+// registry, or removes them when commands are registered per guild
+func (b *Bot) registerGlobalCommands() error {
+	if b.config.Discord.GlobalCommands {
+		return b.syncCommands("", commandDefinitions())
 	}
-
-	// Delete all existing commands first
-	for _, v := range existing {
-		err := b.session.ApplicationCommandDelete(b.config.Discord.ClientID, guildID, v.ID)
-		if err != nil {
-			log.Printf(formatLogMessage(
-				guildID,
-				fmt.Sprintf("%s: Failed to delete command (%v)", v.Name, err),
-				"BOT",
-				serverName,
-			))
-		} else {
-			log.Printf(formatLogMessage(
-				guildID,
-				fmt.Sprintf("%s: Successfully removed command", v.Name),
-				"BOT",
-				serverName,
-			))
-		}
-	}
-
-	// Wait a moment to ensure all deletions are processed
-	time.Sleep(time.Second)
-
-	// Register new commands
-	for _, v := range commands {
-		_, err := b.session.ApplicationCommandCreate(b.config.Discord.ClientID, guildID, v)
-		if err != nil {
-			return fmt.Errorf("error creating command %s: %w", v.Name, err)
-		}
-		log.Printf(formatLogMessage(
-			guildID,
-			fmt.Sprintf("%s: Registered command", v.Name),
-			"BOT",
-			serverName,
-		))
-	}
-
-	return nil
+	return b.syncCommands("", nil)
 }
 
+// Start connects to Discord and runs the bot until ctx is cancelled. All
+// handler work is derived from ctx so that Shutdown can cancel it.
 func (b *Bot) Start(ctx context.Context) error {
-	log.Println("Starting TaskBot...")
+	slog.Info("Starting TaskBot")
+
+	b.cancel()
+	b.ctx, b.cancel = context.WithCancel(ctx)
 
 	// Keep trying to connect until successful
 	for {
 		// Test Discord API connection
-		log.Println("Testing Discord API connection...")
 		if _, err := b.session.User("@me"); err != nil {
-			log.Printf("Failed to connect to Discord API: %v. Retrying in 5 seconds...", err)
+			slog.Warn("Failed to connect to Discord API, retrying in 5 seconds", "error", err)
 			time.Sleep(5 * time.Second)
 			continue
 		}
-		log.Println("Successfully connected to Discord API")
+		slog.Info("Connected to Discord API")
 		break
 	}
 
 	// Keep trying to open session until successful
 	for {
 		if err := b.session.Open(); err != nil {
-			log.Printf("Error opening Discord session: %v. Retrying in 5 seconds...", err)
+			slog.Warn("Error opening Discord session, retrying in 5 seconds", "error", err)
 			time.Sleep(5 * time.Second)
 			continue
 		}
-		log.Printf("Session opened successfully (Session ID: %s)", b.session.State.SessionID)
+		slog.Info("Session opened", "session_id", b.session.State.SessionID)
 		break
 	}
 
 	// Register handlers
+	b.lookups.addHandlers(b.session)
 	b.session.AddHandler(b.handleReady)
 	b.session.AddHandler(func(s *discordgo.Session, i *discordgo.InteractionCreate) {
-		switch i.Type {
-		case discordgo.InteractionApplicationCommand:
-			b.handleCommand(s, i)
-		case discordgo.InteractionApplicationCommandAutocomplete:
-			b.handleAutocomplete(s, i)
-		}
+		b.HandleInteraction(b.cached(s), i)
 	})
 
-	// Force re-register commands for all guilds
-	log.Println("Force re-registering commands for all guilds...")
+	// Sync commands with Discord, only changing what differs from the registry
+	if err := b.registerGlobalCommands(); err != nil {
+		slog.Error("Error syncing global commands", "error", err)
+	}
 	for _, guild := range b.session.State.Guilds {
 		if err := b.registerGuildCommands(guild.ID); err != nil {
-			log.Printf("Error registering commands for guild %s: %v", guild.ID, err)
+			slog.Error("Error syncing guild commands", "guild_id", guild.ID, "error", err)
 		}
 	}
 
 	// Now add the guild create handler for future guilds
 	b.session.AddHandler(b.handleGuildCreate)
 
-	log.Println("Bot is now running. Press CTRL-C to exit.")
+	// Start creating recurring tasks from templates
+	if b.track() {
+		go b.runTemplateScheduler()
+	}
+
+	// Post batched events to the log channels guilds have configured
+	if b.track() {
+		go b.runServerLog()
+	}
+
+	// Deliver queued events to the webhooks guilds have configured
+	if b.track() {
+		go b.runWebhookSender()
+	}
+
+	slog.Info("Bot is now running")
 
 	// Wait for shutdown signal
 	<-ctx.Done()
@@ -198,7 +185,7 @@ func (b *Bot) Start(ctx context.Context) error {
 
 // Shutdown performs a graceful shutdown of the bot
 func (b *Bot) Shutdown() error {
-	log.Println("Initiating graceful shutdown...")
+	slog.Info("Initiating graceful shutdown")
 
 	// Ensure we only close the channel once
 	b.mu.Lock()
@@ -210,138 +197,152 @@ func (b *Bot) Shutdown() error {
 	close(b.shutdownCh)
 	b.mu.Unlock()
 
+	// Cancel database queries and other work still in flight
+	b.cancel()
+
 	// Wait for all handlers to complete
-	log.Println("Waiting for active handlers to complete...")
+	slog.Info("Waiting for active handlers to complete")
 	b.wg.Wait()
 
-	// Remove commands
-	log.Printf(formatLogMessage("", "Removing Discord commands", "BOT", ""))
-
-	for _, guild := range b.session.State.Guilds {
-		// Get guild info for better logging
-		serverName := getServerName(b.session, guild.ID)
-
-		log.Printf(formatLogMessage(guild.ID, "Removing commands", "BOT", serverName))
-
-		registeredCommands, err := b.session.ApplicationCommands(b.config.Discord.ClientID, guild.ID)
-		if err != nil {
-			log.Printf(formatLogMessage(guild.ID, fmt.Sprintf("Error getting commands: %v", err), "BOT", serverName))
-			continue
-		}
-		for _, cmd := range registeredCommands {
-			err := b.session.ApplicationCommandDelete(b.config.Discord.ClientID, guild.ID, cmd.ID)
-			if err != nil {
-				log.Printf(formatLogMessage(guild.ID, fmt.Sprintf("%s: Failed to remove command (%v)", cmd.Name, err), "BOT", serverName))
-			} else {
-				log.Printf(formatLogMessage(guild.ID, fmt.Sprintf("%s: Successfully removed command", cmd.Name), "BOT", serverName))
-			}
-		}
-	}
-
 	// Close Discord session
-	log.Println("Closing Discord session...")
+	slog.Info("Closing Discord session")
 	if err := b.session.Close(); err != nil {
 		return fmt.Errorf("error closing Discord session: %w", err)
 	}
 
 	// Close database connection
-	log.Println("Closing database connection...")
+	slog.Info("Closing database connection")
 	b.db.Close()
 
-	log.Println("Shutdown completed successfully")
+	slog.Info("Shutdown completed")
 	return nil
 }
 
+// HandleInteraction dispatches a slash command or autocomplete interaction. It is
+// called for every InteractionCreate event and can be driven directly with a fake
+// Session to exercise handlers without Discord.
+func (b *Bot) HandleInteraction(s Session, i *discordgo.InteractionCreate) {
+	if !b.track() {
+		return
+	}
+	defer b.wg.Done()
+
+	switch i.Type {
+	case discordgo.InteractionApplicationCommand:
+		b.handleCommand(s, i)
+	case discordgo.InteractionApplicationCommandAutocomplete:
+		b.handleAutocomplete(s, i)
+	}
+}
+
+// cached wraps a session so that guild, member and channel lookups go through the
+// bot's lookup cache
+func (b *Bot) cached(s Session) Session {
+	return cachedSession{Session: s, cache: b.lookups}
+}
+
+// track registers in-flight work with the wait group, returning false once the
+// bot is shutting down and no new work should start
+func (b *Bot) track() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.isShutdown {
+		return false
+	}
+	b.wg.Add(1)
+	return true
+}
+
 func (b *Bot) handleReady(s *discordgo.Session, r *discordgo.Ready) {
-	log.Printf("Bot is ready! Connected to %d guilds", len(r.Guilds))
+	ctx, cancel := context.WithTimeout(b.ctx, eventTimeout)
+	defer cancel()
+
+	slog.Info("Bot is ready", "guilds", len(r.Guilds))
 
 	// Initialize settings for all current guilds
 	for _, guild := range r.Guilds {
-		log.Printf("Initializing settings for guild: %s", guild.ID)
-		if _, err := b.db.GetOrCreateServerSettings(guild.ID); err != nil {
-			log.Printf("Error initializing settings for guild %s: %v", guild.ID, err)
+		slog.Debug("Initializing guild settings", "guild_id", guild.ID)
+		if _, err := b.db.GetOrCreateServerSettings(ctx, guild.ID); err != nil {
+			slog.Error("Error initializing guild settings", "guild_id", guild.ID, "error", err)
 		}
 	}
 }
 
 func (b *Bot) handleGuildCreate(s *discordgo.Session, g *discordgo.GuildCreate) {
-	log.Printf(formatLogMessage(g.ID, "Bot joined new guild", "BOT", g.Name))
+	ctx, cancel := context.WithTimeout(b.ctx, eventTimeout)
+	defer cancel()
+
+	logger := slog.With("guild_id", g.ID, "guild", g.Name)
+	logger.Info("Bot joined guild")
 
 	// Get all members using the Discord API
 	members, err := s.GuildMembers(g.ID, "", 1000) // Get up to 1000 members
 	if err != nil {
-		log.Printf("Error getting guild members: %v", err)
+		logger.Error("Error getting guild members", "error", err)
 		return
 	}
 
 	// Process each member
 	for _, member := range members {
 		if member.User != nil {
-			user, err := b.db.GetOrCreateUser(member.User.ID, member.User.Username)
+			user, err := b.db.GetOrCreateUser(ctx, member.User.ID, member.User.Username)
 			if err != nil {
-				log.Printf("Error processing user %s: %v", member.User.Username, err)
+				logger.Error("Error processing user", "user", member.User.Username, "error", err)
+				continue
+			}
+			if err := b.db.AddUserToGuild(ctx, user.ID, g.ID); err != nil {
+				logger.Error("Error recording guild membership", "user", member.User.Username, "error", err)
 				continue
 			}
-			log.Printf("Processed user: %s (ID: %s)", user.Username, user.ID)
+			logger.Debug("Processed user", "user", user.Username, "user_uuid", user.ID)
 		}
 	}
 
 	// Register commands for the new guild
 	if err := b.registerGuildCommands(g.ID); err != nil {
-		log.Printf(formatLogMessage(g.ID, fmt.Sprintf("Error registering commands: %v", err), "BOT", g.Name))
+		logger.Error("Error registering commands", "error", err)
 	}
 }
 
-func (b *Bot) handleCommand(s *discordgo.Session, i *discordgo.InteractionCreate) {
+func (b *Bot) handleCommand(s Session, i *discordgo.InteractionCreate) {
+	start := time.Now()
 	// Add defer to catch panics with stack trace
 	defer func() {
 		if r := recover(); r != nil {
-			// Get username and context for better error tracking
-			var username, context string
-			if i.Member != nil && i.Member.User != nil {
-				username = i.Member.User.Username
-				if guild, err := s.Guild(i.GuildID); err == nil {
-					context = fmt.Sprintf("guild %s (%s)", guild.Name, i.GuildID)
-				} else {
-					context = fmt.Sprintf("guild ID %s", i.GuildID)
-				}
-			} else if i.User != nil {
-				username = i.User.Username
-				context = "DM"
-			} else {
-				username = "unknown"
-				context = "unknown context"
-			}
-
-			// Log the stack trace with context
+			// Log the stack trace with the interaction context
 			buf := make([]byte, 4096)
 			n := runtime.Stack(buf, false)
-			log.Printf("Panic in command handler for user %s in %s:\nError: %v\nStack Trace:\n%s",
-				username, context, r, string(buf[:n]))
+			interactionLogger(i).Error("Panic in command handler", "panic", r, "stack", string(buf[:n]))
+			b.serverLog(i.GuildID, models.LogErrors, "/%s by %s: internal error", interactionCommand(i), interactionUsername(i))
 
 			respondWithError(s, i, "An internal error occurred")
 		}
 	}()
 
-	// Check if command is allowed in current context
+	// Look up the command in the registry
 	commandName := i.ApplicationCommandData().Name
+	cmd := findCommand(commandName)
+	if cmd != nil {
+		defer func() {
+			commandsTotal.Inc(commandName)
+			commandDuration.Observe(time.Since(start).Seconds(), commandName)
+		}()
+	}
+	if cmd == nil {
+		interactionLogger(i).Warn("Unknown command")
+		respondWithError(s, i, "Unknown command")
+		return
+	}
 
 	// Strict DM check
 	if i.GuildID == "" {
-		if !dmAllowedCommands[commandName] {
+		if !cmd.allowDM {
 			respondWithError(s, i, fmt.Sprintf("The `/%s` command can only be used in a server", commandName))
 			return
 		}
 	}
 
-	// Add guild-specific permission check
-	if i.GuildID != "" {
-		if !hasPermission(s, i.GuildID, i.Member.User.ID, discordgo.PermissionViewChannel) {
-			respondWithError(s, i, "You don't have permission to use this command here")
-			return
-		}
-	}
-
 	// Add initial acknowledgment for long-running commands
 	err := s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
 		Type: discordgo.InteractionResponseDeferredChannelMessageWithSource,
@@ -350,30 +351,27 @@ func (b *Bot) handleCommand(s *discordgo.Session, i *discordgo.InteractionCreate
 		},
 	})
 	if err != nil {
-		log.Printf(formatLogMessage(i.GuildID, "Error acknowledging interaction: "+err.Error(), "", ""))
+		interactionLogger(i).Error("Error acknowledging interaction", "error", err)
 		return
 	}
 
-	// Handle the command
-	switch commandName {
-	case "timezone":
-		b.handleTimezone(s, i)
-	case "declare":
-		b.handleDeclare(s, i)
-	case "checkin":
-		b.handleCheckin(s, i)
-	case "checkout":
-		b.handleCheckout(s, i)
-	case "status":
-		b.handleStatus(s, i)
-	case "report":
-		b.handleReport(s, i)
-	case "task":
-		b.handleTask(s, i)
-	case "globaltask":
-		b.handleGlobalTask(s, i)
-	default:
-		log.Printf(formatLogMessage(i.GuildID, "Unknown command: "+commandName, "", ""))
-		respondWithError(s, i, "Unknown command")
+	ctx, cancel := context.WithTimeout(b.ctx, commandTimeout)
+	defer cancel()
+
+	// Enforce the command's required bot role
+	role := b.memberRole(ctx, s, i.GuildID, interactionUserID(i))
+	if role == models.RoleNone {
+		respondWithError(s, i, "You don't have permission to use this bot here")
+		return
 	}
+	if required := cmd.requiredRole(); !role.AtLeast(required) {
+		respondWithError(s, i, fmt.Sprintf("The `/%s` command requires the %s role", commandName, required))
+		return
+	}
+
+	if cmd.requiredRole() == models.RoleAdmin {
+		b.serverLog(i.GuildID, models.LogAdmin, "%s used /%s %s", interactionUsername(i), commandName, commandOptions(i))
+	}
+
+	cmd.handler(b, withRole(ctx, role), s, i)
 }
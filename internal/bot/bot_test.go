@@ -0,0 +1,307 @@
+package bot_test
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+	"unicode/utf8"
+
+	"taskbot/internal/bot"
+	"taskbot/internal/bot/bottest"
+	"taskbot/internal/config"
+	"taskbot/internal/db/memstore"
+	"taskbot/internal/db/models"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/google/uuid"
+)
+
+const (
+	guildID     = "guild-1"
+	channelID   = "channel-1"
+	ownerID     = "user-owner"
+	memberID    = "user-member"
+	staffRoleID = "role-staff"
+)
+
+type harness struct {
+	bot     *bot.Bot
+	session *bottest.Session
+	store   *memstore.Store
+	owner   *discordgo.Member
+	member  *discordgo.Member
+}
+
+// newHarness sets up a bot over a memstore and a fake guild with its owner, who
+// is an admin, and a plain member
+func newHarness(t *testing.T) *harness {
+	t.Helper()
+
+	cfg := &config.Config{}
+	cfg.Discord.Token = "test"
+	store := memstore.New()
+	b, err := bot.New(cfg, store)
+	if err != nil {
+		t.Fatalf("creating bot: %v", err)
+	}
+
+	h := &harness{
+		bot:     b,
+		session: bottest.NewSession(),
+		store:   store,
+		owner:   bottest.Member(ownerID, "owner"),
+		member:  bottest.Member(memberID, "member"),
+	}
+	h.session.AddGuild(&discordgo.Guild{
+		ID:      guildID,
+		OwnerID: ownerID,
+		Roles:   []*discordgo.Role{{ID: staffRoleID}},
+	})
+	h.session.AddChannel(&discordgo.Channel{ID: channelID, GuildID: guildID})
+	h.session.AddMember(guildID, h.owner)
+	h.session.AddMember(guildID, h.member)
+	return h
+}
+
+// run sends a command and returns the bot's reply
+func (h *harness) run(t *testing.T, member *discordgo.Member, name string, options ...*bottest.Option) string {
+	t.Helper()
+
+	h.session.Reset()
+	h.bot.HandleInteraction(h.session, bottest.Command(guildID, channelID, member, name, options...))
+	reply := h.session.LastFollowup()
+	if reply == "" {
+		t.Fatalf("/%s sent no reply", name)
+	}
+	return reply
+}
+
+// autocomplete sends an autocomplete interaction and returns the suggestions,
+// or nil if the bot did not answer
+func (h *harness) autocomplete(t *testing.T, member *discordgo.Member, name string, options ...*bottest.Option) []*discordgo.ApplicationCommandOptionChoice {
+	t.Helper()
+
+	h.session.Reset()
+	h.bot.HandleInteraction(h.session, bottest.Autocomplete(guildID, channelID, member, name, options...))
+	responses := h.session.Responses()
+	if len(responses) == 0 {
+		return nil
+	}
+	resp := responses[len(responses)-1]
+	if resp.Type != discordgo.InteractionApplicationCommandAutocompleteResult {
+		t.Fatalf("autocomplete response type = %v", resp.Type)
+	}
+	return resp.Data.Choices
+}
+
+// activeCheckIn returns the active check-in of a Discord user in the guild
+func (h *harness) activeCheckIn(t *testing.T, discordID string) *models.CheckIn {
+	t.Helper()
+
+	ctx := context.Background()
+	user, err := h.store.GetUserByDiscordID(ctx, discordID)
+	if err != nil || user == nil {
+		t.Fatalf("getting user %s: %v", discordID, err)
+	}
+	checkIn, err := h.store.GetActiveCheckIn(ctx, user.ID, guildID)
+	if err != nil {
+		t.Fatalf("getting active check-in: %v", err)
+	}
+	return checkIn
+}
+
+func TestCheckinAndCheckout(t *testing.T) {
+	h := newHarness(t)
+
+	reply := h.run(t, h.member, "checkin", bottest.Subcommand("new", bottest.String("name", "Write docs")))
+	if !strings.Contains(reply, "Started working on task: Write docs") {
+		t.Fatalf("checkin reply = %q", reply)
+	}
+	if h.activeCheckIn(t, memberID) == nil {
+		t.Fatal("no active check-in after /checkin")
+	}
+
+	reply = h.run(t, h.member, "checkout")
+	if !strings.Contains(reply, "Checked out from task: Write docs") {
+		t.Fatalf("checkout reply = %q", reply)
+	}
+	if h.activeCheckIn(t, memberID) != nil {
+		t.Fatal("check-in still active after /checkout")
+	}
+
+	reply = h.run(t, h.member, "checkout")
+	if !strings.Contains(reply, "No active task to check out from") {
+		t.Fatalf("second checkout reply = %q", reply)
+	}
+}
+
+func TestCheckinSwitchesTask(t *testing.T) {
+	h := newHarness(t)
+
+	h.run(t, h.member, "checkin", bottest.Subcommand("new", bottest.String("name", "First")))
+	first := h.activeCheckIn(t, memberID)
+	h.run(t, h.member, "checkin", bottest.Subcommand("new", bottest.String("name", "Second")))
+	second := h.activeCheckIn(t, memberID)
+
+	if second == nil || second.ID == first.ID {
+		t.Fatal("second check-in did not replace the first")
+	}
+	ended, err := h.store.GetCheckInByID(context.Background(), first.ID)
+	if err != nil {
+		t.Fatalf("getting first check-in: %v", err)
+	}
+	if ended.Active || ended.EndTime == nil {
+		t.Fatal("first check-in was not ended")
+	}
+}
+
+func TestAdminCommandDeniedToMember(t *testing.T) {
+	h := newHarness(t)
+
+	reply := h.run(t, h.member, "audit")
+	if !strings.Contains(reply, "requires the admin role") {
+		t.Fatalf("member /audit reply = %q", reply)
+	}
+
+	reply = h.run(t, h.owner, "audit")
+	if strings.Contains(reply, "requires the admin role") {
+		t.Fatalf("owner /audit reply = %q", reply)
+	}
+}
+
+func TestRestrictedGuildDeniesUnmappedMembers(t *testing.T) {
+	h := newHarness(t)
+
+	err := h.store.SetRoleMapping(context.Background(), &models.RoleMapping{
+		ServerID:      guildID,
+		DiscordRoleID: staffRoleID,
+		Role:          models.RoleMember,
+	})
+	if err != nil {
+		t.Fatalf("setting role mapping: %v", err)
+	}
+
+	reply := h.run(t, h.member, "checkout")
+	if !strings.Contains(reply, "You don't have permission to use this bot here") {
+		t.Fatalf("unmapped member reply = %q", reply)
+	}
+
+	staff := bottest.Member("user-staff", "staff", staffRoleID)
+	h.session.AddMember(guildID, staff)
+	reply = h.run(t, staff, "checkout")
+	if !strings.Contains(reply, "No active task to check out from") {
+		t.Fatalf("mapped member reply = %q", reply)
+	}
+}
+
+func TestTaskAutocomplete(t *testing.T) {
+	h := newHarness(t)
+
+	h.run(t, h.member, "checkin", bottest.Subcommand("new", bottest.String("name", "Write docs")))
+	h.run(t, h.member, "checkout")
+	h.run(t, h.owner, "checkin", bottest.Subcommand("new", bottest.String("name", "Review docs")))
+
+	// Members only get their own tasks
+	choices := h.autocomplete(t, h.member, "checkin",
+		bottest.Subcommand("existing", bottest.Focused(bottest.String("task", "doc"))))
+	if len(choices) != 1 || choices[0].Name != "Write docs" {
+		t.Fatalf("member suggestions = %v", choiceNames(choices))
+	}
+
+	// Admins merging tasks get every task in the server, labelled with its owner
+	choices = h.autocomplete(t, h.owner, "task",
+		bottest.Subcommand("merge", bottest.Focused(bottest.String("source", "doc"))))
+	names := choiceNames(choices)
+	if len(names) != 2 || !contains(names, "Write docs (member)") || !contains(names, "Review docs") {
+		t.Fatalf("admin merge suggestions = %v", names)
+	}
+}
+
+func TestAutocompleteHiddenFromMembersWithoutRole(t *testing.T) {
+	h := newHarness(t)
+
+	h.run(t, h.owner, "checkin", bottest.Subcommand("new", bottest.String("name", "Review docs")))
+
+	choices := h.autocomplete(t, h.member, "audit", bottest.Focused(bottest.String("task", "")))
+	if choices != nil {
+		t.Fatalf("member got /audit suggestions: %v", choiceNames(choices))
+	}
+}
+
+func TestUsernameAutocomplete(t *testing.T) {
+	h := newHarness(t)
+
+	h.run(t, h.member, "checkin", bottest.Subcommand("new", bottest.String("name", "Write docs")))
+	h.run(t, h.owner, "checkin", bottest.Subcommand("new", bottest.String("name", "Review docs")))
+	if _, err := h.store.GetOrCreateUser(context.Background(), "user-elsewhere", "elsewhere"); err != nil {
+		t.Fatalf("creating user in another guild: %v", err)
+	}
+
+	// Admins get everyone in the guild, but no one from other guilds
+	names := choiceNames(h.autocomplete(t, h.owner, "report", bottest.Focused(bottest.String("username", ""))))
+	if len(names) != 2 || !contains(names, "owner") || !contains(names, "member") {
+		t.Fatalf("admin suggestions = %v", names)
+	}
+
+	// Members only get themselves
+	names = choiceNames(h.autocomplete(t, h.member, "report", bottest.Focused(bottest.String("username", ""))))
+	if len(names) != 1 || names[0] != "member" {
+		t.Fatalf("member suggestions = %v", names)
+	}
+}
+
+func TestTemplateNameLength(t *testing.T) {
+	h := newHarness(t)
+
+	reply := h.run(t, h.owner, "template", bottest.Subcommand("create",
+		bottest.String("name", strings.Repeat("x", 65)),
+		bottest.String("schedule", "daily")))
+	if !strings.Contains(reply, "Template names must be 1 to 64 characters") {
+		t.Fatalf("long name reply = %q", reply)
+	}
+
+	// Templates created before names were capped still get a valid label
+	owner, err := h.store.GetOrCreateUser(context.Background(), ownerID, "owner")
+	if err != nil {
+		t.Fatalf("getting owner: %v", err)
+	}
+	err = h.store.CreateTaskTemplate(context.Background(), &models.TaskTemplate{
+		ID:        uuid.New(),
+		ServerID:  guildID,
+		Name:      strings.Repeat("é", 120),
+		Schedule:  "daily",
+		Timezone:  "UTC",
+		CreatedBy: owner.ID,
+		NextRunAt: time.Now().Add(time.Hour),
+		CreatedAt: time.Now(),
+	})
+	if err != nil {
+		t.Fatalf("creating template: %v", err)
+	}
+	choices := h.autocomplete(t, h.owner, "template",
+		bottest.Subcommand("delete", bottest.Focused(bottest.String("template", ""))))
+	if len(choices) != 1 {
+		t.Fatalf("got %d template suggestions, want 1", len(choices))
+	}
+	if name := choices[0].Name; utf8.RuneCountInString(name) > 100 || !utf8.ValidString(name) {
+		t.Fatalf("template label is not a valid choice name: %q", name)
+	}
+}
+
+func choiceNames(choices []*discordgo.ApplicationCommandOptionChoice) []string {
+	names := make([]string, len(choices))
+	for i, choice := range choices {
+		names[i] = choice.Name
+	}
+	return names
+}
+
+func contains(values []string, want string) bool {
+	for _, value := range values {
+		if value == want {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,82 @@
+package bottest
+
+import (
+	"github.com/bwmarrin/discordgo"
+)
+
+// Option is a command option in a synthetic interaction
+type Option = discordgo.ApplicationCommandInteractionDataOption
+
+// Command builds a slash command interaction sent by member in a guild channel
+func Command(guildID, channelID string, member *discordgo.Member, name string, options ...*Option) *discordgo.InteractionCreate {
+	return interaction(discordgo.InteractionApplicationCommand, guildID, channelID, member, name, options)
+}
+
+// DMCommand builds a slash command interaction sent by user in a direct message
+func DMCommand(channelID string, user *discordgo.User, name string, options ...*Option) *discordgo.InteractionCreate {
+	i := interaction(discordgo.InteractionApplicationCommand, "", channelID, nil, name, options)
+	i.User = user
+	return i
+}
+
+// Autocomplete builds an autocomplete interaction; one of the options, possibly
+// inside a subcommand, should be marked with Focused
+func Autocomplete(guildID, channelID string, member *discordgo.Member, name string, options ...*Option) *discordgo.InteractionCreate {
+	return interaction(discordgo.InteractionApplicationCommandAutocomplete, guildID, channelID, member, name, options)
+}
+
+func interaction(kind discordgo.InteractionType, guildID, channelID string, member *discordgo.Member, name string, options []*Option) *discordgo.InteractionCreate {
+	return &discordgo.InteractionCreate{
+		Interaction: &discordgo.Interaction{
+			ID:        "interaction-" + name,
+			Type:      kind,
+			GuildID:   guildID,
+			ChannelID: channelID,
+			Member:    member,
+			Token:     "token",
+			Data: discordgo.ApplicationCommandInteractionData{
+				Name:    name,
+				Options: options,
+			},
+		},
+	}
+}
+
+// Member builds a guild member with the given roles
+func Member(userID, username string, roles ...string) *discordgo.Member {
+	return &discordgo.Member{
+		User:  &discordgo.User{ID: userID, Username: username},
+		Roles: roles,
+	}
+}
+
+// Subcommand builds a subcommand option holding options
+func Subcommand(name string, options ...*Option) *Option {
+	return &Option{
+		Name:    name,
+		Type:    discordgo.ApplicationCommandOptionSubCommand,
+		Options: options,
+	}
+}
+
+// String builds a string option
+func String(name, value string) *Option {
+	return &Option{Name: name, Type: discordgo.ApplicationCommandOptionString, Value: value}
+}
+
+// Integer builds an integer option. Discord sends numbers as JSON, so the value
+// is stored as a float64 like in real interactions.
+func Integer(name string, value int64) *Option {
+	return &Option{Name: name, Type: discordgo.ApplicationCommandOptionInteger, Value: float64(value)}
+}
+
+// Bool builds a boolean option
+func Bool(name string, value bool) *Option {
+	return &Option{Name: name, Type: discordgo.ApplicationCommandOptionBoolean, Value: value}
+}
+
+// Focused marks an option as the one being typed in an autocomplete interaction
+func Focused(option *Option) *Option {
+	option.Focused = true
+	return option
+}
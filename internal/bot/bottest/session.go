@@ -0,0 +1,208 @@
+// Package bottest provides a fake Discord session and helpers for building
+// synthetic interactions, so bot handlers can be exercised end to end without
+// connecting to Discord.
+package bottest
+
+import (
+	"fmt"
+	"sync"
+
+	"taskbot/internal/bot"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// Session is a fake bot.Session. Guilds, channels and members are served from
+// what was added to it, and everything the bot sends is recorded.
+type Session struct {
+	mu        sync.Mutex
+	guilds    map[string]*discordgo.Guild
+	channels  map[string]*discordgo.Channel
+	members   map[string]map[string]*discordgo.Member
+	responses []*discordgo.InteractionResponse
+	followups []*discordgo.WebhookParams
+	messages  []*Message
+}
+
+// Message is a message sent to a channel through ChannelMessageSend
+type Message struct {
+	ChannelID string
+	Content   string
+}
+
+var _ bot.Session = (*Session)(nil)
+
+// NewSession creates an empty fake session
+func NewSession() *Session {
+	return &Session{
+		guilds:   make(map[string]*discordgo.Guild),
+		channels: make(map[string]*discordgo.Channel),
+		members:  make(map[string]map[string]*discordgo.Member),
+	}
+}
+
+// AddGuild makes a guild and its roles known to the session
+func (s *Session) AddGuild(guild *discordgo.Guild) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.guilds[guild.ID] = guild
+	if s.members[guild.ID] == nil {
+		s.members[guild.ID] = make(map[string]*discordgo.Member)
+	}
+}
+
+// AddChannel makes a channel known to the session
+func (s *Session) AddChannel(channel *discordgo.Channel) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.channels[channel.ID] = channel
+}
+
+// AddMember adds a member to a guild; the member's User must be set
+func (s *Session) AddMember(guildID string, member *discordgo.Member) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.members[guildID] == nil {
+		s.members[guildID] = make(map[string]*discordgo.Member)
+	}
+	member.GuildID = guildID
+	s.members[guildID][member.User.ID] = member
+}
+
+// Responses returns the initial interaction responses sent so far
+func (s *Session) Responses() []*discordgo.InteractionResponse {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return append([]*discordgo.InteractionResponse(nil), s.responses...)
+}
+
+// Followups returns the followup messages sent so far, which is where command
+// results and errors end up after the initial deferred response
+func (s *Session) Followups() []*discordgo.WebhookParams {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return append([]*discordgo.WebhookParams(nil), s.followups...)
+}
+
+// LastFollowup returns the content of the most recent followup message, or an
+// empty string if none was sent
+func (s *Session) LastFollowup() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if len(s.followups) == 0 {
+		return ""
+	}
+	return s.followups[len(s.followups)-1].Content
+}
+
+// Messages returns the channel messages sent so far
+func (s *Session) Messages() []*Message {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return append([]*Message(nil), s.messages...)
+}
+
+// Reset forgets all recorded responses and messages
+func (s *Session) Reset() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.responses = nil
+	s.followups = nil
+	s.messages = nil
+}
+
+func (s *Session) InteractionRespond(interaction *discordgo.Interaction, resp *discordgo.InteractionResponse, options ...discordgo.RequestOption) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.responses = append(s.responses, resp)
+	return nil
+}
+
+func (s *Session) FollowupMessageCreate(interaction *discordgo.Interaction, wait bool, data *discordgo.WebhookParams, options ...discordgo.RequestOption) (*discordgo.Message, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.followups = append(s.followups, data)
+	return &discordgo.Message{
+		ChannelID: interaction.ChannelID,
+		Content:   data.Content,
+	}, nil
+}
+
+func (s *Session) ChannelMessageSend(channelID string, content string, options ...discordgo.RequestOption) (*discordgo.Message, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.messages = append(s.messages, &Message{ChannelID: channelID, Content: content})
+	return &discordgo.Message{ChannelID: channelID, Content: content}, nil
+}
+
+func (s *Session) Channel(channelID string, options ...discordgo.RequestOption) (*discordgo.Channel, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	channel, ok := s.channels[channelID]
+	if !ok {
+		return nil, fmt.Errorf("unknown channel %s", channelID)
+	}
+	return channel, nil
+}
+
+func (s *Session) Guild(guildID string, options ...discordgo.RequestOption) (*discordgo.Guild, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	guild, ok := s.guilds[guildID]
+	if !ok {
+		return nil, fmt.Errorf("unknown guild %s", guildID)
+	}
+	return guild, nil
+}
+
+func (s *Session) GuildMember(guildID, userID string, options ...discordgo.RequestOption) (*discordgo.Member, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	member, ok := s.members[guildID][userID]
+	if !ok {
+		return nil, fmt.Errorf("unknown member %s in guild %s", userID, guildID)
+	}
+	return member, nil
+}
+
+func (s *Session) GuildMembers(guildID string, after string, limit int, options ...discordgo.RequestOption) ([]*discordgo.Member, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var members []*discordgo.Member
+	for _, member := range s.members[guildID] {
+		if len(members) == limit {
+			break
+		}
+		members = append(members, member)
+	}
+	return members, nil
+}
+
+func (s *Session) UserGuilds(limit int, beforeID, afterID string, options ...discordgo.RequestOption) ([]*discordgo.UserGuild, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var guilds []*discordgo.UserGuild
+	for _, guild := range s.guilds {
+		if len(guilds) == limit {
+			break
+		}
+		guilds = append(guilds, &discordgo.UserGuild{ID: guild.ID, Name: guild.Name})
+	}
+	return guilds, nil
+}
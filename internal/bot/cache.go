@@ -0,0 +1,216 @@
+package bot
+
+import (
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+const (
+	// lookupCacheTTL bounds how stale a cached guild, member, member list or
+	// channel can be when an update event is missed
+	lookupCacheTTL = 5 * time.Minute
+
+	// lookupCacheSweepSize is the entry count above which expired entries are
+	// dropped when adding a new one
+	lookupCacheSweepSize = 10000
+)
+
+type cacheEntry struct {
+	value   interface{}
+	expires time.Time
+}
+
+// lookupCache keeps guilds, members, member lists and channels fetched over REST
+// for a short time. Gateway events invalidate entries as soon as they change, so
+// permission checks see role changes without waiting for the TTL.
+type lookupCache struct {
+	ttl     time.Duration
+	mu      sync.Mutex
+	entries map[string]cacheEntry
+}
+
+func newLookupCache(ttl time.Duration) *lookupCache {
+	return &lookupCache{
+		ttl:     ttl,
+		entries: make(map[string]cacheEntry),
+	}
+}
+
+func guildKey(guildID string) string           { return "guild:" + guildID }
+func memberKey(guildID, userID string) string  { return "member:" + guildID + ":" + userID }
+func channelKey(channelID string) string       { return "channel:" + channelID }
+func guildMembersPrefix(guildID string) string { return "member:" + guildID + ":" }
+func memberListPrefix(guildID string) string   { return "members:" + guildID + ":" }
+
+func memberListKey(guildID, after string, limit int) string {
+	return memberListPrefix(guildID) + after + ":" + strconv.Itoa(limit)
+}
+
+func (c *lookupCache) get(key string) (interface{}, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	entry, ok := c.entries[key]
+	if !ok {
+		return nil, false
+	}
+	if time.Now().After(entry.expires) {
+		delete(c.entries, key)
+		return nil, false
+	}
+	return entry.value, true
+}
+
+func (c *lookupCache) set(key string, value interface{}) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := time.Now()
+	if len(c.entries) >= lookupCacheSweepSize {
+		for k, entry := range c.entries {
+			if now.After(entry.expires) {
+				delete(c.entries, k)
+			}
+		}
+	}
+	c.entries[key] = cacheEntry{value: value, expires: now.Add(c.ttl)}
+}
+
+func (c *lookupCache) invalidate(key string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	delete(c.entries, key)
+}
+
+// invalidatePrefix drops every entry whose key starts with one of the prefixes
+func (c *lookupCache) invalidatePrefix(prefixes ...string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for key := range c.entries {
+		for _, prefix := range prefixes {
+			if strings.HasPrefix(key, prefix) {
+				delete(c.entries, key)
+				break
+			}
+		}
+	}
+}
+
+// invalidateGuild drops a guild and all of its cached members and member lists
+func (c *lookupCache) invalidateGuild(guildID string) {
+	c.invalidate(guildKey(guildID))
+	c.invalidatePrefix(guildMembersPrefix(guildID), memberListPrefix(guildID))
+}
+
+// invalidateMember drops a member and the guild's member lists, which include
+// their roles
+func (c *lookupCache) invalidateMember(guildID, userID string) {
+	c.invalidate(memberKey(guildID, userID))
+	c.invalidatePrefix(memberListPrefix(guildID))
+}
+
+// addHandlers registers the gateway events that invalidate cached entries
+func (c *lookupCache) addHandlers(s *discordgo.Session) {
+	s.AddHandler(func(_ *discordgo.Session, e *discordgo.GuildUpdate) {
+		c.invalidate(guildKey(e.ID))
+	})
+	s.AddHandler(func(_ *discordgo.Session, e *discordgo.GuildDelete) {
+		c.invalidateGuild(e.ID)
+	})
+	s.AddHandler(func(_ *discordgo.Session, e *discordgo.GuildRoleCreate) {
+		c.invalidate(guildKey(e.GuildID))
+	})
+	s.AddHandler(func(_ *discordgo.Session, e *discordgo.GuildRoleUpdate) {
+		c.invalidate(guildKey(e.GuildID))
+	})
+	s.AddHandler(func(_ *discordgo.Session, e *discordgo.GuildRoleDelete) {
+		c.invalidate(guildKey(e.GuildID))
+	})
+	s.AddHandler(func(_ *discordgo.Session, e *discordgo.GuildMemberAdd) {
+		if e.User != nil {
+			c.invalidateMember(e.GuildID, e.User.ID)
+		}
+	})
+	s.AddHandler(func(_ *discordgo.Session, e *discordgo.GuildMemberUpdate) {
+		if e.User != nil {
+			c.invalidateMember(e.GuildID, e.User.ID)
+		}
+	})
+	s.AddHandler(func(_ *discordgo.Session, e *discordgo.GuildMemberRemove) {
+		if e.User != nil {
+			c.invalidateMember(e.GuildID, e.User.ID)
+		}
+	})
+	s.AddHandler(func(_ *discordgo.Session, e *discordgo.ChannelUpdate) {
+		c.invalidate(channelKey(e.ID))
+	})
+	s.AddHandler(func(_ *discordgo.Session, e *discordgo.ChannelDelete) {
+		c.invalidate(channelKey(e.ID))
+	})
+}
+
+// cachedSession serves guild, member, member list and channel lookups from a
+// lookupCache and forwards everything else, and cache misses, to the wrapped
+// Session. Handlers must treat the returned values as read-only since they are
+// shared.
+type cachedSession struct {
+	Session
+	cache *lookupCache
+}
+
+func (c cachedSession) Guild(guildID string, options ...discordgo.RequestOption) (*discordgo.Guild, error) {
+	if value, ok := c.cache.get(guildKey(guildID)); ok {
+		return value.(*discordgo.Guild), nil
+	}
+	guild, err := c.Session.Guild(guildID, options...)
+	if err != nil {
+		return nil, err
+	}
+	c.cache.set(guildKey(guildID), guild)
+	return guild, nil
+}
+
+func (c cachedSession) GuildMember(guildID, userID string, options ...discordgo.RequestOption) (*discordgo.Member, error) {
+	if value, ok := c.cache.get(memberKey(guildID, userID)); ok {
+		return value.(*discordgo.Member), nil
+	}
+	member, err := c.Session.GuildMember(guildID, userID, options...)
+	if err != nil {
+		return nil, err
+	}
+	c.cache.set(memberKey(guildID, userID), member)
+	return member, nil
+}
+
+// GuildMembers caches each page of a guild's member list, so that listing the
+// members of role-backed teams does not page through the guild on every command
+func (c cachedSession) GuildMembers(guildID string, after string, limit int, options ...discordgo.RequestOption) ([]*discordgo.Member, error) {
+	key := memberListKey(guildID, after, limit)
+	if value, ok := c.cache.get(key); ok {
+		return value.([]*discordgo.Member), nil
+	}
+	members, err := c.Session.GuildMembers(guildID, after, limit, options...)
+	if err != nil {
+		return nil, err
+	}
+	c.cache.set(key, members)
+	return members, nil
+}
+
+func (c cachedSession) Channel(channelID string, options ...discordgo.RequestOption) (*discordgo.Channel, error) {
+	if value, ok := c.cache.get(channelKey(channelID)); ok {
+		return value.(*discordgo.Channel), nil
+	}
+	channel, err := c.Session.Channel(channelID, options...)
+	if err != nil {
+		return nil, err
+	}
+	c.cache.set(channelKey(channelID), channel)
+	return channel, nil
+}
@@ -1,12 +1,15 @@
 package bot
 
 import (
+	"context"
+	"errors"
 	"fmt"
-	"log"
+	"log/slog"
 	"strconv"
 	"strings"
 	"time"
 
+	"taskbot/internal/db"
 	"taskbot/internal/db/models"
 
 	"github.com/bwmarrin/discordgo"
@@ -14,242 +17,886 @@ import (
 )
 
 var (
-	commands = []*discordgo.ApplicationCommand{
+	// commands is the registry of every slash command the bot provides
+	commands = []*command{
 		{
-			Name:        "timezone",
-			Description: "Set your timezone",
-			Options: []*discordgo.ApplicationCommandOption{
-				{
-					Type:        discordgo.ApplicationCommandOptionString,
-					Name:        "zone",
-					Description: "Timezone (e.g., America/New_York, Europe/London)",
-					Required:    true,
+			definition: &discordgo.ApplicationCommand{
+				Name:        "timezone",
+				Description: "Set your timezone",
+				Options: []*discordgo.ApplicationCommandOption{
+					{
+						Type:        discordgo.ApplicationCommandOptionString,
+						Name:        "zone",
+						Description: "Timezone (e.g., America/New_York, Europe/London)",
+						Required:    true,
+					},
 				},
 			},
+			handler: (*Bot).handleTimezone,
 		},
 		{
-			Name:        "declare",
-			Description: "Declare time spent on a task",
-			Options: []*discordgo.ApplicationCommandOption{
-				{
-					Type:         discordgo.ApplicationCommandOptionString,
-					Name:         "task",
-					Description:  "Select a task",
-					Required:     true,
-					Autocomplete: true,
-				},
-				{
-					Type:        discordgo.ApplicationCommandOptionString,
-					Name:        "time",
-					Description: "Time spent (format: hh:mm)",
-					Required:    true,
+			definition: &discordgo.ApplicationCommand{
+				Name:        "declare",
+				Description: "Declare time spent on a task",
+				Options: []*discordgo.ApplicationCommandOption{
+					{
+						Type:         discordgo.ApplicationCommandOptionString,
+						Name:         "task",
+						Description:  "Select a task",
+						Required:     true,
+						Autocomplete: true,
+					},
+					{
+						Type:        discordgo.ApplicationCommandOptionString,
+						Name:        "time",
+						Description: "Time spent (format: hh:mm)",
+						Required:    true,
+					},
 				},
 			},
+			handler:      (*Bot).handleDeclare,
+			autocomplete: (*Bot).handleTaskAutocomplete,
 		},
 		{
-			Name:        "checkin",
-			Description: "Start working on a task",
-			Options: []*discordgo.ApplicationCommandOption{
-				{
-					Type:        discordgo.ApplicationCommandOptionSubCommand,
-					Name:        "existing",
-					Description: "Check in to an existing task",
-					Options: []*discordgo.ApplicationCommandOption{
-						{
-							Type:         discordgo.ApplicationCommandOptionString,
-							Name:         "task",
-							Description:  "Select a task",
-							Required:     true,
-							Autocomplete: true,
+			definition: &discordgo.ApplicationCommand{
+				Name:        "checkin",
+				Description: "Start working on a task",
+				Options: []*discordgo.ApplicationCommandOption{
+					{
+						Type:        discordgo.ApplicationCommandOptionSubCommand,
+						Name:        "existing",
+						Description: "Check in to an existing task",
+						Options: []*discordgo.ApplicationCommandOption{
+							{
+								Type:         discordgo.ApplicationCommandOptionString,
+								Name:         "task",
+								Description:  "Select a task",
+								Required:     true,
+								Autocomplete: true,
+							},
 						},
 					},
-				},
-				{
-					Type:        discordgo.ApplicationCommandOptionSubCommand,
-					Name:        "new",
-					Description: "Create and check in to a new task",
-					Options: []*discordgo.ApplicationCommandOption{
-						{
-							Type:        discordgo.ApplicationCommandOptionString,
-							Name:        "name",
-							Description: "Task name",
-							Required:    true,
-						},
-						{
-							Type:        discordgo.ApplicationCommandOptionString,
-							Name:        "description",
-							Description: "Task description",
-							Required:    false,
+					{
+						Type:        discordgo.ApplicationCommandOptionSubCommand,
+						Name:        "new",
+						Description: "Create and check in to a new task",
+						Options: []*discordgo.ApplicationCommandOption{
+							{
+								Type:        discordgo.ApplicationCommandOptionString,
+								Name:        "name",
+								Description: "Task name",
+								Required:    true,
+							},
+							{
+								Type:        discordgo.ApplicationCommandOptionString,
+								Name:        "description",
+								Description: "Task description",
+								Required:    false,
+							},
+							{
+								Type:         discordgo.ApplicationCommandOptionString,
+								Name:         "parent",
+								Description:  "Create as a subtask of this task",
+								Required:     false,
+								Autocomplete: true,
+							},
 						},
 					},
 				},
 			},
+			handler:      (*Bot).handleCheckin,
+			autocomplete: (*Bot).handleTaskAutocomplete,
 		},
 		{
-			Name:        "checkout",
-			Description: "Stop working on the current task",
+			definition: &discordgo.ApplicationCommand{
+				Name:        "checkout",
+				Description: "Stop working on the current task",
+			},
+			handler: (*Bot).handleCheckout,
 		},
 		{
-			Name:        "status",
-			Description: "Show current task status for all users",
+			definition: &discordgo.ApplicationCommand{
+				Name:        "status",
+				Description: "Show current task status for all users",
+			},
+			handler: (*Bot).handleStatus,
 		},
 		{
-			Name:        "report",
-			Description: "Show task history",
-			Options: []*discordgo.ApplicationCommandOption{
-				{
-					Type:        discordgo.ApplicationCommandOptionString,
-					Name:        "period",
-					Description: "Time period",
-					Required:    true,
-					Choices: []*discordgo.ApplicationCommandOptionChoice{
-						{
-							Name:  "Today",
-							Value: "today",
+			definition: &discordgo.ApplicationCommand{
+				Name:        "report",
+				Description: "Show task history",
+				Options: []*discordgo.ApplicationCommandOption{
+					{
+						Type:        discordgo.ApplicationCommandOptionString,
+						Name:        "period",
+						Description: "Time period",
+						Required:    true,
+						Choices: []*discordgo.ApplicationCommandOptionChoice{
+							{
+								Name:  "Today",
+								Value: "today",
+							},
+							{
+								Name:  "This Week",
+								Value: "week",
+							},
+							{
+								Name:  "This Month",
+								Value: "month",
+							},
+							{
+								Name:  "Last Month",
+								Value: "last_month",
+							},
+							{
+								Name:  "2 Months Ago",
+								Value: "month_2",
+							},
+							{
+								Name:  "3 Months Ago",
+								Value: "month_3",
+							},
+							{
+								Name:  "4 Months Ago",
+								Value: "month_4",
+							},
+							{
+								Name:  "5 Months Ago",
+								Value: "month_5",
+							},
+							{
+								Name:  "6 Months Ago",
+								Value: "month_6",
+							},
 						},
-						{
-							Name:  "This Week",
-							Value: "week",
+					},
+					{
+						Type:        discordgo.ApplicationCommandOptionString,
+						Name:        "format",
+						Description: "Output format (CSV for leads and admins; iCalendar has one event per check-in)",
+						Required:    false,
+						Choices: []*discordgo.ApplicationCommandOptionChoice{
+							{
+								Name:  "Text",
+								Value: "text",
+							},
+							{
+								Name:  "CSV",
+								Value: "csv",
+							},
+							{
+								Name:  "iCalendar",
+								Value: "ics",
+							},
 						},
-						{
-							Name:  "This Month",
-							Value: "month",
+					},
+					{
+						Type:         discordgo.ApplicationCommandOptionString,
+						Name:         "username",
+						Description:  "Filter by username",
+						Required:     false,
+						Autocomplete: true,
+					},
+				},
+			},
+			handler:      (*Bot).handleReport,
+			autocomplete: (*Bot).handleUsernameAutocomplete,
+		},
+		{
+			definition: &discordgo.ApplicationCommand{
+				Name:        "task",
+				Description: "Manage tasks",
+				Options: []*discordgo.ApplicationCommandOption{
+					{
+						Type:        discordgo.ApplicationCommandOptionSubCommand,
+						Name:        "update",
+						Description: "Update task status",
+						Options: []*discordgo.ApplicationCommandOption{
+							{
+								Type:         discordgo.ApplicationCommandOptionString,
+								Name:         "task",
+								Description:  "Select a task",
+								Required:     true,
+								Autocomplete: true,
+							},
+							{
+								Type:        discordgo.ApplicationCommandOptionString,
+								Name:        "status",
+								Description: "New task status",
+								Required:    true,
+								Choices: []*discordgo.ApplicationCommandOptionChoice{
+									{
+										Name:  "Open",
+										Value: "open",
+									},
+									{
+										Name:  "Completed",
+										Value: "completed",
+									},
+								},
+							},
+							{
+								Type:        discordgo.ApplicationCommandOptionBoolean,
+								Name:        "force",
+								Description: "Complete even if subtasks are still open (admin only)",
+								Required:    false,
+							},
 						},
-						{
-							Name:  "Last Month",
-							Value: "last_month",
+					},
+					{
+						Type:        discordgo.ApplicationCommandOptionSubCommand,
+						Name:        "search",
+						Description: "Search tasks by name, description and tags",
+						Options: []*discordgo.ApplicationCommandOption{
+							{
+								Type:        discordgo.ApplicationCommandOptionString,
+								Name:        "query",
+								Description: "Words to search for",
+								Required:    false,
+							},
+							{
+								Type:        discordgo.ApplicationCommandOptionString,
+								Name:        "status",
+								Description: "Filter by status",
+								Required:    false,
+								Choices: []*discordgo.ApplicationCommandOptionChoice{
+									{
+										Name:  "Open",
+										Value: "open",
+									},
+									{
+										Name:  "Completed",
+										Value: "completed",
+									},
+								},
+							},
+							{
+								Type:         discordgo.ApplicationCommandOptionString,
+								Name:         "username",
+								Description:  "Filter by owner",
+								Required:     false,
+								Autocomplete: true,
+							},
+							{
+								Type:        discordgo.ApplicationCommandOptionString,
+								Name:        "project",
+								Description: "Filter by project tag",
+								Required:    false,
+							},
+							{
+								Type:        discordgo.ApplicationCommandOptionString,
+								Name:        "from",
+								Description: "Created on or after (format: YYYY-MM-DD)",
+								Required:    false,
+							},
+							{
+								Type:        discordgo.ApplicationCommandOptionString,
+								Name:        "to",
+								Description: "Created on or before (format: YYYY-MM-DD)",
+								Required:    false,
+							},
+							{
+								Type:        discordgo.ApplicationCommandOptionInteger,
+								Name:        "page",
+								Description: "Result page (default 1)",
+								Required:    false,
+								MinValue:    &searchMinPage,
+							},
 						},
-						{
-							Name:  "2 Months Ago",
-							Value: "month_2",
+					},
+					{
+						Type:        discordgo.ApplicationCommandOptionSubCommand,
+						Name:        "archive",
+						Description: "Hide a task from suggestions while keeping its history",
+						Options: []*discordgo.ApplicationCommandOption{
+							{
+								Type:         discordgo.ApplicationCommandOptionString,
+								Name:         "task",
+								Description:  "Select a task",
+								Required:     true,
+								Autocomplete: true,
+							},
 						},
-						{
-							Name:  "3 Months Ago",
-							Value: "month_3",
+					},
+					{
+						Type:        discordgo.ApplicationCommandOptionSubCommand,
+						Name:        "archive-completed",
+						Description: "Archive all completed tasks with no activity for a number of days (admin only)",
+						Options: []*discordgo.ApplicationCommandOption{
+							{
+								Type:        discordgo.ApplicationCommandOptionInteger,
+								Name:        "days",
+								Description: "Days without activity",
+								Required:    true,
+								MinValue:    &archiveMinDays,
+							},
 						},
-						{
-							Name:  "4 Months Ago",
-							Value: "month_4",
+					},
+					{
+						Type:        discordgo.ApplicationCommandOptionSubCommand,
+						Name:        "merge",
+						Description: "Move all time from a duplicate task into another and remove it (admin only)",
+						Options: []*discordgo.ApplicationCommandOption{
+							{
+								Type:         discordgo.ApplicationCommandOptionString,
+								Name:         "source",
+								Description:  "Duplicate task to remove",
+								Required:     true,
+								Autocomplete: true,
+							},
+							{
+								Type:         discordgo.ApplicationCommandOptionString,
+								Name:         "target",
+								Description:  "Task to keep",
+								Required:     true,
+								Autocomplete: true,
+							},
 						},
-						{
-							Name:  "5 Months Ago",
-							Value: "month_5",
+					},
+					{
+						Type:        discordgo.ApplicationCommandOptionSubCommand,
+						Name:        "delete",
+						Description: "Permanently delete a task (admin only)",
+						Options: []*discordgo.ApplicationCommandOption{
+							{
+								Type:         discordgo.ApplicationCommandOptionString,
+								Name:         "task",
+								Description:  "Task to delete",
+								Required:     true,
+								Autocomplete: true,
+							},
+							{
+								Type:         discordgo.ApplicationCommandOptionString,
+								Name:         "reassign_to",
+								Description:  "Task that receives the deleted task's check-ins",
+								Required:     false,
+								Autocomplete: true,
+							},
 						},
-						{
-							Name:  "6 Months Ago",
-							Value: "month_6",
+					},
+				},
+			},
+			handler:      (*Bot).handleTask,
+			autocomplete: (*Bot).handleOptionAutocomplete,
+		},
+		{
+			definition: &discordgo.ApplicationCommand{
+				Name:        "globaltask",
+				Description: "Create a global task visible to everyone (admin only)",
+				Options: []*discordgo.ApplicationCommandOption{
+					{
+						Type:        discordgo.ApplicationCommandOptionString,
+						Name:        "name",
+						Description: "Task name",
+						Required:    true,
+					},
+					{
+						Type:        discordgo.ApplicationCommandOptionString,
+						Name:        "description",
+						Description: "Task description",
+						Required:    false,
+					},
+				},
+			},
+			handler: (*Bot).handleGlobalTask,
+			role:    models.RoleAdmin,
+		},
+		{
+			definition: &discordgo.ApplicationCommand{
+				Name:        "audit",
+				Description: "Show who changed tasks and check-ins (admin only)",
+				Options: []*discordgo.ApplicationCommandOption{
+					{
+						Type:         discordgo.ApplicationCommandOptionString,
+						Name:         "username",
+						Description:  "Filter by user",
+						Required:     false,
+						Autocomplete: true,
+					},
+					{
+						Type:         discordgo.ApplicationCommandOptionString,
+						Name:         "task",
+						Description:  "Filter by task",
+						Required:     false,
+						Autocomplete: true,
+					},
+					{
+						Type:        discordgo.ApplicationCommandOptionString,
+						Name:        "from",
+						Description: "Start date (format: YYYY-MM-DD)",
+						Required:    false,
+					},
+					{
+						Type:        discordgo.ApplicationCommandOptionString,
+						Name:        "to",
+						Description: "End date, inclusive (format: YYYY-MM-DD)",
+						Required:    false,
+					},
+					{
+						Type:        discordgo.ApplicationCommandOptionInteger,
+						Name:        "limit",
+						Description: "Maximum number of events (default 25)",
+						Required:    false,
+						MinValue:    &auditMinLimit,
+						MaxValue:    auditMaxLimit,
+					},
+				},
+			},
+			handler:      (*Bot).handleAudit,
+			autocomplete: (*Bot).handleOptionAutocomplete,
+			role:         models.RoleAdmin,
+		},
+		{
+			definition: &discordgo.ApplicationCommand{
+				Name:        "template",
+				Description: "Manage recurring global tasks (admin only)",
+				Options: []*discordgo.ApplicationCommandOption{
+					{
+						Type:        discordgo.ApplicationCommandOptionSubCommand,
+						Name:        "create",
+						Description: "Create a recurring task template",
+						Options: []*discordgo.ApplicationCommandOption{
+							{
+								Type:        discordgo.ApplicationCommandOptionString,
+								Name:        "name",
+								Description: "Task name",
+								Required:    true,
+								MaxLength:   templateNameMaxLength,
+							},
+							{
+								Type:        discordgo.ApplicationCommandOptionString,
+								Name:        "schedule",
+								Description: "When to create a fresh task",
+								Required:    true,
+								Choices:     templateSchedules,
+							},
+							{
+								Type:        discordgo.ApplicationCommandOptionString,
+								Name:        "description",
+								Description: "Task description",
+								Required:    false,
+							},
+						},
+					},
+					{
+						Type:        discordgo.ApplicationCommandOptionSubCommand,
+						Name:        "list",
+						Description: "List recurring task templates",
+					},
+					{
+						Type:        discordgo.ApplicationCommandOptionSubCommand,
+						Name:        "delete",
+						Description: "Stop a recurring task template",
+						Options: []*discordgo.ApplicationCommandOption{
+							{
+								Type:         discordgo.ApplicationCommandOptionString,
+								Name:         "template",
+								Description:  "Select a template",
+								Required:     true,
+								Autocomplete: true,
+							},
 						},
 					},
 				},
-				{
-					Type:        discordgo.ApplicationCommandOptionString,
-					Name:        "format",
-					Description: "Output format (CSV available for admins only)",
-					Required:    false,
-					Choices: []*discordgo.ApplicationCommandOptionChoice{
-						{
-							Name:  "Text",
-							Value: "text",
+			},
+			handler:      (*Bot).handleTemplate,
+			autocomplete: (*Bot).handleTemplateAutocomplete,
+			role:         models.RoleAdmin,
+		},
+		{
+			definition: &discordgo.ApplicationCommand{
+				Name:        "roles",
+				Description: "Map Discord roles to bot roles (admin only)",
+				Options: []*discordgo.ApplicationCommandOption{
+					{
+						Type:        discordgo.ApplicationCommandOptionSubCommand,
+						Name:        "set",
+						Description: "Grant a bot role to members with a Discord role",
+						Options: []*discordgo.ApplicationCommandOption{
+							{
+								Type:        discordgo.ApplicationCommandOptionRole,
+								Name:        "role",
+								Description: "Discord role",
+								Required:    true,
+							},
+							{
+								Type:        discordgo.ApplicationCommandOptionString,
+								Name:        "level",
+								Description: "Bot role to grant",
+								Required:    true,
+								Choices:     botRoleChoices,
+							},
 						},
-						{
-							Name:  "CSV",
-							Value: "csv",
+					},
+					{
+						Type:        discordgo.ApplicationCommandOptionSubCommand,
+						Name:        "remove",
+						Description: "Remove the mapping of a Discord role",
+						Options: []*discordgo.ApplicationCommandOption{
+							{
+								Type:        discordgo.ApplicationCommandOptionRole,
+								Name:        "role",
+								Description: "Discord role",
+								Required:    true,
+							},
 						},
 					},
+					{
+						Type:        discordgo.ApplicationCommandOptionSubCommand,
+						Name:        "list",
+						Description: "List role mappings",
+					},
 				},
-				{
-					Type:         discordgo.ApplicationCommandOptionString,
-					Name:         "username",
-					Description:  "Filter by username",
-					Required:     false,
-					Autocomplete: true,
+			},
+			handler: (*Bot).handleRoles,
+			role:    models.RoleAdmin,
+		},
+		{
+			definition: &discordgo.ApplicationCommand{
+				Name:        "team",
+				Description: "Manage teams whose reports leads can see (admin only)",
+				Options: []*discordgo.ApplicationCommandOption{
+					{
+						Type:        discordgo.ApplicationCommandOptionSubCommand,
+						Name:        "create",
+						Description: "Create a team, optionally following a Discord role",
+						Options: []*discordgo.ApplicationCommandOption{
+							{
+								Type:        discordgo.ApplicationCommandOptionString,
+								Name:        "name",
+								Description: "Team name",
+								Required:    true,
+								MaxLength:   64,
+							},
+							{
+								Type:        discordgo.ApplicationCommandOptionRole,
+								Name:        "role",
+								Description: "Everyone with this Discord role is in the team",
+								Required:    false,
+							},
+						},
+					},
+					{
+						Type:        discordgo.ApplicationCommandOptionSubCommand,
+						Name:        "delete",
+						Description: "Delete a team",
+						Options: []*discordgo.ApplicationCommandOption{
+							{
+								Type:         discordgo.ApplicationCommandOptionString,
+								Name:         "team",
+								Description:  "Select a team",
+								Required:     true,
+								Autocomplete: true,
+							},
+						},
+					},
+					{
+						Type:        discordgo.ApplicationCommandOptionSubCommand,
+						Name:        "add",
+						Description: "Add a user to a team",
+						Options: []*discordgo.ApplicationCommandOption{
+							{
+								Type:         discordgo.ApplicationCommandOptionString,
+								Name:         "team",
+								Description:  "Select a team",
+								Required:     true,
+								Autocomplete: true,
+							},
+							{
+								Type:         discordgo.ApplicationCommandOptionString,
+								Name:         "username",
+								Description:  "User to add",
+								Required:     true,
+								Autocomplete: true,
+							},
+						},
+					},
+					{
+						Type:        discordgo.ApplicationCommandOptionSubCommand,
+						Name:        "remove",
+						Description: "Remove a user from a team",
+						Options: []*discordgo.ApplicationCommandOption{
+							{
+								Type:         discordgo.ApplicationCommandOptionString,
+								Name:         "team",
+								Description:  "Select a team",
+								Required:     true,
+								Autocomplete: true,
+							},
+							{
+								Type:         discordgo.ApplicationCommandOptionString,
+								Name:         "username",
+								Description:  "User to remove",
+								Required:     true,
+								Autocomplete: true,
+							},
+						},
+					},
+					{
+						Type:        discordgo.ApplicationCommandOptionSubCommand,
+						Name:        "list",
+						Description: "List teams",
+					},
 				},
 			},
+			handler:      (*Bot).handleTeam,
+			autocomplete: (*Bot).handleTeamAutocomplete,
+			role:         models.RoleAdmin,
 		},
 		{
-			Name:        "task",
-			Description: "Update task status",
-			Options: []*discordgo.ApplicationCommandOption{
-				{
-					Type:         discordgo.ApplicationCommandOptionString,
-					Name:         "task",
-					Description:  "Select a task",
-					Required:     true,
-					Autocomplete: true,
+			definition: &discordgo.ApplicationCommand{
+				Name:        "logchannel",
+				Description: "Post bot errors and admin actions to a channel (admin only)",
+				Options: []*discordgo.ApplicationCommandOption{
+					{
+						Type:        discordgo.ApplicationCommandOptionSubCommand,
+						Name:        "set",
+						Description: "Choose the log channel and which events go there",
+						Options: append([]*discordgo.ApplicationCommandOption{
+							{
+								Type:         discordgo.ApplicationCommandOptionChannel,
+								Name:         "channel",
+								Description:  "Channel to post to",
+								Required:     true,
+								ChannelTypes: []discordgo.ChannelType{discordgo.ChannelTypeGuildText},
+							},
+						}, logCategoryOptions()...),
+					},
+					{
+						Type:        discordgo.ApplicationCommandOptionSubCommand,
+						Name:        "off",
+						Description: "Stop posting to the log channel",
+					},
+					{
+						Type:        discordgo.ApplicationCommandOptionSubCommand,
+						Name:        "show",
+						Description: "Show the log channel settings",
+					},
 				},
-				{
-					Type:        discordgo.ApplicationCommandOptionString,
-					Name:        "status",
-					Description: "New task status",
-					Required:    true,
-					Choices: []*discordgo.ApplicationCommandOptionChoice{
-						{
-							Name:  "Open",
-							Value: "open",
+			},
+			handler: (*Bot).handleLogChannel,
+			role:    models.RoleAdmin,
+		},
+		{
+			definition: &discordgo.ApplicationCommand{
+				Name:        "apitoken",
+				Description: "Manage tokens for the HTTP API",
+				Options: []*discordgo.ApplicationCommandOption{
+					{
+						Type:        discordgo.ApplicationCommandOptionSubCommand,
+						Name:        "create",
+						Description: "Create a token for this server; it is shown once",
+						Options: []*discordgo.ApplicationCommandOption{
+							{
+								Type:        discordgo.ApplicationCommandOptionString,
+								Name:        "name",
+								Description: "What the token is for, e.g. billing",
+								Required:    true,
+								MaxLength:   100,
+							},
+							{
+								Type:        discordgo.ApplicationCommandOptionString,
+								Name:        "access",
+								Description: "What the token may do (default: read my own data)",
+								Required:    false,
+								Choices:     apiTokenAccessChoices(),
+							},
+							{
+								Type:        discordgo.ApplicationCommandOptionInteger,
+								Name:        "expires",
+								Description: "How long the token is valid (default: 90 days)",
+								Required:    false,
+								Choices:     apiTokenLifetimes,
+							},
 						},
-						{
-							Name:  "Completed",
-							Value: "completed",
+					},
+					{
+						Type:        discordgo.ApplicationCommandOptionSubCommand,
+						Name:        "list",
+						Description: "List your tokens, or every token in the server for admins",
+					},
+					{
+						Type:        discordgo.ApplicationCommandOptionSubCommand,
+						Name:        "revoke",
+						Description: "Revoke a token",
+						Options: []*discordgo.ApplicationCommandOption{
+							{
+								Type:         discordgo.ApplicationCommandOptionString,
+								Name:         "token",
+								Description:  "Select a token",
+								Required:     true,
+								Autocomplete: true,
+							},
 						},
 					},
 				},
 			},
+			handler:      (*Bot).handleAPIToken,
+			autocomplete: (*Bot).handleAPITokenAutocomplete,
 		},
 		{
-			Name:                     "globaltask",
-			Description:              "Create a global task visible to everyone (admin only)",
-			DefaultMemberPermissions: &adminPermission,
-			Options: []*discordgo.ApplicationCommandOption{
-				{
-					Type:        discordgo.ApplicationCommandOptionString,
-					Name:        "name",
-					Description: "Task name",
-					Required:    true,
-				},
-				{
-					Type:        discordgo.ApplicationCommandOptionString,
-					Name:        "description",
-					Description: "Task description",
-					Required:    false,
+			definition: &discordgo.ApplicationCommand{
+				Name:        "webhook",
+				Description: "Send check-in and task events to other systems",
+				Options: []*discordgo.ApplicationCommandOption{
+					{
+						Type:        discordgo.ApplicationCommandOptionSubCommand,
+						Name:        "add",
+						Description: "Add a webhook; its signing secret is shown once",
+						Options: []*discordgo.ApplicationCommandOption{
+							{
+								Type:        discordgo.ApplicationCommandOptionString,
+								Name:        "url",
+								Description: "URL that events are posted to",
+								Required:    true,
+							},
+							{
+								Type:        discordgo.ApplicationCommandOptionString,
+								Name:        "events",
+								Description: "Events to send (default: all)",
+								Required:    false,
+								Choices:     webhookSubscriptionChoices(),
+							},
+						},
+					},
+					{
+						Type:        discordgo.ApplicationCommandOptionSubCommand,
+						Name:        "list",
+						Description: "List webhooks and their delivery status",
+					},
+					{
+						Type:        discordgo.ApplicationCommandOptionSubCommand,
+						Name:        "remove",
+						Description: "Remove a webhook and drop its pending deliveries",
+						Options: []*discordgo.ApplicationCommandOption{
+							{
+								Type:         discordgo.ApplicationCommandOptionString,
+								Name:         "webhook",
+								Description:  "Select a webhook",
+								Required:     true,
+								Autocomplete: true,
+							},
+						},
+					},
+					{
+						Type:        discordgo.ApplicationCommandOptionSubCommand,
+						Name:        "test",
+						Description: "Send a ping event to a webhook",
+						Options: []*discordgo.ApplicationCommandOption{
+							{
+								Type:         discordgo.ApplicationCommandOptionString,
+								Name:         "webhook",
+								Description:  "Select a webhook",
+								Required:     true,
+								Autocomplete: true,
+							},
+						},
+					},
 				},
 			},
+			handler:      (*Bot).handleWebhook,
+			autocomplete: (*Bot).handleWebhookAutocomplete,
+			role:         models.RoleAdmin,
 		},
 	}
 
-	// Permission for admin commands (Manage Server permission)
-	adminPermission = int64(discordgo.PermissionManageServer)
+	// Bounds for the /audit limit option
+	auditMinLimit = float64(1)
+
+	// Lower bound for the /task search page option
+	searchMinPage = float64(1)
+
+	// Lower bound for the /task archive-completed days option
+	archiveMinDays = float64(1)
 )
 
-func (b *Bot) handleAutocomplete(s *discordgo.Session, i *discordgo.InteractionCreate) {
-	switch i.ApplicationCommandData().Name {
-	case "checkin", "task", "declare":
-		b.handleTaskAutocomplete(s, i)
-	case "report":
-		b.handleUsernameAutocomplete(s, i)
+func (b *Bot) handleAutocomplete(s Session, i *discordgo.InteractionCreate) {
+	cmd := findCommand(i.ApplicationCommandData().Name)
+	if cmd == nil || cmd.autocomplete == nil {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(b.ctx, autocompleteTimeout)
+	defer cancel()
+
+	// Don't leak suggestions to users who cannot run the command
+	role := b.memberRole(ctx, s, i.GuildID, interactionUserID(i))
+	if !role.AtLeast(cmd.requiredRole()) {
+		return
+	}
+
+	cmd.autocomplete(b, withRole(ctx, role), s, i)
+}
+
+// handleOptionAutocomplete suggests users for options named "username" and tasks
+// for every other option
+func (b *Bot) handleOptionAutocomplete(ctx context.Context, s Session, i *discordgo.InteractionCreate) {
+	focused := focusedOption(i.ApplicationCommandData().Options)
+	if focused == nil {
+		return
+	}
+	if focused.Name == "username" {
+		b.handleUsernameAutocomplete(ctx, s, i)
+	} else {
+		b.handleTaskAutocomplete(ctx, s, i)
+	}
+}
+
+// serverWideTaskOptions are the admin-only task options, by optionPath, whose
+// autocomplete offers every task in the server
+var serverWideTaskOptions = map[string]bool{
+	"task merge source":       true,
+	"task merge target":       true,
+	"task delete task":        true,
+	"task delete reassign_to": true,
+	"audit task":              true,
+}
+
+// optionPath names an option by its command, subcommand if any, and name, such
+// as "task merge source"
+func optionPath(i *discordgo.InteractionCreate, opt *discordgo.ApplicationCommandInteractionDataOption) string {
+	data := i.ApplicationCommandData()
+	path := data.Name
+	if len(data.Options) > 0 && data.Options[0].Type == discordgo.ApplicationCommandOptionSubCommand {
+		path += " " + data.Options[0].Name
+	}
+	return path + " " + opt.Name
+}
+
+// focusedOption returns the option currently being typed, looking inside subcommands
+func focusedOption(options []*discordgo.ApplicationCommandInteractionDataOption) *discordgo.ApplicationCommandInteractionDataOption {
+	for _, opt := range options {
+		if opt.Focused {
+			return opt
+		}
+		if found := focusedOption(opt.Options); found != nil {
+			return found
+		}
 	}
+	return nil
 }
 
-func (b *Bot) handleTaskAutocomplete(s *discordgo.Session, i *discordgo.InteractionCreate) {
+func (b *Bot) handleTaskAutocomplete(ctx context.Context, s Session, i *discordgo.InteractionCreate) {
 	// Get the user's tasks for autocomplete
-	user, err := b.getUserFromInteraction(s, i)
+	user, err := b.getUserFromInteraction(ctx, s, i)
 	if err != nil || user == nil {
-		log.Printf("Error getting user from interaction: %v", err)
+		interactionLogger(i).Error("Error getting user from interaction", "error", err)
 		return
 	}
 
 	// Check if user is admin
 	if i == nil || i.Member == nil || i.Member.User == nil {
-		log.Printf("Interaction or member is nil")
+		slog.Warn("Task autocomplete without a guild member")
 		return
 	}
-	isUserAdmin := isAdmin(s, i.GuildID, i.Member.User.ID)
+	isUserAdmin := b.isAdmin(ctx, s, i)
 
 	// Get active check-in to filter out active task
 	var activeTaskID *uuid.UUID
 	if i.ApplicationCommandData().Name == "checkin" {
-		activeCheckIn, err := b.db.GetActiveCheckIn(user.ID, i.GuildID)
+		activeCheckIn, err := b.db.GetActiveCheckIn(ctx, user.ID, i.GuildID)
 		if err != nil {
-			log.Printf("Error getting active check-in: %v", err)
+			interactionLogger(i).Error("Error getting active check-in", "error", err)
 			return
 		}
 		if activeCheckIn != nil {
@@ -257,39 +904,43 @@ func (b *Bot) handleTaskAutocomplete(s *discordgo.Session, i *discordgo.Interact
 		}
 	}
 
-	tasks, err := b.db.GetUserTasks(user.ID, i.GuildID)
-	if err != nil {
-		log.Printf("Error getting tasks for autocomplete: %v", err)
+	// Get the current input value
+	focused := focusedOption(i.ApplicationCommandData().Options)
+	if focused == nil {
 		return
 	}
 
-	// Get the current input value
-	var focusedOption *discordgo.ApplicationCommandInteractionDataOption
-	if i.ApplicationCommandData().Name == "checkin" {
-		// For checkin command, the task option is nested under the "existing" subcommand
-		if len(i.ApplicationCommandData().Options) > 0 && len(i.ApplicationCommandData().Options[0].Options) > 0 {
-			focusedOption = i.ApplicationCommandData().Options[0].Options[0]
-		}
+	// Admin-only options offer every task in the server, not just the admin's own
+	serverWide := isUserAdmin && serverWideTaskOptions[optionPath(i, focused)]
+
+	var usages []*models.TaskUsage
+	if serverWide {
+		usages, err = b.db.GetServerTaskSuggestions(ctx, i.GuildID)
 	} else {
-		// For task and declare commands, the task option is directly in the options
-		if len(i.ApplicationCommandData().Options) > 0 {
-			focusedOption = i.ApplicationCommandData().Options[0]
-		}
+		usages, err = b.db.GetTaskSuggestions(ctx, user.ID, i.GuildID)
 	}
-
-	if focusedOption == nil {
+	if err != nil {
+		interactionLogger(i).Error("Error getting tasks for autocomplete", "error", err)
 		return
 	}
 
-	input := strings.ToLower(focusedOption.StringValue())
+	// Rank matching tasks by usage and match quality
+	ranked := rankTaskSuggestions(usages, focused.StringValue(), time.Now())
 
 	// Filter and create choices
 	var choices []*discordgo.ApplicationCommandOptionChoice
-	for _, task := range tasks {
+	for _, usage := range ranked {
+		task := usage.Task
+
+		// For the parent option, only offer open top-level tasks
+		if focused.Name == "parent" && (task.ParentID != nil || task.Completed) {
+			continue
+		}
+
 		// For checkin command:
 		// - Skip completed tasks
 		// - Skip currently active task
-		if i.ApplicationCommandData().Name == "checkin" {
+		if i.ApplicationCommandData().Name == "checkin" && focused.Name == "task" {
 			if task.Completed {
 				continue
 			}
@@ -305,23 +956,29 @@ func (b *Bot) handleTaskAutocomplete(s *discordgo.Session, i *discordgo.Interact
 			}
 		}
 
-		if strings.Contains(strings.ToLower(task.Name), input) {
-			// Add task status to the name for /task command
-			displayName := task.Name
-			if i.ApplicationCommandData().Name == "task" {
-				if task.Global {
-					displayName = fmt.Sprintf("%s [Global]", task.Name)
-				}
-				if task.Completed {
-					displayName = fmt.Sprintf("%s (Completed)", displayName)
-				}
+		// Add task status to the name for /task command
+		displayName := taskLabel(usage)
+		if i.ApplicationCommandData().Name == "task" {
+			if task.Global {
+				displayName = fmt.Sprintf("%s [Global]", displayName)
+			}
+			if task.Completed {
+				displayName = fmt.Sprintf("%s (Completed)", displayName)
 			}
-
-			choices = append(choices, &discordgo.ApplicationCommandOptionChoice{
-				Name:  displayName,
-				Value: task.ID.String(),
-			})
 		}
+		if serverWide {
+			if !task.Global && task.UserID != user.ID {
+				displayName = fmt.Sprintf("%s (%s)", displayName, usage.OwnerName)
+			}
+			if task.ArchivedAt != nil {
+				displayName = fmt.Sprintf("%s (Archived)", displayName)
+			}
+		}
+
+		choices = append(choices, &discordgo.ApplicationCommandOptionChoice{
+			Name:  choiceLabel(displayName),
+			Value: task.ID.String(),
+		})
 		if len(choices) >= 25 { // Discord limit
 			break
 		}
@@ -335,28 +992,41 @@ func (b *Bot) handleTaskAutocomplete(s *discordgo.Session, i *discordgo.Interact
 	})
 }
 
-func (b *Bot) handleUsernameAutocomplete(s *discordgo.Session, i *discordgo.InteractionCreate) {
-	// Get all users who have any activity
-	users, err := b.db.GetAllUsers()
-	if err != nil {
-		logError(s, i.ChannelID, "GetAllUsers", err.Error())
+// handleUsernameAutocomplete suggests the users of the guild. Admins get everyone;
+// others only the users whose details they may see in reports.
+func (b *Bot) handleUsernameAutocomplete(ctx context.Context, s Session, i *discordgo.InteractionCreate) {
+	// Get the current input value
+	focused := focusedOption(i.ApplicationCommandData().Options)
+	if focused == nil || focused.Name != "username" {
 		return
 	}
 
-	// Get the current input value
-	var focusedOption *discordgo.ApplicationCommandInteractionDataOption
-	for _, opt := range i.ApplicationCommandData().Options {
-		if opt.Name == "username" && opt.Focused {
-			focusedOption = opt
-			break
-		}
+	users, err := b.db.GetGuildUsers(ctx, i.GuildID)
+	if err != nil {
+		b.logError(i, "GetGuildUsers", err)
+		return
 	}
 
-	if focusedOption == nil {
-		return
+	if !b.isAdmin(ctx, s, i) {
+		caller, err := b.db.GetUserByDiscordID(ctx, interactionUserID(i))
+		if err != nil || caller == nil {
+			return
+		}
+		visibility, err := b.reportVisibility(ctx, s, i, caller, users)
+		if err != nil {
+			interactionLogger(i).Error("Error resolving autocomplete visibility", "error", err)
+			return
+		}
+		var visible []*models.User
+		for _, user := range users {
+			if visibility.canSee(user.ID) {
+				visible = append(visible, user)
+			}
+		}
+		users = visible
 	}
 
-	input := strings.ToLower(focusedOption.StringValue())
+	input := strings.ToLower(focused.StringValue())
 
 	// Filter and create choices
 	var choices []*discordgo.ApplicationCommandOptionChoice
@@ -379,36 +1049,23 @@ func (b *Bot) handleUsernameAutocomplete(s *discordgo.Session, i *discordgo.Inte
 		},
 	})
 	if err != nil {
-		log.Printf("Error responding to autocomplete: %v", err)
+		interactionLogger(i).Error("Error responding to autocomplete", "error", err)
 	}
 }
 
-func (b *Bot) handleCheckin(s *discordgo.Session, i *discordgo.InteractionCreate) {
+func (b *Bot) handleCheckin(ctx context.Context, s Session, i *discordgo.InteractionCreate) {
 	// Validate interaction data
 	if i.ApplicationCommandData().Options == nil || len(i.ApplicationCommandData().Options) == 0 {
 		respondWithError(s, i, "Invalid command options")
 		return
 	}
 
-	// Get user information, handling both DM and guild contexts
-	var userID, username string
-	if i.Member != nil && i.Member.User != nil {
-		userID = i.Member.User.ID
-		username = i.Member.User.Username
-	} else if i.User != nil {
-		userID = i.User.ID
-		username = i.User.Username
-	} else {
+	// Check-ins work in both DM and guild contexts, but always need a user
+	if interactionUserID(i) == "" {
 		respondWithError(s, i, "Could not determine user information")
 		return
 	}
 
-	// Log the interaction context
-	log.Printf("Processing command for user %s (ID: %s) in context: %s",
-		username,
-		userID,
-		map[bool]string{true: "DM", false: "Guild"}[i.Member == nil])
-
 	subcommand := i.ApplicationCommandData().Options[0]
 	if subcommand == nil {
 		respondWithError(s, i, "Invalid subcommand")
@@ -429,10 +1086,11 @@ func (b *Bot) handleCheckin(s *discordgo.Session, i *discordgo.InteractionCreate
 
 	var task *models.Task
 	var err error
+	var hint string
 
-	user, err := b.getUserFromInteraction(s, i)
+	user, err := b.getUserFromInteraction(ctx, s, i)
 	if err != nil || user == nil {
-		log.Printf("Error getting user from interaction: %v", err)
+		interactionLogger(i).Error("Error getting user from interaction", "error", err)
 		respondWithError(s, i, "Could not get user information")
 		return
 	}
@@ -450,7 +1108,7 @@ func (b *Bot) handleCheckin(s *discordgo.Session, i *discordgo.InteractionCreate
 			return
 		}
 
-		task, err = b.db.GetTaskByID(taskID)
+		task, err = b.db.GetTaskByID(ctx, taskID)
 		if err != nil {
 			respondWithError(s, i, "Error getting task: "+err.Error())
 			return
@@ -459,6 +1117,10 @@ func (b *Bot) handleCheckin(s *discordgo.Session, i *discordgo.InteractionCreate
 			respondWithError(s, i, "Task not found")
 			return
 		}
+		if task.ArchivedAt != nil {
+			respondWithError(s, i, "Task is archived")
+			return
+		}
 
 	case "new":
 		if len(options) == 0 {
@@ -466,51 +1128,80 @@ func (b *Bot) handleCheckin(s *discordgo.Session, i *discordgo.InteractionCreate
 			return
 		}
 
-		taskName := options[0].StringValue()
-		var description string
-		if len(options) > 1 {
-			description = options[1].StringValue()
+		var taskName, description string
+		var parentID *uuid.UUID
+		for _, opt := range options {
+			switch opt.Name {
+			case "name":
+				taskName = opt.StringValue()
+			case "description":
+				description = opt.StringValue()
+			case "parent":
+				id, err := uuid.Parse(opt.StringValue())
+				if err != nil {
+					respondWithError(s, i, "Invalid parent task ID")
+					return
+				}
+				parentID = &id
+			}
+		}
+
+		if parentID != nil {
+			parent, err := b.db.GetTaskByID(ctx, *parentID)
+			if err != nil {
+				respondWithError(s, i, "Error getting parent task: "+err.Error())
+				return
+			}
+			if parent == nil || parent.ServerID != i.GuildID || (!parent.Global && parent.UserID != user.ID) {
+				respondWithError(s, i, "Parent task not found")
+				return
+			}
+			if parent.ParentID != nil {
+				respondWithError(s, i, "Subtasks cannot have their own subtasks")
+				return
+			}
+			if parent.Completed || parent.ArchivedAt != nil {
+				respondWithError(s, i, "Cannot add a subtask to a completed or archived task")
+				return
+			}
 		}
 
 		task = &models.Task{
 			ID:          uuid.New(),
 			UserID:      user.ID,
 			ServerID:    i.GuildID,
+			ParentID:    parentID,
 			Name:        taskName,
 			Description: description,
 			CreatedAt:   time.Now(),
 		}
 
-		if err := b.db.CreateTask(task); err != nil {
-			logError(s, i.ChannelID, "CreateTask", err.Error())
+		// Warn when a task with a near-identical name already exists
+		existing, err := b.db.GetUserTasks(ctx, user.ID, i.GuildID)
+		if err != nil {
+			interactionLogger(i).Error("Error getting tasks for duplicate check", "error", err)
+		}
+		for _, t := range existing {
+			if similarTaskNames(t.Name, taskName) {
+				hint = fmt.Sprintf("\nNote: a similar task '%s' already exists. Use `/checkin existing` to log time to it.", t.Name)
+				break
+			}
+		}
+
+		if err := b.db.CreateTask(ctx, task); err != nil {
+			b.logError(i, "CreateTask", err)
 			respondWithError(s, i, "Error creating task: "+err.Error())
 			return
 		}
+		b.publish(ctx, task.ServerID)
 	default:
 		respondWithError(s, i, "Invalid subcommand")
 		return
 	}
 
-	logCommand(s, i, "checkin")
+	logCommand(i, "checkin")
 
-	// Check for active check-in
-	activeCheckIn, err := b.db.GetActiveCheckIn(user.ID, i.GuildID)
-	if err != nil {
-		logError(s, i.ChannelID, "GetActiveCheckIn", err.Error())
-		respondWithError(s, i, "Error checking active tasks: "+err.Error())
-		return
-	}
-
-	// If there's an active check-in, check out first
-	if activeCheckIn != nil {
-		if err := b.db.CheckOut(activeCheckIn.ID); err != nil {
-			logError(s, i.ChannelID, "CheckOut", err.Error())
-			respondWithError(s, i, "Error checking out from previous task: "+err.Error())
-			return
-		}
-	}
-
-	// Create check-in record
+	// Check out of any active task and start the new one in a single transaction
 	checkIn := &models.CheckIn{
 		ID:        uuid.New(),
 		UserID:    user.ID,
@@ -519,28 +1210,34 @@ func (b *Bot) handleCheckin(s *discordgo.Session, i *discordgo.InteractionCreate
 		StartTime: time.Now(),
 	}
 
-	if err := b.db.CreateCheckIn(checkIn); err != nil {
-		logError(s, i.ChannelID, "CreateCheckIn", err.Error())
+	_, err = b.db.SwitchCheckIn(ctx, checkIn)
+	if err != nil {
+		if errors.Is(err, db.ErrActiveCheckInConflict) || errors.Is(err, db.ErrCheckInNotActive) {
+			respondWithError(s, i, "Your active task changed while checking in. Please try again.")
+			return
+		}
+		b.logError(i, "SwitchCheckIn", err)
 		respondWithError(s, i, "Error creating check-in: "+err.Error())
 		return
 	}
+	b.publish(ctx, checkIn.ServerID)
 
-	respondWithSuccess(s, i, fmt.Sprintf("Started working on task: %s", task.Name))
+	respondWithSuccess(s, i, fmt.Sprintf("Started working on task: %s%s", task.Name, hint))
 }
 
-func (b *Bot) handleCheckout(s *discordgo.Session, i *discordgo.InteractionCreate) {
-	logCommand(s, i, "checkout")
+func (b *Bot) handleCheckout(ctx context.Context, s Session, i *discordgo.InteractionCreate) {
+	logCommand(i, "checkout")
 
-	user, err := b.getUserFromInteraction(s, i)
+	user, err := b.getUserFromInteraction(ctx, s, i)
 	if err != nil || user == nil {
-		log.Printf("Error getting user from interaction: %v", err)
+		interactionLogger(i).Error("Error getting user from interaction", "error", err)
 		return
 	}
 
 	// Get active check-in
-	activeCheckIn, err := b.db.GetActiveCheckIn(user.ID, i.GuildID)
+	activeCheckIn, err := b.db.GetActiveCheckIn(ctx, user.ID, i.GuildID)
 	if err != nil {
-		logError(s, i.ChannelID, "GetActiveCheckIn", err.Error())
+		b.logError(i, "GetActiveCheckIn", err)
 		respondWithError(s, i, "Error checking active tasks: "+err.Error())
 		return
 	}
@@ -551,42 +1248,47 @@ func (b *Bot) handleCheckout(s *discordgo.Session, i *discordgo.InteractionCreat
 	}
 
 	// Get task details
-	task, err := b.db.GetTaskByID(activeCheckIn.TaskID)
+	task, err := b.db.GetTaskByID(ctx, activeCheckIn.TaskID)
 	if err != nil {
-		logError(s, i.ChannelID, "GetTaskByID", err.Error())
+		b.logError(i, "GetTaskByID", err)
 		respondWithError(s, i, "Error retrieving task details: "+err.Error())
 		return
 	}
 
 	// Check out
-	if err := b.db.CheckOut(activeCheckIn.ID); err != nil {
+	if err := b.db.CheckOut(ctx, activeCheckIn.ID); err != nil {
+		if errors.Is(err, db.ErrCheckInNotActive) {
+			respondWithError(s, i, "No active task to check out from")
+			return
+		}
 		respondWithError(s, i, "Error checking out: "+err.Error())
 		return
 	}
 
 	// Get the updated check-in to get the actual end time
-	updatedCheckIn, err := b.db.GetCheckInByID(activeCheckIn.ID)
+	updatedCheckIn, err := b.db.GetCheckInByID(ctx, activeCheckIn.ID)
 	if err != nil {
 		respondWithError(s, i, "Error retrieving checkout details: "+err.Error())
 		return
 	}
+	b.publish(ctx, updatedCheckIn.ServerID)
 
 	duration := updatedCheckIn.EndTime.Sub(updatedCheckIn.StartTime)
 	respondWithSuccess(s, i, fmt.Sprintf("Checked out from task: %s\nTime spent: %s", task.Name, formatDuration(duration)))
 }
 
-func (b *Bot) handleStatus(s *discordgo.Session, i *discordgo.InteractionCreate) {
-	logCommand(s, i, "status")
+func (b *Bot) handleStatus(ctx context.Context, s Session, i *discordgo.InteractionCreate) {
+	logCommand(i, "status")
 
 	// Get all active check-ins for this server
-	activeCheckIns, err := b.db.GetAllActiveCheckIns(i.GuildID)
+	activeCheckIns, err := b.db.GetAllActiveCheckIns(ctx, i.GuildID)
 	if err != nil {
 		respondWithError(s, i, "Error retrieving active check-ins: "+err.Error())
 		return
 	}
 
 	// Get all users in this guild
-	allUsers, err := b.db.GetGuildUsers(i.GuildID)
+	allUsers, err := b.db.GetGuildUsers(ctx, i.GuildID)
 	if err != nil {
 		respondWithError(s, i, "Error retrieving users: "+err.Error())
 		return
@@ -613,7 +1315,7 @@ func (b *Bot) handleStatus(s *discordgo.Session, i *discordgo.InteractionCreate)
 		}
 		processedUsers[user.ID] = true
 
-		task, err := b.db.GetTaskByID(checkIn.CheckIn.TaskID)
+		task, err := b.db.GetTaskByID(ctx, checkIn.CheckIn.TaskID)
 		if err != nil {
 			continue
 		}
@@ -640,8 +1342,37 @@ func (b *Bot) handleStatus(s *discordgo.Session, i *discordgo.InteractionCreate)
 	respondWithSuccess(s, i, "```\n"+response.String()+"```")
 }
 
-func (b *Bot) handleTask(s *discordgo.Session, i *discordgo.InteractionCreate) {
-	options := i.ApplicationCommandData().Options
+func (b *Bot) handleTask(ctx context.Context, s Session, i *discordgo.InteractionCreate) {
+	if len(i.ApplicationCommandData().Options) == 0 {
+		respondWithError(s, i, "Invalid command options")
+		return
+	}
+
+	subcommand := i.ApplicationCommandData().Options[0]
+	switch subcommand.Name {
+	case "update":
+		b.handleTaskUpdate(ctx, s, i, subcommand.Options)
+	case "search":
+		b.handleTaskSearch(ctx, s, i, subcommand.Options)
+	case "archive":
+		b.handleTaskArchive(ctx, s, i, subcommand.Options)
+	case "archive-completed":
+		b.handleTaskArchiveCompleted(ctx, s, i, subcommand.Options)
+	case "delete":
+		b.handleTaskDelete(ctx, s, i, subcommand.Options)
+	case "merge":
+		b.handleTaskMerge(ctx, s, i, subcommand.Options)
+	default:
+		respondWithError(s, i, "Invalid subcommand")
+	}
+}
+
+func (b *Bot) handleTaskUpdate(ctx context.Context, s Session, i *discordgo.InteractionCreate, options []*discordgo.ApplicationCommandInteractionDataOption) {
+	if len(options) < 2 {
+		respondWithError(s, i, "Missing required options")
+		return
+	}
+
 	taskID, err := uuid.Parse(options[0].StringValue())
 	if err != nil {
 		respondWithError(s, i, "Invalid task ID")
@@ -651,15 +1382,22 @@ func (b *Bot) handleTask(s *discordgo.Session, i *discordgo.InteractionCreate) {
 	newStatus := options[1].StringValue()
 	completed := newStatus == "completed"
 
+	force := false
+	for _, opt := range options[2:] {
+		if opt.Name == "force" {
+			force = opt.BoolValue()
+		}
+	}
+
 	// Get the user to verify ownership
-	user, err := b.getUserFromInteraction(s, i)
+	user, err := b.getUserFromInteraction(ctx, s, i)
 	if err != nil || user == nil {
-		log.Printf("Error getting user from interaction: %v", err)
+		interactionLogger(i).Error("Error getting user from interaction", "error", err)
 		return
 	}
 
 	// Get the task
-	task, err := b.db.GetTaskByID(taskID)
+	task, err := b.db.GetTaskByID(ctx, taskID)
 	if err != nil {
 		respondWithError(s, i, "Error getting task: "+err.Error())
 		return
@@ -669,17 +1407,17 @@ func (b *Bot) handleTask(s *discordgo.Session, i *discordgo.InteractionCreate) {
 		return
 	}
 
-	logCommand(s, i, "task")
+	logCommand(i, "task")
 
 	// Check if user is admin or task owner
-	isUserAdmin := isAdmin(s, i.GuildID, i.Member.User.ID)
+	isUserAdmin := b.isAdmin(ctx, s, i)
 	if !isUserAdmin && task.UserID != user.ID {
 		respondWithError(s, i, "You can only update your own tasks")
 		return
 	}
 
 	// Check if task is currently active
-	activeCheckIn, err := b.db.GetActiveCheckIn(user.ID, i.GuildID)
+	activeCheckIn, err := b.db.GetActiveCheckIn(ctx, user.ID, i.GuildID)
 	if err != nil {
 		respondWithError(s, i, "Error checking active tasks: "+err.Error())
 		return
@@ -690,11 +1428,28 @@ func (b *Bot) handleTask(s *discordgo.Session, i *discordgo.InteractionCreate) {
 		return
 	}
 
+	// Block completion while subtasks are open unless an admin forces it
+	if completed {
+		openSubtasks, err := b.db.CountOpenSubtasks(ctx, taskID)
+		if err != nil {
+			respondWithError(s, i, "Error checking subtasks: "+err.Error())
+			return
+		}
+		if openSubtasks > 0 && !(force && isUserAdmin) {
+			respondWithError(s, i, fmt.Sprintf("Task '%s' still has %d open subtasks. Complete them first, or ask an admin to force completion.", task.Name, openSubtasks))
+			return
+		}
+	}
+
 	// Update task status
-	if err := b.db.UpdateTaskStatus(taskID, completed); err != nil {
+	adminAction := isUserAdmin && task.UserID != user.ID
+	if err := b.db.UpdateTaskStatus(ctx, taskID, completed, user.ID, adminAction); err != nil {
 		respondWithError(s, i, "Error updating task status: "+err.Error())
 		return
 	}
+	if task.Completed != completed {
+		b.publish(ctx, task.ServerID)
+	}
 
 	statusText := "open"
 	if completed {
@@ -703,22 +1458,14 @@ func (b *Bot) handleTask(s *discordgo.Session, i *discordgo.InteractionCreate) {
 
 	// Add admin action note to the message if applicable
 	message := fmt.Sprintf("Task '%s' marked as %s", task.Name, statusText)
-	if isUserAdmin && task.UserID != user.ID {
+	if adminAction {
 		message += " (admin action)"
 	}
 	respondWithSuccess(s, i, message)
 }
 
-// Helper function to truncate strings that are too long
-func truncateString(s string, maxLen int) string {
-	if len(s) <= maxLen {
-		return s + strings.Repeat(" ", maxLen-len(s))
-	}
-	return s[:maxLen-3] + "..."
-}
-
-func (b *Bot) handleTimezone(s *discordgo.Session, i *discordgo.InteractionCreate) {
-	logCommand(s, i, "timezone")
+func (b *Bot) handleTimezone(ctx context.Context, s Session, i *discordgo.InteractionCreate) {
+	logCommand(i, "timezone")
 
 	timezone := i.ApplicationCommandData().Options[0].StringValue()
 
@@ -729,14 +1476,14 @@ func (b *Bot) handleTimezone(s *discordgo.Session, i *discordgo.InteractionCreat
 		return
 	}
 
-	user, err := b.getUserFromInteraction(s, i)
+	user, err := b.getUserFromInteraction(ctx, s, i)
 	if err != nil || user == nil {
-		log.Printf("Error getting user from interaction: %v", err)
+		interactionLogger(i).Error("Error getting user from interaction", "error", err)
 		return
 	}
 
 	// Update timezone
-	if err := b.db.UpdateUserTimezone(user.ID, timezone); err != nil {
+	if err := b.db.UpdateUserTimezone(ctx, user.ID, i.GuildID, timezone); err != nil {
 		respondWithError(s, i, "Error updating timezone: "+err.Error())
 		return
 	}
@@ -744,7 +1491,7 @@ func (b *Bot) handleTimezone(s *discordgo.Session, i *discordgo.InteractionCreat
 	respondWithSuccess(s, i, fmt.Sprintf("Timezone updated to %s", timezone))
 }
 
-func (b *Bot) handleGlobalTask(s *discordgo.Session, i *discordgo.InteractionCreate) {
+func (b *Bot) handleGlobalTask(ctx context.Context, s Session, i *discordgo.InteractionCreate) {
 	options := i.ApplicationCommandData().Options
 	taskName := options[0].StringValue()
 	var description string
@@ -753,9 +1500,9 @@ func (b *Bot) handleGlobalTask(s *discordgo.Session, i *discordgo.InteractionCre
 	}
 
 	// Get the admin user
-	user, err := b.getUserFromInteraction(s, i)
+	user, err := b.getUserFromInteraction(ctx, s, i)
 	if err != nil || user == nil {
-		log.Printf("Error getting user from interaction: %v", err)
+		interactionLogger(i).Error("Error getting user from interaction", "error", err)
 		return
 	}
 
@@ -770,18 +1517,19 @@ func (b *Bot) handleGlobalTask(s *discordgo.Session, i *discordgo.InteractionCre
 		CreatedAt:   time.Now(),
 	}
 
-	logCommand(s, i, "globaltask")
+	logCommand(i, "globaltask")
 
-	if err := b.db.CreateTask(task); err != nil {
-		logError(s, i.ChannelID, "CreateTask", err.Error())
+	if err := b.db.CreateTask(ctx, task); err != nil {
+		b.logError(i, "CreateTask", err)
 		respondWithError(s, i, "Error creating global task: "+err.Error())
 		return
 	}
+	b.publish(ctx, task.ServerID)
 
 	respondWithSuccess(s, i, fmt.Sprintf("Created global task: %s", task.Name))
 }
 
-func (b *Bot) handleDeclare(s *discordgo.Session, i *discordgo.InteractionCreate) {
+func (b *Bot) handleDeclare(ctx context.Context, s Session, i *discordgo.InteractionCreate) {
 	options := i.ApplicationCommandData().Options
 	taskID, err := uuid.Parse(options[0].StringValue())
 	if err != nil {
@@ -812,14 +1560,14 @@ func (b *Bot) handleDeclare(s *discordgo.Session, i *discordgo.InteractionCreate
 	duration := time.Duration(hours)*time.Hour + time.Duration(minutes)*time.Minute
 
 	// Get the user
-	user, err := b.getUserFromInteraction(s, i)
+	user, err := b.getUserFromInteraction(ctx, s, i)
 	if err != nil || user == nil {
-		log.Printf("Error getting user from interaction: %v", err)
+		interactionLogger(i).Error("Error getting user from interaction", "error", err)
 		return
 	}
 
 	// Get the task
-	task, err := b.db.GetTaskByID(taskID)
+	task, err := b.db.GetTaskByID(ctx, taskID)
 	if err != nil {
 		respondWithError(s, i, "Error getting task: "+err.Error())
 		return
@@ -828,22 +1576,17 @@ func (b *Bot) handleDeclare(s *discordgo.Session, i *discordgo.InteractionCreate
 		respondWithError(s, i, "Task not found")
 		return
 	}
+	if task.ArchivedAt != nil {
+		respondWithError(s, i, "Task is archived")
+		return
+	}
 
 	// Log command with warning if over 8 hours
+	logger := interactionLogger(i).With("duration", formatDuration(duration), "task", task.Name)
 	if duration > 8*time.Hour {
-		log.Printf(formatLogMessage(
-			i.GuildID,
-			fmt.Sprintf("executed /declare [WARNING: OVER 8 HOURS: %s on task: %s]", formatDuration(duration), task.Name),
-			user.Username,
-			getServerName(s, i.GuildID),
-		))
+		logger.Warn("Declared more than 8 hours")
 	} else {
-		log.Printf(formatLogMessage(
-			i.GuildID,
-			fmt.Sprintf("executed /declare [%s on task: %s]", formatDuration(duration), task.Name),
-			user.Username,
-			getServerName(s, i.GuildID),
-		))
+		logger.Info("Declared time")
 	}
 
 	// Create check-in record with end time
@@ -858,133 +1601,34 @@ func (b *Bot) handleDeclare(s *discordgo.Session, i *discordgo.InteractionCreate
 		EndTime:   &now,
 	}
 
-	if err := b.db.CreateCheckIn(checkIn); err != nil {
-		logError(s, i.ChannelID, "CreateCheckIn", err.Error())
-		respondWithError(s, i, "Error creating check-in: "+err.Error())
-		return
-	}
-
-	// Check for and handle any active check-in
-	activeCheckIn, err := b.db.GetActiveCheckIn(user.ID, i.GuildID)
+	// Save the declared time and check out of any active task in a single transaction
+	previous, err := b.db.DeclareCheckIn(ctx, checkIn)
 	if err != nil {
-		logError(s, i.ChannelID, "GetActiveCheckIn", err.Error())
-		respondWithError(s, i, "Error checking active tasks: "+err.Error())
+		if errors.Is(err, db.ErrCheckInNotActive) {
+			respondWithError(s, i, "Your active task changed while declaring time. Please try again.")
+			return
+		}
+		b.logError(i, "DeclareCheckIn", err)
+		respondWithError(s, i, "Error creating check-in: "+err.Error())
 		return
 	}
+	b.publish(ctx, checkIn.ServerID)
 
 	var checkoutMsg string
-	if activeCheckIn != nil {
-		// Get active task details
-		activeTask, err := b.db.GetTaskByID(activeCheckIn.TaskID)
+	if previous != nil {
+		activeTask, err := b.db.GetTaskByID(ctx, previous.TaskID)
 		if err != nil {
-			logError(s, i.ChannelID, "GetTaskByID", err.Error())
-			respondWithError(s, i, "Error retrieving active task details: "+err.Error())
-			return
-		}
-
-		// Check out from active task
-		if err := b.db.CheckOut(activeCheckIn.ID); err != nil {
-			respondWithError(s, i, "Error checking out: "+err.Error())
+			b.logError(i, "GetTaskByID", err)
+			respondWithError(s, i, "Your time was declared and your active task checked out, but retrieving its details failed: "+err.Error())
 			return
 		}
-
-		// Get the updated check-in to get the actual end time
-		updatedCheckIn, err := b.db.GetCheckInByID(activeCheckIn.ID)
-		if err != nil {
-			respondWithError(s, i, "Error retrieving checkout details: "+err.Error())
-			return
+		if activeTask != nil {
+			activeDuration := previous.EndTime.Sub(previous.StartTime)
+			checkoutMsg = fmt.Sprintf("\nChecked out from active task: %s (Time spent: %s)",
+				activeTask.Name, formatDuration(activeDuration))
 		}
-
-		activeDuration := updatedCheckIn.EndTime.Sub(updatedCheckIn.StartTime)
-		checkoutMsg = fmt.Sprintf("\nChecked out from active task: %s (Time spent: %s)",
-			activeTask.Name, formatDuration(activeDuration))
 	}
 
 	respondWithSuccess(s, i, fmt.Sprintf("Declared %s spent on task: %s%s",
 		formatDuration(duration), task.Name, checkoutMsg))
 }
-
-// Helper function to check if a user is an admin
-func isAdmin(s *discordgo.Session, guildID string, userID string) bool {
-	// If this is a DM channel (no guild), check if the user is a bot owner
-	if guildID == "" {
-		// In DMs, we consider the user an admin if they have admin permissions in any mutual guild
-		guilds, err := s.UserGuilds(100, "", "")
-		if err != nil {
-			log.Printf("Error getting user guilds: %v", err)
-			return false
-		}
-
-		for _, guild := range guilds {
-			member, err := s.GuildMember(guild.ID, userID)
-			if err != nil {
-				continue
-			}
-
-			// Get guild to check roles
-			g, err := s.Guild(guild.ID)
-			if err != nil {
-				continue
-			}
-
-			// Check if user is the guild owner
-			if g.OwnerID == userID {
-				log.Printf(formatLogMessage(guild.ID, "User is the guild owner", userID, guild.Name))
-				return true
-			}
-
-			// Check roles for admin permissions
-			for _, roleID := range member.Roles {
-				for _, role := range g.Roles {
-					if role.ID == roleID {
-						if role.Permissions&discordgo.PermissionAdministrator != 0 || role.Permissions&discordgo.PermissionManageServer != 0 {
-							log.Printf(formatLogMessage(guild.ID, "User has admin permissions", userID, guild.Name))
-							return true
-						}
-						break
-					}
-				}
-			}
-		}
-		return false
-	}
-
-	// For guild channels, check the guild roles
-	member, err := s.GuildMember(guildID, userID)
-	if err != nil {
-		log.Printf("Error getting guild member: %v", err)
-		return false
-	}
-
-	// Get guild to check roles
-	guild, err := s.Guild(guildID)
-	if err != nil {
-		log.Printf("Error getting guild: %v", err)
-		return false
-	}
-
-	// First check if user is the guild owner
-	if guild.OwnerID == userID {
-		log.Printf(formatLogMessage(guildID, "User is the guild owner", userID, guild.Name))
-		return true
-	}
-
-	// Check each role the user has
-	for _, roleID := range member.Roles {
-		for _, role := range guild.Roles {
-			if role.ID == roleID {
-				// Log role details for debugging
-				log.Printf("Checking role %s (ID: %s) with permissions: %d", role.Name, role.ID, role.Permissions)
-
-				if role.Permissions&discordgo.PermissionAdministrator != 0 || role.Permissions&discordgo.PermissionManageServer != 0 {
-					log.Printf("User %s is admin via role %s", userID, role.Name)
-					return true
-				}
-				break
-			}
-		}
-	}
-
-	log.Printf("User %s is not an admin in guild %s", userID, guildID)
-	return false
-}
@@ -0,0 +1,21 @@
+package bot
+
+import (
+	"context"
+)
+
+// publish signals that the store recorded events for a guild in the change just
+// made; changes outside guilds record none
+func (b *Bot) publish(ctx context.Context, guildID string) {
+	if guildID == "" {
+		return
+	}
+	b.events.Publish(ctx, guildID)
+}
+
+// wakeWebhooksOnEvent wakes the webhook sender after a change was published.
+// The store queues the deliveries in the transaction of the change itself, so
+// they are not lost when the bot stops before getting here.
+func (b *Bot) wakeWebhooksOnEvent(ctx context.Context, guildID string) {
+	b.wakeWebhooks()
+}
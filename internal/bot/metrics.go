@@ -0,0 +1,101 @@
+package bot
+
+import (
+	"context"
+	"errors"
+
+	"taskbot/internal/metrics"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+var (
+	commandsTotal = metrics.NewCounterVec("taskbot_commands_total",
+		"Slash commands handled, by command.", "command")
+	commandDuration = metrics.NewHistogramVec("taskbot_command_duration_seconds",
+		"Time spent handling slash commands, by command.", metrics.DefaultBuckets, "command")
+	commandErrors = metrics.NewCounterVec("taskbot_command_errors_total",
+		"Error responses sent for slash commands, by command.", "command")
+	operationErrors = metrics.NewCounterVec("taskbot_operation_errors_total",
+		"Failed store operations while handling commands, by operation.", "op")
+	webhookDeliveries = metrics.NewCounterVec("taskbot_webhook_deliveries_total",
+		"Webhook delivery attempts, by result: delivered, retried or failed.", "result")
+)
+
+// poolStatter is implemented by stores backed by a pgx connection pool
+type poolStatter interface {
+	Stat() *pgxpool.Stat
+}
+
+// RegisterMetrics adds the bot's metrics to a registry: command counters and
+// latencies, webhook deliveries, active check-ins per guild and, for Postgres, connection pool stats
+func (b *Bot) RegisterMetrics(r *metrics.Registry) {
+	r.MustRegister(commandsTotal, commandDuration, commandErrors, operationErrors, webhookDeliveries)
+
+	r.MustRegister(metrics.NewGaugeFunc("taskbot_active_checkins",
+		"Check-ins currently in progress, by guild.", []string{"guild_id"},
+		func(ctx context.Context) ([]metrics.Sample, error) {
+			counts, err := b.db.CountActiveCheckIns(ctx)
+			if err != nil {
+				return nil, err
+			}
+			samples := make([]metrics.Sample, 0, len(counts))
+			for guildID, count := range counts {
+				samples = append(samples, metrics.Sample{Labels: []string{guildID}, Value: float64(count)})
+			}
+			return samples, nil
+		}))
+
+	pool, ok := b.db.(poolStatter)
+	if !ok {
+		return
+	}
+	r.MustRegister(
+		metrics.NewGaugeFunc("taskbot_db_pool_connections",
+			"Database pool connections, by state.", []string{"state"},
+			func(ctx context.Context) ([]metrics.Sample, error) {
+				stat := pool.Stat()
+				return []metrics.Sample{
+					{Labels: []string{"acquired"}, Value: float64(stat.AcquiredConns())},
+					{Labels: []string{"constructing"}, Value: float64(stat.ConstructingConns())},
+					{Labels: []string{"idle"}, Value: float64(stat.IdleConns())},
+					{Labels: []string{"total"}, Value: float64(stat.TotalConns())},
+					{Labels: []string{"max"}, Value: float64(stat.MaxConns())},
+				}, nil
+			}),
+		metrics.NewCounterFunc("taskbot_db_pool_acquires_total",
+			"Connections acquired from the database pool, by result.", []string{"result"},
+			func(ctx context.Context) ([]metrics.Sample, error) {
+				stat := pool.Stat()
+				return []metrics.Sample{
+					{Labels: []string{"success"}, Value: float64(stat.AcquireCount())},
+					{Labels: []string{"empty"}, Value: float64(stat.EmptyAcquireCount())},
+					{Labels: []string{"canceled"}, Value: float64(stat.CanceledAcquireCount())},
+				}, nil
+			}),
+		metrics.NewCounterFunc("taskbot_db_pool_acquire_duration_seconds_total",
+			"Total time spent acquiring connections from the database pool.", nil,
+			func(ctx context.Context) ([]metrics.Sample, error) {
+				return []metrics.Sample{{Value: pool.Stat().AcquireDuration().Seconds()}}, nil
+			}),
+	)
+}
+
+// HealthChecks returns the checks behind the health endpoint, by name
+func (b *Bot) HealthChecks() map[string]func(ctx context.Context) error {
+	return map[string]func(ctx context.Context) error{
+		"discord":  b.checkDiscord,
+		"database": b.db.Ping,
+	}
+}
+
+// checkDiscord reports whether the gateway connection is up and has received Ready
+func (b *Bot) checkDiscord(ctx context.Context) error {
+	b.session.RLock()
+	defer b.session.RUnlock()
+
+	if !b.session.DataReady {
+		return errors.New("discord session is not connected")
+	}
+	return nil
+}
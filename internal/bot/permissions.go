@@ -0,0 +1,100 @@
+package bot
+
+import (
+	"context"
+	"log/slog"
+
+	"taskbot/internal/db/models"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// roleContextKey stores the caller's resolved bot role in a handler context
+type roleContextKey struct{}
+
+// withRole returns a context carrying the caller's bot role
+func withRole(ctx context.Context, role models.BotRole) context.Context {
+	return context.WithValue(ctx, roleContextKey{}, role)
+}
+
+// callerRole returns the bot role of the user behind an interaction, reusing the
+// role resolved by handleCommand when it is available
+func (b *Bot) callerRole(ctx context.Context, s Session, i *discordgo.InteractionCreate) models.BotRole {
+	if role, ok := ctx.Value(roleContextKey{}).(models.BotRole); ok {
+		return role
+	}
+	return b.memberRole(ctx, s, i.GuildID, interactionUserID(i))
+}
+
+// isAdmin reports whether the user behind an interaction has the admin bot role
+func (b *Bot) isAdmin(ctx context.Context, s Session, i *discordgo.InteractionCreate) bool {
+	return b.callerRole(ctx, s, i).AtLeast(models.RoleAdmin)
+}
+
+// MemberRole returns the current bot role of a Discord user in a guild, as used
+// for commands
+func (b *Bot) MemberRole(ctx context.Context, guildID, discordID string) models.BotRole {
+	return b.memberRole(ctx, b.cached(b.session), guildID, discordID)
+}
+
+// memberRole resolves the bot role of a guild member. The guild owner and members
+// with Administrator or Manage Server are always admins, so a guild cannot lock
+// itself out. Everyone else gets the highest role mapped to one of their Discord
+// roles. Unmapped members are members, unless the guild maps a Discord role to
+// member, in which case only mapped roles may use the bot. When the member, guild
+// or mappings cannot be loaded, no role is granted.
+func (b *Bot) memberRole(ctx context.Context, s Session, guildID, userID string) models.BotRole {
+	// Commands allowed in DMs only act on the caller's own data
+	if guildID == "" {
+		return models.RoleMember
+	}
+
+	member, err := s.GuildMember(guildID, userID)
+	if err != nil {
+		slog.Warn("Error checking guild membership", "guild_id", guildID, "user_id", userID, "error", err)
+		return models.RoleNone
+	}
+
+	guild, err := s.Guild(guildID)
+	if err != nil {
+		slog.Error("Error getting guild", "guild_id", guildID, "error", err)
+		return models.RoleNone
+	}
+
+	if guild.OwnerID == userID {
+		return models.RoleAdmin
+	}
+
+	memberRoles := make(map[string]bool, len(member.Roles))
+	for _, roleID := range member.Roles {
+		memberRoles[roleID] = true
+	}
+	for _, role := range guild.Roles {
+		if memberRoles[role.ID] && role.Permissions&(discordgo.PermissionAdministrator|discordgo.PermissionManageServer) != 0 {
+			return models.RoleAdmin
+		}
+	}
+
+	mappings, err := b.db.GetRoleMappings(ctx, guildID)
+	if err != nil {
+		slog.Error("Error getting role mappings", "guild_id", guildID, "user_id", userID, "error", err)
+		return models.RoleNone
+	}
+
+	role := models.RoleMember
+	restricted := false
+	for _, mapping := range mappings {
+		if mapping.Role == models.RoleMember {
+			restricted = true
+		}
+	}
+	if restricted {
+		role = models.RoleNone
+	}
+	for _, mapping := range mappings {
+		if memberRoles[mapping.DiscordRoleID] && !role.AtLeast(mapping.Role) {
+			role = mapping.Role
+		}
+	}
+	return role
+}
@@ -0,0 +1,56 @@
+package bot
+
+import (
+	"context"
+
+	"taskbot/internal/db/models"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// commandHandlerFunc handles a slash command or autocomplete interaction
+type commandHandlerFunc func(b *Bot, ctx context.Context, s Session, i *discordgo.InteractionCreate)
+
+// command ties a slash command definition to the code that serves it. Command
+// registration, dispatch and autocomplete routing are all driven by the registry.
+type command struct {
+	definition   *discordgo.ApplicationCommand
+	handler      commandHandlerFunc
+	autocomplete commandHandlerFunc
+	allowDM      bool
+	// role is the minimum bot role required; commands without one are open to members
+	role models.BotRole
+}
+
+// requiredRole returns the minimum bot role needed to run the command
+func (c *command) requiredRole() models.BotRole {
+	if c.role == models.RoleNone {
+		return models.RoleMember
+	}
+	return c.role
+}
+
+// findCommand returns the registered command with the given name, or nil
+func findCommand(name string) *command {
+	for _, cmd := range commands {
+		if cmd.definition.Name == name {
+			return cmd
+		}
+	}
+	return nil
+}
+
+// commandDefinitions returns the definitions to register with Discord, with DM
+// availability derived from the registry. No default member permissions are set,
+// so that members given a bot role with /roles can see the commands it allows;
+// handleCommand checks the role on every use.
+func commandDefinitions() []*discordgo.ApplicationCommand {
+	definitions := make([]*discordgo.ApplicationCommand, 0, len(commands))
+	for _, cmd := range commands {
+		definition := *cmd.definition
+		allowDM := cmd.allowDM
+		definition.DMPermission = &allowDM
+		definitions = append(definitions, &definition)
+	}
+	return definitions
+}
@@ -2,20 +2,24 @@ package bot
 
 import (
 	"bytes"
+	"context"
 	"fmt"
-	"log"
 	"sort"
 	"strings"
 	"time"
 
 	"taskbot/internal/db/models"
+	"taskbot/internal/ical"
 
 	"github.com/bwmarrin/discordgo"
 	"github.com/google/uuid"
 )
 
-func (b *Bot) handleReport(s *discordgo.Session, i *discordgo.InteractionCreate) {
-	logCommand(s, i, "report")
+// csvExportRole is the minimum bot role allowed to export reports as CSV
+const csvExportRole = models.RoleLead
+
+func (b *Bot) handleReport(ctx context.Context, s Session, i *discordgo.InteractionCreate) {
+	logCommand(i, "report")
 
 	// Ensure we're in a guild
 	if i.GuildID == "" {
@@ -23,12 +27,6 @@ func (b *Bot) handleReport(s *discordgo.Session, i *discordgo.InteractionCreate)
 		return
 	}
 
-	// Add permission check
-	if !hasPermission(s, i.GuildID, i.Member.User.ID, discordgo.PermissionViewChannel) {
-		respondWithError(s, i, "You don't have permission to use this command here")
-		return
-	}
-
 	period := i.ApplicationCommandData().Options[0].StringValue()
 	format := "text"     // default format
 	filterUsername := "" // default to no filter
@@ -43,22 +41,15 @@ func (b *Bot) handleReport(s *discordgo.Session, i *discordgo.InteractionCreate)
 		}
 	}
 
-	// Get user ID safely
-	var userID string
-	if i.Member != nil && i.Member.User != nil {
-		userID = i.Member.User.ID
-	} else if i.User != nil {
-		userID = i.User.ID
-	} else {
-		respondWithError(s, i, "Could not determine user information")
+	caller, err := b.getUserFromInteraction(ctx, s, i)
+	if err != nil || caller == nil {
 		return
 	}
 
-	// Check if user is admin when requesting CSV
-	isUserAdmin := isAdmin(s, i.GuildID, userID)
-	if format == "csv" && !isUserAdmin {
-		log.Printf("CSV access denied for user %s in guild %s", userID, i.GuildID)
-		respondWithError(s, i, "CSV format is only available for administrators")
+	// CSV export is limited to leads and admins
+	if format == "csv" && !b.callerRole(ctx, s, i).AtLeast(csvExportRole) {
+		interactionLogger(i).Info("CSV access denied")
+		respondWithError(s, i, "CSV format is only available for leads and administrators")
 		return
 	}
 
@@ -104,7 +95,7 @@ func (b *Bot) handleReport(s *discordgo.Session, i *discordgo.InteractionCreate)
 	}
 
 	// Get all task history for this server
-	history, err := b.db.GetAllTaskHistory(i.GuildID, startDate, now)
+	history, err := b.db.GetAllTaskHistory(ctx, i.GuildID, startDate, now)
 	if err != nil {
 		respondWithError(s, i, "Error retrieving task history: "+err.Error())
 		return
@@ -121,24 +112,35 @@ func (b *Bot) handleReport(s *discordgo.Session, i *discordgo.InteractionCreate)
 			duration := ci.CheckIn.EndTime.Sub(ci.CheckIn.StartTime)
 			userHours[ci.CheckIn.UserID.String()] += duration
 
-			// Track individual task times
+			// Track individual task times, rolling subtask time up into the parent
+			taskID, taskName := ci.CheckIn.TaskID, ci.Task.Name
+			if ci.Parent != nil {
+				taskID, taskName = ci.Parent.ID, ci.Parent.Name
+			}
 			if userTasks[ci.CheckIn.UserID.String()] == nil {
 				userTasks[ci.CheckIn.UserID.String()] = make(map[uuid.UUID]time.Duration)
 			}
-			userTasks[ci.CheckIn.UserID.String()][ci.CheckIn.TaskID] += duration
+			userTasks[ci.CheckIn.UserID.String()][taskID] += duration
 
 			// Store task name
-			taskNames[ci.CheckIn.TaskID] = ci.Task.Name
+			taskNames[taskID] = taskName
 		}
 	}
 
 	// Get users for THIS guild only
-	allUsers, err := b.db.GetGuildUsers(i.GuildID)
+	allUsers, err := b.db.GetGuildUsers(ctx, i.GuildID)
 	if err != nil {
 		respondWithError(s, i, "Error retrieving users: "+err.Error())
 		return
 	}
 
+	// Limit per-user details to the users the caller may see
+	visibility, err := b.reportVisibility(ctx, s, i, caller, allUsers)
+	if err != nil {
+		respondWithError(s, i, "Error resolving report visibility: "+err.Error())
+		return
+	}
+
 	// Create a map for quick lookup
 	userMap := make(map[uuid.UUID]*models.User)
 	for _, user := range allUsers {
@@ -146,6 +148,20 @@ func (b *Bot) handleReport(s *discordgo.Session, i *discordgo.InteractionCreate)
 		userIDs[user.DiscordID] = user.ID
 	}
 
+	if filterUsername != "" && !visibility.canSee(userIDs[filterUsername]) {
+		if b.callerRole(ctx, s, i).AtLeast(models.RoleLead) {
+			respondWithError(s, i, "You can only view reports for yourself and your team")
+		} else {
+			respondWithError(s, i, "You can only view your own report")
+		}
+		return
+	}
+
+	if format == "ics" {
+		b.respondWithCalendar(s, i, period, history, visibility, filterUsername)
+		return
+	}
+
 	// Build report including all users
 	var reportRows [][]string
 	if filterUsername != "" {
@@ -171,6 +187,9 @@ func (b *Bot) handleReport(s *discordgo.Session, i *discordgo.InteractionCreate)
 		// All users report - show total time and task count for each user
 		for userID, taskDurations := range userTasks {
 			uid, _ := uuid.Parse(userID)
+			if !visibility.canSee(uid) {
+				continue
+			}
 			if user, exists := userMap[uid]; exists {
 				totalDuration := userHours[userID]
 				taskCount := len(taskDurations)
@@ -185,6 +204,9 @@ func (b *Bot) handleReport(s *discordgo.Session, i *discordgo.InteractionCreate)
 
 		// Add users with 0 hours
 		for _, user := range userMap {
+			if !visibility.canSee(user.ID) {
+				continue
+			}
 			reportRows = append(reportRows, []string{
 				user.Username,
 				"0h 0m 0s",
@@ -201,6 +223,19 @@ func (b *Bot) handleReport(s *discordgo.Session, i *discordgo.InteractionCreate)
 		return reportRows[i][1] < reportRows[j][1]
 	})
 
+	// Users who cannot see everyone still get the server-wide totals
+	if filterUsername == "" && !visibility.all {
+		var total time.Duration
+		for _, duration := range userHours {
+			total += duration
+		}
+		reportRows = append(reportRows, []string{
+			"Server total",
+			formatDuration(total),
+			fmt.Sprintf("%d", len(taskNames)),
+		})
+	}
+
 	// Prepare the report title based on whether it's filtered
 	reportTitle := fmt.Sprintf("Task history for %s", period)
 	if filterUsername != "" {
@@ -223,18 +258,10 @@ func (b *Bot) handleReport(s *discordgo.Session, i *discordgo.InteractionCreate)
 		}
 
 		// Create and send file
-		file := &discordgo.File{
+		respondWithFile(s, i, reportTitle, &discordgo.File{
 			Name:        fmt.Sprintf("task_report_%s.csv", period),
 			ContentType: "text/csv",
 			Reader:      bytes.NewReader([]byte(csvContent.String())),
-		}
-
-		s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
-			Type: discordgo.InteractionResponseChannelMessageWithSource,
-			Data: &discordgo.InteractionResponseData{
-				Files: []*discordgo.File{file},
-				Flags: discordgo.MessageFlagsEphemeral,
-			},
 		})
 		return
 	}
@@ -272,3 +299,41 @@ func (b *Bot) handleReport(s *discordgo.Session, i *discordgo.InteractionCreate)
 	response.WriteString("```")
 	respondWithSuccess(s, i, response.String())
 }
+
+// respondWithCalendar sends the ended check-ins of the report as an iCalendar
+// file, limited to the users the caller may see and to filterUsername if set
+func (b *Bot) respondWithCalendar(s Session, i *discordgo.InteractionCreate, period string, history []*models.CheckInWithTask, visibility reportVisibility, filterUsername string) {
+	var entries []*models.CheckInWithTask
+	for _, ci := range history {
+		if !visibility.canSee(ci.User.ID) {
+			continue
+		}
+		if filterUsername != "" && ci.User.DiscordID != filterUsername {
+			continue
+		}
+		entries = append(entries, ci)
+	}
+
+	events := ical.CheckInEvents(entries)
+	if len(events) == 0 {
+		respondWithError(s, i, "No completed check-ins in this period")
+		return
+	}
+
+	var buf bytes.Buffer
+	err := ical.Write(&buf, ical.Calendar{
+		Name:    fmt.Sprintf("Task history for %s", period),
+		Created: time.Now(),
+		Events:  events,
+	})
+	if err != nil {
+		respondWithError(s, i, "Error creating calendar: "+err.Error())
+		return
+	}
+
+	respondWithFile(s, i, fmt.Sprintf("%d time entries for %s, in each user's timezone", len(events), period), &discordgo.File{
+		Name:        fmt.Sprintf("task_report_%s.ics", period),
+		ContentType: "text/calendar",
+		Reader:      &buf,
+	})
+}
@@ -0,0 +1,113 @@
+package bot
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"taskbot/internal/db"
+	"taskbot/internal/db/models"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// Bot roles that can be granted to a Discord role
+var botRoleChoices = []*discordgo.ApplicationCommandOptionChoice{
+	{Name: "Member", Value: string(models.RoleMember)},
+	{Name: "Lead", Value: string(models.RoleLead)},
+	{Name: "Admin", Value: string(models.RoleAdmin)},
+}
+
+func (b *Bot) handleRoles(ctx context.Context, s Session, i *discordgo.InteractionCreate) {
+	logCommand(i, "roles")
+
+	if len(i.ApplicationCommandData().Options) == 0 {
+		respondWithError(s, i, "Invalid command options")
+		return
+	}
+
+	user, err := b.getUserFromInteraction(ctx, s, i)
+	if err != nil || user == nil {
+		return
+	}
+
+	subcommand := i.ApplicationCommandData().Options[0]
+	var roleID, level string
+	for _, opt := range subcommand.Options {
+		switch opt.Name {
+		case "role":
+			roleID = fmt.Sprint(opt.Value)
+		case "level":
+			level = opt.StringValue()
+		}
+	}
+
+	switch subcommand.Name {
+	case "set":
+		mapping := &models.RoleMapping{
+			ServerID:      i.GuildID,
+			DiscordRoleID: roleID,
+			Role:          models.BotRole(level),
+			CreatedBy:     user.ID,
+		}
+		if err := b.db.SetRoleMapping(ctx, mapping); err != nil {
+			b.logError(i, "SetRoleMapping", err)
+			respondWithError(s, i, "Error mapping role: "+err.Error())
+			return
+		}
+
+		msg := fmt.Sprintf("Members with <@&%s> now have the %s role", roleID, level)
+		if mapping.Role == models.RoleMember {
+			msg += "\nMembers without a mapped role can no longer use the bot."
+		}
+		respondWithSuccess(s, i, msg)
+
+	case "remove":
+		err := b.db.DeleteRoleMapping(ctx, i.GuildID, roleID, user.ID)
+		if errors.Is(err, db.ErrRoleMappingNotFound) {
+			respondWithError(s, i, "That role is not mapped")
+			return
+		}
+		if err != nil {
+			respondWithError(s, i, "Error removing role mapping: "+err.Error())
+			return
+		}
+		respondWithSuccess(s, i, fmt.Sprintf("Removed the mapping for <@&%s>", roleID))
+
+	case "list":
+		mappings, err := b.db.GetRoleMappings(ctx, i.GuildID)
+		if err != nil {
+			respondWithError(s, i, "Error retrieving role mappings: "+err.Error())
+			return
+		}
+		if len(mappings) == 0 {
+			respondWithSuccess(s, i, "No roles mapped. Every member can use the bot; "+
+				"server owners and members with Manage Server are admins.")
+			return
+		}
+
+		roleNames := make(map[string]string)
+		if guild, err := s.Guild(i.GuildID); err == nil {
+			for _, role := range guild.Roles {
+				roleNames[role.ID] = role.Name
+			}
+		}
+
+		var rows [][]string
+		for _, mapping := range mappings {
+			name, ok := roleNames[mapping.DiscordRoleID]
+			if !ok {
+				name = "unknown (" + mapping.DiscordRoleID + ")"
+			}
+			rows = append(rows, []string{
+				truncateString(name, 30),
+				string(mapping.Role),
+				mapping.CreatedAt.Format("2006-01-02"),
+			})
+		}
+		respondWithSuccess(s, i, "# Role mappings\n"+formatTable([]string{"DISCORD ROLE", "BOT ROLE", "SINCE"}, rows))
+
+	default:
+		respondWithError(s, i, "Invalid subcommand")
+	}
+}
@@ -0,0 +1,280 @@
+package bot
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"taskbot/internal/db/models"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+const (
+	// serverLogFlushInterval is how often queued log events are posted; each
+	// guild gets at most one log message per interval
+	serverLogFlushInterval = 10 * time.Second
+
+	// serverLogMaxLines caps the events queued per guild and category between
+	// flushes; any more are only counted
+	serverLogMaxLines = 20
+
+	// serverLogMaxLength keeps a batch within Discord's 2000 character limit,
+	// leaving room for the code block and the dropped events note
+	serverLogMaxLength = 1800
+
+	// serverLogFlushTimeout bounds a single flush, including the final one on shutdown
+	serverLogFlushTimeout = 10 * time.Second
+)
+
+// Log categories admins can choose from
+var logCategoryChoices = []struct {
+	category    models.LogCategory
+	description string
+}{
+	{models.LogErrors, "Failed commands and background jobs"},
+	{models.LogAdmin, "Admin commands and who ran them"},
+}
+
+type serverLogEntry struct {
+	category models.LogCategory
+	text     string
+}
+
+type serverLogBatch struct {
+	entries []serverLogEntry
+	queued  map[models.LogCategory]int
+	dropped map[models.LogCategory]int
+}
+
+// serverLogQueue batches log events per guild until the next flush. Events are
+// queued without looking at the guild's settings; categories the guild does not
+// log are dropped when the batch is posted.
+type serverLogQueue struct {
+	mu      sync.Mutex
+	pending map[string]*serverLogBatch
+}
+
+func newServerLogQueue() *serverLogQueue {
+	return &serverLogQueue{pending: make(map[string]*serverLogBatch)}
+}
+
+func (q *serverLogQueue) add(guildID string, category models.LogCategory, text string) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	batch, ok := q.pending[guildID]
+	if !ok {
+		batch = &serverLogBatch{
+			queued:  make(map[models.LogCategory]int),
+			dropped: make(map[models.LogCategory]int),
+		}
+		q.pending[guildID] = batch
+	}
+	if batch.queued[category] >= serverLogMaxLines {
+		batch.dropped[category]++
+		return
+	}
+	batch.queued[category]++
+	batch.entries = append(batch.entries, serverLogEntry{category: category, text: text})
+}
+
+// take removes and returns everything queued so far
+func (q *serverLogQueue) take() map[string]*serverLogBatch {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	pending := q.pending
+	q.pending = make(map[string]*serverLogBatch)
+	return pending
+}
+
+// serverLog queues an event for a guild's log channel
+func (b *Bot) serverLog(guildID string, category models.LogCategory, format string, args ...interface{}) {
+	if guildID == "" {
+		return
+	}
+	text := fmt.Sprintf("%s [%s] %s", time.Now().UTC().Format("15:04:05"), category, fmt.Sprintf(format, args...))
+	b.serverLogs.add(guildID, category, text)
+}
+
+// runServerLog posts queued log events until shutdown, then flushes what is left
+func (b *Bot) runServerLog() {
+	defer b.wg.Done()
+
+	ticker := time.NewTicker(serverLogFlushInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-b.shutdownCh:
+			// The root context is already cancelled, but the session is still open
+			ctx, cancel := context.WithTimeout(context.Background(), serverLogFlushTimeout)
+			b.flushServerLog(ctx, b.session)
+			cancel()
+			return
+		case <-ticker.C:
+			ctx, cancel := context.WithTimeout(b.ctx, serverLogFlushTimeout)
+			b.flushServerLog(ctx, b.session)
+			cancel()
+		}
+	}
+}
+
+// flushServerLog posts one message per guild with the events its log channel
+// is configured for
+func (b *Bot) flushServerLog(ctx context.Context, s Session) {
+	for guildID, batch := range b.serverLogs.take() {
+		settings, err := b.db.GetOrCreateServerSettings(ctx, guildID)
+		if err != nil {
+			slog.Error("Error getting log channel settings", "guild_id", guildID, "error", err)
+			continue
+		}
+
+		var lines []string
+		length := 0
+		dropped := 0
+		for _, entry := range batch.entries {
+			if !settings.LogsCategory(entry.category) {
+				continue
+			}
+			if length+len(entry.text)+1 > serverLogMaxLength {
+				dropped++
+				continue
+			}
+			lines = append(lines, entry.text)
+			length += len(entry.text) + 1
+		}
+		for category, count := range batch.dropped {
+			if settings.LogsCategory(category) {
+				dropped += count
+			}
+		}
+		if len(lines) == 0 {
+			continue
+		}
+		if dropped > 0 {
+			lines = append(lines, fmt.Sprintf("... and %d more events", dropped))
+		}
+		sendServerLog(s, settings.LogChannelID, strings.Join(lines, "\n"))
+	}
+}
+
+// parseLogCategories returns the categories that are switched on, keeping the
+// order of logCategoryChoices
+func parseLogCategories(enabled map[models.LogCategory]bool) []models.LogCategory {
+	var categories []models.LogCategory
+	for _, choice := range logCategoryChoices {
+		if enabled[choice.category] {
+			categories = append(categories, choice.category)
+		}
+	}
+	return categories
+}
+
+// formatLogCategories renders categories as a comma separated list
+func formatLogCategories(categories []models.LogCategory) string {
+	if len(categories) == 0 {
+		return "none"
+	}
+	names := make([]string, 0, len(categories))
+	for _, category := range categories {
+		names = append(names, string(category))
+	}
+	sort.Strings(names)
+	return strings.Join(names, ", ")
+}
+
+// logCategoryOptions returns a boolean /logchannel option per category
+func logCategoryOptions() []*discordgo.ApplicationCommandOption {
+	options := make([]*discordgo.ApplicationCommandOption, 0, len(logCategoryChoices))
+	for _, choice := range logCategoryChoices {
+		options = append(options, &discordgo.ApplicationCommandOption{
+			Type:        discordgo.ApplicationCommandOptionBoolean,
+			Name:        string(choice.category),
+			Description: choice.description + " (default: on)",
+		})
+	}
+	return options
+}
+
+func (b *Bot) handleLogChannel(ctx context.Context, s Session, i *discordgo.InteractionCreate) {
+	logCommand(i, "logchannel")
+
+	if len(i.ApplicationCommandData().Options) == 0 {
+		respondWithError(s, i, "Invalid command options")
+		return
+	}
+
+	user, err := b.getUserFromInteraction(ctx, s, i)
+	if err != nil || user == nil {
+		return
+	}
+
+	subcommand := i.ApplicationCommandData().Options[0]
+	switch subcommand.Name {
+	case "set":
+		var channelID string
+		enabled := make(map[models.LogCategory]bool)
+		for _, choice := range logCategoryChoices {
+			enabled[choice.category] = true
+		}
+		for _, opt := range subcommand.Options {
+			if opt.Name == "channel" {
+				channelID = fmt.Sprint(opt.Value)
+				continue
+			}
+			enabled[models.LogCategory(opt.Name)] = opt.BoolValue()
+		}
+		categories := parseLogCategories(enabled)
+		if len(categories) == 0 {
+			respondWithError(s, i, "Choose at least one category, or use `/logchannel off`")
+			return
+		}
+
+		// Make sure the bot can post there before saving
+		if _, err := s.ChannelMessageSend(channelID, "Bot log events will be posted here: "+formatLogCategories(categories)); err != nil {
+			respondWithError(s, i, fmt.Sprintf("I can't post in <#%s>; check that I can view the channel and send messages there", channelID))
+			return
+		}
+
+		if err := b.db.SetLogChannel(ctx, i.GuildID, channelID, categories, user.ID); err != nil {
+			b.logError(i, "SetLogChannel", err)
+			respondWithError(s, i, "Error setting log channel: "+err.Error())
+			return
+		}
+		respondWithSuccess(s, i, fmt.Sprintf("Posting %s to <#%s>", formatLogCategories(categories), channelID))
+
+	case "off":
+		settings, err := b.db.GetOrCreateServerSettings(ctx, i.GuildID)
+		if err != nil {
+			respondWithError(s, i, "Error getting settings: "+err.Error())
+			return
+		}
+		if err := b.db.SetLogChannel(ctx, i.GuildID, "", settings.LogCategories, user.ID); err != nil {
+			respondWithError(s, i, "Error turning off log channel: "+err.Error())
+			return
+		}
+		respondWithSuccess(s, i, "Log channel turned off")
+
+	case "show":
+		settings, err := b.db.GetOrCreateServerSettings(ctx, i.GuildID)
+		if err != nil {
+			respondWithError(s, i, "Error getting settings: "+err.Error())
+			return
+		}
+		if settings.LogChannelID == "" {
+			respondWithSuccess(s, i, "No log channel set. Use `/logchannel set` to choose one.")
+			return
+		}
+		respondWithSuccess(s, i, fmt.Sprintf("Posting %s to <#%s>, at most one message every %s",
+			formatLogCategories(settings.LogCategories), settings.LogChannelID, serverLogFlushInterval))
+
+	default:
+		respondWithError(s, i, "Invalid subcommand")
+	}
+}
@@ -0,0 +1,163 @@
+package bot
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// commandSyncAttempts is how often a command sync is tried before giving up
+const commandSyncAttempts = 3
+
+// commandDiff lists the commands that differ between Discord and the registry
+type commandDiff struct {
+	added   []string
+	changed []string
+	removed []string
+}
+
+func (d commandDiff) empty() bool {
+	return len(d.added) == 0 && len(d.changed) == 0 && len(d.removed) == 0
+}
+
+func (d commandDiff) String() string {
+	var parts []string
+	if len(d.added) > 0 {
+		parts = append(parts, "added "+strings.Join(d.added, ", "))
+	}
+	if len(d.changed) > 0 {
+		parts = append(parts, "changed "+strings.Join(d.changed, ", "))
+	}
+	if len(d.removed) > 0 {
+		parts = append(parts, "removed "+strings.Join(d.removed, ", "))
+	}
+	return strings.Join(parts, "; ")
+}
+
+// syncCommands makes the commands registered in a guild, or globally when guildID
+// is empty, match desired. Nothing is sent when they already match; otherwise a
+// single bulk overwrite applies the difference, which leaves unchanged commands
+// in place so they never disappear for users.
+func (b *Bot) syncCommands(guildID string, desired []*discordgo.ApplicationCommand) error {
+	var lastErr error
+	for attempt := 1; attempt <= commandSyncAttempts; attempt++ {
+		err := b.syncCommandsOnce(guildID, desired)
+		if err == nil {
+			return nil
+		}
+		lastErr = err
+		slog.Warn("Command sync attempt failed", "guild_id", guildID, "attempt", attempt, "error", err)
+		time.Sleep(time.Second * time.Duration(attempt))
+	}
+	return fmt.Errorf("failed to sync commands after %d attempts: %w", commandSyncAttempts, lastErr)
+}
+
+func (b *Bot) syncCommandsOnce(guildID string, desired []*discordgo.ApplicationCommand) error {
+	logger := slog.With("scope", "global")
+	if guildID != "" {
+		logger = slog.With("scope", "guild", "guild_id", guildID)
+	}
+
+	existing, err := b.session.ApplicationCommands(b.config.Discord.ClientID, guildID)
+	if err != nil {
+		return fmt.Errorf("error getting existing commands: %w", err)
+	}
+
+	if len(existing) == 0 && len(desired) == 0 {
+		return nil
+	}
+
+	diff := diffCommands(existing, desired, guildID != "")
+	if diff.empty() {
+		logger.Debug("Commands up to date", "commands", len(desired))
+		return nil
+	}
+
+	if desired == nil {
+		// Discord expects an empty list, not null, to remove all commands
+		desired = []*discordgo.ApplicationCommand{}
+	}
+	if _, err := b.session.ApplicationCommandBulkOverwrite(b.config.Discord.ClientID, guildID, desired); err != nil {
+		return fmt.Errorf("error overwriting commands: %w", err)
+	}
+
+	logger.Info("Synced commands", "diff", diff.String())
+	return nil
+}
+
+// diffCommands compares registered commands with the desired definitions by name
+func diffCommands(existing, desired []*discordgo.ApplicationCommand, guildScoped bool) commandDiff {
+	current := make(map[string]string, len(existing))
+	for _, cmd := range existing {
+		current[cmd.Name] = commandFingerprint(cmd, guildScoped)
+	}
+
+	var diff commandDiff
+	wanted := make(map[string]bool, len(desired))
+	for _, cmd := range desired {
+		wanted[cmd.Name] = true
+		fingerprint, ok := current[cmd.Name]
+		switch {
+		case !ok:
+			diff.added = append(diff.added, cmd.Name)
+		case fingerprint != commandFingerprint(cmd, guildScoped):
+			diff.changed = append(diff.changed, cmd.Name)
+		}
+	}
+	for name := range current {
+		if !wanted[name] {
+			diff.removed = append(diff.removed, name)
+		}
+	}
+	sort.Strings(diff.removed)
+	return diff
+}
+
+// commandFingerprint encodes the parts of a command that we define, ignoring IDs,
+// versions and defaults that Discord fills in on registered commands
+func commandFingerprint(cmd *discordgo.ApplicationCommand, guildScoped bool) string {
+	normalized := discordgo.ApplicationCommand{
+		Name:                     cmd.Name,
+		Description:              cmd.Description,
+		DefaultMemberPermissions: cmd.DefaultMemberPermissions,
+		Options:                  normalizeOptions(cmd.Options),
+	}
+	// DM availability only applies to global commands
+	if !guildScoped {
+		allowDM := cmd.DMPermission == nil || *cmd.DMPermission
+		normalized.DMPermission = &allowDM
+	}
+
+	data, err := json.Marshal(normalized)
+	if err != nil {
+		// Never treat an unencodable command as unchanged
+		return fmt.Sprintf("unencodable: %v", err)
+	}
+	return string(data)
+}
+
+// normalizeOptions clears empty slices so that omitted and empty values compare equal
+func normalizeOptions(options []*discordgo.ApplicationCommandOption) []*discordgo.ApplicationCommandOption {
+	if len(options) == 0 {
+		return nil
+	}
+
+	normalized := make([]*discordgo.ApplicationCommandOption, 0, len(options))
+	for _, opt := range options {
+		copied := *opt
+		copied.Options = normalizeOptions(opt.Options)
+		if len(copied.Choices) == 0 {
+			copied.Choices = nil
+		}
+		if len(copied.ChannelTypes) == 0 {
+			copied.ChannelTypes = nil
+		}
+		normalized = append(normalized, &copied)
+	}
+	return normalized
+}
@@ -0,0 +1,159 @@
+package bot
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+func boolPtr(b bool) *bool {
+	return &b
+}
+
+func stringCommand(name, description string, options ...*discordgo.ApplicationCommandOption) *discordgo.ApplicationCommand {
+	return &discordgo.ApplicationCommand{Name: name, Description: description, Options: options}
+}
+
+// registered returns a command as Discord lists it, with the IDs and version it assigns
+func registered(cmd *discordgo.ApplicationCommand) *discordgo.ApplicationCommand {
+	copied := *cmd
+	copied.ID = "id-" + cmd.Name
+	copied.ApplicationID = "app-1"
+	copied.Version = "1"
+	copied.Type = discordgo.ChatApplicationCommand
+	return &copied
+}
+
+func TestDiffCommands(t *testing.T) {
+	option := func(name string, choices ...*discordgo.ApplicationCommandOptionChoice) *discordgo.ApplicationCommandOption {
+		return &discordgo.ApplicationCommandOption{Type: discordgo.ApplicationCommandOptionString, Name: name, Description: name, Choices: choices}
+	}
+	checkin := stringCommand("checkin", "Check in", option("task"))
+	report := stringCommand("report", "Show a report")
+
+	withDM := func(cmd *discordgo.ApplicationCommand, allow *bool) *discordgo.ApplicationCommand {
+		copied := *cmd
+		copied.DMPermission = allow
+		return &copied
+	}
+
+	tests := []struct {
+		name        string
+		existing    []*discordgo.ApplicationCommand
+		desired     []*discordgo.ApplicationCommand
+		guildScoped bool
+		want        commandDiff
+	}{
+		{
+			name:     "unchanged",
+			existing: []*discordgo.ApplicationCommand{registered(checkin), registered(report)},
+			desired:  []*discordgo.ApplicationCommand{checkin, report},
+		},
+		{
+			name:     "empty and omitted choices match",
+			existing: []*discordgo.ApplicationCommand{registered(stringCommand("checkin", "Check in", option("task")))},
+			desired:  []*discordgo.ApplicationCommand{stringCommand("checkin", "Check in", option("task", []*discordgo.ApplicationCommandOptionChoice{}...))},
+		},
+		{
+			name:     "added",
+			existing: []*discordgo.ApplicationCommand{registered(checkin)},
+			desired:  []*discordgo.ApplicationCommand{checkin, report},
+			want:     commandDiff{added: []string{"report"}},
+		},
+		{
+			name:     "removed, sorted",
+			existing: []*discordgo.ApplicationCommand{registered(report), registered(stringCommand("b", "b")), registered(checkin), registered(stringCommand("a", "a"))},
+			desired:  []*discordgo.ApplicationCommand{checkin, report},
+			want:     commandDiff{removed: []string{"a", "b"}},
+		},
+		{
+			name:     "description changed",
+			existing: []*discordgo.ApplicationCommand{registered(report)},
+			desired:  []*discordgo.ApplicationCommand{stringCommand("report", "Show a time report")},
+			want:     commandDiff{changed: []string{"report"}},
+		},
+		{
+			name:     "option choice added",
+			existing: []*discordgo.ApplicationCommand{registered(checkin)},
+			desired:  []*discordgo.ApplicationCommand{stringCommand("checkin", "Check in", option("task", &discordgo.ApplicationCommandOptionChoice{Name: "Docs", Value: "docs"}))},
+			want:     commandDiff{changed: []string{"checkin"}},
+		},
+		{
+			name:     "global DM default is allowed",
+			existing: []*discordgo.ApplicationCommand{registered(withDM(report, nil))},
+			desired:  []*discordgo.ApplicationCommand{withDM(report, boolPtr(true))},
+		},
+		{
+			name:     "global DM permission changed",
+			existing: []*discordgo.ApplicationCommand{registered(withDM(report, boolPtr(true)))},
+			desired:  []*discordgo.ApplicationCommand{withDM(report, boolPtr(false))},
+			want:     commandDiff{changed: []string{"report"}},
+		},
+		{
+			name:        "DM permission ignored in guilds",
+			existing:    []*discordgo.ApplicationCommand{registered(withDM(report, nil))},
+			desired:     []*discordgo.ApplicationCommand{withDM(report, boolPtr(false))},
+			guildScoped: true,
+		},
+		{
+			name:     "remove everything",
+			existing: []*discordgo.ApplicationCommand{registered(checkin)},
+			want:     commandDiff{removed: []string{"checkin"}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := diffCommands(tt.existing, tt.desired, tt.guildScoped)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Fatalf("diffCommands = %q, want %q", got, tt.want)
+			}
+			if got.empty() != tt.want.empty() {
+				t.Fatalf("empty() = %v", got.empty())
+			}
+		})
+	}
+}
+
+func TestCommandDiffString(t *testing.T) {
+	diff := commandDiff{added: []string{"a"}, changed: []string{"b", "c"}, removed: []string{"d"}}
+	if got, want := diff.String(), "added a; changed b, c; removed d"; got != want {
+		t.Fatalf("String() = %q, want %q", got, want)
+	}
+	if got := (commandDiff{}).String(); got != "" {
+		t.Fatalf("empty diff String() = %q", got)
+	}
+}
+
+// TestRegistryRoundTrip checks that the registry compares equal to itself after
+// a trip through Discord's JSON, so startup does not re-sync unchanged commands
+func TestRegistryRoundTrip(t *testing.T) {
+	for _, guildScoped := range []bool{true, false} {
+		desired := commandDefinitions()
+		data, err := json.Marshal(desired)
+		if err != nil {
+			t.Fatalf("encoding commands: %v", err)
+		}
+		var existing []*discordgo.ApplicationCommand
+		if err := json.Unmarshal(data, &existing); err != nil {
+			t.Fatalf("decoding commands: %v", err)
+		}
+		for i, cmd := range existing {
+			existing[i] = registered(cmd)
+		}
+
+		if diff := diffCommands(existing, desired, guildScoped); !diff.empty() {
+			t.Errorf("guild scoped %v: registry differs from itself: %s", guildScoped, diff)
+		}
+	}
+}
+
+func TestCommandFingerprintIgnoresDiscordFields(t *testing.T) {
+	cmd := stringCommand("report", "Show a report")
+	for _, guildScoped := range []bool{true, false} {
+		if commandFingerprint(cmd, guildScoped) != commandFingerprint(registered(cmd), guildScoped) {
+			t.Errorf("guild scoped %v: fingerprint depends on IDs or version", guildScoped)
+		}
+	}
+}
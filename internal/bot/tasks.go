@@ -0,0 +1,409 @@
+package bot
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+	"unicode"
+
+	"taskbot/internal/db"
+	"taskbot/internal/db/models"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/google/uuid"
+)
+
+const searchPageSize = 10
+
+func (b *Bot) handleTaskSearch(ctx context.Context, s Session, i *discordgo.InteractionCreate, options []*discordgo.ApplicationCommandInteractionDataOption) {
+	logCommand(i, "task search")
+
+	if i.GuildID == "" {
+		respondWithError(s, i, "This command must be used in a server")
+		return
+	}
+
+	user, err := b.getUserFromInteraction(ctx, s, i)
+	if err != nil || user == nil {
+		return
+	}
+
+	loc, err := time.LoadLocation(user.Timezone)
+	if err != nil {
+		loc = time.UTC
+	}
+
+	filter := models.TaskSearchFilter{
+		ServerID: i.GuildID,
+		Limit:    searchPageSize,
+	}
+	page := 1
+
+	for _, opt := range options {
+		switch opt.Name {
+		case "query":
+			filter.Query = opt.StringValue()
+		case "status":
+			completed := opt.StringValue() == "completed"
+			filter.Completed = &completed
+		case "username":
+			owner, err := b.db.GetUserByDiscordID(ctx, opt.StringValue())
+			if err != nil {
+				respondWithError(s, i, "Error getting user: "+err.Error())
+				return
+			}
+			if owner == nil {
+				respondWithError(s, i, "User not found")
+				return
+			}
+			filter.OwnerID = &owner.ID
+		case "project":
+			filter.Tag = opt.StringValue()
+		case "from":
+			since, err := parseDate(opt.StringValue(), loc)
+			if err != nil {
+				respondWithError(s, i, "Invalid start date. Please use YYYY-MM-DD")
+				return
+			}
+			filter.Since = since
+		case "to":
+			until, err := parseDate(opt.StringValue(), loc)
+			if err != nil {
+				respondWithError(s, i, "Invalid end date. Please use YYYY-MM-DD")
+				return
+			}
+			filter.Until = until.AddDate(0, 0, 1)
+		case "page":
+			page = int(opt.IntValue())
+		}
+	}
+
+	if page < 1 {
+		page = 1
+	}
+	filter.Offset = (page - 1) * searchPageSize
+
+	// Show the same people's tasks and time as /report does
+	users, err := b.db.GetGuildUsers(ctx, i.GuildID)
+	if err != nil {
+		respondWithError(s, i, "Error retrieving users: "+err.Error())
+		return
+	}
+	visibility, err := b.reportVisibility(ctx, s, i, user, users)
+	if err != nil {
+		respondWithError(s, i, "Error resolving search visibility: "+err.Error())
+		return
+	}
+	if filter.OwnerID != nil && !visibility.canSee(*filter.OwnerID) {
+		respondWithError(s, i, "You can only search the tasks of yourself and the teams you lead")
+		return
+	}
+	filter.VisibleUserIDs = visibility.userIDs()
+
+	results, total, err := b.db.SearchTasks(ctx, filter)
+	if err != nil {
+		b.logError(i, "SearchTasks", err)
+		respondWithError(s, i, "Error searching tasks: "+err.Error())
+		return
+	}
+
+	if total == 0 {
+		respondWithSuccess(s, i, "No tasks found")
+		return
+	}
+
+	pages := (total + searchPageSize - 1) / searchPageSize
+	if len(results) == 0 {
+		respondWithError(s, i, fmt.Sprintf("Page %d is out of range (%d pages)", page, pages))
+		return
+	}
+
+	var rows [][]string
+	for _, result := range results {
+		status := "Open"
+		if result.Task.Completed {
+			status = "Completed"
+		}
+		if result.Task.ArchivedAt != nil {
+			status = "Archived"
+		}
+		name := result.Task.Name
+		if result.Task.Global {
+			name += " [Global]"
+		}
+		rows = append(rows, []string{
+			truncateString(name, 30),
+			truncateString(result.OwnerName, 16),
+			status,
+			formatDuration(result.TimeSpent),
+			formatTime(result.Task.CreatedAt, user.Timezone)[:10],
+		})
+	}
+
+	message := fmt.Sprintf("# Task search\n%s\nPage %d of %d (%d tasks)",
+		formatTable([]string{"TASK", "OWNER", "STATUS", "LOGGED", "CREATED"}, rows),
+		page, pages, total)
+	respondWithSuccess(s, i, message)
+}
+
+func (b *Bot) handleTaskArchive(ctx context.Context, s Session, i *discordgo.InteractionCreate, options []*discordgo.ApplicationCommandInteractionDataOption) {
+	logCommand(i, "task archive")
+
+	if len(options) == 0 {
+		respondWithError(s, i, "Missing task")
+		return
+	}
+
+	taskID, err := uuid.Parse(options[0].StringValue())
+	if err != nil {
+		respondWithError(s, i, "Invalid task ID")
+		return
+	}
+
+	user, err := b.getUserFromInteraction(ctx, s, i)
+	if err != nil || user == nil {
+		return
+	}
+
+	task, err := b.db.GetTaskByID(ctx, taskID)
+	if err != nil {
+		respondWithError(s, i, "Error getting task: "+err.Error())
+		return
+	}
+	if task == nil || task.ServerID != i.GuildID {
+		respondWithError(s, i, "Task not found")
+		return
+	}
+	if task.ArchivedAt != nil {
+		respondWithError(s, i, "Task is already archived")
+		return
+	}
+
+	isUserAdmin := b.isAdmin(ctx, s, i)
+	if !isUserAdmin && task.UserID != user.ID {
+		respondWithError(s, i, "You can only archive your own tasks")
+		return
+	}
+
+	if err := b.db.ArchiveTask(ctx, taskID, user.ID); err != nil {
+		b.logError(i, "ArchiveTask", err)
+		respondWithError(s, i, "Error archiving task: "+err.Error())
+		return
+	}
+
+	respondWithSuccess(s, i, fmt.Sprintf("Task '%s' archived", task.Name))
+}
+
+func (b *Bot) handleTaskArchiveCompleted(ctx context.Context, s Session, i *discordgo.InteractionCreate, options []*discordgo.ApplicationCommandInteractionDataOption) {
+	logCommand(i, "task archive-completed")
+
+	if !b.isAdmin(ctx, s, i) {
+		respondWithError(s, i, "Only administrators can bulk archive tasks")
+		return
+	}
+
+	if len(options) == 0 || options[0].IntValue() < 1 {
+		respondWithError(s, i, "Please provide a number of days")
+		return
+	}
+	days := int(options[0].IntValue())
+
+	user, err := b.getUserFromInteraction(ctx, s, i)
+	if err != nil || user == nil {
+		return
+	}
+
+	cutoff := time.Now().AddDate(0, 0, -days)
+	archived, err := b.db.ArchiveCompletedTasks(ctx, i.GuildID, cutoff, user.ID)
+	if err != nil {
+		b.logError(i, "ArchiveCompletedTasks", err)
+		respondWithError(s, i, "Error archiving tasks: "+err.Error())
+		return
+	}
+
+	respondWithSuccess(s, i, fmt.Sprintf("Archived %d completed tasks with no activity in the last %d days", archived, days))
+}
+
+func (b *Bot) handleTaskDelete(ctx context.Context, s Session, i *discordgo.InteractionCreate, options []*discordgo.ApplicationCommandInteractionDataOption) {
+	logCommand(i, "task delete")
+
+	if !b.isAdmin(ctx, s, i) {
+		respondWithError(s, i, "Only administrators can delete tasks")
+		return
+	}
+
+	var taskID uuid.UUID
+	var reassignTo *uuid.UUID
+	for _, opt := range options {
+		id, err := uuid.Parse(opt.StringValue())
+		if err != nil {
+			respondWithError(s, i, "Invalid task ID")
+			return
+		}
+		switch opt.Name {
+		case "task":
+			taskID = id
+		case "reassign_to":
+			reassignTo = &id
+		}
+	}
+
+	if reassignTo != nil && *reassignTo == taskID {
+		respondWithError(s, i, "Cannot reassign check-ins to the task being deleted")
+		return
+	}
+
+	user, err := b.getUserFromInteraction(ctx, s, i)
+	if err != nil || user == nil {
+		return
+	}
+
+	task, err := b.db.GetTaskByID(ctx, taskID)
+	if err != nil {
+		respondWithError(s, i, "Error getting task: "+err.Error())
+		return
+	}
+	if task == nil || task.ServerID != i.GuildID {
+		respondWithError(s, i, "Task not found")
+		return
+	}
+
+	moved, err := b.db.DeleteTask(ctx, taskID, reassignTo, user.ID)
+	if errors.Is(err, db.ErrTaskHasCheckIns) {
+		respondWithError(s, i, fmt.Sprintf("Task '%s' has logged time. Choose a task to reassign its check-ins to, or archive it instead.", task.Name))
+		return
+	}
+	if err != nil {
+		b.logError(i, "DeleteTask", err)
+		respondWithError(s, i, "Error deleting task: "+err.Error())
+		return
+	}
+
+	message := fmt.Sprintf("Task '%s' deleted", task.Name)
+	if moved > 0 {
+		message += fmt.Sprintf(" (%d check-ins reassigned)", moved)
+	}
+	respondWithSuccess(s, i, message)
+}
+
+func (b *Bot) handleTaskMerge(ctx context.Context, s Session, i *discordgo.InteractionCreate, options []*discordgo.ApplicationCommandInteractionDataOption) {
+	logCommand(i, "task merge")
+
+	if !b.isAdmin(ctx, s, i) {
+		respondWithError(s, i, "Only administrators can merge tasks")
+		return
+	}
+
+	var sourceID, targetID uuid.UUID
+	for _, opt := range options {
+		id, err := uuid.Parse(opt.StringValue())
+		if err != nil {
+			respondWithError(s, i, "Invalid task ID")
+			return
+		}
+		switch opt.Name {
+		case "source":
+			sourceID = id
+		case "target":
+			targetID = id
+		}
+	}
+
+	if sourceID == targetID {
+		respondWithError(s, i, "Source and target must be different tasks")
+		return
+	}
+
+	user, err := b.getUserFromInteraction(ctx, s, i)
+	if err != nil || user == nil {
+		return
+	}
+
+	source, err := b.db.GetTaskByID(ctx, sourceID)
+	if err != nil {
+		respondWithError(s, i, "Error getting task: "+err.Error())
+		return
+	}
+	target, err := b.db.GetTaskByID(ctx, targetID)
+	if err != nil {
+		respondWithError(s, i, "Error getting task: "+err.Error())
+		return
+	}
+	if source == nil || target == nil || source.ServerID != i.GuildID || target.ServerID != i.GuildID {
+		respondWithError(s, i, "Task not found")
+		return
+	}
+	if target.ArchivedAt != nil {
+		respondWithError(s, i, fmt.Sprintf("Task '%s' is archived and cannot take merged check-ins", target.Name))
+		return
+	}
+
+	moved, err := b.db.MergeTasks(ctx, sourceID, targetID, user.ID)
+	if err != nil {
+		b.logError(i, "MergeTasks", err)
+		respondWithError(s, i, "Error merging tasks: "+err.Error())
+		return
+	}
+
+	respondWithSuccess(s, i, fmt.Sprintf("Merged '%s' into '%s' (%d check-ins moved)", source.Name, target.Name, moved))
+}
+
+// similarTaskNames reports whether two task names likely describe the same task,
+// ignoring case, punctuation and small typos
+func similarTaskNames(a, b string) bool {
+	na, nb := normalizeTaskName(a), normalizeTaskName(b)
+	if na == "" || nb == "" {
+		return false
+	}
+	if na == nb {
+		return true
+	}
+
+	shorter := len([]rune(na))
+	if n := len([]rune(nb)); n < shorter {
+		shorter = n
+	}
+	switch {
+	case shorter >= 10:
+		return editDistance(na, nb) <= 2
+	case shorter >= 5:
+		return editDistance(na, nb) <= 1
+	}
+	return false
+}
+
+// normalizeTaskName lower-cases a name and drops everything but letters and digits
+func normalizeTaskName(name string) string {
+	var sb strings.Builder
+	for _, r := range strings.ToLower(name) {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			sb.WriteRune(r)
+		}
+	}
+	return sb.String()
+}
+
+// editDistance computes the Levenshtein distance between two strings
+func editDistance(a, b string) int {
+	ra, rb := []rune(a), []rune(b)
+	prev := make([]int, len(rb)+1)
+	curr := make([]int, len(rb)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+
+	for i := 1; i <= len(ra); i++ {
+		curr[0] = i
+		for j := 1; j <= len(rb); j++ {
+			cost := 1
+			if ra[i-1] == rb[j-1] {
+				cost = 0
+			}
+			curr[j] = min(prev[j]+1, curr[j-1]+1, prev[j-1]+cost)
+		}
+		prev, curr = curr, prev
+	}
+	return prev[len(rb)]
+}
@@ -0,0 +1,335 @@
+package bot
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"taskbot/internal/db"
+	"taskbot/internal/db/models"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/google/uuid"
+)
+
+// reportVisibility lists the users whose details a report may show
+type reportVisibility struct {
+	all   bool
+	users map[uuid.UUID]bool
+}
+
+func (v reportVisibility) canSee(userID uuid.UUID) bool {
+	return v.all || v.users[userID]
+}
+
+// userIDs returns the users that may be seen, or nil when everyone may be
+func (v reportVisibility) userIDs() []uuid.UUID {
+	if v.all {
+		return nil
+	}
+	ids := make([]uuid.UUID, 0, len(v.users))
+	for id := range v.users {
+		ids = append(ids, id)
+	}
+	return ids
+}
+
+// reportVisibility decides whose details the caller may see in reports. Admins see
+// everyone, leads see themselves and the members of their teams, and members only
+// see themselves.
+func (b *Bot) reportVisibility(ctx context.Context, s Session, i *discordgo.InteractionCreate, caller *models.User, users []*models.User) (reportVisibility, error) {
+	visibility := reportVisibility{users: map[uuid.UUID]bool{caller.ID: true}}
+
+	role := b.callerRole(ctx, s, i)
+	if role.AtLeast(models.RoleAdmin) {
+		visibility.all = true
+		return visibility, nil
+	}
+	if !role.AtLeast(models.RoleLead) {
+		return visibility, nil
+	}
+
+	teams, err := b.db.GetTeams(ctx, i.GuildID)
+	if err != nil {
+		return visibility, err
+	}
+
+	callerRoles := make(map[string]bool)
+	if i.Member != nil {
+		for _, roleID := range i.Member.Roles {
+			callerRoles[roleID] = true
+		}
+	}
+	userIDs := make(map[string]uuid.UUID, len(users))
+	for _, user := range users {
+		userIDs[user.DiscordID] = user.ID
+	}
+
+	for _, team := range teams {
+		if team.DiscordRoleID != "" && !callerRoles[team.DiscordRoleID] {
+			continue
+		}
+		members, err := teamMembers(s, team, userIDs)
+		if err != nil {
+			return visibility, err
+		}
+		if team.DiscordRoleID == "" && !members[caller.ID] {
+			continue
+		}
+		for userID := range members {
+			visibility.users[userID] = true
+		}
+	}
+	return visibility, nil
+}
+
+// teamMembers returns the users in a team. Members of a role-backed team are the
+// guild members with the role that the bot knows about.
+func teamMembers(s Session, team *models.Team, userIDs map[string]uuid.UUID) (map[uuid.UUID]bool, error) {
+	members := make(map[uuid.UUID]bool)
+	if team.DiscordRoleID == "" {
+		for _, userID := range team.MemberIDs {
+			members[userID] = true
+		}
+		return members, nil
+	}
+
+	discordIDs, err := guildMembersWithRole(s, team.ServerID, team.DiscordRoleID)
+	if err != nil {
+		return nil, err
+	}
+	for _, discordID := range discordIDs {
+		if userID, ok := userIDs[discordID]; ok {
+			members[userID] = true
+		}
+	}
+	return members, nil
+}
+
+// guildMembersWithRole returns the Discord IDs of the guild members with a role
+func guildMembersWithRole(s Session, guildID, roleID string) ([]string, error) {
+	var discordIDs []string
+	after := ""
+	for {
+		members, err := s.GuildMembers(guildID, after, 1000)
+		if err != nil {
+			return nil, fmt.Errorf("error getting guild members: %w", err)
+		}
+		for _, member := range members {
+			for _, memberRole := range member.Roles {
+				if memberRole == roleID {
+					discordIDs = append(discordIDs, member.User.ID)
+					break
+				}
+			}
+		}
+		if len(members) < 1000 {
+			return discordIDs, nil
+		}
+		after = members[len(members)-1].User.ID
+	}
+}
+
+// findTeam returns the team of the guild with the given ID option value
+func (b *Bot) findTeam(ctx context.Context, guildID, value string) (*models.Team, error) {
+	teamID, err := uuid.Parse(value)
+	if err != nil {
+		return nil, db.ErrTeamNotFound
+	}
+	teams, err := b.db.GetTeams(ctx, guildID)
+	if err != nil {
+		return nil, err
+	}
+	for _, team := range teams {
+		if team.ID == teamID {
+			return team, nil
+		}
+	}
+	return nil, db.ErrTeamNotFound
+}
+
+func (b *Bot) handleTeam(ctx context.Context, s Session, i *discordgo.InteractionCreate) {
+	logCommand(i, "team")
+
+	if len(i.ApplicationCommandData().Options) == 0 {
+		respondWithError(s, i, "Invalid command options")
+		return
+	}
+
+	user, err := b.getUserFromInteraction(ctx, s, i)
+	if err != nil || user == nil {
+		return
+	}
+
+	subcommand := i.ApplicationCommandData().Options[0]
+	var name, roleID, teamValue, username string
+	for _, opt := range subcommand.Options {
+		switch opt.Name {
+		case "name":
+			name = strings.TrimSpace(opt.StringValue())
+		case "role":
+			roleID = fmt.Sprint(opt.Value)
+		case "team":
+			teamValue = opt.StringValue()
+		case "username":
+			username = opt.StringValue()
+		}
+	}
+
+	switch subcommand.Name {
+	case "create":
+		if name == "" {
+			respondWithError(s, i, "Team name cannot be empty")
+			return
+		}
+		team := &models.Team{
+			ID:            uuid.New(),
+			ServerID:      i.GuildID,
+			Name:          name,
+			DiscordRoleID: roleID,
+			CreatedBy:     user.ID,
+		}
+		if err := b.db.CreateTeam(ctx, team); err != nil {
+			if !errors.Is(err, db.ErrTeamExists) {
+				b.logError(i, "CreateTeam", err)
+			}
+			respondWithError(s, i, "Error creating team: "+err.Error())
+			return
+		}
+
+		if roleID != "" {
+			respondWithSuccess(s, i, fmt.Sprintf("Created team '%s' for everyone with <@&%s>", team.Name, roleID))
+		} else {
+			respondWithSuccess(s, i, fmt.Sprintf("Created team '%s'. Add members with `/team add`.", team.Name))
+		}
+
+	case "delete":
+		team, err := b.findTeam(ctx, i.GuildID, teamValue)
+		if err != nil {
+			respondWithError(s, i, "Error deleting team: "+err.Error())
+			return
+		}
+		if err := b.db.DeleteTeam(ctx, team.ID, i.GuildID, user.ID); err != nil {
+			respondWithError(s, i, "Error deleting team: "+err.Error())
+			return
+		}
+		respondWithSuccess(s, i, fmt.Sprintf("Team '%s' deleted", team.Name))
+
+	case "add", "remove":
+		team, err := b.findTeam(ctx, i.GuildID, teamValue)
+		if err != nil {
+			respondWithError(s, i, "Error updating team: "+err.Error())
+			return
+		}
+		if team.DiscordRoleID != "" {
+			respondWithError(s, i, fmt.Sprintf("Members of '%s' follow the <@&%s> role; change their roles in Discord instead", team.Name, team.DiscordRoleID))
+			return
+		}
+
+		member, err := b.db.GetUserByDiscordID(ctx, username)
+		if err != nil {
+			respondWithError(s, i, "Error getting user: "+err.Error())
+			return
+		}
+		if member == nil {
+			respondWithError(s, i, "Unknown user")
+			return
+		}
+
+		if subcommand.Name == "add" {
+			err = b.db.AddTeamMember(ctx, team.ID, i.GuildID, member.ID, user.ID)
+		} else {
+			err = b.db.RemoveTeamMember(ctx, team.ID, i.GuildID, member.ID, user.ID)
+		}
+		if err != nil {
+			respondWithError(s, i, "Error updating team: "+err.Error())
+			return
+		}
+
+		if subcommand.Name == "add" {
+			respondWithSuccess(s, i, fmt.Sprintf("Added %s to team '%s'", member.Username, team.Name))
+		} else {
+			respondWithSuccess(s, i, fmt.Sprintf("Removed %s from team '%s'", member.Username, team.Name))
+		}
+
+	case "list":
+		teams, err := b.db.GetTeams(ctx, i.GuildID)
+		if err != nil {
+			respondWithError(s, i, "Error retrieving teams: "+err.Error())
+			return
+		}
+		if len(teams) == 0 {
+			respondWithSuccess(s, i, "No teams configured")
+			return
+		}
+
+		roleNames := make(map[string]string)
+		if guild, err := s.Guild(i.GuildID); err == nil {
+			for _, role := range guild.Roles {
+				roleNames[role.ID] = role.Name
+			}
+		}
+
+		var rows [][]string
+		for _, team := range teams {
+			members := fmt.Sprintf("%d", len(team.MemberIDs))
+			if team.DiscordRoleID != "" {
+				roleName, ok := roleNames[team.DiscordRoleID]
+				if !ok {
+					roleName = team.DiscordRoleID
+				}
+				members = "role " + roleName
+			}
+			rows = append(rows, []string{truncateString(team.Name, 30), truncateString(members, 30)})
+		}
+		respondWithSuccess(s, i, "# Teams\n"+formatTable([]string{"NAME", "MEMBERS"}, rows))
+
+	default:
+		respondWithError(s, i, "Invalid subcommand")
+	}
+}
+
+// handleTeamAutocomplete suggests teams for the team option and users for the
+// username option
+func (b *Bot) handleTeamAutocomplete(ctx context.Context, s Session, i *discordgo.InteractionCreate) {
+	focused := focusedOption(i.ApplicationCommandData().Options)
+	if focused == nil {
+		return
+	}
+	if focused.Name == "username" {
+		b.handleUsernameAutocomplete(ctx, s, i)
+		return
+	}
+
+	teams, err := b.db.GetTeams(ctx, i.GuildID)
+	if err != nil {
+		interactionLogger(i).Error("Error getting teams for autocomplete", "error", err)
+		return
+	}
+
+	input := strings.ToLower(focused.StringValue())
+	var choices []*discordgo.ApplicationCommandOptionChoice
+	for _, team := range teams {
+		if !strings.Contains(strings.ToLower(team.Name), input) {
+			continue
+		}
+		choices = append(choices, &discordgo.ApplicationCommandOptionChoice{
+			Name:  team.Name,
+			Value: team.ID.String(),
+		})
+		if len(choices) >= 25 { // Discord limit
+			break
+		}
+	}
+
+	err = s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
+		Type: discordgo.InteractionApplicationCommandAutocompleteResult,
+		Data: &discordgo.InteractionResponseData{
+			Choices: choices,
+		},
+	})
+	if err != nil {
+		interactionLogger(i).Error("Error responding to autocomplete", "error", err)
+	}
+}
@@ -0,0 +1,273 @@
+package bot
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"taskbot/internal/db/models"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/google/uuid"
+)
+
+// How often the scheduler looks for due task templates
+const templateCheckInterval = time.Minute
+
+// templateNameMaxLength keeps template names, with their schedule, within
+// Discord's limit for autocomplete choices
+const templateNameMaxLength = 64
+
+// Supported template schedules
+var templateSchedules = []*discordgo.ApplicationCommandOptionChoice{
+	{Name: "Every day", Value: "daily"},
+	{Name: "Every weekday", Value: "weekdays"},
+	{Name: "Every Monday", Value: "monday"},
+	{Name: "Every Tuesday", Value: "tuesday"},
+	{Name: "Every Wednesday", Value: "wednesday"},
+	{Name: "Every Thursday", Value: "thursday"},
+	{Name: "Every Friday", Value: "friday"},
+	{Name: "Every Saturday", Value: "saturday"},
+	{Name: "Every Sunday", Value: "sunday"},
+}
+
+// scheduleMatches reports whether a template schedule runs on the given weekday
+func scheduleMatches(schedule string, day time.Weekday) bool {
+	switch schedule {
+	case "daily":
+		return true
+	case "weekdays":
+		return day != time.Saturday && day != time.Sunday
+	default:
+		return strings.EqualFold(schedule, day.String())
+	}
+}
+
+// nextOccurrence returns the first midnight in loc strictly after the given time
+// on which the schedule runs
+func nextOccurrence(schedule string, loc *time.Location, after time.Time) time.Time {
+	t := after.In(loc)
+	day := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, loc)
+	for i := 0; i < 8; i++ {
+		if day.After(after) && scheduleMatches(schedule, day.Weekday()) {
+			return day
+		}
+		day = day.AddDate(0, 0, 1)
+	}
+	return day
+}
+
+// scheduleName returns the human-readable name of a schedule value
+func scheduleName(schedule string) string {
+	for _, choice := range templateSchedules {
+		if choice.Value == schedule {
+			return choice.Name
+		}
+	}
+	return schedule
+}
+
+// runTemplateScheduler materializes due task templates until shutdown
+func (b *Bot) runTemplateScheduler() {
+	defer b.wg.Done()
+
+	ticker := time.NewTicker(templateCheckInterval)
+	defer ticker.Stop()
+
+	for {
+		ctx, cancel := context.WithTimeout(b.ctx, templateCheckInterval)
+		b.runDueTemplates(ctx, time.Now())
+		cancel()
+
+		select {
+		case <-b.shutdownCh:
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (b *Bot) runDueTemplates(ctx context.Context, now time.Time) {
+	templates, err := b.db.GetDueTaskTemplates(ctx, now)
+	if err != nil {
+		slog.Error("Error getting due task templates", "error", err)
+		return
+	}
+
+	for _, tmpl := range templates {
+		loc, err := time.LoadLocation(tmpl.Timezone)
+		if err != nil {
+			loc = time.UTC
+		}
+
+		runDate := tmpl.NextRunAt.In(loc)
+		task := &models.Task{
+			ID:          uuid.New(),
+			UserID:      tmpl.CreatedBy,
+			ServerID:    tmpl.ServerID,
+			Name:        fmt.Sprintf("%s (%s)", tmpl.Name, runDate.Format("2006-01-02")),
+			Description: tmpl.Description,
+			Global:      true,
+			CreatedAt:   now,
+		}
+
+		ran, err := b.db.RunTaskTemplate(ctx, tmpl.ID, task, nextOccurrence(tmpl.Schedule, loc, now))
+		if err != nil {
+			slog.Error("Error running task template", "guild_id", tmpl.ServerID, "template", tmpl.Name, "error", err)
+			b.serverLog(tmpl.ServerID, models.LogErrors, "Recurring task %q could not be created: %v", tmpl.Name, err)
+			continue
+		}
+		if ran {
+			slog.Info("Created recurring task", "guild_id", tmpl.ServerID, "task", task.Name)
+			b.publish(ctx, task.ServerID)
+		}
+	}
+}
+
+func (b *Bot) handleTemplate(ctx context.Context, s Session, i *discordgo.InteractionCreate) {
+	logCommand(i, "template")
+
+	if len(i.ApplicationCommandData().Options) == 0 {
+		respondWithError(s, i, "Invalid command options")
+		return
+	}
+
+	user, err := b.getUserFromInteraction(ctx, s, i)
+	if err != nil || user == nil {
+		return
+	}
+
+	subcommand := i.ApplicationCommandData().Options[0]
+	switch subcommand.Name {
+	case "create":
+		var name, description, schedule string
+		for _, opt := range subcommand.Options {
+			switch opt.Name {
+			case "name":
+				name = strings.TrimSpace(opt.StringValue())
+			case "schedule":
+				schedule = opt.StringValue()
+			case "description":
+				description = opt.StringValue()
+			}
+		}
+
+		if name == "" || utf8.RuneCountInString(name) > templateNameMaxLength {
+			respondWithError(s, i, fmt.Sprintf("Template names must be 1 to %d characters", templateNameMaxLength))
+			return
+		}
+
+		loc, err := time.LoadLocation(user.Timezone)
+		if err != nil {
+			loc = time.UTC
+		}
+
+		// Run today if the schedule matches, otherwise on the next matching day
+		now := time.Now().In(loc)
+		startOfToday := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, loc)
+
+		tmpl := &models.TaskTemplate{
+			ID:          uuid.New(),
+			ServerID:    i.GuildID,
+			Name:        name,
+			Description: description,
+			Schedule:    schedule,
+			Timezone:    loc.String(),
+			CreatedBy:   user.ID,
+			NextRunAt:   nextOccurrence(schedule, loc, startOfToday.Add(-time.Second)),
+			CreatedAt:   time.Now(),
+		}
+
+		if err := b.db.CreateTaskTemplate(ctx, tmpl); err != nil {
+			b.logError(i, "CreateTaskTemplate", err)
+			respondWithError(s, i, "Error creating template: "+err.Error())
+			return
+		}
+
+		respondWithSuccess(s, i, fmt.Sprintf("Created template '%s' (%s). Next task: %s",
+			tmpl.Name, scheduleName(tmpl.Schedule), formatTime(tmpl.NextRunAt, tmpl.Timezone)))
+
+	case "list":
+		templates, err := b.db.GetTaskTemplates(ctx, i.GuildID)
+		if err != nil {
+			respondWithError(s, i, "Error retrieving templates: "+err.Error())
+			return
+		}
+		if len(templates) == 0 {
+			respondWithSuccess(s, i, "No task templates configured")
+			return
+		}
+
+		var rows [][]string
+		for _, tmpl := range templates {
+			rows = append(rows, []string{
+				truncateString(tmpl.Name, 30),
+				scheduleName(tmpl.Schedule),
+				formatTime(tmpl.NextRunAt, tmpl.Timezone),
+				tmpl.Timezone,
+			})
+		}
+		respondWithSuccess(s, i, "# Task templates\n"+formatTable([]string{"NAME", "SCHEDULE", "NEXT RUN", "TIMEZONE"}, rows))
+
+	case "delete":
+		if len(subcommand.Options) == 0 {
+			respondWithError(s, i, "Missing template")
+			return
+		}
+		templateID, err := uuid.Parse(subcommand.Options[0].StringValue())
+		if err != nil {
+			respondWithError(s, i, "Invalid template ID")
+			return
+		}
+
+		if err := b.db.DeleteTaskTemplate(ctx, templateID, i.GuildID, user.ID); err != nil {
+			respondWithError(s, i, "Error deleting template: "+err.Error())
+			return
+		}
+		respondWithSuccess(s, i, "Template deleted. Tasks it already created are kept.")
+
+	default:
+		respondWithError(s, i, "Invalid subcommand")
+	}
+}
+
+func (b *Bot) handleTemplateAutocomplete(ctx context.Context, s Session, i *discordgo.InteractionCreate) {
+	focused := focusedOption(i.ApplicationCommandData().Options)
+	if focused == nil {
+		return
+	}
+
+	templates, err := b.db.GetTaskTemplates(ctx, i.GuildID)
+	if err != nil {
+		interactionLogger(i).Error("Error getting templates for autocomplete", "error", err)
+		return
+	}
+
+	input := strings.ToLower(focused.StringValue())
+	var choices []*discordgo.ApplicationCommandOptionChoice
+	for _, tmpl := range templates {
+		if !strings.Contains(strings.ToLower(tmpl.Name), input) {
+			continue
+		}
+		choices = append(choices, &discordgo.ApplicationCommandOptionChoice{
+			Name:  choiceLabel(fmt.Sprintf("%s (%s)", tmpl.Name, scheduleName(tmpl.Schedule))),
+			Value: tmpl.ID.String(),
+		})
+		if len(choices) >= 25 { // Discord limit
+			break
+		}
+	}
+
+	err = s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
+		Type: discordgo.InteractionApplicationCommandAutocompleteResult,
+		Data: &discordgo.InteractionResponseData{
+			Choices: choices,
+		},
+	})
+	if err != nil {
+		interactionLogger(i).Error("Error responding to autocomplete", "error", err)
+	}
+}
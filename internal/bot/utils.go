@@ -1,16 +1,43 @@
 package bot
 
 import (
+	"context"
 	"fmt"
-	"log"
+	"log/slog"
 	"strings"
 	"time"
+	"unicode/utf8"
 
 	"taskbot/internal/db/models"
 
 	"github.com/bwmarrin/discordgo"
 )
 
+// maxChoiceLength is the most characters Discord accepts in an autocomplete
+// choice name
+const maxChoiceLength = 100
+
+// shorten cuts s to at most maxLen characters, ending it with "..." when cut.
+// Multi-byte characters are never split.
+func shorten(s string, maxLen int) string {
+	if utf8.RuneCountInString(s) <= maxLen {
+		return s
+	}
+	return string([]rune(s)[:maxLen-3]) + "..."
+}
+
+// truncateString shortens s to maxLen characters, padding shorter strings with
+// spaces so that table columns line up
+func truncateString(s string, maxLen int) string {
+	s = shorten(s, maxLen)
+	return s + strings.Repeat(" ", maxLen-utf8.RuneCountInString(s))
+}
+
+// choiceLabel shortens an autocomplete choice name to what Discord accepts
+func choiceLabel(label string) string {
+	return shorten(label, maxChoiceLength)
+}
+
 // formatDuration formats a duration in a human-readable way
 func formatDuration(d time.Duration) string {
 	d = d.Round(time.Second)
@@ -30,39 +57,60 @@ func formatDuration(d time.Duration) string {
 }
 
 // respondWithError sends an error response to the user
-func respondWithError(s *discordgo.Session, i *discordgo.InteractionCreate, errMsg string) {
-	var username string
-	if i.Member != nil && i.Member.User != nil {
-		username = i.Member.User.Username
-	} else if i.User != nil {
-		username = i.User.Username
-	}
-
-	serverName := getServerName(s, i.GuildID)
-
-	log.Printf(formatLogMessage(
-		i.GuildID,
-		"Error: "+errMsg,
-		username,
-		serverName,
-	))
+func respondWithError(s Session, i *discordgo.InteractionCreate, errMsg string) {
+	logger := interactionLogger(i)
+	logger.Info("Responding with error", "reason", errMsg)
+	commandErrors.Inc(interactionCommand(i))
 
 	_, err := s.FollowupMessageCreate(i.Interaction, true, &discordgo.WebhookParams{
 		Content: "Error: " + errMsg,
 		Flags:   discordgo.MessageFlagsEphemeral,
 	})
 	if err != nil {
-		log.Printf(formatLogMessage(
-			i.GuildID,
-			"Error sending error response: "+err.Error(),
-			username,
-			serverName,
-		))
+		logger.Error("Error sending error response", "error", err)
+	}
+}
+
+// interactionLogger returns a logger carrying the interaction ID, guild, user and
+// command of an interaction
+func interactionLogger(i *discordgo.InteractionCreate) *slog.Logger {
+	attrs := []any{
+		"interaction_id", i.ID,
+		"guild_id", i.GuildID,
+		"user_id", interactionUserID(i),
+	}
+	if i.Member != nil && i.Member.User != nil {
+		attrs = append(attrs, "user", i.Member.User.Username)
+	} else if i.User != nil {
+		attrs = append(attrs, "user", i.User.Username)
+	}
+	if name := interactionCommand(i); name != "" {
+		attrs = append(attrs, "command", name)
+	}
+	return slog.With(attrs...)
+}
+
+// interactionCommand returns the name of the command an interaction is for, if any
+func interactionCommand(i *discordgo.InteractionCreate) string {
+	if i.Type != discordgo.InteractionApplicationCommand && i.Type != discordgo.InteractionApplicationCommandAutocomplete {
+		return ""
+	}
+	return i.ApplicationCommandData().Name
+}
+
+// interactionUserID returns the Discord ID of the user who sent the interaction
+func interactionUserID(i *discordgo.InteractionCreate) string {
+	if i.Member != nil && i.Member.User != nil {
+		return i.Member.User.ID
+	}
+	if i.User != nil {
+		return i.User.ID
 	}
+	return ""
 }
 
 // getUserFromInteraction gets or creates a user from the interaction
-func (b *Bot) getUserFromInteraction(s *discordgo.Session, i *discordgo.InteractionCreate) (*models.User, error) {
+func (b *Bot) getUserFromInteraction(ctx context.Context, s Session, i *discordgo.InteractionCreate) (*models.User, error) {
 	var userID, username string
 	if i.Member != nil && i.Member.User != nil {
 		// Server interaction
@@ -78,7 +126,7 @@ func (b *Bot) getUserFromInteraction(s *discordgo.Session, i *discordgo.Interact
 		return nil, err
 	}
 
-	user, err := b.db.GetOrCreateUser(userID, username)
+	user, err := b.db.GetOrCreateUser(ctx, userID, username)
 	if err != nil {
 		respondWithError(s, i, "Error getting user: "+err.Error())
 		return nil, err
@@ -95,100 +143,93 @@ func formatTime(t time.Time, timezone string) string {
 	return t.In(loc).Format("2006-01-02 15:04:05")
 }
 
+// parseDate parses a YYYY-MM-DD date option as midnight in the given location
+func parseDate(value string, loc *time.Location) (time.Time, error) {
+	return time.ParseInLocation("2006-01-02", value, loc)
+}
+
 // respondWithSuccess sends a success response to the user
-func respondWithSuccess(s *discordgo.Session, i *discordgo.InteractionCreate, msg string) {
+func respondWithSuccess(s Session, i *discordgo.InteractionCreate, msg string) {
 	_, err := s.FollowupMessageCreate(i.Interaction, true, &discordgo.WebhookParams{
 		Content: msg,
 		Flags:   discordgo.MessageFlagsEphemeral,
 	})
 	if err != nil {
-		log.Printf("Error sending success response: %v", err)
+		interactionLogger(i).Error("Error sending success response", "error", err)
 	}
 }
 
-// Update formatLogMessage to put username after server name
-func formatLogMessage(guildID, message, username, serverName string) string {
-	if serverName == "" {
-		serverName = "DM"
-		if guildID != "" {
-			serverName = guildID // Fallback to ID if name not provided
-		}
-	}
-	if username == "" {
-		username = "unknown"
+// respondWithFile sends a file as an ephemeral followup to a deferred interaction
+func respondWithFile(s Session, i *discordgo.InteractionCreate, msg string, file *discordgo.File) {
+	_, err := s.FollowupMessageCreate(i.Interaction, true, &discordgo.WebhookParams{
+		Content: msg,
+		Files:   []*discordgo.File{file},
+		Flags:   discordgo.MessageFlagsEphemeral,
+	})
+	if err != nil {
+		interactionLogger(i).Error("Error sending file response", "error", err)
 	}
-	return fmt.Sprintf("%s [%s]: %s (server: %s)",
-		guildID,
-		username,
-		message,
-		serverName)
 }
 
-// Add helper function to get server name
-func getServerName(s *discordgo.Session, guildID string) string {
-	if guildID == "" {
-		return "DM"
-	}
-	guild, err := s.Guild(guildID)
-	if err != nil {
-		return guildID // Fallback to ID if can't get guild
-	}
-	return guild.Name
+// logCommand logs a command invocation with its options
+func logCommand(i *discordgo.InteractionCreate, commandName string) {
+	interactionLogger(i).Info("Executing command", "handler", commandName, "options", commandOptions(i))
 }
 
-// Update logCommand to include optional details
-func logCommand(s *discordgo.Session, i *discordgo.InteractionCreate, commandName string) {
-	var username string
-	if i.Member != nil && i.Member.User != nil {
-		username = i.Member.User.Username
-	} else if i.User != nil {
-		username = i.User.Username
+// commandOptions renders the options of a command interaction as name:value pairs
+func commandOptions(i *discordgo.InteractionCreate) string {
+	var options []string
+	for _, opt := range i.ApplicationCommandData().Options {
+		options = append(options, formatOption(opt))
 	}
+	return strings.Join(options, " ")
+}
 
-	serverName := getServerName(s, i.GuildID)
+// redactedOptions are options holding URLs that may carry credentials, such as
+// webhook URLs; only their host is logged
+var redactedOptions = map[string]bool{"url": true}
 
-	// Format command options
-	var options []string
-	if i.ApplicationCommandData().Options != nil {
-		for _, opt := range i.ApplicationCommandData().Options {
-			options = append(options, fmt.Sprintf("%s:%v", opt.Name, opt.Value))
-		}
+// formatOption renders an option and its nested subcommand options as name:value
+func formatOption(opt *discordgo.ApplicationCommandInteractionDataOption) string {
+	if redactedOptions[opt.Name] {
+		return fmt.Sprintf("%s:%s/[redacted]", opt.Name, models.WebhookHost(fmt.Sprint(opt.Value)))
 	}
-	optionsStr := ""
-	if len(options) > 0 {
-		optionsStr = " [" + strings.Join(options, ", ") + "]"
+	if len(opt.Options) == 0 {
+		return fmt.Sprintf("%s:%v", opt.Name, opt.Value)
 	}
-
-	log.Printf(formatLogMessage(
-		i.GuildID,
-		fmt.Sprintf("executed /%s%s", commandName, optionsStr),
-		username,
-		serverName,
-	))
+	nested := make([]string, 0, len(opt.Options))
+	for _, child := range opt.Options {
+		nested = append(nested, formatOption(child))
+	}
+	return fmt.Sprintf("%s[%s]", opt.Name, strings.Join(nested, " "))
 }
 
-// Update logError to use the new format
-func logError(s *discordgo.Session, channelID string, errContext, errMsg string) {
-	guildID := "unknown"
-	serverName := "unknown"
+// logError logs a failed operation while handling an interaction and reports it
+// to the guild's log channel
+func (b *Bot) logError(i *discordgo.InteractionCreate, op string, err error) {
+	interactionLogger(i).Error("Operation failed", "op", op, "error", err)
+	operationErrors.Inc(op)
+	b.serverLog(i.GuildID, models.LogErrors, "/%s by %s: %s failed: %v", interactionCommand(i), interactionUsername(i), op, err)
+}
 
-	// Try to get channel info to get guild ID
-	if channel, err := s.Channel(channelID); err == nil {
-		guildID = channel.GuildID
-		if guild, err := s.Guild(channel.GuildID); err == nil {
-			serverName = guild.Name
-		}
+// interactionUsername returns the username of the user who sent the interaction
+func interactionUsername(i *discordgo.InteractionCreate) string {
+	if i.Member != nil && i.Member.User != nil {
+		return i.Member.User.Username
 	}
-
-	message := fmt.Sprintf("ERROR - %s: %s", errContext, errMsg)
-	log.Printf(formatLogMessage(guildID, message, "", serverName))
+	if i.User != nil {
+		return i.User.Username
+	}
+	return "unknown"
 }
 
-// sendServerLog sends a log message to the Discord server
-func sendServerLog(s *discordgo.Session, channelID string, message string) {
-	_, err := s.ChannelMessageSend(channelID, fmt.Sprintf("`%s`", message))
+// sendServerLog sends log lines to a server's log channel as a code block, which
+// also keeps user content from pinging anyone
+func sendServerLog(s Session, channelID string, message string) {
+	message = strings.ReplaceAll(message, "```", "'''")
+	_, err := s.ChannelMessageSend(channelID, "```\n"+message+"\n```")
 	if err != nil {
-		log.Printf("Error sending log to Discord: %v", err)
+		slog.Error("Error sending log to Discord", "channel_id", channelID, "error", err)
 	}
 }
 
@@ -234,21 +275,3 @@ func formatTable(headers []string, rows [][]string) string {
 
 	return result.String()
 }
-
-// Add this new function to handle permission checks
-func hasPermission(s *discordgo.Session, guildID string, userID string, requiredPermission int64) bool {
-	// If this is a DM channel (no guild), allow the action
-	if guildID == "" {
-		return true
-	}
-
-	// Just check if the user is a member of the guild
-	_, err := s.GuildMember(guildID, userID)
-	if err != nil {
-		log.Printf("Error checking guild membership for user %s in guild %s: %v", userID, guildID, err)
-		return false
-	}
-
-	// If we can get the member, they have permission to use the bot
-	return true
-}
@@ -0,0 +1,63 @@
+package bot
+
+import (
+	"strings"
+	"testing"
+	"unicode/utf8"
+)
+
+func TestShorten(t *testing.T) {
+	tests := []struct {
+		name   string
+		in     string
+		maxLen int
+		want   string
+	}{
+		{"short", "docs", 10, "docs"},
+		{"exact", "0123456789", 10, "0123456789"},
+		{"cut", "0123456789ab", 10, "0123456..."},
+		{"multi-byte kept whole", "ééééééééééé", 10, "ééééééé..."},
+		{"emoji", strings.Repeat("🚀", 12), 10, strings.Repeat("🚀", 7) + "..."},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := shorten(tt.in, tt.maxLen)
+			if got != tt.want {
+				t.Fatalf("shorten(%q, %d) = %q, want %q", tt.in, tt.maxLen, got, tt.want)
+			}
+			if !utf8.ValidString(got) {
+				t.Fatalf("shorten(%q, %d) is not valid UTF-8", tt.in, tt.maxLen)
+			}
+		})
+	}
+}
+
+func TestTruncateString(t *testing.T) {
+	tests := []struct {
+		in   string
+		want string
+	}{
+		{"abc", "abc   "},
+		{"café", "café  "},
+		{"abcdefgh", "abc..."},
+		{"ééééééé", "ééé..."},
+	}
+	for _, tt := range tests {
+		if got := truncateString(tt.in, 6); got != tt.want {
+			t.Errorf("truncateString(%q, 6) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestChoiceLabel(t *testing.T) {
+	label := choiceLabel(strings.Repeat("ü", 150))
+	if n := utf8.RuneCountInString(label); n != maxChoiceLength {
+		t.Fatalf("label has %d characters, want %d", n, maxChoiceLength)
+	}
+	if !utf8.ValidString(label) {
+		t.Fatal("label is not valid UTF-8")
+	}
+	if short := choiceLabel("Write docs"); short != "Write docs" {
+		t.Fatalf("short label changed to %q", short)
+	}
+}
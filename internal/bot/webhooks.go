@@ -0,0 +1,399 @@
+package bot
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strings"
+	"time"
+
+	"taskbot/internal/db"
+	"taskbot/internal/db/models"
+	"taskbot/internal/events"
+	"taskbot/internal/webhook"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/google/uuid"
+)
+
+const (
+	// webhookPollInterval is how often the outbox is checked for due deliveries
+	// when no new events wake the sender
+	webhookPollInterval = 15 * time.Second
+
+	// webhookBatchSize caps the deliveries attempted per pass over the outbox
+	webhookBatchSize = 50
+
+	// webhookLease is how long claimed deliveries are hidden from other instances
+	// of the bot; it outlasts a batch in which every delivery times out
+	webhookLease = webhookBatchSize*webhook.Timeout + time.Minute
+
+	// Failed deliveries are retried with exponential backoff from webhookRetryBase
+	// up to webhookRetryMax between attempts, and given up after
+	// webhookMaxAttempts, about three hours after the event
+	webhookRetryBase   = 30 * time.Second
+	webhookRetryMax    = time.Hour
+	webhookMaxAttempts = 10
+
+	// maxWebhooks caps the webhooks per guild
+	maxWebhooks = 10
+)
+
+// Event subscriptions offered by /webhook add; no events means every event
+var webhookSubscriptions = []struct {
+	name   string
+	value  string
+	events []events.Type
+}{
+	{"All events", "all", nil},
+	{"Check-ins and declared time", "checkins", []events.Type{events.CheckInStarted, events.CheckInEnded, events.TimeDeclared}},
+	{"Task changes", "tasks", []events.Type{events.TaskCreated, events.TaskCompleted, events.TaskReopened}},
+}
+
+func webhookSubscriptionChoices() []*discordgo.ApplicationCommandOptionChoice {
+	choices := make([]*discordgo.ApplicationCommandOptionChoice, 0, len(webhookSubscriptions))
+	for _, sub := range webhookSubscriptions {
+		choices = append(choices, &discordgo.ApplicationCommandOptionChoice{Name: sub.name, Value: sub.value})
+	}
+	return choices
+}
+
+// webhookBackoff returns the delay before the next attempt after a number of
+// failed ones
+func webhookBackoff(attempts int) time.Duration {
+	delay := webhookRetryBase
+	for n := 1; n < attempts && delay < webhookRetryMax; n++ {
+		delay *= 2
+	}
+	if delay > webhookRetryMax {
+		delay = webhookRetryMax
+	}
+	return delay
+}
+
+// webhookEventsText lists the events a webhook is subscribed to
+func webhookEventsText(hook *models.Webhook) string {
+	if len(hook.Events) == 0 {
+		return "all"
+	}
+	return strings.Join(hook.Events, ", ")
+}
+
+// wakeWebhooks makes the sender check the outbox without waiting for the next poll
+func (b *Bot) wakeWebhooks() {
+	select {
+	case b.webhookWake <- struct{}{}:
+	default:
+	}
+}
+
+// runWebhookSender posts queued webhook deliveries until shutdown. Deliveries
+// left in the outbox are sent after the next start.
+func (b *Bot) runWebhookSender() {
+	defer b.wg.Done()
+
+	ticker := time.NewTicker(webhookPollInterval)
+	defer ticker.Stop()
+
+	for {
+		b.sendDueWebhooks(b.ctx, time.Now())
+
+		select {
+		case <-b.shutdownCh:
+			return
+		case <-ticker.C:
+		case <-b.webhookWake:
+		}
+	}
+}
+
+func (b *Bot) sendDueWebhooks(ctx context.Context, now time.Time) {
+	deliveries, err := b.db.ClaimDueWebhookDeliveries(ctx, now, webhookLease, webhookBatchSize)
+	if err != nil {
+		if ctx.Err() == nil {
+			slog.Error("Error claiming due webhook deliveries", "error", err)
+		}
+		return
+	}
+
+	for _, delivery := range deliveries {
+		err := webhook.Deliver(ctx, webhook.Client, delivery, time.Now())
+		if ctx.Err() != nil {
+			// Shutting down; the delivery is retried once its lease runs out
+			return
+		}
+		b.recordWebhookAttempt(ctx, delivery, err)
+	}
+
+	// Keep going while the outbox has a backlog
+	if len(deliveries) == webhookBatchSize {
+		b.wakeWebhooks()
+	}
+}
+
+// recordWebhookAttempt removes a delivery from the outbox once it succeeded or
+// ran out of attempts, and otherwise schedules a retry
+func (b *Bot) recordWebhookAttempt(ctx context.Context, delivery *models.WebhookDelivery, deliveryErr error) {
+	now := time.Now()
+	logger := slog.With("guild_id", delivery.ServerID, "webhook_id", delivery.WebhookID,
+		"delivery_id", delivery.ID, "event", delivery.EventType)
+
+	var err error
+	switch attempts := delivery.Attempts + 1; {
+	case deliveryErr == nil:
+		webhookDeliveries.Inc("delivered")
+		logger.Debug("Delivered webhook")
+		err = b.db.CompleteWebhookDelivery(ctx, delivery, now, "")
+
+	case attempts >= webhookMaxAttempts:
+		webhookDeliveries.Inc("failed")
+		logger.Warn("Giving up on webhook delivery", "attempts", attempts, "error", deliveryErr)
+		b.serverLog(delivery.ServerID, models.LogErrors, "Webhook to %s gave up on a %s event after %d attempts: %v",
+			models.WebhookHost(delivery.URL), delivery.EventType, attempts, deliveryErr)
+		err = b.db.CompleteWebhookDelivery(ctx, delivery, now, deliveryErr.Error())
+
+	default:
+		webhookDeliveries.Inc("retried")
+		next := now.Add(webhookBackoff(attempts))
+		logger.Info("Webhook delivery failed, will retry", "attempts", attempts, "next_attempt", next, "error", deliveryErr)
+		err = b.db.RetryWebhookDelivery(ctx, delivery.ID, next, deliveryErr.Error())
+	}
+	if err != nil {
+		logger.Error("Error updating webhook delivery", "error", err)
+	}
+}
+
+func (b *Bot) handleWebhook(ctx context.Context, s Session, i *discordgo.InteractionCreate) {
+	logCommand(i, "webhook")
+
+	if len(i.ApplicationCommandData().Options) == 0 {
+		respondWithError(s, i, "Invalid command options")
+		return
+	}
+
+	user, err := b.getUserFromInteraction(ctx, s, i)
+	if err != nil || user == nil {
+		return
+	}
+
+	subcommand := i.ApplicationCommandData().Options[0]
+	switch subcommand.Name {
+	case "add":
+		b.addWebhook(ctx, s, i, user, subcommand.Options)
+
+	case "list":
+		webhooks, err := b.db.GetWebhooks(ctx, i.GuildID)
+		if err != nil {
+			respondWithError(s, i, "Error retrieving webhooks: "+err.Error())
+			return
+		}
+		if len(webhooks) == 0 {
+			respondWithSuccess(s, i, "No webhooks. Add one with `/webhook add`.")
+			return
+		}
+
+		var rows [][]string
+		for _, hook := range webhooks {
+			last := "never"
+			if hook.LastDeliveryAt != nil {
+				last = formatTime(*hook.LastDeliveryAt, user.Timezone)
+				if hook.LastError != "" {
+					last += " (failed)"
+				}
+			}
+			rows = append(rows, []string{
+				truncateString(models.WebhookHost(hook.URL), 30),
+				webhookEventsText(hook),
+				fmt.Sprint(hook.Pending),
+				last,
+			})
+		}
+		respondWithSuccess(s, i, "# Webhooks\n"+formatTable(
+			[]string{"HOST", "EVENTS", "PENDING", "LAST DELIVERY"}, rows))
+
+	case "remove", "test":
+		hook, err := b.webhookOption(ctx, i, subcommand.Options)
+		if err != nil {
+			respondWithError(s, i, "Error retrieving webhooks: "+err.Error())
+			return
+		}
+		if hook == nil {
+			respondWithError(s, i, "Webhook not found")
+			return
+		}
+
+		if subcommand.Name == "test" {
+			b.testWebhook(ctx, s, i, user, hook)
+			return
+		}
+
+		err = b.db.DeleteWebhook(ctx, hook.ID, i.GuildID, user.ID)
+		if errors.Is(err, db.ErrWebhookNotFound) {
+			respondWithError(s, i, "Webhook not found")
+			return
+		}
+		if err != nil {
+			respondWithError(s, i, "Error removing webhook: "+err.Error())
+			return
+		}
+		respondWithSuccess(s, i, fmt.Sprintf("Removed the webhook to %s and its %d pending deliveries", models.WebhookHost(hook.URL), hook.Pending))
+
+	default:
+		respondWithError(s, i, "Invalid subcommand")
+	}
+}
+
+// webhookOption returns the guild's webhook chosen in the webhook option, or nil
+// if there is no such webhook
+func (b *Bot) webhookOption(ctx context.Context, i *discordgo.InteractionCreate, options []*discordgo.ApplicationCommandInteractionDataOption) (*models.Webhook, error) {
+	var value string
+	for _, opt := range options {
+		if opt.Name == "webhook" {
+			value = opt.StringValue()
+		}
+	}
+
+	webhooks, err := b.db.GetWebhooks(ctx, i.GuildID)
+	if err != nil {
+		return nil, err
+	}
+	if id, err := uuid.Parse(value); err == nil {
+		for _, hook := range webhooks {
+			if hook.ID == id {
+				return hook, nil
+			}
+		}
+	}
+	return nil, nil
+}
+
+func (b *Bot) addWebhook(ctx context.Context, s Session, i *discordgo.InteractionCreate, user *models.User, options []*discordgo.ApplicationCommandInteractionDataOption) {
+	var rawURL string
+	subscription := webhookSubscriptions[0]
+	for _, opt := range options {
+		switch opt.Name {
+		case "url":
+			rawURL = strings.TrimSpace(opt.StringValue())
+		case "events":
+			for _, sub := range webhookSubscriptions {
+				if sub.value == opt.StringValue() {
+					subscription = sub
+				}
+			}
+		}
+	}
+	if err := webhook.ValidateURL(ctx, rawURL); err != nil {
+		switch {
+		case errors.Is(err, webhook.ErrInvalidURL):
+			respondWithError(s, i, "The URL must start with https:// or http://")
+		case errors.Is(err, webhook.ErrForbiddenAddress):
+			respondWithError(s, i, "Webhooks can only be sent to public addresses, not to loopback, private or link-local ones")
+		default:
+			respondWithError(s, i, "Could not resolve the webhook's host: "+models.WebhookHost(rawURL))
+		}
+		return
+	}
+
+	existing, err := b.db.GetWebhooks(ctx, i.GuildID)
+	if err != nil {
+		respondWithError(s, i, "Error retrieving webhooks: "+err.Error())
+		return
+	}
+	if len(existing) >= maxWebhooks {
+		respondWithError(s, i, fmt.Sprintf("This server already has %d webhooks; remove one first", maxWebhooks))
+		return
+	}
+
+	secret, err := webhook.NewSecret()
+	if err != nil {
+		b.logError(i, "NewSecret", err)
+		respondWithError(s, i, "Error creating webhook")
+		return
+	}
+
+	hook := &models.Webhook{
+		ID:        uuid.New(),
+		ServerID:  i.GuildID,
+		URL:       rawURL,
+		Secret:    secret,
+		Events:    []string{},
+		CreatedBy: user.ID,
+		CreatedAt: time.Now(),
+	}
+	for _, t := range subscription.events {
+		hook.Events = append(hook.Events, string(t))
+	}
+	if err := b.db.CreateWebhook(ctx, hook); err != nil {
+		b.logError(i, "CreateWebhook", err)
+		respondWithError(s, i, "Error creating webhook: "+err.Error())
+		return
+	}
+
+	respondWithSuccess(s, i, fmt.Sprintf("Added a webhook to %s for %s.\n"+
+		"Deliveries are signed with this secret; copy it now, it will not be shown again:\n```\n%s\n```\n"+
+		"Check the `%s` header against `sha256=HMAC-SHA256(secret, \"<%s>.<body>\")`. Use `/webhook test` to send a ping.",
+		models.WebhookHost(hook.URL), strings.ToLower(subscription.name), secret, webhook.HeaderSignature, webhook.HeaderTimestamp))
+}
+
+// testWebhook queues a ping event for one webhook, whatever it is subscribed to
+func (b *Bot) testWebhook(ctx context.Context, s Session, i *discordgo.InteractionCreate, user *models.User, hook *models.Webhook) {
+	actor := events.NewUser(user)
+	e := events.Event{
+		ID:      uuid.New(),
+		Type:    events.Ping,
+		GuildID: i.GuildID,
+		Time:    time.Now(),
+		Data:    events.PingData{User: actor},
+	}
+	payload, err := json.Marshal(e)
+	if err != nil {
+		respondWithError(s, i, "Error creating test event: "+err.Error())
+		return
+	}
+
+	if _, err := b.db.EnqueueWebhookEvent(ctx, i.GuildID, &hook.ID, string(e.Type), payload, e.Time); err != nil {
+		b.logError(i, "EnqueueWebhookEvent", err)
+		respondWithError(s, i, "Error queueing test event: "+err.Error())
+		return
+	}
+	b.wakeWebhooks()
+	respondWithSuccess(s, i, fmt.Sprintf("Queued a `%s` event for the webhook to %s. Check `/webhook list` for the result.", events.Ping, models.WebhookHost(hook.URL)))
+}
+
+func (b *Bot) handleWebhookAutocomplete(ctx context.Context, s Session, i *discordgo.InteractionCreate) {
+	focused := focusedOption(i.ApplicationCommandData().Options)
+	if focused == nil {
+		return
+	}
+
+	webhooks, err := b.db.GetWebhooks(ctx, i.GuildID)
+	if err != nil {
+		interactionLogger(i).Error("Error getting webhooks for autocomplete", "error", err)
+		return
+	}
+
+	input := strings.ToLower(focused.StringValue())
+	var choices []*discordgo.ApplicationCommandOptionChoice
+	for _, hook := range webhooks {
+		label := fmt.Sprintf("%s (%s, added %s)", models.WebhookHost(hook.URL), webhookEventsText(hook), hook.CreatedAt.Format("2006-01-02"))
+		if !strings.Contains(strings.ToLower(label), input) {
+			continue
+		}
+		choices = append(choices, &discordgo.ApplicationCommandOptionChoice{
+			Name:  choiceLabel(label),
+			Value: hook.ID.String(),
+		})
+	}
+
+	err = s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
+		Type: discordgo.InteractionApplicationCommandAutocompleteResult,
+		Data: &discordgo.InteractionResponseData{
+			Choices: choices,
+		},
+	})
+	if err != nil {
+		interactionLogger(i).Error("Error responding to autocomplete", "error", err)
+	}
+}
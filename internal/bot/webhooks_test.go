@@ -0,0 +1,36 @@
+package bot
+
+import (
+	"testing"
+	"time"
+)
+
+func TestWebhookBackoff(t *testing.T) {
+	tests := []struct {
+		attempts int
+		want     time.Duration
+	}{
+		{0, 30 * time.Second},
+		{1, 30 * time.Second},
+		{2, time.Minute},
+		{3, 2 * time.Minute},
+		{7, 32 * time.Minute},
+		{8, time.Hour},
+		{9, time.Hour},
+		{100, time.Hour},
+	}
+	for _, tt := range tests {
+		if got := webhookBackoff(tt.attempts); got != tt.want {
+			t.Errorf("webhookBackoff(%d) = %v, want %v", tt.attempts, got, tt.want)
+		}
+	}
+
+	// Deliveries are given up about three hours after the event
+	var total time.Duration
+	for attempts := 1; attempts < webhookMaxAttempts; attempts++ {
+		total += webhookBackoff(attempts)
+	}
+	if total < 3*time.Hour || total > 3*time.Hour+10*time.Minute {
+		t.Fatalf("retries span %v, want about three hours", total)
+	}
+}
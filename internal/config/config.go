@@ -14,6 +14,9 @@ type Config struct {
 		Token       string `yaml:"token" env:"DISCORD_TOKEN,required"`
 		ClientID    string `yaml:"client_id" env:"DISCORD_CLIENT_ID,required"`
 		Permissions int64  `yaml:"permissions" env:"DISCORD_PERMISSIONS"`
+		// GlobalCommands registers slash commands once for the application instead
+		// of per guild. Global command changes can take up to an hour to propagate.
+		GlobalCommands bool `yaml:"global_commands" env:"DISCORD_GLOBAL_COMMANDS"`
 	} `yaml:"discord"`
 
 	Database struct {
@@ -24,6 +27,23 @@ type Config struct {
 		DBName   string `yaml:"dbname" env:"DB_NAME,required"`
 		SSLMode  string `yaml:"sslmode" env:"DB_SSLMODE,required"`
 	} `yaml:"database"`
+
+	Logging struct {
+		// Level is one of debug, info, warn or error; defaults to info
+		Level string `yaml:"level" env:"LOG_LEVEL"`
+		// Format is text or json; defaults to text
+		Format string `yaml:"format" env:"LOG_FORMAT"`
+	} `yaml:"logging"`
+
+	HTTP struct {
+		// Addr is the listen address for /healthz, /metrics and the REST API
+		// under /api/v1, e.g. ":8080"; the listener is disabled when empty
+		Addr string `yaml:"addr" env:"HTTP_ADDR"`
+		// APIKey is an optional master key for the REST API that callers send
+		// as a bearer token to read every guild. Tokens created with /apitoken
+		// work without it.
+		APIKey string `yaml:"api_key" env:"HTTP_API_KEY"`
+	} `yaml:"http"`
 }
 
 var configPaths = []string{
@@ -83,6 +103,31 @@ func Load() (*Config, error) {
 		cfg.Discord.Permissions = perm
 	}
 
+	// Load global command registration from environment variable if present
+	if globalStr := os.Getenv("DISCORD_GLOBAL_COMMANDS"); globalStr != "" {
+		global, err := strconv.ParseBool(globalStr)
+		if err != nil {
+			return nil, fmt.Errorf("invalid DISCORD_GLOBAL_COMMANDS value: %w", err)
+		}
+		cfg.Discord.GlobalCommands = global
+	}
+
+	// Load logging options from environment variables if present
+	if level := os.Getenv("LOG_LEVEL"); level != "" {
+		cfg.Logging.Level = level
+	}
+	if format := os.Getenv("LOG_FORMAT"); format != "" {
+		cfg.Logging.Format = format
+	}
+
+	// Load the HTTP listen address from environment variable if present
+	if addr := os.Getenv("HTTP_ADDR"); addr != "" {
+		cfg.HTTP.Addr = addr
+	}
+	if apiKey := os.Getenv("HTTP_API_KEY"); apiKey != "" {
+		cfg.HTTP.APIKey = apiKey
+	}
+
 	// Convert DB_PORT from string to int if it's an environment variable
 	if portStr := os.Getenv("DB_PORT"); portStr != "" {
 		port, err := strconv.Atoi(portStr)
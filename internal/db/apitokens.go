@@ -0,0 +1,182 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"taskbot/internal/db/models"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+)
+
+// ErrAPITokenNotFound is returned when revoking a token that does not exist in the server
+var ErrAPITokenNotFound = errors.New("API token not found")
+
+const apiTokenColumns = `
+	a.id, a.server_id, a.user_id, u.username, u.discord_id, a.name, a.prefix, a.token_hash,
+	a.permissions, a.created_at, a.expires_at, a.last_used_at`
+
+func scanAPIToken(row pgx.Row) (*models.APIToken, error) {
+	token := &models.APIToken{}
+	var permissions []string
+	err := row.Scan(
+		&token.ID,
+		&token.ServerID,
+		&token.UserID,
+		&token.Username,
+		&token.DiscordID,
+		&token.Name,
+		&token.Prefix,
+		&token.TokenHash,
+		&permissions,
+		&token.CreatedAt,
+		&token.ExpiresAt,
+		&token.LastUsedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	for _, p := range permissions {
+		token.Permissions = append(token.Permissions, models.APIPermission(p))
+	}
+	return token, nil
+}
+
+func permissionNames(permissions []models.APIPermission) []string {
+	names := make([]string, 0, len(permissions))
+	for _, p := range permissions {
+		names = append(names, string(p))
+	}
+	return names
+}
+
+// CreateAPIToken stores a new API token; TokenHash must already be set
+func (db *DB) CreateAPIToken(ctx context.Context, token *models.APIToken) error {
+	if token.CreatedAt.IsZero() {
+		token.CreatedAt = time.Now()
+	}
+
+	query := `
+		INSERT INTO api_tokens (id, server_id, user_id, name, prefix, token_hash, permissions, created_at, expires_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)`
+
+	return db.withTx(ctx, func(tx pgx.Tx) error {
+		_, err := tx.Exec(ctx, query,
+			token.ID.String(),
+			token.ServerID,
+			token.UserID.String(),
+			token.Name,
+			token.Prefix,
+			token.TokenHash,
+			permissionNames(token.Permissions),
+			token.CreatedAt,
+			token.ExpiresAt,
+		)
+		if err != nil {
+			return fmt.Errorf("error creating API token: %w", err)
+		}
+
+		return recordAudit(ctx, tx, &models.AuditEvent{
+			ServerID:     token.ServerID,
+			ActorID:      &token.UserID,
+			TargetUserID: &token.UserID,
+			Action:       models.AuditAPITokenCreated,
+			Details: map[string]string{
+				"token_id":    token.ID.String(),
+				"name":        token.Name,
+				"permissions": strings.Join(permissionNames(token.Permissions), ","),
+				"expires_at":  token.ExpiresAt.Format(time.RFC3339),
+			},
+		})
+	})
+}
+
+// GetAPITokens returns a server's API tokens, including expired ones, newest
+// first. When userID is set only that user's tokens are returned.
+func (db *DB) GetAPITokens(ctx context.Context, serverID string, userID *uuid.UUID) ([]*models.APIToken, error) {
+	query := `
+		SELECT` + apiTokenColumns + `
+		FROM api_tokens a
+		JOIN users u ON u.id = a.user_id
+		WHERE a.server_id = $1 AND ($2::uuid IS NULL OR a.user_id = $2::uuid)
+		ORDER BY a.created_at DESC`
+
+	var userParam *string
+	if userID != nil {
+		id := userID.String()
+		userParam = &id
+	}
+	rows, err := db.Query(ctx, query, serverID, userParam)
+	if err != nil {
+		return nil, fmt.Errorf("error getting API tokens: %w", err)
+	}
+	defer rows.Close()
+
+	var tokens []*models.APIToken
+	for rows.Next() {
+		token, err := scanAPIToken(rows)
+		if err != nil {
+			return nil, fmt.Errorf("error scanning API token: %w", err)
+		}
+		tokens = append(tokens, token)
+	}
+	return tokens, rows.Err()
+}
+
+// UseAPIToken looks up an unexpired token by its hash and records that it was
+// used. It returns nil when no such token exists.
+func (db *DB) UseAPIToken(ctx context.Context, tokenHash string, now time.Time) (*models.APIToken, error) {
+	query := `
+		WITH used AS (
+			UPDATE api_tokens SET last_used_at = $2
+			WHERE token_hash = $1 AND expires_at > $2
+			RETURNING *
+		)
+		SELECT` + apiTokenColumns + `
+		FROM used a
+		JOIN users u ON u.id = a.user_id`
+
+	token, err := scanAPIToken(db.QueryRow(ctx, query, tokenHash, now))
+	if err == pgx.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error using API token: %w", err)
+	}
+	return token, nil
+}
+
+// RevokeAPIToken deletes an API token of a server
+func (db *DB) RevokeAPIToken(ctx context.Context, tokenID uuid.UUID, serverID string, actorID uuid.UUID) error {
+	query := `
+		DELETE FROM api_tokens
+		WHERE id = $1 AND server_id = $2
+		RETURNING user_id, name`
+
+	return db.withTx(ctx, func(tx pgx.Tx) error {
+		var ownerID uuid.UUID
+		var name string
+		err := tx.QueryRow(ctx, query, tokenID.String(), serverID).Scan(&ownerID, &name)
+		if err == pgx.ErrNoRows {
+			return ErrAPITokenNotFound
+		}
+		if err != nil {
+			return fmt.Errorf("error revoking API token: %w", err)
+		}
+
+		return recordAudit(ctx, tx, &models.AuditEvent{
+			ServerID:     serverID,
+			ActorID:      &actorID,
+			TargetUserID: &ownerID,
+			Action:       models.AuditAPITokenRevoked,
+			Details: map[string]string{
+				"token_id": tokenID.String(),
+				"name":     name,
+			},
+		})
+	})
+}
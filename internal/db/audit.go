@@ -0,0 +1,128 @@
+package db
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"taskbot/internal/db/models"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+)
+
+// recordAudit appends an audit event within the given transaction
+func recordAudit(ctx context.Context, tx pgx.Tx, event *models.AuditEvent) error {
+	if event.ID == uuid.Nil {
+		event.ID = uuid.New()
+	}
+	if event.CreatedAt.IsZero() {
+		event.CreatedAt = time.Now()
+	}
+	if event.Details == nil {
+		event.Details = map[string]string{}
+	}
+
+	details, err := json.Marshal(event.Details)
+	if err != nil {
+		return fmt.Errorf("error encoding audit details: %w", err)
+	}
+
+	query := `
+		INSERT INTO audit_events (id, server_id, actor_id, target_user_id, task_id, action, details, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7::jsonb, $8)`
+
+	_, err = tx.Exec(ctx, query,
+		event.ID.String(),
+		event.ServerID,
+		nullableUUID(event.ActorID),
+		nullableUUID(event.TargetUserID),
+		nullableUUID(event.TaskID),
+		event.Action,
+		string(details),
+		event.CreatedAt,
+	)
+	if err != nil {
+		return fmt.Errorf("error recording audit event: %w", err)
+	}
+	return nil
+}
+
+// GetAuditEvents returns audit events for a server matching the filter, newest first
+func (db *DB) GetAuditEvents(ctx context.Context, filter models.AuditFilter) ([]*models.AuditEvent, error) {
+	conditions := []string{"a.server_id = $1"}
+	args := []any{filter.ServerID}
+
+	if filter.UserID != nil {
+		args = append(args, filter.UserID.String())
+		conditions = append(conditions, fmt.Sprintf("(a.actor_id = $%d OR a.target_user_id = $%d)", len(args), len(args)))
+	}
+	if filter.TaskID != nil {
+		args = append(args, filter.TaskID.String())
+		conditions = append(conditions, fmt.Sprintf("a.task_id = $%d", len(args)))
+	}
+	if !filter.Since.IsZero() {
+		args = append(args, filter.Since)
+		conditions = append(conditions, fmt.Sprintf("a.created_at >= $%d", len(args)))
+	}
+	if !filter.Until.IsZero() {
+		args = append(args, filter.Until)
+		conditions = append(conditions, fmt.Sprintf("a.created_at < $%d", len(args)))
+	}
+
+	limit := filter.Limit
+	if limit <= 0 {
+		limit = 50
+	}
+	args = append(args, limit)
+
+	query := fmt.Sprintf(`
+		SELECT a.id, a.server_id, a.actor_id, COALESCE(u.username, ''), a.target_user_id, a.task_id,
+			a.action, a.details::text, a.created_at
+		FROM audit_events a
+		LEFT JOIN users u ON a.actor_id = u.id
+		WHERE %s
+		ORDER BY a.created_at DESC
+		LIMIT $%d`, strings.Join(conditions, " AND "), len(args))
+
+	rows, err := db.Query(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("error getting audit events: %w", err)
+	}
+	defer rows.Close()
+
+	var events []*models.AuditEvent
+	for rows.Next() {
+		event := &models.AuditEvent{}
+		var details string
+		err := rows.Scan(
+			&event.ID,
+			&event.ServerID,
+			&event.ActorID,
+			&event.ActorName,
+			&event.TargetUserID,
+			&event.TaskID,
+			&event.Action,
+			&details,
+			&event.CreatedAt,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("error scanning audit event: %w", err)
+		}
+		if err := json.Unmarshal([]byte(details), &event.Details); err != nil {
+			return nil, fmt.Errorf("error decoding audit details: %w", err)
+		}
+		events = append(events, event)
+	}
+	return events, rows.Err()
+}
+
+// nullableUUID converts an optional UUID into a query argument
+func nullableUUID(id *uuid.UUID) any {
+	if id == nil {
+		return nil
+	}
+	return id.String()
+}
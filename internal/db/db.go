@@ -3,16 +3,33 @@ package db
 import (
 	"context"
 	"database/sql"
+	"errors"
 	"fmt"
+	"strings"
 	"time"
 
 	"taskbot/internal/db/models"
+	"taskbot/internal/events"
 
 	"github.com/google/uuid"
 	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
 	"github.com/jackc/pgx/v5/pgxpool"
 )
 
+// activeCheckInIndex is the partial unique index allowing one active check-in
+// per user per server
+const activeCheckInIndex = "idx_check_ins_one_active"
+
+var (
+	// ErrActiveCheckInConflict is returned when starting a check-in while another
+	// one became active for the same user and server concurrently
+	ErrActiveCheckInConflict = errors.New("another check-in is already active")
+
+	// ErrCheckInNotActive is returned when ending a check-in that has already ended
+	ErrCheckInNotActive = errors.New("check-in is no longer active")
+)
+
 type DB struct {
 	*pgxpool.Pool
 }
@@ -50,45 +67,136 @@ func New(config struct {
 	return &DB{pool}, nil
 }
 
+// isActiveCheckInViolation reports whether err is a violation of activeCheckInIndex
+func isActiveCheckInViolation(err error) bool {
+	var pgErr *pgconn.PgError
+	return errors.As(err, &pgErr) && pgErr.Code == "23505" && pgErr.ConstraintName == activeCheckInIndex
+}
+
+// withTx runs fn inside a transaction, committing only if fn succeeds
+func (db *DB) withTx(ctx context.Context, fn func(tx pgx.Tx) error) error {
+	tx, err := db.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("error starting transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	if err := fn(tx); err != nil {
+		return err
+	}
+	return tx.Commit(ctx)
+}
+
 // CreateTask creates a new task in the database
-func (db *DB) CreateTask(task *models.Task) error {
+func (db *DB) CreateTask(ctx context.Context, task *models.Task) error {
 	query := `
-		INSERT INTO tasks (id, user_id, server_id, name, description, tags, completed, global, created_at)
-		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)`
-
-	_, err := db.Exec(context.Background(), query,
-		task.ID.String(),
-		task.UserID.String(),
-		task.ServerID,
-		task.Name,
-		task.Description,
-		task.Tags,
-		task.Completed,
-		task.Global,
-		task.CreatedAt,
-	)
-	return err
+		INSERT INTO tasks (id, user_id, server_id, parent_id, name, description, tags, completed, global, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)`
+
+	details := map[string]string{
+		"name":   task.Name,
+		"global": fmt.Sprintf("%t", task.Global),
+	}
+	if task.ParentID != nil {
+		details["parent_id"] = task.ParentID.String()
+	}
+
+	return db.withTx(ctx, func(tx pgx.Tx) error {
+		_, err := tx.Exec(ctx, query,
+			task.ID.String(),
+			task.UserID.String(),
+			task.ServerID,
+			nullableUUID(task.ParentID),
+			task.Name,
+			task.Description,
+			task.Tags,
+			task.Completed,
+			task.Global,
+			task.CreatedAt,
+		)
+		if err != nil {
+			return err
+		}
+
+		err = recordAudit(ctx, tx, &models.AuditEvent{
+			ServerID:     task.ServerID,
+			ActorID:      &task.UserID,
+			TargetUserID: &task.UserID,
+			TaskID:       &task.ID,
+			Action:       models.AuditTaskCreated,
+			Details:      details,
+		})
+		if err != nil {
+			return err
+		}
+		return recordTaskEvent(ctx, tx, events.TaskCreated, task.ServerID, task.ID, &task.UserID)
+	})
 }
 
-// CreateCheckIn creates a new check-in record
-func (db *DB) CreateCheckIn(checkIn *models.CheckIn) error {
+// CreateCheckIn creates a new check-in record. A check-in with an end time is
+// stored as a declared, inactive record.
+func (db *DB) CreateCheckIn(ctx context.Context, checkIn *models.CheckIn) error {
+	return db.withTx(ctx, func(tx pgx.Tx) error {
+		return insertCheckIn(ctx, tx, checkIn)
+	})
+}
+
+// insertCheckIn inserts a check-in and its audit event inside tx
+func insertCheckIn(ctx context.Context, tx pgx.Tx, checkIn *models.CheckIn) error {
 	query := `
-		INSERT INTO check_ins (id, user_id, server_id, task_id, start_time, active)
-		VALUES ($1, $2, $3, $4, $5, $6)`
+		INSERT INTO check_ins (id, user_id, server_id, task_id, start_time, end_time, active)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)`
+
+	action := models.AuditCheckInStarted
+	details := map[string]string{
+		"start_time": checkIn.StartTime.UTC().Format(time.RFC3339),
+	}
+	var endTime sql.NullTime
+	if checkIn.EndTime != nil {
+		action = models.AuditCheckInDeclared
+		endTime = sql.NullTime{Time: *checkIn.EndTime, Valid: true}
+		details["end_time"] = checkIn.EndTime.UTC().Format(time.RFC3339)
+		details["duration"] = checkIn.EndTime.Sub(checkIn.StartTime).String()
+	}
+	checkIn.Active = checkIn.EndTime == nil
 
-	_, err := db.Exec(context.Background(), query,
+	_, err := tx.Exec(ctx, query,
 		checkIn.ID.String(),
 		checkIn.UserID.String(),
 		checkIn.ServerID,
 		checkIn.TaskID.String(),
 		checkIn.StartTime,
-		true,
+		endTime,
+		checkIn.Active,
 	)
-	return err
+	if isActiveCheckInViolation(err) {
+		return ErrActiveCheckInConflict
+	}
+	if err != nil {
+		return err
+	}
+
+	err = recordAudit(ctx, tx, &models.AuditEvent{
+		ServerID:     checkIn.ServerID,
+		ActorID:      &checkIn.UserID,
+		TargetUserID: &checkIn.UserID,
+		TaskID:       &checkIn.TaskID,
+		Action:       action,
+		Details:      details,
+	})
+	if err != nil {
+		return err
+	}
+
+	eventType := events.CheckInStarted
+	if !checkIn.Active {
+		eventType = events.TimeDeclared
+	}
+	return recordCheckInEvent(ctx, tx, eventType, checkIn)
 }
 
 // GetActiveCheckIn gets the active check-in for a user if one exists
-func (db *DB) GetActiveCheckIn(userID uuid.UUID, serverID string) (*models.CheckIn, error) {
+func (db *DB) GetActiveCheckIn(ctx context.Context, userID uuid.UUID, serverID string) (*models.CheckIn, error) {
 	query := `
 		SELECT id, user_id, server_id, task_id, start_time, end_time, active
 		FROM check_ins
@@ -97,7 +205,7 @@ func (db *DB) GetActiveCheckIn(userID uuid.UUID, serverID string) (*models.Check
 
 	var checkIn models.CheckIn
 	var endTime sql.NullTime
-	err := db.QueryRow(context.Background(), query, userID.String(), serverID).Scan(
+	err := db.QueryRow(ctx, query, userID.String(), serverID).Scan(
 		&checkIn.ID,
 		&checkIn.UserID,
 		&checkIn.ServerID,
@@ -119,50 +227,147 @@ func (db *DB) GetActiveCheckIn(userID uuid.UUID, serverID string) (*models.Check
 }
 
 // CheckOut updates the end_time of a check-in
-func (db *DB) CheckOut(checkInID uuid.UUID) error {
-	// First get the check-in to validate it exists and isn't already checked out
-	query := `
-		SELECT start_time
-		FROM check_ins
-		WHERE id = $1 AND end_time IS NULL`
+func (db *DB) CheckOut(ctx context.Context, checkInID uuid.UUID) error {
+	return db.withTx(ctx, func(tx pgx.Tx) error {
+		query := `
+			SELECT id, user_id, server_id, task_id, start_time
+			FROM check_ins
+			WHERE id = $1 AND end_time IS NULL
+			FOR UPDATE`
+
+		var checkIn models.CheckIn
+		err := tx.QueryRow(ctx, query, checkInID.String()).Scan(
+			&checkIn.ID,
+			&checkIn.UserID,
+			&checkIn.ServerID,
+			&checkIn.TaskID,
+			&checkIn.StartTime,
+		)
+		if err == pgx.ErrNoRows {
+			return fmt.Errorf("error getting check-in: %w", ErrCheckInNotActive)
+		}
+		if err != nil {
+			return fmt.Errorf("error getting check-in: %w", err)
+		}
+
+		return closeCheckIn(ctx, tx, &checkIn)
+	})
+}
+
+// SwitchCheckIn atomically ends the user's active check-in in the server, if any,
+// and starts checkIn. The ended check-in is returned, or nil if there was none.
+func (db *DB) SwitchCheckIn(ctx context.Context, checkIn *models.CheckIn) (*models.CheckIn, error) {
+	return db.replaceActiveCheckIn(ctx, checkIn)
+}
+
+// DeclareCheckIn atomically stores checkIn, which has an end time, as declared
+// time and ends the user's active check-in in the server, if any. The ended
+// check-in is returned, or nil if there was none.
+func (db *DB) DeclareCheckIn(ctx context.Context, checkIn *models.CheckIn) (*models.CheckIn, error) {
+	return db.replaceActiveCheckIn(ctx, checkIn)
+}
+
+// replaceActiveCheckIn ends the user's active check-in in the server, if any, and
+// inserts checkIn in one transaction
+func (db *DB) replaceActiveCheckIn(ctx context.Context, checkIn *models.CheckIn) (*models.CheckIn, error) {
+	var previous *models.CheckIn
+
+	err := db.withTx(ctx, func(tx pgx.Tx) error {
+		query := `
+			SELECT id, user_id, server_id, task_id, start_time
+			FROM check_ins
+			WHERE user_id = $1 AND server_id = $2 AND active = true
+			FOR UPDATE`
+
+		var active models.CheckIn
+		err := tx.QueryRow(ctx, query, checkIn.UserID.String(), checkIn.ServerID).Scan(
+			&active.ID,
+			&active.UserID,
+			&active.ServerID,
+			&active.TaskID,
+			&active.StartTime,
+		)
+		switch {
+		case err == pgx.ErrNoRows:
+		case err != nil:
+			return fmt.Errorf("error getting active check-in: %w", err)
+		default:
+			if err := closeCheckIn(ctx, tx, &active); err != nil {
+				return fmt.Errorf("error checking out: %w", err)
+			}
+			previous = &active
+		}
 
-	var startTime time.Time
-	err := db.QueryRow(context.Background(), query, checkInID.String()).Scan(&startTime)
+		return insertCheckIn(ctx, tx, checkIn)
+	})
 	if err != nil {
-		return fmt.Errorf("error getting check-in: %w", err)
+		return nil, err
 	}
+	return previous, nil
+}
 
+// closeCheckIn ends an active check-in now and records the audit event inside tx.
+// The end and active fields of checkIn are updated to match the stored row.
+func closeCheckIn(ctx context.Context, tx pgx.Tx, checkIn *models.CheckIn) error {
 	// Calculate end time
 	endTime := time.Now()
-	if endTime.Before(startTime) {
-		endTime = startTime.Add(time.Second)
+	if endTime.Before(checkIn.StartTime) {
+		endTime = checkIn.StartTime.Add(time.Second)
 	}
 
-	query = `
+	query := `
 		UPDATE check_ins
 		SET end_time = $1, active = false
 		WHERE id = $2 AND end_time IS NULL`
 
-	_, err = db.Exec(context.Background(), query, endTime, checkInID.String())
-	return err
+	tag, err := tx.Exec(ctx, query, endTime, checkIn.ID.String())
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrCheckInNotActive
+	}
+	checkIn.EndTime = &endTime
+	checkIn.Active = false
+
+	err = recordAudit(ctx, tx, &models.AuditEvent{
+		ServerID:     checkIn.ServerID,
+		ActorID:      &checkIn.UserID,
+		TargetUserID: &checkIn.UserID,
+		TaskID:       &checkIn.TaskID,
+		Action:       models.AuditCheckInEnded,
+		Details: map[string]string{
+			"start_time": checkIn.StartTime.UTC().Format(time.RFC3339),
+			"end_time":   endTime.UTC().Format(time.RFC3339),
+			"duration":   endTime.Sub(checkIn.StartTime).Round(time.Second).String(),
+		},
+	})
+	if err != nil {
+		return err
+	}
+	return recordCheckInEvent(ctx, tx, events.CheckInEnded, checkIn)
 }
 
 // GetTaskByID retrieves a task by its ID
-func (db *DB) GetTaskByID(taskID uuid.UUID) (*models.Task, error) {
+func (db *DB) GetTaskByID(ctx context.Context, taskID uuid.UUID) (*models.Task, error) {
 	query := `
-		SELECT id, user_id, name, description, tags, completed, created_at
+		SELECT id, user_id, server_id, parent_id, name, description, tags, completed, global, created_at, archived_at
 		FROM tasks
 		WHERE id = $1`
 
 	task := &models.Task{}
-	err := db.QueryRow(context.Background(), query, taskID.String()).Scan(
+	err := db.QueryRow(ctx, query, taskID.String()).Scan(
 		&task.ID,
 		&task.UserID,
+		&task.ServerID,
+		&task.ParentID,
 		&task.Name,
 		&task.Description,
 		&task.Tags,
 		&task.Completed,
+		&task.Global,
 		&task.CreatedAt,
+		&task.ArchivedAt,
 	)
 	if err == pgx.ErrNoRows {
 		return nil, nil
@@ -170,8 +375,34 @@ func (db *DB) GetTaskByID(taskID uuid.UUID) (*models.Task, error) {
 	return task, err
 }
 
+// CountActiveCheckIns returns the number of active check-ins per server
+func (db *DB) CountActiveCheckIns(ctx context.Context) (map[string]int, error) {
+	query := `
+		SELECT server_id, COUNT(*)
+		FROM check_ins
+		WHERE active = true
+		GROUP BY server_id`
+
+	rows, err := db.Query(ctx, query)
+	if err != nil {
+		return nil, fmt.Errorf("error counting active check-ins: %w", err)
+	}
+	defer rows.Close()
+
+	counts := make(map[string]int)
+	for rows.Next() {
+		var serverID string
+		var count int
+		if err := rows.Scan(&serverID, &count); err != nil {
+			return nil, fmt.Errorf("error scanning active check-in count: %w", err)
+		}
+		counts[serverID] = count
+	}
+	return counts, rows.Err()
+}
+
 // GetAllActiveCheckIns returns all active check-ins for a server
-func (db *DB) GetAllActiveCheckIns(guildID string) ([]*models.CheckInWithTask, error) {
+func (db *DB) GetAllActiveCheckIns(ctx context.Context, guildID string) ([]*models.CheckInWithTask, error) {
 	query := `
 		SELECT 
 			ci.id, ci.user_id, ci.server_id, ci.task_id, ci.start_time, ci.end_time, ci.active,
@@ -184,7 +415,7 @@ func (db *DB) GetAllActiveCheckIns(guildID string) ([]*models.CheckInWithTask, e
 		AND ci.active = true 
 		AND ci.end_time IS NULL`
 
-	rows, err := db.Query(context.Background(), query, guildID)
+	rows, err := db.Query(ctx, query, guildID)
 	if err != nil {
 		return nil, fmt.Errorf("error getting active check-ins: %w", err)
 	}
@@ -218,7 +449,7 @@ func (db *DB) GetAllActiveCheckIns(guildID string) ([]*models.CheckInWithTask, e
 }
 
 // GetTaskHistory retrieves completed check-ins for a user within a date range
-func (db *DB) GetTaskHistory(userID uuid.UUID, startDate, endDate time.Time) ([]*models.CheckInWithTask, error) {
+func (db *DB) GetTaskHistory(ctx context.Context, userID uuid.UUID, startDate, endDate time.Time) ([]*models.CheckInWithTask, error) {
 	query := `
 		SELECT 
 			c.id, c.user_id, c.task_id, c.start_time, c.end_time,
@@ -231,7 +462,7 @@ func (db *DB) GetTaskHistory(userID uuid.UUID, startDate, endDate time.Time) ([]
 		AND c.end_time IS NOT NULL
 		ORDER BY c.start_time DESC`
 
-	rows, err := db.Query(context.Background(), query, userID.String(), startDate, endDate)
+	rows, err := db.Query(ctx, query, userID.String(), startDate, endDate)
 	if err != nil {
 		return nil, err
 	}
@@ -261,21 +492,23 @@ func (db *DB) GetTaskHistory(userID uuid.UUID, startDate, endDate time.Time) ([]
 }
 
 // GetAllTaskHistory returns all task history for a server within a time range
-func (db *DB) GetAllTaskHistory(guildID string, startDate, endDate time.Time) ([]*models.CheckInWithTask, error) {
+func (db *DB) GetAllTaskHistory(ctx context.Context, guildID string, startDate, endDate time.Time) ([]*models.CheckInWithTask, error) {
 	query := `
 		SELECT 
 			ci.id, ci.user_id, ci.server_id, ci.task_id, ci.start_time, ci.end_time, ci.active,
-			t.id, t.user_id, t.server_id, t.name, t.description, t.tags, t.completed, t.global, t.created_at,
-			u.id, u.discord_id, u.username, u.timezone, u.created_at
+			t.id, t.user_id, t.server_id, t.parent_id, t.name, t.description, t.tags, t.completed, t.global, t.created_at,
+			u.id, u.discord_id, u.username, u.timezone, u.created_at,
+			p.name
 		FROM check_ins ci
 		JOIN tasks t ON ci.task_id = t.id
 		JOIN users u ON ci.user_id = u.id
+		LEFT JOIN tasks p ON t.parent_id = p.id
 		WHERE ci.server_id = $1 
 		AND ci.start_time >= $2 
 		AND (ci.end_time <= $3 OR ci.end_time IS NULL)
 		ORDER BY ci.start_time DESC`
 
-	rows, err := db.Query(context.Background(), query, guildID, startDate, endDate)
+	rows, err := db.Query(ctx, query, guildID, startDate, endDate)
 	if err != nil {
 		return nil, fmt.Errorf("error getting task history: %w", err)
 	}
@@ -286,30 +519,36 @@ func (db *DB) GetAllTaskHistory(guildID string, startDate, endDate time.Time) ([
 		checkIn := &models.CheckIn{}
 		task := &models.Task{}
 		user := &models.User{}
+		var parentName *string
 
 		err := rows.Scan(
 			&checkIn.ID, &checkIn.UserID, &checkIn.ServerID, &checkIn.TaskID,
 			&checkIn.StartTime, &checkIn.EndTime, &checkIn.Active,
-			&task.ID, &task.UserID, &task.ServerID, &task.Name, &task.Description,
+			&task.ID, &task.UserID, &task.ServerID, &task.ParentID, &task.Name, &task.Description,
 			&task.Tags, &task.Completed, &task.Global, &task.CreatedAt,
 			&user.ID, &user.DiscordID, &user.Username, &user.Timezone, &user.CreatedAt,
+			&parentName,
 		)
 		if err != nil {
 			return nil, fmt.Errorf("error scanning check-in: %w", err)
 		}
 
-		history = append(history, &models.CheckInWithTask{
+		entry := &models.CheckInWithTask{
 			CheckIn: checkIn,
 			Task:    task,
 			User:    user,
-		})
+		}
+		if task.ParentID != nil && parentName != nil {
+			entry.Parent = &models.Task{ID: *task.ParentID, Name: *parentName}
+		}
+		history = append(history, entry)
 	}
 
 	return history, nil
 }
 
 // GetOrCreateUser retrieves a user by Discord ID or creates a new one
-func (db *DB) GetOrCreateUser(discordID string, username string) (*models.User, error) {
+func (db *DB) GetOrCreateUser(ctx context.Context, discordID string, username string) (*models.User, error) {
 	// Try to get existing user
 	query := `
 		SELECT id, discord_id, username, timezone, created_at
@@ -317,7 +556,7 @@ func (db *DB) GetOrCreateUser(discordID string, username string) (*models.User,
 		WHERE discord_id = $1`
 
 	user := &models.User{}
-	err := db.QueryRow(context.Background(), query, discordID).Scan(
+	err := db.QueryRow(ctx, query, discordID).Scan(
 		&user.ID,
 		&user.DiscordID,
 		&user.Username,
@@ -339,7 +578,7 @@ func (db *DB) GetOrCreateUser(discordID string, username string) (*models.User,
 			INSERT INTO users (id, discord_id, username, timezone, created_at)
 			VALUES ($1, $2, $3, $4, $5)`
 
-		_, err = db.Exec(context.Background(), insertQuery,
+		_, err = db.Exec(ctx, insertQuery,
 			user.ID.String(),
 			user.DiscordID,
 			user.Username,
@@ -359,29 +598,47 @@ func (db *DB) GetOrCreateUser(discordID string, username string) (*models.User,
 	return user, nil
 }
 
-// UpdateUserTimezone updates a user's timezone
-func (db *DB) UpdateUserTimezone(userID uuid.UUID, timezone string) error {
+// UpdateUserTimezone updates a user's timezone, auditing the change in the given server
+func (db *DB) UpdateUserTimezone(ctx context.Context, userID uuid.UUID, serverID string, timezone string) error {
 	query := `
-		UPDATE users
+		UPDATE users u
 		SET timezone = $1
-		WHERE id = $2`
+		FROM (SELECT timezone FROM users WHERE id = $2) old
+		WHERE u.id = $2
+		RETURNING old.timezone`
+
+	return db.withTx(ctx, func(tx pgx.Tx) error {
+		var oldTimezone string
+		if err := tx.QueryRow(ctx, query, timezone, userID.String()).Scan(&oldTimezone); err != nil {
+			return err
+		}
 
-	_, err := db.Exec(context.Background(), query, timezone, userID.String())
-	return err
+		return recordAudit(ctx, tx, &models.AuditEvent{
+			ServerID:     serverID,
+			ActorID:      &userID,
+			TargetUserID: &userID,
+			Action:       models.AuditTimezoneChanged,
+			Details: map[string]string{
+				"from": oldTimezone,
+				"to":   timezone,
+			},
+		})
+	})
 }
 
 // GetCheckInByID retrieves a check-in by its ID
-func (db *DB) GetCheckInByID(checkInID uuid.UUID) (*models.CheckIn, error) {
+func (db *DB) GetCheckInByID(ctx context.Context, checkInID uuid.UUID) (*models.CheckIn, error) {
 	query := `
-		SELECT id, user_id, task_id, start_time, end_time, active
+		SELECT id, user_id, server_id, task_id, start_time, end_time, active
 		FROM check_ins
 		WHERE id = $1`
 
 	var checkIn models.CheckIn
 	var endTime sql.NullTime
-	err := db.QueryRow(context.Background(), query, checkInID.String()).Scan(
+	err := db.QueryRow(ctx, query, checkInID.String()).Scan(
 		&checkIn.ID,
 		&checkIn.UserID,
+		&checkIn.ServerID,
 		&checkIn.TaskID,
 		&checkIn.StartTime,
 		&endTime,
@@ -400,14 +657,14 @@ func (db *DB) GetCheckInByID(checkInID uuid.UUID) (*models.CheckIn, error) {
 }
 
 // GetUserTasks retrieves all tasks for a user in a specific server
-func (db *DB) GetUserTasks(userID uuid.UUID, serverID string) ([]*models.Task, error) {
+func (db *DB) GetUserTasks(ctx context.Context, userID uuid.UUID, serverID string) ([]*models.Task, error) {
 	query := `
 		SELECT id, user_id, server_id, name, description, tags, completed, global, created_at
 		FROM tasks
-		WHERE (user_id = $1 OR global = true) AND server_id = $2
+		WHERE (user_id = $1 OR global = true) AND server_id = $2 AND archived_at IS NULL
 		ORDER BY created_at DESC`
 
-	rows, err := db.Query(context.Background(), query, userID.String(), serverID)
+	rows, err := db.Query(ctx, query, userID.String(), serverID)
 	if err != nil {
 		return nil, err
 	}
@@ -435,8 +692,128 @@ func (db *DB) GetUserTasks(userID uuid.UUID, serverID string) ([]*models.Task, e
 	return tasks, rows.Err()
 }
 
+// GetTaskSuggestions retrieves the tasks available to a user in a server along with
+// the user's check-in statistics, most recently used first
+func (db *DB) GetTaskSuggestions(ctx context.Context, userID uuid.UUID, serverID string) ([]*models.TaskUsage, error) {
+	query := `
+		SELECT
+			t.id, t.user_id, t.server_id, t.parent_id, t.name, t.description, t.tags, t.completed, t.global, t.created_at,
+			COALESCE(p.name, ''), stats.last_used, COALESCE(stats.use_count, 0)
+		FROM tasks t
+		LEFT JOIN tasks p ON t.parent_id = p.id
+		LEFT JOIN (
+			SELECT task_id, MAX(start_time) AS last_used, COUNT(*) AS use_count
+			FROM check_ins
+			WHERE user_id = $1 AND server_id = $2
+			GROUP BY task_id
+		) stats ON stats.task_id = t.id
+		WHERE (t.user_id = $1 OR t.global = true) AND t.server_id = $2 AND t.archived_at IS NULL
+		ORDER BY stats.last_used DESC NULLS LAST, COALESCE(stats.use_count, 0) DESC, t.created_at DESC`
+
+	rows, err := db.Query(ctx, query, userID.String(), serverID)
+	if err != nil {
+		return nil, fmt.Errorf("error getting task suggestions: %w", err)
+	}
+	defer rows.Close()
+
+	var usages []*models.TaskUsage
+	for rows.Next() {
+		task := &models.Task{}
+		usage := &models.TaskUsage{Task: task}
+		err := rows.Scan(
+			&task.ID,
+			&task.UserID,
+			&task.ServerID,
+			&task.ParentID,
+			&task.Name,
+			&task.Description,
+			&task.Tags,
+			&task.Completed,
+			&task.Global,
+			&task.CreatedAt,
+			&usage.ParentName,
+			&usage.LastUsed,
+			&usage.UseCount,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("error scanning task suggestion: %w", err)
+		}
+		usages = append(usages, usage)
+	}
+	return usages, rows.Err()
+}
+
+// GetServerTaskSuggestions retrieves every task in a server, archived ones
+// included, with its owner's name and check-in statistics across all users, most
+// recently used first
+func (db *DB) GetServerTaskSuggestions(ctx context.Context, serverID string) ([]*models.TaskUsage, error) {
+	query := `
+		SELECT
+			t.id, t.user_id, t.server_id, t.parent_id, t.name, t.description, t.tags, t.completed, t.global, t.created_at,
+			t.archived_at, COALESCE(p.name, ''), u.username, stats.last_used, COALESCE(stats.use_count, 0)
+		FROM tasks t
+		JOIN users u ON u.id = t.user_id
+		LEFT JOIN tasks p ON t.parent_id = p.id
+		LEFT JOIN (
+			SELECT task_id, MAX(start_time) AS last_used, COUNT(*) AS use_count
+			FROM check_ins
+			WHERE server_id = $1
+			GROUP BY task_id
+		) stats ON stats.task_id = t.id
+		WHERE t.server_id = $1
+		ORDER BY stats.last_used DESC NULLS LAST, COALESCE(stats.use_count, 0) DESC, t.created_at DESC`
+
+	rows, err := db.Query(ctx, query, serverID)
+	if err != nil {
+		return nil, fmt.Errorf("error getting server task suggestions: %w", err)
+	}
+	defer rows.Close()
+
+	var usages []*models.TaskUsage
+	for rows.Next() {
+		task := &models.Task{}
+		usage := &models.TaskUsage{Task: task}
+		err := rows.Scan(
+			&task.ID,
+			&task.UserID,
+			&task.ServerID,
+			&task.ParentID,
+			&task.Name,
+			&task.Description,
+			&task.Tags,
+			&task.Completed,
+			&task.Global,
+			&task.CreatedAt,
+			&task.ArchivedAt,
+			&usage.ParentName,
+			&usage.OwnerName,
+			&usage.LastUsed,
+			&usage.UseCount,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("error scanning task suggestion: %w", err)
+		}
+		usages = append(usages, usage)
+	}
+	return usages, rows.Err()
+}
+
+// CountOpenSubtasks returns how many subtasks of a task are not completed
+func (db *DB) CountOpenSubtasks(ctx context.Context, taskID uuid.UUID) (int, error) {
+	query := `
+		SELECT COUNT(*)
+		FROM tasks
+		WHERE parent_id = $1 AND completed = false AND archived_at IS NULL`
+
+	var count int
+	if err := db.QueryRow(ctx, query, taskID.String()).Scan(&count); err != nil {
+		return 0, fmt.Errorf("error counting subtasks: %w", err)
+	}
+	return count, nil
+}
+
 // GetAllUsers retrieves all users from the database
-func (db *DB) GetAllUsers() ([]*models.User, error) {
+func (db *DB) GetAllUsers(ctx context.Context) ([]*models.User, error) {
 	query := `
 		SELECT DISTINCT 
 			u.id, 
@@ -451,7 +828,7 @@ func (db *DB) GetAllUsers() ([]*models.User, error) {
 			has_activity,
 			u.username ASC`
 
-	rows, err := db.Query(context.Background(), query)
+	rows, err := db.Query(ctx, query)
 	if err != nil {
 		return nil, err
 	}
@@ -478,18 +855,22 @@ func (db *DB) GetAllUsers() ([]*models.User, error) {
 }
 
 // GetServerSettings retrieves settings for a specific server
-func (db *DB) GetServerSettings(serverID string) (*models.ServerSettings, error) {
+func (db *DB) GetServerSettings(ctx context.Context, serverID string) (*models.ServerSettings, error) {
 	query := `
-		SELECT id, server_id, inactivity_limit, ping_timeout, created_at
+		SELECT id, server_id, inactivity_limit, ping_timeout, log_channel_id, log_categories, created_at
 		FROM server_settings
 		WHERE server_id = $1`
 
 	settings := &models.ServerSettings{}
-	err := db.QueryRow(context.Background(), query, serverID).Scan(
+	var logChannelID *string
+	var logCategories []string
+	err := db.QueryRow(ctx, query, serverID).Scan(
 		&settings.ID,
 		&settings.ServerID,
 		&settings.InactivityLimit,
 		&settings.PingTimeout,
+		&logChannelID,
+		&logCategories,
 		&settings.CreatedAt,
 	)
 
@@ -500,16 +881,23 @@ func (db *DB) GetServerSettings(serverID string) (*models.ServerSettings, error)
 		return nil, fmt.Errorf("error getting server settings: %w", err)
 	}
 
+	if logChannelID != nil {
+		settings.LogChannelID = *logChannelID
+	}
+	for _, category := range logCategories {
+		settings.LogCategories = append(settings.LogCategories, models.LogCategory(category))
+	}
 	return settings, nil
 }
 
 // CreateServerSettings creates new settings for a server with default values
-func (db *DB) CreateServerSettings(serverID string) (*models.ServerSettings, error) {
+func (db *DB) CreateServerSettings(ctx context.Context, serverID string) (*models.ServerSettings, error) {
 	settings := &models.ServerSettings{
 		ID:              uuid.New(),
 		ServerID:        serverID,
 		InactivityLimit: 30, // Default 30 minutes
 		PingTimeout:     5,  // Default 5 minutes
+		LogCategories:   append([]models.LogCategory(nil), models.DefaultLogCategories...),
 		CreatedAt:       time.Now(),
 	}
 
@@ -517,13 +905,27 @@ func (db *DB) CreateServerSettings(serverID string) (*models.ServerSettings, err
 		INSERT INTO server_settings (id, server_id, inactivity_limit, ping_timeout, created_at)
 		VALUES ($1, $2, $3, $4, $5)`
 
-	_, err := db.Exec(context.Background(), query,
-		settings.ID.String(),
-		settings.ServerID,
-		settings.InactivityLimit,
-		settings.PingTimeout,
-		settings.CreatedAt,
-	)
+	err := db.withTx(ctx, func(tx pgx.Tx) error {
+		_, err := tx.Exec(ctx, query,
+			settings.ID.String(),
+			settings.ServerID,
+			settings.InactivityLimit,
+			settings.PingTimeout,
+			settings.CreatedAt,
+		)
+		if err != nil {
+			return err
+		}
+
+		return recordAudit(ctx, tx, &models.AuditEvent{
+			ServerID: settings.ServerID,
+			Action:   models.AuditSettingsCreated,
+			Details: map[string]string{
+				"inactivity_limit": fmt.Sprintf("%d", settings.InactivityLimit),
+				"ping_timeout":     fmt.Sprintf("%d", settings.PingTimeout),
+			},
+		})
+	})
 	if err != nil {
 		return nil, fmt.Errorf("error creating server settings: %w", err)
 	}
@@ -532,26 +934,82 @@ func (db *DB) CreateServerSettings(serverID string) (*models.ServerSettings, err
 }
 
 // GetOrCreateServerSettings retrieves server settings or creates them with defaults
-func (db *DB) GetOrCreateServerSettings(serverID string) (*models.ServerSettings, error) {
-	settings, err := db.GetServerSettings(serverID)
+func (db *DB) GetOrCreateServerSettings(ctx context.Context, serverID string) (*models.ServerSettings, error) {
+	settings, err := db.GetServerSettings(ctx, serverID)
 	if err != nil {
 		return nil, err
 	}
 	if settings == nil {
-		return db.CreateServerSettings(serverID)
+		return db.CreateServerSettings(ctx, serverID)
 	}
 	return settings, nil
 }
 
+// SetLogChannel sets the channel that receives a server's log events and the
+// categories posted there. An empty channel ID turns the log channel off.
+func (db *DB) SetLogChannel(ctx context.Context, serverID, channelID string, categories []models.LogCategory, actorID uuid.UUID) error {
+	names := make([]string, 0, len(categories))
+	for _, category := range categories {
+		names = append(names, string(category))
+	}
+
+	query := `
+		INSERT INTO server_settings (id, server_id, log_channel_id, log_categories, created_at)
+		VALUES ($1, $2, NULLIF($3, ''), $4, NOW())
+		ON CONFLICT (server_id)
+		DO UPDATE SET log_channel_id = EXCLUDED.log_channel_id, log_categories = EXCLUDED.log_categories`
+
+	return db.withTx(ctx, func(tx pgx.Tx) error {
+		_, err := tx.Exec(ctx, query, uuid.New().String(), serverID, channelID, names)
+		if err != nil {
+			return fmt.Errorf("error setting log channel: %w", err)
+		}
+
+		return recordAudit(ctx, tx, &models.AuditEvent{
+			ServerID: serverID,
+			ActorID:  &actorID,
+			Action:   models.AuditLogChannelSet,
+			Details: map[string]string{
+				"channel_id": channelID,
+				"categories": strings.Join(names, ","),
+			},
+		})
+	})
+}
+
+// GetUserByDiscordID retrieves a user by Discord ID, returning nil if unknown
+func (db *DB) GetUserByDiscordID(ctx context.Context, discordID string) (*models.User, error) {
+	query := `
+		SELECT id, discord_id, username, timezone, created_at
+		FROM users
+		WHERE discord_id = $1`
+
+	user := &models.User{}
+	err := db.QueryRow(ctx, query, discordID).Scan(
+		&user.ID,
+		&user.DiscordID,
+		&user.Username,
+		&user.Timezone,
+		&user.CreatedAt,
+	)
+	if err == pgx.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error getting user: %w", err)
+	}
+	return user, nil
+}
+
 // GetUserByID retrieves a user by their ID
-func (db *DB) GetUserByID(userID uuid.UUID) (*models.User, error) {
+func (db *DB) GetUserByID(ctx context.Context, userID uuid.UUID) (*models.User, error) {
 	query := `
 		SELECT id, discord_id, username, timezone, created_at
 		FROM users
 		WHERE id = $1`
 
 	user := &models.User{}
-	err := db.QueryRow(context.Background(), query, userID.String()).Scan(
+	err := db.QueryRow(ctx, query, userID.String()).Scan(
 		&user.ID,
 		&user.DiscordID,
 		&user.Username,
@@ -567,35 +1025,72 @@ func (db *DB) GetUserByID(userID uuid.UUID) (*models.User, error) {
 	return user, nil
 }
 
-// UpdateTaskStatus updates a task's completed status
-func (db *DB) UpdateTaskStatus(taskID uuid.UUID, completed bool) error {
+// UpdateTaskStatus updates a task's completed status on behalf of actorID, who
+// acts as an admin on someone else's task when adminAction is set. Nothing is
+// recorded when the task already has that status.
+func (db *DB) UpdateTaskStatus(ctx context.Context, taskID uuid.UUID, completed bool, actorID uuid.UUID, adminAction bool) error {
 	query := `
 		UPDATE tasks
 		SET completed = $1
-		WHERE id = $2
+		WHERE id = $2 AND completed <> $1
+		RETURNING user_id, server_id
 	`
-	ctx := context.Background()
-	result, err := db.Exec(ctx, query, completed, taskID)
-	if err != nil {
-		return fmt.Errorf("error updating task status: %w", err)
+	action, eventType := models.AuditTaskReopened, events.TaskReopened
+	if completed {
+		action, eventType = models.AuditTaskCompleted, events.TaskCompleted
 	}
 
-	rowsAffected := result.RowsAffected()
-	if rowsAffected == 0 {
-		return fmt.Errorf("task not found")
-	}
+	return db.withTx(ctx, func(tx pgx.Tx) error {
+		var ownerID uuid.UUID
+		var serverID string
+		err := tx.QueryRow(ctx, query, completed, taskID.String()).Scan(&ownerID, &serverID)
+		if err == pgx.ErrNoRows {
+			var exists bool
+			err := tx.QueryRow(ctx, `SELECT EXISTS (SELECT 1 FROM tasks WHERE id = $1)`, taskID.String()).Scan(&exists)
+			if err != nil {
+				return fmt.Errorf("error getting task: %w", err)
+			}
+			if !exists {
+				return ErrTaskNotFound
+			}
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("error updating task status: %w", err)
+		}
 
-	return nil
+		details := map[string]string{}
+		if adminAction {
+			details["admin_action"] = "true"
+		}
+
+		err = recordAudit(ctx, tx, &models.AuditEvent{
+			ServerID:     serverID,
+			ActorID:      &actorID,
+			TargetUserID: &ownerID,
+			TaskID:       &taskID,
+			Action:       action,
+			Details:      details,
+		})
+		if err != nil {
+			return err
+		}
+		return recordTaskEvent(ctx, tx, eventType, serverID, taskID, &actorID)
+	})
 }
 
-// GetGuildUsers returns all users from the specified guild
-func (db *DB) GetGuildUsers(guildID string) ([]*models.User, error) {
+// GetGuildUsers returns the members of a guild known to the bot and everyone who
+// has tasks or check-ins there
+func (db *DB) GetGuildUsers(ctx context.Context, guildID string) ([]*models.User, error) {
 	query := `
-		SELECT DISTINCT u.id, u.discord_id, u.username, u.timezone, u.created_at
+		SELECT u.id, u.discord_id, u.username, u.timezone, u.created_at
 		FROM users u
+		WHERE EXISTS (SELECT 1 FROM guild_users g WHERE g.user_id = u.id AND g.guild_id = $1)
+		OR EXISTS (SELECT 1 FROM tasks t WHERE t.user_id = u.id AND t.server_id = $1)
+		OR EXISTS (SELECT 1 FROM check_ins c WHERE c.user_id = u.id AND c.server_id = $1)
 		ORDER BY u.username ASC`
 
-	rows, err := db.Query(context.Background(), query)
+	rows, err := db.Query(ctx, query, guildID)
 	if err != nil {
 		return nil, fmt.Errorf("error getting guild users: %w", err)
 	}
@@ -620,13 +1115,15 @@ func (db *DB) GetGuildUsers(guildID string) ([]*models.User, error) {
 	return users, nil
 }
 
-// Add function to track guild membership
-func (db *DB) AddUserToGuild(userID uuid.UUID, guildID string) error {
+// AddUserToGuild records that a user is a member of a guild
+func (db *DB) AddUserToGuild(ctx context.Context, userID uuid.UUID, guildID string) error {
 	query := `
 		INSERT INTO guild_users (user_id, guild_id)
 		VALUES ($1, $2)
 		ON CONFLICT (user_id, guild_id) DO NOTHING`
 
-	_, err := db.Exec(context.Background(), query, userID, guildID)
-	return err
+	if _, err := db.Exec(ctx, query, userID, guildID); err != nil {
+		return fmt.Errorf("error adding user to guild: %w", err)
+	}
+	return nil
 }
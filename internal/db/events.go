@@ -0,0 +1,102 @@
+package db
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"taskbot/internal/db/models"
+	"taskbot/internal/events"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+)
+
+// recordEvent adds an event to the outbox of the server's webhooks subscribed to
+// it inside tx, so that it is delivered exactly when the change it describes is
+// committed. Events outside servers are dropped.
+func recordEvent(ctx context.Context, tx pgx.Tx, eventType events.Type, serverID string, data interface{}) error {
+	if serverID == "" {
+		return nil
+	}
+
+	e := events.Event{ID: uuid.New(), Type: eventType, GuildID: serverID, Time: time.Now(), Data: data}
+	payload, err := json.Marshal(e)
+	if err != nil {
+		return fmt.Errorf("error encoding %s event: %w", eventType, err)
+	}
+	if _, err := enqueueWebhookEvent(ctx, tx, serverID, nil, string(eventType), payload, e.Time); err != nil {
+		return err
+	}
+	return nil
+}
+
+// recordCheckInEvent records a check-in or declared time event inside tx
+func recordCheckInEvent(ctx context.Context, tx pgx.Tx, eventType events.Type, checkIn *models.CheckIn) error {
+	user, err := eventUser(ctx, tx, checkIn.UserID)
+	if err != nil {
+		return err
+	}
+	task, err := eventTask(ctx, tx, checkIn.TaskID)
+	if err != nil {
+		return err
+	}
+	return recordEvent(ctx, tx, eventType, checkIn.ServerID, events.CheckInData{
+		User:    user,
+		Task:    task,
+		CheckIn: events.NewCheckIn(checkIn),
+	})
+}
+
+// recordTaskEvent records a task event inside tx; actorID is nil when no one
+// made the change
+func recordTaskEvent(ctx context.Context, tx pgx.Tx, eventType events.Type, serverID string, taskID uuid.UUID, actorID *uuid.UUID) error {
+	task, err := eventTask(ctx, tx, taskID)
+	if err != nil {
+		return err
+	}
+	data := events.TaskData{Task: task}
+	if actorID != nil {
+		actor, err := eventUser(ctx, tx, *actorID)
+		if err != nil {
+			return err
+		}
+		data.User = &actor
+	}
+	return recordEvent(ctx, tx, eventType, serverID, data)
+}
+
+// eventUser loads a user as event data inside tx
+func eventUser(ctx context.Context, tx pgx.Tx, userID uuid.UUID) (events.User, error) {
+	user := &models.User{}
+	err := tx.QueryRow(ctx, `SELECT id, discord_id, username FROM users WHERE id = $1`, userID.String()).
+		Scan(&user.ID, &user.DiscordID, &user.Username)
+	if err != nil {
+		return events.User{}, fmt.Errorf("error getting user for event: %w", err)
+	}
+	return events.NewUser(user), nil
+}
+
+// eventTask loads a task as event data inside tx
+func eventTask(ctx context.Context, tx pgx.Tx, taskID uuid.UUID) (events.Task, error) {
+	query := `
+		SELECT id, parent_id, name, description, tags, completed, global
+		FROM tasks
+		WHERE id = $1`
+
+	task := &models.Task{}
+	err := tx.QueryRow(ctx, query, taskID.String()).Scan(
+		&task.ID,
+		&task.ParentID,
+		&task.Name,
+		&task.Description,
+		&task.Tags,
+		&task.Completed,
+		&task.Global,
+	)
+	if err != nil {
+		return events.Task{}, fmt.Errorf("error getting task for event: %w", err)
+	}
+	return events.NewTask(task), nil
+}
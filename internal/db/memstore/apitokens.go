@@ -0,0 +1,102 @@
+package memstore
+
+import (
+	"context"
+	"sort"
+	"strings"
+	"time"
+
+	"taskbot/internal/db"
+	"taskbot/internal/db/models"
+
+	"github.com/google/uuid"
+)
+
+func permissionNames(permissions []models.APIPermission) string {
+	names := make([]string, 0, len(permissions))
+	for _, p := range permissions {
+		names = append(names, string(p))
+	}
+	return strings.Join(names, ",")
+}
+
+// CreateAPIToken stores a new API token; TokenHash must already be set
+func (m *Store) CreateAPIToken(ctx context.Context, token *models.APIToken) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if token.CreatedAt.IsZero() {
+		token.CreatedAt = time.Now()
+	}
+	m.apiTokens[token.ID] = copyAPIToken(token, m.users)
+	m.recordAudit(&models.AuditEvent{
+		ServerID:     token.ServerID,
+		ActorID:      copyUUID(&token.UserID),
+		TargetUserID: copyUUID(&token.UserID),
+		Action:       models.AuditAPITokenCreated,
+		Details: map[string]string{
+			"token_id":    token.ID.String(),
+			"name":        token.Name,
+			"permissions": permissionNames(token.Permissions),
+			"expires_at":  token.ExpiresAt.Format(time.RFC3339),
+		},
+	})
+	return nil
+}
+
+// GetAPITokens returns a server's API tokens, including expired ones, newest
+// first. When userID is set only that user's tokens are returned.
+func (m *Store) GetAPITokens(ctx context.Context, serverID string, userID *uuid.UUID) ([]*models.APIToken, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	var tokens []*models.APIToken
+	for _, token := range m.apiTokens {
+		if token.ServerID != serverID || (userID != nil && token.UserID != *userID) {
+			continue
+		}
+		tokens = append(tokens, copyAPIToken(token, m.users))
+	}
+	sort.Slice(tokens, func(a, b int) bool {
+		return tokens[a].CreatedAt.After(tokens[b].CreatedAt)
+	})
+	return tokens, nil
+}
+
+// UseAPIToken looks up an unexpired token by its hash and records that it was
+// used. It returns nil when no such token exists.
+func (m *Store) UseAPIToken(ctx context.Context, tokenHash string, now time.Time) (*models.APIToken, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, token := range m.apiTokens {
+		if token.TokenHash == tokenHash && token.ExpiresAt.After(now) {
+			token.LastUsedAt = &now
+			return copyAPIToken(token, m.users), nil
+		}
+	}
+	return nil, nil
+}
+
+// RevokeAPIToken deletes an API token of a server
+func (m *Store) RevokeAPIToken(ctx context.Context, tokenID uuid.UUID, serverID string, actorID uuid.UUID) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	token, ok := m.apiTokens[tokenID]
+	if !ok || token.ServerID != serverID {
+		return db.ErrAPITokenNotFound
+	}
+	delete(m.apiTokens, tokenID)
+	m.recordAudit(&models.AuditEvent{
+		ServerID:     serverID,
+		ActorID:      &actorID,
+		TargetUserID: copyUUID(&token.UserID),
+		Action:       models.AuditAPITokenRevoked,
+		Details: map[string]string{
+			"token_id": tokenID.String(),
+			"name":     token.Name,
+		},
+	})
+	return nil
+}
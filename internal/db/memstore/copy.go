@@ -0,0 +1,104 @@
+package memstore
+
+import (
+	"time"
+
+	"taskbot/internal/db/models"
+
+	"github.com/google/uuid"
+)
+
+func copyUser(user *models.User) *models.User {
+	copied := *user
+	return &copied
+}
+
+func copyTask(task *models.Task) *models.Task {
+	copied := *task
+	copied.ParentID = copyUUID(task.ParentID)
+	copied.ArchivedAt = copyTime(task.ArchivedAt)
+	if task.Tags != nil {
+		copied.Tags = append([]string(nil), task.Tags...)
+	}
+	return &copied
+}
+
+func copyCheckIn(checkIn *models.CheckIn) *models.CheckIn {
+	copied := *checkIn
+	copied.EndTime = copyTime(checkIn.EndTime)
+	return &copied
+}
+
+func copyTemplate(tmpl *models.TaskTemplate) *models.TaskTemplate {
+	copied := *tmpl
+	copied.LastTaskID = copyUUID(tmpl.LastTaskID)
+	return &copied
+}
+
+func copyTeam(team *models.Team) *models.Team {
+	copied := *team
+	if team.MemberIDs != nil {
+		copied.MemberIDs = append([]uuid.UUID(nil), team.MemberIDs...)
+	}
+	return &copied
+}
+
+func copyAPIToken(token *models.APIToken, users map[uuid.UUID]*models.User) *models.APIToken {
+	copied := *token
+	copied.Permissions = append([]models.APIPermission(nil), token.Permissions...)
+	copied.LastUsedAt = copyTime(token.LastUsedAt)
+	if user, ok := users[token.UserID]; ok {
+		copied.Username = user.Username
+		copied.DiscordID = user.DiscordID
+	}
+	return &copied
+}
+
+func copyWebhook(webhook *models.Webhook) *models.Webhook {
+	copied := *webhook
+	copied.Events = append([]string{}, webhook.Events...)
+	copied.LastDeliveryAt = copyTime(webhook.LastDeliveryAt)
+	return &copied
+}
+
+func copyWebhookDelivery(delivery *models.WebhookDelivery) *models.WebhookDelivery {
+	copied := *delivery
+	copied.Payload = append([]byte(nil), delivery.Payload...)
+	return &copied
+}
+
+func copySettings(settings *models.ServerSettings) *models.ServerSettings {
+	copied := *settings
+	if settings.LogCategories != nil {
+		copied.LogCategories = append([]models.LogCategory(nil), settings.LogCategories...)
+	}
+	return &copied
+}
+
+func copyAuditEvent(event *models.AuditEvent) *models.AuditEvent {
+	copied := *event
+	copied.ActorID = copyUUID(event.ActorID)
+	copied.TargetUserID = copyUUID(event.TargetUserID)
+	copied.TaskID = copyUUID(event.TaskID)
+	copied.Details = make(map[string]string, len(event.Details))
+	for k, v := range event.Details {
+		copied.Details[k] = v
+	}
+	return &copied
+}
+
+func copyUUID(id *uuid.UUID) *uuid.UUID {
+	if id == nil {
+		return nil
+	}
+	copied := *id
+	return &copied
+}
+
+func copyTime(t *time.Time) *time.Time {
+	if t == nil {
+		return nil
+	}
+	copied := *t
+	return &copied
+}
@@ -0,0 +1,1395 @@
+// Package memstore implements db.Store in memory, for tests, local demos and
+// running the bot without Postgres. Data is lost when the process exits.
+package memstore
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+
+	"taskbot/internal/db"
+	"taskbot/internal/db/models"
+	"taskbot/internal/events"
+
+	"github.com/google/uuid"
+)
+
+// Store is a concurrency-safe in-memory db.Store. Values passed in and returned
+// are copies, so callers cannot modify stored records without going through it.
+type Store struct {
+	mu        sync.RWMutex
+	users     map[uuid.UUID]*models.User
+	tasks     map[uuid.UUID]*models.Task
+	checkIns  map[uuid.UUID]*models.CheckIn
+	settings  map[string]*models.ServerSettings
+	templates map[uuid.UUID]*models.TaskTemplate
+	roles     map[string]map[string]*models.RoleMapping
+	teams     map[uuid.UUID]*models.Team
+	members   map[string]map[uuid.UUID]bool
+	apiTokens map[uuid.UUID]*models.APIToken
+	webhooks  map[uuid.UUID]*models.Webhook
+	outbox    map[uuid.UUID]*models.WebhookDelivery
+	audit     []*models.AuditEvent
+}
+
+var _ db.Store = (*Store)(nil)
+
+// New creates an empty store
+func New() *Store {
+	return &Store{
+		users:     make(map[uuid.UUID]*models.User),
+		tasks:     make(map[uuid.UUID]*models.Task),
+		checkIns:  make(map[uuid.UUID]*models.CheckIn),
+		settings:  make(map[string]*models.ServerSettings),
+		templates: make(map[uuid.UUID]*models.TaskTemplate),
+		roles:     make(map[string]map[string]*models.RoleMapping),
+		teams:     make(map[uuid.UUID]*models.Team),
+		members:   make(map[string]map[uuid.UUID]bool),
+		apiTokens: make(map[uuid.UUID]*models.APIToken),
+		webhooks:  make(map[uuid.UUID]*models.Webhook),
+		outbox:    make(map[uuid.UUID]*models.WebhookDelivery),
+	}
+}
+
+// Close is a no-op; it exists to satisfy db.Store
+func (m *Store) Close() {}
+
+// Ping always succeeds; it exists to satisfy db.Store
+func (m *Store) Ping(ctx context.Context) error {
+	return nil
+}
+
+// recordAudit appends an audit event; the caller must hold the write lock
+func (m *Store) recordAudit(event *models.AuditEvent) {
+	if event.ID == uuid.Nil {
+		event.ID = uuid.New()
+	}
+	if event.CreatedAt.IsZero() {
+		event.CreatedAt = time.Now()
+	}
+	if event.Details == nil {
+		event.Details = map[string]string{}
+	}
+	m.audit = append(m.audit, copyAuditEvent(event))
+}
+
+// GetOrCreateUser retrieves a user by Discord ID or creates a new one
+func (m *Store) GetOrCreateUser(ctx context.Context, discordID string, username string) (*models.User, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if user := m.userByDiscordID(discordID); user != nil {
+		return copyUser(user), nil
+	}
+
+	user := &models.User{
+		ID:        uuid.New(),
+		DiscordID: discordID,
+		Username:  username,
+		Timezone:  "UTC",
+		CreatedAt: time.Now(),
+	}
+	m.users[user.ID] = user
+	return copyUser(user), nil
+}
+
+// GetUserByDiscordID retrieves a user by Discord ID, returning nil if unknown
+func (m *Store) GetUserByDiscordID(ctx context.Context, discordID string) (*models.User, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	if user := m.userByDiscordID(discordID); user != nil {
+		return copyUser(user), nil
+	}
+	return nil, nil
+}
+
+func (m *Store) userByDiscordID(discordID string) *models.User {
+	for _, user := range m.users {
+		if user.DiscordID == discordID {
+			return user
+		}
+	}
+	return nil
+}
+
+// GetAllUsers returns all users, those with check-ins first, then by username
+func (m *Store) GetAllUsers(ctx context.Context) ([]*models.User, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	active := make(map[uuid.UUID]bool)
+	for _, ci := range m.checkIns {
+		active[ci.UserID] = true
+	}
+
+	users := m.sortedUsers()
+	sort.SliceStable(users, func(a, b int) bool {
+		return active[users[a].ID] && !active[users[b].ID]
+	})
+	return users, nil
+}
+
+// GetGuildUsers returns the members of a guild known to the store and everyone
+// who has tasks or check-ins there, ordered by username
+func (m *Store) GetGuildUsers(ctx context.Context, guildID string) ([]*models.User, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	inGuild := make(map[uuid.UUID]bool)
+	for userID := range m.members[guildID] {
+		inGuild[userID] = true
+	}
+	for _, task := range m.tasks {
+		if task.ServerID == guildID {
+			inGuild[task.UserID] = true
+		}
+	}
+	for _, checkIn := range m.checkIns {
+		if checkIn.ServerID == guildID {
+			inGuild[checkIn.UserID] = true
+		}
+	}
+
+	var users []*models.User
+	for _, user := range m.sortedUsers() {
+		if inGuild[user.ID] {
+			users = append(users, user)
+		}
+	}
+	return users, nil
+}
+
+// AddUserToGuild records that a user is a member of a guild
+func (m *Store) AddUserToGuild(ctx context.Context, userID uuid.UUID, guildID string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.members[guildID] == nil {
+		m.members[guildID] = make(map[uuid.UUID]bool)
+	}
+	m.members[guildID][userID] = true
+	return nil
+}
+
+func (m *Store) sortedUsers() []*models.User {
+	users := make([]*models.User, 0, len(m.users))
+	for _, user := range m.users {
+		users = append(users, copyUser(user))
+	}
+	sort.Slice(users, func(a, b int) bool {
+		return users[a].Username < users[b].Username
+	})
+	return users
+}
+
+// UpdateUserTimezone updates a user's timezone, auditing the change in the given server
+func (m *Store) UpdateUserTimezone(ctx context.Context, userID uuid.UUID, serverID string, timezone string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	user, ok := m.users[userID]
+	if !ok {
+		return fmt.Errorf("user not found")
+	}
+
+	oldTimezone := user.Timezone
+	user.Timezone = timezone
+	m.recordAudit(&models.AuditEvent{
+		ServerID:     serverID,
+		ActorID:      &userID,
+		TargetUserID: &userID,
+		Action:       models.AuditTimezoneChanged,
+		Details: map[string]string{
+			"from": oldTimezone,
+			"to":   timezone,
+		},
+	})
+	return nil
+}
+
+// CreateTask creates a new task
+func (m *Store) CreateTask(ctx context.Context, task *models.Task) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.tasks[task.ID]; ok {
+		return fmt.Errorf("task %s already exists", task.ID)
+	}
+	m.tasks[task.ID] = copyTask(task)
+
+	details := map[string]string{
+		"name":   task.Name,
+		"global": fmt.Sprintf("%t", task.Global),
+	}
+	if task.ParentID != nil {
+		details["parent_id"] = task.ParentID.String()
+	}
+	m.recordAudit(&models.AuditEvent{
+		ServerID:     task.ServerID,
+		ActorID:      &task.UserID,
+		TargetUserID: &task.UserID,
+		TaskID:       &task.ID,
+		Action:       models.AuditTaskCreated,
+		Details:      details,
+	})
+	m.recordTaskEvent(events.TaskCreated, task, &task.UserID)
+	return nil
+}
+
+// GetTaskByID retrieves a task by its ID, returning nil if it does not exist
+func (m *Store) GetTaskByID(ctx context.Context, taskID uuid.UUID) (*models.Task, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	if task, ok := m.tasks[taskID]; ok {
+		return copyTask(task), nil
+	}
+	return nil, nil
+}
+
+// GetUserTasks retrieves the unarchived tasks available to a user in a server
+func (m *Store) GetUserTasks(ctx context.Context, userID uuid.UUID, serverID string) ([]*models.Task, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	var tasks []*models.Task
+	for _, task := range m.tasks {
+		if m.visibleTo(task, userID, serverID) {
+			tasks = append(tasks, copyTask(task))
+		}
+	}
+	sort.Slice(tasks, func(a, b int) bool {
+		return tasks[a].CreatedAt.After(tasks[b].CreatedAt)
+	})
+	return tasks, nil
+}
+
+func (m *Store) visibleTo(task *models.Task, userID uuid.UUID, serverID string) bool {
+	return task.ServerID == serverID && task.ArchivedAt == nil && (task.UserID == userID || task.Global)
+}
+
+// GetTaskSuggestions retrieves the tasks available to a user in a server along with
+// the user's check-in statistics, most recently used first
+func (m *Store) GetTaskSuggestions(ctx context.Context, userID uuid.UUID, serverID string) ([]*models.TaskUsage, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	var usages []*models.TaskUsage
+	for _, task := range m.tasks {
+		if !m.visibleTo(task, userID, serverID) {
+			continue
+		}
+
+		usage := &models.TaskUsage{Task: copyTask(task)}
+		if task.ParentID != nil {
+			if parent, ok := m.tasks[*task.ParentID]; ok {
+				usage.ParentName = parent.Name
+			}
+		}
+		for _, ci := range m.checkIns {
+			if ci.TaskID != task.ID || ci.UserID != userID || ci.ServerID != serverID {
+				continue
+			}
+			usage.UseCount++
+			if usage.LastUsed == nil || ci.StartTime.After(*usage.LastUsed) {
+				lastUsed := ci.StartTime
+				usage.LastUsed = &lastUsed
+			}
+		}
+		usages = append(usages, usage)
+	}
+	sortTaskUsages(usages)
+	return usages, nil
+}
+
+// GetServerTaskSuggestions retrieves every task in a server, archived ones
+// included, with its owner's name and check-in statistics across all users, most
+// recently used first
+func (m *Store) GetServerTaskSuggestions(ctx context.Context, serverID string) ([]*models.TaskUsage, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	var usages []*models.TaskUsage
+	for _, task := range m.tasks {
+		if task.ServerID != serverID {
+			continue
+		}
+
+		usage := &models.TaskUsage{Task: copyTask(task)}
+		if owner, ok := m.users[task.UserID]; ok {
+			usage.OwnerName = owner.Username
+		}
+		if task.ParentID != nil {
+			if parent, ok := m.tasks[*task.ParentID]; ok {
+				usage.ParentName = parent.Name
+			}
+		}
+		for _, ci := range m.checkIns {
+			if ci.TaskID != task.ID || ci.ServerID != serverID {
+				continue
+			}
+			usage.UseCount++
+			if usage.LastUsed == nil || ci.StartTime.After(*usage.LastUsed) {
+				lastUsed := ci.StartTime
+				usage.LastUsed = &lastUsed
+			}
+		}
+		usages = append(usages, usage)
+	}
+	sortTaskUsages(usages)
+	return usages, nil
+}
+
+// sortTaskUsages orders suggestions most recently used first, then by use count
+// and newest task
+func sortTaskUsages(usages []*models.TaskUsage) {
+	sort.Slice(usages, func(a, b int) bool {
+		ua, ub := usages[a], usages[b]
+		switch {
+		case ua.LastUsed != nil && ub.LastUsed == nil:
+			return true
+		case ua.LastUsed == nil && ub.LastUsed != nil:
+			return false
+		case ua.LastUsed != nil && !ua.LastUsed.Equal(*ub.LastUsed):
+			return ua.LastUsed.After(*ub.LastUsed)
+		case ua.UseCount != ub.UseCount:
+			return ua.UseCount > ub.UseCount
+		}
+		return ua.Task.CreatedAt.After(ub.Task.CreatedAt)
+	})
+}
+
+// CountOpenSubtasks returns how many subtasks of a task are not completed
+func (m *Store) CountOpenSubtasks(ctx context.Context, taskID uuid.UUID) (int, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	count := 0
+	for _, task := range m.tasks {
+		if task.ParentID != nil && *task.ParentID == taskID && !task.Completed && task.ArchivedAt == nil {
+			count++
+		}
+	}
+	return count, nil
+}
+
+// UpdateTaskStatus updates a task's completed status on behalf of actorID, who
+// acts as an admin on someone else's task when adminAction is set. Nothing is
+// recorded when the task already has that status.
+func (m *Store) UpdateTaskStatus(ctx context.Context, taskID uuid.UUID, completed bool, actorID uuid.UUID, adminAction bool) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	task, ok := m.tasks[taskID]
+	if !ok {
+		return db.ErrTaskNotFound
+	}
+	if task.Completed == completed {
+		return nil
+	}
+	task.Completed = completed
+
+	action, eventType := models.AuditTaskReopened, events.TaskReopened
+	if completed {
+		action, eventType = models.AuditTaskCompleted, events.TaskCompleted
+	}
+	details := map[string]string{}
+	if adminAction {
+		details["admin_action"] = "true"
+	}
+	ownerID := task.UserID
+	m.recordAudit(&models.AuditEvent{
+		ServerID:     task.ServerID,
+		ActorID:      &actorID,
+		TargetUserID: &ownerID,
+		TaskID:       &taskID,
+		Action:       action,
+		Details:      details,
+	})
+	m.recordTaskEvent(eventType, task, &actorID)
+	return nil
+}
+
+// SearchTasks matches every word of the query as a prefix of a word in a task's
+// name, description or tags, and returns one page of results with the total count
+func (m *Store) SearchTasks(ctx context.Context, filter models.TaskSearchFilter) ([]*models.TaskSearchResult, int, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	terms := searchWords(filter.Query)
+
+	var visible map[uuid.UUID]bool
+	if filter.VisibleUserIDs != nil {
+		visible = make(map[uuid.UUID]bool, len(filter.VisibleUserIDs))
+		for _, id := range filter.VisibleUserIDs {
+			visible[id] = true
+		}
+	}
+
+	var results []*models.TaskSearchResult
+	for _, task := range m.tasks {
+		if task.ServerID != filter.ServerID {
+			continue
+		}
+		if filter.OwnerID != nil && task.UserID != *filter.OwnerID {
+			continue
+		}
+		if visible != nil && !task.Global && !visible[task.UserID] {
+			continue
+		}
+		if filter.Completed != nil && task.Completed != *filter.Completed {
+			continue
+		}
+		if filter.Tag != "" && !hasTag(task.Tags, filter.Tag) {
+			continue
+		}
+		if !filter.Since.IsZero() && task.CreatedAt.Before(filter.Since) {
+			continue
+		}
+		if !filter.Until.IsZero() && !task.CreatedAt.Before(filter.Until) {
+			continue
+		}
+		if !matchesAll(task, terms) {
+			continue
+		}
+
+		result := &models.TaskSearchResult{Task: copyTask(task)}
+		if owner, ok := m.users[task.UserID]; ok {
+			result.OwnerName = owner.Username
+		}
+		for _, ci := range m.checkIns {
+			if ci.TaskID == task.ID && ci.EndTime != nil && (visible == nil || visible[ci.UserID]) {
+				result.TimeSpent += ci.EndTime.Sub(ci.StartTime).Truncate(time.Second)
+			}
+		}
+		results = append(results, result)
+	}
+
+	sort.Slice(results, func(a, b int) bool {
+		return results[a].Task.CreatedAt.After(results[b].Task.CreatedAt)
+	})
+
+	total := len(results)
+	limit := filter.Limit
+	if limit <= 0 {
+		limit = 10
+	}
+	if filter.Offset >= total {
+		return nil, total, nil
+	}
+	end := filter.Offset + limit
+	if end > total {
+		end = total
+	}
+	return results[filter.Offset:end], total, nil
+}
+
+// searchWords splits text into lower-case words the same way the search index does
+func searchWords(text string) []string {
+	return strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+}
+
+func matchesAll(task *models.Task, terms []string) bool {
+	if len(terms) == 0 {
+		return true
+	}
+
+	words := searchWords(task.Name + " " + task.Description + " " + strings.Join(task.Tags, " "))
+	for _, term := range terms {
+		found := false
+		for _, word := range words {
+			if strings.HasPrefix(word, term) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+func hasTag(tags []string, tag string) bool {
+	for _, t := range tags {
+		if strings.EqualFold(t, tag) {
+			return true
+		}
+	}
+	return false
+}
+
+// ArchiveTask hides a task from autocomplete while keeping its history
+func (m *Store) ArchiveTask(ctx context.Context, taskID uuid.UUID, actorID uuid.UUID) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	task, ok := m.tasks[taskID]
+	if !ok || task.ArchivedAt != nil {
+		return db.ErrTaskNotFound
+	}
+
+	now := time.Now()
+	task.ArchivedAt = &now
+	ownerID := task.UserID
+	m.recordAudit(&models.AuditEvent{
+		ServerID:     task.ServerID,
+		ActorID:      &actorID,
+		TargetUserID: &ownerID,
+		TaskID:       &taskID,
+		Action:       models.AuditTaskArchived,
+	})
+	return nil
+}
+
+// ArchiveCompletedTasks archives every completed task in a server with no activity
+// since the cutoff and returns how many tasks were archived
+func (m *Store) ArchiveCompletedTasks(ctx context.Context, serverID string, cutoff time.Time, actorID uuid.UUID) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	recent := make(map[uuid.UUID]bool)
+	for _, ci := range m.checkIns {
+		if ci.EndTime == nil || !ci.EndTime.Before(cutoff) {
+			recent[ci.TaskID] = true
+		}
+	}
+
+	now := time.Now()
+	archived := 0
+	for _, task := range m.tasks {
+		if task.ServerID != serverID || !task.Completed || task.ArchivedAt != nil ||
+			!task.CreatedAt.Before(cutoff) || recent[task.ID] {
+			continue
+		}
+
+		archivedAt := now
+		task.ArchivedAt = &archivedAt
+		taskID, ownerID := task.ID, task.UserID
+		m.recordAudit(&models.AuditEvent{
+			ServerID:     serverID,
+			ActorID:      &actorID,
+			TargetUserID: &ownerID,
+			TaskID:       &taskID,
+			Action:       models.AuditTaskArchived,
+			Details: map[string]string{
+				"bulk":   "true",
+				"cutoff": cutoff.UTC().Format(time.RFC3339),
+			},
+		})
+		archived++
+	}
+	return archived, nil
+}
+
+// DeleteTask permanently removes a task. If the task has check-ins they are moved
+// to reassignTo, or db.ErrTaskHasCheckIns is returned when reassignTo is nil.
+// It returns the number of check-ins that were reassigned.
+func (m *Store) DeleteTask(ctx context.Context, taskID uuid.UUID, reassignTo *uuid.UUID, actorID uuid.UUID) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	task, ok := m.tasks[taskID]
+	if !ok {
+		return 0, db.ErrTaskNotFound
+	}
+
+	details := map[string]string{"name": task.Name}
+	var moved int64
+	if m.countCheckIns(taskID) > 0 {
+		if reassignTo == nil {
+			return 0, db.ErrTaskHasCheckIns
+		}
+
+		target, ok := m.tasks[*reassignTo]
+		if !ok {
+			return 0, fmt.Errorf("reassignment target: %w", db.ErrTaskNotFound)
+		}
+		if target.ServerID != task.ServerID {
+			return 0, fmt.Errorf("reassignment target belongs to another server")
+		}
+
+		moved = m.moveCheckIns(taskID, target.ID)
+		details["reassigned_to"] = reassignTo.String()
+		details["check_ins_moved"] = fmt.Sprintf("%d", moved)
+	}
+
+	// Subtasks of a deleted task become top-level tasks
+	for _, t := range m.tasks {
+		if t.ParentID != nil && *t.ParentID == taskID {
+			t.ParentID = nil
+		}
+	}
+	delete(m.tasks, taskID)
+
+	ownerID := task.UserID
+	m.recordAudit(&models.AuditEvent{
+		ServerID:     task.ServerID,
+		ActorID:      &actorID,
+		TargetUserID: &ownerID,
+		TaskID:       &taskID,
+		Action:       models.AuditTaskDeleted,
+		Details:      details,
+	})
+	return moved, nil
+}
+
+// MergeTasks moves all check-ins from source to target, adds the source's tags to
+// the target and deletes the source. It returns the number of check-ins moved, or
+// ErrTaskArchived when the target is archived.
+func (m *Store) MergeTasks(ctx context.Context, sourceID, targetID uuid.UUID, actorID uuid.UUID) (int64, error) {
+	if sourceID == targetID {
+		return 0, fmt.Errorf("cannot merge a task into itself")
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	source, ok := m.tasks[sourceID]
+	if !ok {
+		return 0, fmt.Errorf("merge source: %w", db.ErrTaskNotFound)
+	}
+	target, ok := m.tasks[targetID]
+	if !ok {
+		return 0, fmt.Errorf("merge target: %w", db.ErrTaskNotFound)
+	}
+	if target.ArchivedAt != nil {
+		return 0, fmt.Errorf("merge target: %w", db.ErrTaskArchived)
+	}
+	if target.ServerID != source.ServerID {
+		return 0, fmt.Errorf("cannot merge tasks from different servers")
+	}
+
+	moved := m.moveCheckIns(sourceID, targetID)
+
+	for _, tag := range source.Tags {
+		if !hasTag(target.Tags, tag) {
+			target.Tags = append(target.Tags, tag)
+		}
+	}
+
+	// Subtasks of the source move under the target, or under the target's parent
+	// when the target is itself a subtask, keeping the hierarchy one level deep
+	if target.ParentID != nil && *target.ParentID == sourceID {
+		target.ParentID = nil
+	}
+	newParent := target.ID
+	if target.ParentID != nil {
+		newParent = *target.ParentID
+	}
+	for _, t := range m.tasks {
+		if t.ParentID != nil && *t.ParentID == sourceID {
+			parentID := newParent
+			t.ParentID = &parentID
+		}
+	}
+	delete(m.tasks, sourceID)
+
+	ownerID := source.UserID
+	m.recordAudit(&models.AuditEvent{
+		ServerID:     source.ServerID,
+		ActorID:      &actorID,
+		TargetUserID: &ownerID,
+		TaskID:       &targetID,
+		Action:       models.AuditTaskMerged,
+		Details: map[string]string{
+			"source_id":       sourceID.String(),
+			"source_name":     source.Name,
+			"check_ins_moved": fmt.Sprintf("%d", moved),
+		},
+	})
+	return moved, nil
+}
+
+func (m *Store) countCheckIns(taskID uuid.UUID) int {
+	count := 0
+	for _, ci := range m.checkIns {
+		if ci.TaskID == taskID {
+			count++
+		}
+	}
+	return count
+}
+
+func (m *Store) moveCheckIns(fromID, toID uuid.UUID) int64 {
+	var moved int64
+	for _, ci := range m.checkIns {
+		if ci.TaskID == fromID {
+			ci.TaskID = toID
+			moved++
+		}
+	}
+	return moved
+}
+
+// CreateCheckIn creates a new check-in record. A check-in with an end time is
+// stored as a declared, inactive record.
+func (m *Store) CreateCheckIn(ctx context.Context, checkIn *models.CheckIn) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return m.insertCheckIn(checkIn)
+}
+
+// insertCheckIn stores a check-in, enforcing one active check-in per user and
+// server; the caller must hold the write lock
+func (m *Store) insertCheckIn(checkIn *models.CheckIn) error {
+	checkIn.Active = checkIn.EndTime == nil
+	if checkIn.Active && m.activeCheckIn(checkIn.UserID, checkIn.ServerID) != nil {
+		return db.ErrActiveCheckInConflict
+	}
+	m.checkIns[checkIn.ID] = copyCheckIn(checkIn)
+
+	action, eventType := models.AuditCheckInStarted, events.CheckInStarted
+	details := map[string]string{
+		"start_time": checkIn.StartTime.UTC().Format(time.RFC3339),
+	}
+	if checkIn.EndTime != nil {
+		action, eventType = models.AuditCheckInDeclared, events.TimeDeclared
+		details["end_time"] = checkIn.EndTime.UTC().Format(time.RFC3339)
+		details["duration"] = checkIn.EndTime.Sub(checkIn.StartTime).String()
+	}
+	userID, taskID := checkIn.UserID, checkIn.TaskID
+	m.recordAudit(&models.AuditEvent{
+		ServerID:     checkIn.ServerID,
+		ActorID:      &userID,
+		TargetUserID: &userID,
+		TaskID:       &taskID,
+		Action:       action,
+		Details:      details,
+	})
+	m.recordCheckInEvent(eventType, checkIn)
+	return nil
+}
+
+// SwitchCheckIn atomically ends the user's active check-in in the server, if any,
+// and starts checkIn. The ended check-in is returned, or nil if there was none.
+func (m *Store) SwitchCheckIn(ctx context.Context, checkIn *models.CheckIn) (*models.CheckIn, error) {
+	return m.replaceActiveCheckIn(checkIn)
+}
+
+// DeclareCheckIn atomically stores checkIn, which has an end time, as declared
+// time and ends the user's active check-in in the server, if any. The ended
+// check-in is returned, or nil if there was none.
+func (m *Store) DeclareCheckIn(ctx context.Context, checkIn *models.CheckIn) (*models.CheckIn, error) {
+	return m.replaceActiveCheckIn(checkIn)
+}
+
+// replaceActiveCheckIn ends the user's active check-in in the server, if any, and
+// inserts checkIn under one lock
+func (m *Store) replaceActiveCheckIn(checkIn *models.CheckIn) (*models.CheckIn, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var previous *models.CheckIn
+	if active := m.activeCheckIn(checkIn.UserID, checkIn.ServerID); active != nil {
+		m.closeCheckIn(active)
+		previous = copyCheckIn(active)
+	}
+
+	if err := m.insertCheckIn(checkIn); err != nil {
+		return nil, err
+	}
+	return previous, nil
+}
+
+// CheckOut ends an active check-in
+func (m *Store) CheckOut(ctx context.Context, checkInID uuid.UUID) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	checkIn, ok := m.checkIns[checkInID]
+	if !ok || checkIn.EndTime != nil {
+		return fmt.Errorf("error getting check-in: %w", db.ErrCheckInNotActive)
+	}
+	m.closeCheckIn(checkIn)
+	return nil
+}
+
+// closeCheckIn ends a stored check-in now; the caller must hold the write lock
+func (m *Store) closeCheckIn(checkIn *models.CheckIn) {
+	endTime := time.Now()
+	if endTime.Before(checkIn.StartTime) {
+		endTime = checkIn.StartTime.Add(time.Second)
+	}
+	checkIn.EndTime = &endTime
+	checkIn.Active = false
+
+	userID, taskID := checkIn.UserID, checkIn.TaskID
+	m.recordAudit(&models.AuditEvent{
+		ServerID:     checkIn.ServerID,
+		ActorID:      &userID,
+		TargetUserID: &userID,
+		TaskID:       &taskID,
+		Action:       models.AuditCheckInEnded,
+		Details: map[string]string{
+			"start_time": checkIn.StartTime.UTC().Format(time.RFC3339),
+			"end_time":   endTime.UTC().Format(time.RFC3339),
+			"duration":   endTime.Sub(checkIn.StartTime).Round(time.Second).String(),
+		},
+	})
+	m.recordCheckInEvent(events.CheckInEnded, checkIn)
+}
+
+func (m *Store) activeCheckIn(userID uuid.UUID, serverID string) *models.CheckIn {
+	for _, ci := range m.checkIns {
+		if ci.Active && ci.UserID == userID && ci.ServerID == serverID {
+			return ci
+		}
+	}
+	return nil
+}
+
+// GetActiveCheckIn gets the active check-in for a user if one exists
+func (m *Store) GetActiveCheckIn(ctx context.Context, userID uuid.UUID, serverID string) (*models.CheckIn, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	if ci := m.activeCheckIn(userID, serverID); ci != nil {
+		return copyCheckIn(ci), nil
+	}
+	return nil, nil
+}
+
+// GetCheckInByID retrieves a check-in by its ID, returning nil if it does not exist
+func (m *Store) GetCheckInByID(ctx context.Context, checkInID uuid.UUID) (*models.CheckIn, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	if ci, ok := m.checkIns[checkInID]; ok {
+		return copyCheckIn(ci), nil
+	}
+	return nil, nil
+}
+
+// CountActiveCheckIns returns the number of active check-ins per server
+func (m *Store) CountActiveCheckIns(ctx context.Context) (map[string]int, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	counts := make(map[string]int)
+	for _, ci := range m.checkIns {
+		if ci.Active {
+			counts[ci.ServerID]++
+		}
+	}
+	return counts, nil
+}
+
+// GetAllActiveCheckIns returns all active check-ins for a server
+func (m *Store) GetAllActiveCheckIns(ctx context.Context, guildID string) ([]*models.CheckInWithTask, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	var checkIns []*models.CheckInWithTask
+	for _, ci := range m.checkIns {
+		if ci.ServerID != guildID || !ci.Active {
+			continue
+		}
+		if entry := m.withTask(ci); entry != nil {
+			checkIns = append(checkIns, entry)
+		}
+	}
+	return checkIns, nil
+}
+
+// GetAllTaskHistory returns all task history for a server within a time range
+func (m *Store) GetAllTaskHistory(ctx context.Context, guildID string, startDate, endDate time.Time) ([]*models.CheckInWithTask, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	var history []*models.CheckInWithTask
+	for _, ci := range m.checkIns {
+		if ci.ServerID != guildID || ci.StartTime.Before(startDate) {
+			continue
+		}
+		if ci.EndTime != nil && ci.EndTime.After(endDate) {
+			continue
+		}
+		if entry := m.withTask(ci); entry != nil {
+			history = append(history, entry)
+		}
+	}
+	sort.Slice(history, func(a, b int) bool {
+		return history[a].CheckIn.StartTime.After(history[b].CheckIn.StartTime)
+	})
+	return history, nil
+}
+
+// withTask joins a check-in with its task, user and parent task, returning nil
+// if the task or user no longer exists
+func (m *Store) withTask(ci *models.CheckIn) *models.CheckInWithTask {
+	task, ok := m.tasks[ci.TaskID]
+	if !ok {
+		return nil
+	}
+	user, ok := m.users[ci.UserID]
+	if !ok {
+		return nil
+	}
+
+	entry := &models.CheckInWithTask{
+		CheckIn: copyCheckIn(ci),
+		Task:    copyTask(task),
+		User:    copyUser(user),
+	}
+	if task.ParentID != nil {
+		if parent, ok := m.tasks[*task.ParentID]; ok {
+			entry.Parent = &models.Task{ID: parent.ID, Name: parent.Name}
+		}
+	}
+	return entry
+}
+
+// CreateTaskTemplate creates a new recurring task template
+func (m *Store) CreateTaskTemplate(ctx context.Context, tmpl *models.TaskTemplate) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.templates[tmpl.ID]; ok {
+		return fmt.Errorf("error creating task template: template %s already exists", tmpl.ID)
+	}
+	m.templates[tmpl.ID] = copyTemplate(tmpl)
+
+	createdBy := tmpl.CreatedBy
+	m.recordAudit(&models.AuditEvent{
+		ServerID: tmpl.ServerID,
+		ActorID:  &createdBy,
+		Action:   models.AuditTemplateCreated,
+		Details: map[string]string{
+			"template_id": tmpl.ID.String(),
+			"name":        tmpl.Name,
+			"schedule":    tmpl.Schedule,
+		},
+	})
+	return nil
+}
+
+// GetTaskTemplates returns all task templates for a server ordered by name
+func (m *Store) GetTaskTemplates(ctx context.Context, serverID string) ([]*models.TaskTemplate, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	var templates []*models.TaskTemplate
+	for _, tmpl := range m.templates {
+		if tmpl.ServerID == serverID {
+			templates = append(templates, copyTemplate(tmpl))
+		}
+	}
+	sort.Slice(templates, func(a, b int) bool {
+		return templates[a].Name < templates[b].Name
+	})
+	return templates, nil
+}
+
+// GetDueTaskTemplates returns templates across all servers whose next run is due
+func (m *Store) GetDueTaskTemplates(ctx context.Context, now time.Time) ([]*models.TaskTemplate, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	var templates []*models.TaskTemplate
+	for _, tmpl := range m.templates {
+		if !tmpl.NextRunAt.After(now) {
+			templates = append(templates, copyTemplate(tmpl))
+		}
+	}
+	sort.Slice(templates, func(a, b int) bool {
+		return templates[a].NextRunAt.Before(templates[b].NextRunAt)
+	})
+	return templates, nil
+}
+
+// DeleteTaskTemplate removes a template from a server. Tasks it already created are kept.
+func (m *Store) DeleteTaskTemplate(ctx context.Context, templateID uuid.UUID, serverID string, actorID uuid.UUID) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	tmpl, ok := m.templates[templateID]
+	if !ok || tmpl.ServerID != serverID {
+		return fmt.Errorf("template not found")
+	}
+	delete(m.templates, templateID)
+
+	m.recordAudit(&models.AuditEvent{
+		ServerID: serverID,
+		ActorID:  &actorID,
+		Action:   models.AuditTemplateDeleted,
+		Details: map[string]string{
+			"template_id": templateID.String(),
+			"name":        tmpl.Name,
+		},
+	})
+	return nil
+}
+
+// RunTaskTemplate materializes a due template: it completes the task created by the
+// previous run, creates the given task and schedules the next run. It reports false
+// if the template was no longer due.
+func (m *Store) RunTaskTemplate(ctx context.Context, templateID uuid.UUID, task *models.Task, nextRunAt time.Time) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	tmpl, ok := m.templates[templateID]
+	if !ok || tmpl.NextRunAt.After(time.Now()) {
+		return false, nil
+	}
+
+	if tmpl.LastTaskID != nil {
+		if last, ok := m.tasks[*tmpl.LastTaskID]; ok && !last.Completed {
+			last.Completed = true
+			ownerID, lastID := last.UserID, last.ID
+			m.recordAudit(&models.AuditEvent{
+				ServerID:     tmpl.ServerID,
+				TargetUserID: &ownerID,
+				TaskID:       &lastID,
+				Action:       models.AuditTaskCompleted,
+				Details:      map[string]string{"template_id": tmpl.ID.String()},
+			})
+			m.recordTaskEvent(events.TaskCompleted, last, nil)
+		}
+	}
+
+	created := copyTask(task)
+	created.Completed = false
+	created.Global = true
+	created.ParentID = nil
+	created.Tags = nil
+	m.tasks[created.ID] = created
+
+	ownerID, taskID := task.UserID, task.ID
+	m.recordAudit(&models.AuditEvent{
+		ServerID:     task.ServerID,
+		TargetUserID: &ownerID,
+		TaskID:       &taskID,
+		Action:       models.AuditTaskCreated,
+		Details: map[string]string{
+			"name":        task.Name,
+			"global":      "true",
+			"template_id": tmpl.ID.String(),
+		},
+	})
+	m.recordTaskEvent(events.TaskCreated, created, nil)
+
+	tmpl.LastTaskID = &taskID
+	tmpl.NextRunAt = nextRunAt
+	return true, nil
+}
+
+// GetRoleMappings returns the Discord role to bot role mappings of a server,
+// highest bot role first
+func (m *Store) GetRoleMappings(ctx context.Context, serverID string) ([]*models.RoleMapping, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	var mappings []*models.RoleMapping
+	for _, mapping := range m.roles[serverID] {
+		copied := *mapping
+		mappings = append(mappings, &copied)
+	}
+	sort.Slice(mappings, func(a, b int) bool {
+		if mappings[a].Role != mappings[b].Role {
+			return mappings[a].Role.AtLeast(mappings[b].Role)
+		}
+		return mappings[a].DiscordRoleID < mappings[b].DiscordRoleID
+	})
+	return mappings, nil
+}
+
+// SetRoleMapping maps a Discord role to a bot role, replacing any existing mapping
+// for that Discord role
+func (m *Store) SetRoleMapping(ctx context.Context, mapping *models.RoleMapping) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if mapping.CreatedAt.IsZero() {
+		mapping.CreatedAt = time.Now()
+	}
+	if m.roles[mapping.ServerID] == nil {
+		m.roles[mapping.ServerID] = make(map[string]*models.RoleMapping)
+	}
+
+	details := map[string]string{
+		"discord_role_id": mapping.DiscordRoleID,
+		"role":            string(mapping.Role),
+	}
+	if previous, ok := m.roles[mapping.ServerID][mapping.DiscordRoleID]; ok {
+		details["previous"] = string(previous.Role)
+	}
+
+	copied := *mapping
+	m.roles[mapping.ServerID][mapping.DiscordRoleID] = &copied
+
+	createdBy := mapping.CreatedBy
+	m.recordAudit(&models.AuditEvent{
+		ServerID: mapping.ServerID,
+		ActorID:  &createdBy,
+		Action:   models.AuditRoleMapped,
+		Details:  details,
+	})
+	return nil
+}
+
+// DeleteRoleMapping removes the mapping of a Discord role in a server
+func (m *Store) DeleteRoleMapping(ctx context.Context, serverID, discordRoleID string, actorID uuid.UUID) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	mapping, ok := m.roles[serverID][discordRoleID]
+	if !ok {
+		return db.ErrRoleMappingNotFound
+	}
+	delete(m.roles[serverID], discordRoleID)
+
+	m.recordAudit(&models.AuditEvent{
+		ServerID: serverID,
+		ActorID:  &actorID,
+		Action:   models.AuditRoleUnmapped,
+		Details: map[string]string{
+			"discord_role_id": discordRoleID,
+			"role":            string(mapping.Role),
+		},
+	})
+	return nil
+}
+
+// CreateTeam creates a new team
+func (m *Store) CreateTeam(ctx context.Context, team *models.Team) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, existing := range m.teams {
+		if existing.ServerID == team.ServerID && strings.EqualFold(existing.Name, team.Name) {
+			return db.ErrTeamExists
+		}
+	}
+	if team.CreatedAt.IsZero() {
+		team.CreatedAt = time.Now()
+	}
+	m.teams[team.ID] = copyTeam(team)
+
+	details := map[string]string{
+		"team_id": team.ID.String(),
+		"name":    team.Name,
+	}
+	if team.DiscordRoleID != "" {
+		details["discord_role_id"] = team.DiscordRoleID
+	}
+	m.recordAudit(&models.AuditEvent{
+		ServerID: team.ServerID,
+		ActorID:  &team.CreatedBy,
+		Action:   models.AuditTeamCreated,
+		Details:  details,
+	})
+	return nil
+}
+
+// GetTeams returns the teams of a server with their bot-managed members
+func (m *Store) GetTeams(ctx context.Context, serverID string) ([]*models.Team, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	var teams []*models.Team
+	for _, team := range m.teams {
+		if team.ServerID == serverID {
+			teams = append(teams, copyTeam(team))
+		}
+	}
+	sort.Slice(teams, func(a, b int) bool {
+		return strings.ToLower(teams[a].Name) < strings.ToLower(teams[b].Name)
+	})
+	return teams, nil
+}
+
+// DeleteTeam removes a team from a server along with its member list
+func (m *Store) DeleteTeam(ctx context.Context, teamID uuid.UUID, serverID string, actorID uuid.UUID) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	team, ok := m.teams[teamID]
+	if !ok || team.ServerID != serverID {
+		return db.ErrTeamNotFound
+	}
+	delete(m.teams, teamID)
+
+	m.recordAudit(&models.AuditEvent{
+		ServerID: serverID,
+		ActorID:  &actorID,
+		Action:   models.AuditTeamDeleted,
+		Details: map[string]string{
+			"team_id": teamID.String(),
+			"name":    team.Name,
+		},
+	})
+	return nil
+}
+
+// AddTeamMember adds a user to a bot-managed team
+func (m *Store) AddTeamMember(ctx context.Context, teamID uuid.UUID, serverID string, userID, actorID uuid.UUID) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	team, ok := m.teams[teamID]
+	if !ok || team.ServerID != serverID {
+		return db.ErrTeamNotFound
+	}
+	for _, memberID := range team.MemberIDs {
+		if memberID == userID {
+			return db.ErrAlreadyTeamMember
+		}
+	}
+	team.MemberIDs = append(team.MemberIDs, userID)
+
+	m.recordAudit(&models.AuditEvent{
+		ServerID:     serverID,
+		ActorID:      &actorID,
+		TargetUserID: &userID,
+		Action:       models.AuditTeamJoined,
+		Details: map[string]string{
+			"team_id": teamID.String(),
+			"name":    team.Name,
+		},
+	})
+	return nil
+}
+
+// RemoveTeamMember removes a user from a bot-managed team
+func (m *Store) RemoveTeamMember(ctx context.Context, teamID uuid.UUID, serverID string, userID, actorID uuid.UUID) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	team, ok := m.teams[teamID]
+	if !ok || team.ServerID != serverID {
+		return db.ErrTeamNotFound
+	}
+	for idx, memberID := range team.MemberIDs {
+		if memberID != userID {
+			continue
+		}
+		team.MemberIDs = append(team.MemberIDs[:idx], team.MemberIDs[idx+1:]...)
+
+		m.recordAudit(&models.AuditEvent{
+			ServerID:     serverID,
+			ActorID:      &actorID,
+			TargetUserID: &userID,
+			Action:       models.AuditTeamLeft,
+			Details: map[string]string{
+				"team_id": teamID.String(),
+				"name":    team.Name,
+			},
+		})
+		return nil
+	}
+	return db.ErrNotTeamMember
+}
+
+// GetOrCreateServerSettings retrieves server settings or creates them with defaults
+func (m *Store) GetOrCreateServerSettings(ctx context.Context, serverID string) (*models.ServerSettings, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return copySettings(m.serverSettings(serverID)), nil
+}
+
+// serverSettings returns a server's settings, creating them with defaults; the
+// caller must hold the write lock
+func (m *Store) serverSettings(serverID string) *models.ServerSettings {
+	if settings, ok := m.settings[serverID]; ok {
+		return settings
+	}
+
+	settings := &models.ServerSettings{
+		ID:              uuid.New(),
+		ServerID:        serverID,
+		InactivityLimit: 30, // Default 30 minutes
+		PingTimeout:     5,  // Default 5 minutes
+		LogCategories:   append([]models.LogCategory(nil), models.DefaultLogCategories...),
+		CreatedAt:       time.Now(),
+	}
+	m.settings[serverID] = settings
+	m.recordAudit(&models.AuditEvent{
+		ServerID: serverID,
+		Action:   models.AuditSettingsCreated,
+		Details: map[string]string{
+			"inactivity_limit": fmt.Sprintf("%d", settings.InactivityLimit),
+			"ping_timeout":     fmt.Sprintf("%d", settings.PingTimeout),
+		},
+	})
+	return settings
+}
+
+// SetLogChannel sets the channel that receives a server's log events and the
+// categories posted there. An empty channel ID turns the log channel off.
+func (m *Store) SetLogChannel(ctx context.Context, serverID, channelID string, categories []models.LogCategory, actorID uuid.UUID) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	settings := m.serverSettings(serverID)
+	settings.LogChannelID = channelID
+	settings.LogCategories = append([]models.LogCategory{}, categories...)
+
+	names := make([]string, 0, len(categories))
+	for _, category := range categories {
+		names = append(names, string(category))
+	}
+	m.recordAudit(&models.AuditEvent{
+		ServerID: serverID,
+		ActorID:  &actorID,
+		Action:   models.AuditLogChannelSet,
+		Details: map[string]string{
+			"channel_id": channelID,
+			"categories": strings.Join(names, ","),
+		},
+	})
+	return nil
+}
+
+// GetAuditEvents returns audit events for a server matching the filter, newest first
+func (m *Store) GetAuditEvents(ctx context.Context, filter models.AuditFilter) ([]*models.AuditEvent, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	limit := filter.Limit
+	if limit <= 0 {
+		limit = 50
+	}
+
+	var events []*models.AuditEvent
+	for i := len(m.audit) - 1; i >= 0 && len(events) < limit; i-- {
+		event := m.audit[i]
+		if event.ServerID != filter.ServerID {
+			continue
+		}
+		if filter.UserID != nil && !sameUUID(event.ActorID, *filter.UserID) && !sameUUID(event.TargetUserID, *filter.UserID) {
+			continue
+		}
+		if filter.TaskID != nil && !sameUUID(event.TaskID, *filter.TaskID) {
+			continue
+		}
+		if !filter.Since.IsZero() && event.CreatedAt.Before(filter.Since) {
+			continue
+		}
+		if !filter.Until.IsZero() && !event.CreatedAt.Before(filter.Until) {
+			continue
+		}
+
+		copied := copyAuditEvent(event)
+		if event.ActorID != nil {
+			if actor, ok := m.users[*event.ActorID]; ok {
+				copied.ActorName = actor.Username
+			}
+		}
+		events = append(events, copied)
+	}
+	return events, nil
+}
+
+func sameUUID(id *uuid.UUID, want uuid.UUID) bool {
+	return id != nil && *id == want
+}
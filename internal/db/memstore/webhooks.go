@@ -0,0 +1,236 @@
+package memstore
+
+import (
+	"context"
+	"encoding/json"
+	"sort"
+	"strings"
+	"time"
+
+	"taskbot/internal/db"
+	"taskbot/internal/db/models"
+	"taskbot/internal/events"
+
+	"github.com/google/uuid"
+)
+
+// CreateWebhook stores a new webhook for a server
+func (m *Store) CreateWebhook(ctx context.Context, webhook *models.Webhook) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if webhook.CreatedAt.IsZero() {
+		webhook.CreatedAt = time.Now()
+	}
+	m.webhooks[webhook.ID] = copyWebhook(webhook)
+	m.recordAudit(&models.AuditEvent{
+		ServerID: webhook.ServerID,
+		ActorID:  copyUUID(&webhook.CreatedBy),
+		Action:   models.AuditWebhookCreated,
+		Details: map[string]string{
+			"webhook_id": webhook.ID.String(),
+			"host":       models.WebhookHost(webhook.URL),
+			"events":     strings.Join(webhook.Events, ","),
+		},
+	})
+	return nil
+}
+
+// GetWebhooks returns a server's webhooks, oldest first, with the number of
+// deliveries each has waiting in the outbox
+func (m *Store) GetWebhooks(ctx context.Context, serverID string) ([]*models.Webhook, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	var webhooks []*models.Webhook
+	for _, webhook := range m.webhooks {
+		if webhook.ServerID != serverID {
+			continue
+		}
+		copied := copyWebhook(webhook)
+		for _, delivery := range m.outbox {
+			if delivery.WebhookID == webhook.ID {
+				copied.Pending++
+			}
+		}
+		webhooks = append(webhooks, copied)
+	}
+	sort.Slice(webhooks, func(a, b int) bool {
+		return webhooks[a].CreatedAt.Before(webhooks[b].CreatedAt)
+	})
+	return webhooks, nil
+}
+
+// DeleteWebhook deletes a webhook of a server along with its pending deliveries
+func (m *Store) DeleteWebhook(ctx context.Context, webhookID uuid.UUID, serverID string, actorID uuid.UUID) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	webhook, ok := m.webhooks[webhookID]
+	if !ok || webhook.ServerID != serverID {
+		return db.ErrWebhookNotFound
+	}
+	delete(m.webhooks, webhookID)
+	for id, delivery := range m.outbox {
+		if delivery.WebhookID == webhookID {
+			delete(m.outbox, id)
+		}
+	}
+	m.recordAudit(&models.AuditEvent{
+		ServerID: serverID,
+		ActorID:  &actorID,
+		Action:   models.AuditWebhookDeleted,
+		Details: map[string]string{
+			"webhook_id": webhookID.String(),
+			"host":       models.WebhookHost(webhook.URL),
+		},
+	})
+	return nil
+}
+
+// EnqueueWebhookEvent adds an event to the outbox of every webhook in the server
+// subscribed to its type, or only of webhookID when set, whatever its
+// subscriptions. It returns the number of deliveries queued.
+func (m *Store) EnqueueWebhookEvent(ctx context.Context, serverID string, webhookID *uuid.UUID, eventType string, payload []byte, at time.Time) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return m.enqueueWebhookEvent(serverID, webhookID, eventType, payload, at), nil
+}
+
+// enqueueWebhookEvent queues deliveries as described by EnqueueWebhookEvent; the
+// caller must hold the write lock
+func (m *Store) enqueueWebhookEvent(serverID string, webhookID *uuid.UUID, eventType string, payload []byte, at time.Time) int {
+	queued := 0
+	for _, webhook := range m.webhooks {
+		if webhook.ServerID != serverID {
+			continue
+		}
+		if webhookID != nil && webhook.ID != *webhookID {
+			continue
+		}
+		if webhookID == nil && !webhook.Subscribed(eventType) {
+			continue
+		}
+		id := uuid.New()
+		m.outbox[id] = &models.WebhookDelivery{
+			ID:            id,
+			WebhookID:     webhook.ID,
+			EventType:     eventType,
+			Payload:       append([]byte(nil), payload...),
+			NextAttemptAt: at,
+			CreatedAt:     at,
+		}
+		queued++
+	}
+	return queued
+}
+
+// recordEvent adds an event to the outbox of the server's webhooks subscribed to
+// it, along with the change it describes; the caller must hold the write lock.
+// Events outside servers are dropped.
+func (m *Store) recordEvent(eventType events.Type, serverID string, data interface{}) {
+	if serverID == "" {
+		return
+	}
+
+	e := events.Event{ID: uuid.New(), Type: eventType, GuildID: serverID, Time: time.Now(), Data: data}
+	// Event data is made of plain structs, so encoding cannot fail
+	payload, _ := json.Marshal(e)
+	m.enqueueWebhookEvent(serverID, nil, string(eventType), payload, e.Time)
+}
+
+// recordCheckInEvent records a check-in or declared time event; the caller must
+// hold the write lock
+func (m *Store) recordCheckInEvent(eventType events.Type, checkIn *models.CheckIn) {
+	user, ok := m.users[checkIn.UserID]
+	task, found := m.tasks[checkIn.TaskID]
+	if !ok || !found {
+		return
+	}
+	m.recordEvent(eventType, checkIn.ServerID, events.CheckInData{
+		User:    events.NewUser(user),
+		Task:    events.NewTask(task),
+		CheckIn: events.NewCheckIn(checkIn),
+	})
+}
+
+// recordTaskEvent records a task event, with actorID nil when no one made the
+// change; the caller must hold the write lock
+func (m *Store) recordTaskEvent(eventType events.Type, task *models.Task, actorID *uuid.UUID) {
+	data := events.TaskData{Task: events.NewTask(task)}
+	if actorID != nil {
+		if user, ok := m.users[*actorID]; ok {
+			actor := events.NewUser(user)
+			data.User = &actor
+		}
+	}
+	m.recordEvent(eventType, task.ServerID, data)
+}
+
+// ClaimDueWebhookDeliveries returns up to limit deliveries whose next attempt is
+// due and leases them until now+lease. A delivery that is neither completed nor
+// retried before the lease runs out is due again.
+func (m *Store) ClaimDueWebhookDeliveries(ctx context.Context, now time.Time, lease time.Duration, limit int) ([]*models.WebhookDelivery, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var due []*models.WebhookDelivery
+	for _, delivery := range m.outbox {
+		if !delivery.NextAttemptAt.After(now) {
+			due = append(due, delivery)
+		}
+	}
+	sort.Slice(due, func(a, b int) bool {
+		if !due[a].NextAttemptAt.Equal(due[b].NextAttemptAt) {
+			return due[a].NextAttemptAt.Before(due[b].NextAttemptAt)
+		}
+		return due[a].CreatedAt.Before(due[b].CreatedAt)
+	})
+	if len(due) > limit {
+		due = due[:limit]
+	}
+
+	deliveries := make([]*models.WebhookDelivery, 0, len(due))
+	for _, delivery := range due {
+		delivery.NextAttemptAt = now.Add(lease)
+		webhook := m.webhooks[delivery.WebhookID]
+		copied := copyWebhookDelivery(delivery)
+		copied.ServerID = webhook.ServerID
+		copied.URL = webhook.URL
+		copied.Secret = webhook.Secret
+		deliveries = append(deliveries, copied)
+	}
+	sort.Slice(deliveries, func(a, b int) bool {
+		return deliveries[a].CreatedAt.Before(deliveries[b].CreatedAt)
+	})
+	return deliveries, nil
+}
+
+// CompleteWebhookDelivery removes a delivery from the outbox once it succeeded
+// or was given up on, recording the outcome on its webhook. deliveryErr is empty
+// on success.
+func (m *Store) CompleteWebhookDelivery(ctx context.Context, delivery *models.WebhookDelivery, at time.Time, deliveryErr string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	delete(m.outbox, delivery.ID)
+	if webhook, ok := m.webhooks[delivery.WebhookID]; ok {
+		webhook.LastDeliveryAt = &at
+		webhook.LastError = deliveryErr
+	}
+	return nil
+}
+
+// RetryWebhookDelivery records a failed attempt and schedules the next one
+func (m *Store) RetryWebhookDelivery(ctx context.Context, deliveryID uuid.UUID, nextAttemptAt time.Time, deliveryErr string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if delivery, ok := m.outbox[deliveryID]; ok {
+		delivery.Attempts++
+		delivery.NextAttemptAt = nextAttemptAt
+		delivery.LastError = deliveryErr
+	}
+	return nil
+}
@@ -1,6 +1,7 @@
 package models
 
 import (
+	"net/url"
 	"time"
 
 	"github.com/google/uuid"
@@ -18,12 +19,14 @@ type Task struct {
 	ID          uuid.UUID
 	UserID      uuid.UUID
 	ServerID    string
+	ParentID    *uuid.UUID
 	Name        string
 	Description string
 	Tags        []string
 	Completed   bool
 	Global      bool
 	CreatedAt   time.Time
+	ArchivedAt  *time.Time
 }
 
 // CheckIn represents a task check-in record
@@ -41,6 +44,8 @@ type CheckInWithTask struct {
 	CheckIn *CheckIn
 	Task    *Task
 	User    *User
+	// Parent is the task's parent with only ID and Name set, or nil for top-level tasks
+	Parent *Task
 }
 
 type ServerSettings struct {
@@ -48,7 +53,280 @@ type ServerSettings struct {
 	ServerID        string
 	InactivityLimit int
 	PingTimeout     int
-	CreatedAt       time.Time
+	// LogChannelID is the channel that receives server log events, or empty
+	LogChannelID string
+	// LogCategories are the event categories posted to the log channel
+	LogCategories []LogCategory
+	CreatedAt     time.Time
+}
+
+// LogCategory groups the events that can be posted to a server's log channel
+type LogCategory string
+
+const (
+	// LogErrors covers failed commands and background jobs
+	LogErrors LogCategory = "errors"
+	// LogAdmin covers admin-only commands
+	LogAdmin LogCategory = "admin"
+)
+
+// DefaultLogCategories are posted when a log channel is set without choosing
+var DefaultLogCategories = []LogCategory{LogErrors, LogAdmin}
+
+// LogsCategory reports whether events of a category go to the log channel
+func (s *ServerSettings) LogsCategory(category LogCategory) bool {
+	if s.LogChannelID == "" {
+		return false
+	}
+	for _, c := range s.LogCategories {
+		if c == category {
+			return true
+		}
+	}
+	return false
+}
+
+// Audit actions recorded in audit_events
+const (
+	AuditTaskCreated     = "task.created"
+	AuditTaskCompleted   = "task.completed"
+	AuditTaskReopened    = "task.reopened"
+	AuditTaskArchived    = "task.archived"
+	AuditTaskDeleted     = "task.deleted"
+	AuditTaskMerged      = "task.merged"
+	AuditCheckInStarted  = "checkin.started"
+	AuditCheckInDeclared = "checkin.declared"
+	AuditCheckInEnded    = "checkin.ended"
+	AuditTimezoneChanged = "user.timezone_changed"
+	AuditSettingsCreated = "settings.created"
+	AuditLogChannelSet   = "settings.log_channel_set"
+	AuditTemplateCreated = "template.created"
+	AuditTemplateDeleted = "template.deleted"
+	AuditRoleMapped      = "role.mapped"
+	AuditRoleUnmapped    = "role.unmapped"
+	AuditTeamCreated     = "team.created"
+	AuditTeamDeleted     = "team.deleted"
+	AuditTeamJoined      = "team.member_added"
+	AuditTeamLeft        = "team.member_removed"
+	AuditAPITokenCreated = "api_token.created"
+	AuditAPITokenRevoked = "api_token.revoked"
+	AuditWebhookCreated  = "webhook.created"
+	AuditWebhookDeleted  = "webhook.deleted"
+)
+
+// AuditEvent is an append-only record of a change made through the bot
+type AuditEvent struct {
+	ID           uuid.UUID
+	ServerID     string
+	ActorID      *uuid.UUID
+	ActorName    string
+	TargetUserID *uuid.UUID
+	TaskID       *uuid.UUID
+	Action       string
+	Details      map[string]string
+	CreatedAt    time.Time
+}
+
+// AuditFilter narrows down audit event queries
+type AuditFilter struct {
+	ServerID string
+	UserID   *uuid.UUID
+	TaskID   *uuid.UUID
+	Since    time.Time
+	Until    time.Time
+	Limit    int
+}
+
+// TaskSearchFilter narrows down task search queries
+type TaskSearchFilter struct {
+	ServerID  string
+	Query     string
+	OwnerID   *uuid.UUID
+	Completed *bool
+	Tag       string
+	Since     time.Time
+	Until     time.Time
+	Limit     int
+	Offset    int
+
+	// VisibleUserIDs, when not nil, limits results to global tasks and tasks
+	// owned by these users, and time spent to their check-ins
+	VisibleUserIDs []uuid.UUID
+}
+
+// TaskSearchResult is a task matched by a search along with its logged time
+type TaskSearchResult struct {
+	Task      *Task
+	OwnerName string
+	TimeSpent time.Duration
+}
+
+// TaskUsage is a task together with how often and how recently a user checked in to it
+type TaskUsage struct {
+	Task       *Task
+	ParentName string
+	// OwnerName is the username of the task's owner; only GetServerTaskSuggestions sets it
+	OwnerName string
+	LastUsed  *time.Time
+	UseCount  int
+}
+
+// TaskTemplate describes a global task that is recreated on a recurring schedule
+type TaskTemplate struct {
+	ID          uuid.UUID
+	ServerID    string
+	Name        string
+	Description string
+	Schedule    string
+	Timezone    string
+	CreatedBy   uuid.UUID
+	LastTaskID  *uuid.UUID
+	NextRunAt   time.Time
+	CreatedAt   time.Time
+}
+
+// BotRole is a permission level within the bot, granted through Discord roles
+type BotRole string
+
+const (
+	// RoleNone grants no access; members get it when a guild restricts the bot
+	// to members with a role mapped to RoleMember and they have none
+	RoleNone   BotRole = ""
+	RoleMember BotRole = "member"
+	RoleLead   BotRole = "lead"
+	RoleAdmin  BotRole = "admin"
+)
+
+// AtLeast reports whether r grants at least the permissions of min
+func (r BotRole) AtLeast(min BotRole) bool {
+	return r.rank() >= min.rank()
+}
+
+func (r BotRole) rank() int {
+	switch r {
+	case RoleMember:
+		return 1
+	case RoleLead:
+		return 2
+	case RoleAdmin:
+		return 3
+	}
+	return 0
+}
+
+// RoleMapping grants a bot role to every member with a Discord role in a guild
+type RoleMapping struct {
+	ServerID      string
+	DiscordRoleID string
+	Role          BotRole
+	CreatedBy     uuid.UUID
+	CreatedAt     time.Time
 }
 
 // Add other models here if needed
+
+// Team groups the users whose detailed reports its leads may see. A team backed by
+// a Discord role includes everyone with that role; otherwise its members are
+// managed in the bot.
+type Team struct {
+	ID            uuid.UUID
+	ServerID      string
+	Name          string
+	DiscordRoleID string // empty for bot-managed teams
+	MemberIDs     []uuid.UUID
+	CreatedBy     uuid.UUID
+	CreatedAt     time.Time
+}
+
+// APIPermission is something an API token allows its holder to do
+type APIPermission string
+
+const (
+	// APIReadOwn allows reading the token owner's own data
+	APIReadOwn APIPermission = "read-own"
+	// APIReadAll allows reading the data of everyone in the token's guild while
+	// its owner is an admin there
+	APIReadAll APIPermission = "read-all"
+)
+
+// APIToken authenticates HTTP API calls on behalf of a Discord user in one guild.
+// Only a hash of the token is stored; Prefix identifies it in listings.
+type APIToken struct {
+	ID          uuid.UUID
+	ServerID    string
+	UserID      uuid.UUID
+	Username    string
+	DiscordID   string
+	Name        string
+	Prefix      string
+	TokenHash   string
+	Permissions []APIPermission
+	CreatedAt   time.Time
+	ExpiresAt   time.Time
+	LastUsedAt  *time.Time
+}
+
+// Has reports whether the token grants a permission
+func (t *APIToken) Has(permission APIPermission) bool {
+	for _, p := range t.Permissions {
+		if p == permission {
+			return true
+		}
+	}
+	return false
+}
+
+// Webhook posts a guild's events to an external URL, signed with its secret
+type Webhook struct {
+	ID        uuid.UUID
+	ServerID  string
+	URL       string
+	Secret    string
+	Events    []string // empty means every event
+	CreatedBy uuid.UUID
+	CreatedAt time.Time
+
+	// Outcome of the most recent delivery; LastError is empty when it succeeded
+	LastDeliveryAt *time.Time
+	LastError      string
+
+	// Pending counts deliveries still waiting in the outbox
+	Pending int
+}
+
+// Subscribed reports whether the webhook receives events of a type
+func (w *Webhook) Subscribed(eventType string) bool {
+	if len(w.Events) == 0 {
+		return true
+	}
+	for _, e := range w.Events {
+		if e == eventType {
+			return true
+		}
+	}
+	return false
+}
+
+// WebhookHost returns the host of a webhook URL, which unlike the full URL is
+// safe to show and log since paths and queries often carry credentials
+func WebhookHost(rawURL string) string {
+	if u, err := url.Parse(rawURL); err == nil && u.Host != "" {
+		return u.Host
+	}
+	return "webhook"
+}
+
+// WebhookDelivery is an event in the outbox waiting to be posted to a webhook
+type WebhookDelivery struct {
+	ID            uuid.UUID
+	WebhookID     uuid.UUID
+	ServerID      string
+	URL           string
+	Secret        string
+	EventType     string
+	Payload       []byte
+	Attempts      int
+	NextAttemptAt time.Time
+	LastError     string
+	CreatedAt     time.Time
+}
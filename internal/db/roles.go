@@ -0,0 +1,127 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"taskbot/internal/db/models"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+)
+
+// ErrRoleMappingNotFound is returned when removing a Discord role that is not mapped
+var ErrRoleMappingNotFound = errors.New("role mapping not found")
+
+// GetRoleMappings returns the Discord role to bot role mappings of a server
+func (db *DB) GetRoleMappings(ctx context.Context, serverID string) ([]*models.RoleMapping, error) {
+	query := `
+		SELECT server_id, discord_role_id, role, created_by, created_at
+		FROM role_mappings
+		WHERE server_id = $1
+		ORDER BY CASE role WHEN 'admin' THEN 0 WHEN 'lead' THEN 1 ELSE 2 END, discord_role_id ASC`
+
+	rows, err := db.Query(ctx, query, serverID)
+	if err != nil {
+		return nil, fmt.Errorf("error getting role mappings: %w", err)
+	}
+	defer rows.Close()
+
+	var mappings []*models.RoleMapping
+	for rows.Next() {
+		mapping := &models.RoleMapping{}
+		err := rows.Scan(
+			&mapping.ServerID,
+			&mapping.DiscordRoleID,
+			&mapping.Role,
+			&mapping.CreatedBy,
+			&mapping.CreatedAt,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("error scanning role mapping: %w", err)
+		}
+		mappings = append(mappings, mapping)
+	}
+	return mappings, rows.Err()
+}
+
+// SetRoleMapping maps a Discord role to a bot role, replacing any existing mapping
+// for that Discord role
+func (db *DB) SetRoleMapping(ctx context.Context, mapping *models.RoleMapping) error {
+	if mapping.CreatedAt.IsZero() {
+		mapping.CreatedAt = time.Now()
+	}
+
+	query := `
+		INSERT INTO role_mappings (server_id, discord_role_id, role, created_by, created_at)
+		VALUES ($1, $2, $3, $4, $5)
+		ON CONFLICT (server_id, discord_role_id)
+		DO UPDATE SET role = EXCLUDED.role, created_by = EXCLUDED.created_by, created_at = EXCLUDED.created_at`
+
+	return db.withTx(ctx, func(tx pgx.Tx) error {
+		var previous string
+		err := tx.QueryRow(ctx, `
+			SELECT role FROM role_mappings
+			WHERE server_id = $1 AND discord_role_id = $2
+			FOR UPDATE`, mapping.ServerID, mapping.DiscordRoleID).Scan(&previous)
+		if err != nil && err != pgx.ErrNoRows {
+			return fmt.Errorf("error getting role mapping: %w", err)
+		}
+
+		_, err = tx.Exec(ctx, query,
+			mapping.ServerID,
+			mapping.DiscordRoleID,
+			string(mapping.Role),
+			mapping.CreatedBy.String(),
+			mapping.CreatedAt,
+		)
+		if err != nil {
+			return fmt.Errorf("error setting role mapping: %w", err)
+		}
+
+		details := map[string]string{
+			"discord_role_id": mapping.DiscordRoleID,
+			"role":            string(mapping.Role),
+		}
+		if previous != "" {
+			details["previous"] = previous
+		}
+		return recordAudit(ctx, tx, &models.AuditEvent{
+			ServerID: mapping.ServerID,
+			ActorID:  &mapping.CreatedBy,
+			Action:   models.AuditRoleMapped,
+			Details:  details,
+		})
+	})
+}
+
+// DeleteRoleMapping removes the mapping of a Discord role in a server
+func (db *DB) DeleteRoleMapping(ctx context.Context, serverID, discordRoleID string, actorID uuid.UUID) error {
+	query := `
+		DELETE FROM role_mappings
+		WHERE server_id = $1 AND discord_role_id = $2
+		RETURNING role`
+
+	return db.withTx(ctx, func(tx pgx.Tx) error {
+		var role string
+		err := tx.QueryRow(ctx, query, serverID, discordRoleID).Scan(&role)
+		if err == pgx.ErrNoRows {
+			return ErrRoleMappingNotFound
+		}
+		if err != nil {
+			return fmt.Errorf("error deleting role mapping: %w", err)
+		}
+
+		return recordAudit(ctx, tx, &models.AuditEvent{
+			ServerID: serverID,
+			ActorID:  &actorID,
+			Action:   models.AuditRoleUnmapped,
+			Details: map[string]string{
+				"discord_role_id": discordRoleID,
+				"role":            role,
+			},
+		})
+	})
+}
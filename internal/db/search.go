@@ -0,0 +1,128 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+	"unicode"
+
+	"taskbot/internal/db/models"
+)
+
+// SearchTasks runs a full-text search over a server's tasks and returns one page
+// of results together with the total number of matches, which is counted even
+// when the page is past the last one
+func (db *DB) SearchTasks(ctx context.Context, filter models.TaskSearchFilter) ([]*models.TaskSearchResult, int, error) {
+	conditions := []string{"t.server_id = $1"}
+	args := []any{filter.ServerID}
+	rank := "0"
+
+	if tsquery := prefixTSQuery(filter.Query); tsquery != "" {
+		args = append(args, tsquery)
+		conditions = append(conditions, fmt.Sprintf("t.search_vector @@ to_tsquery('simple', $%d)", len(args)))
+		rank = fmt.Sprintf("ts_rank(t.search_vector, to_tsquery('simple', $%d))", len(args))
+	}
+	if filter.OwnerID != nil {
+		args = append(args, filter.OwnerID.String())
+		conditions = append(conditions, fmt.Sprintf("t.user_id = $%d", len(args)))
+	}
+	if filter.Completed != nil {
+		args = append(args, *filter.Completed)
+		conditions = append(conditions, fmt.Sprintf("t.completed = $%d", len(args)))
+	}
+	if filter.Tag != "" {
+		args = append(args, strings.ToLower(filter.Tag))
+		conditions = append(conditions, fmt.Sprintf("EXISTS (SELECT 1 FROM unnest(t.tags) tag WHERE lower(tag) = $%d)", len(args)))
+	}
+	if !filter.Since.IsZero() {
+		args = append(args, filter.Since)
+		conditions = append(conditions, fmt.Sprintf("t.created_at >= $%d", len(args)))
+	}
+	if !filter.Until.IsZero() {
+		args = append(args, filter.Until)
+		conditions = append(conditions, fmt.Sprintf("t.created_at < $%d", len(args)))
+	}
+
+	// Time logged by users the caller may not see is left out of the totals
+	checkInCondition := ""
+	if filter.VisibleUserIDs != nil {
+		userIDs := make([]string, len(filter.VisibleUserIDs))
+		for i, id := range filter.VisibleUserIDs {
+			userIDs[i] = id.String()
+		}
+		args = append(args, userIDs)
+		conditions = append(conditions, fmt.Sprintf("(t.global OR t.user_id = ANY($%d::uuid[]))", len(args)))
+		checkInCondition = fmt.Sprintf(" AND c.user_id = ANY($%d::uuid[])", len(args))
+	}
+
+	where := strings.Join(conditions, " AND ")
+
+	// Count separately so that the total is known even for a page past the end
+	var total int
+	err := db.QueryRow(ctx, "SELECT COUNT(*) FROM tasks t WHERE "+where, args...).Scan(&total)
+	if err != nil {
+		return nil, 0, fmt.Errorf("error counting tasks: %w", err)
+	}
+	if total == 0 {
+		return nil, 0, nil
+	}
+
+	limit := filter.Limit
+	if limit <= 0 {
+		limit = 10
+	}
+	args = append(args, limit, filter.Offset)
+
+	query := fmt.Sprintf(`
+		SELECT
+			t.id, t.user_id, t.server_id, t.name, COALESCE(t.description, ''), t.tags, t.completed, t.global, t.created_at,
+			t.archived_at, u.username,
+			COALESCE(SUM(EXTRACT(EPOCH FROM (c.end_time - c.start_time))), 0)::bigint AS seconds
+		FROM tasks t
+		JOIN users u ON t.user_id = u.id
+		LEFT JOIN check_ins c ON c.task_id = t.id AND c.end_time IS NOT NULL%s
+		WHERE %s
+		GROUP BY t.id, u.username
+		ORDER BY %s DESC, t.created_at DESC
+		LIMIT $%d OFFSET $%d`, checkInCondition, where, rank, len(args)-1, len(args))
+
+	rows, err := db.Query(ctx, query, args...)
+	if err != nil {
+		return nil, 0, fmt.Errorf("error searching tasks: %w", err)
+	}
+	defer rows.Close()
+
+	var results []*models.TaskSearchResult
+	for rows.Next() {
+		task := &models.Task{}
+		result := &models.TaskSearchResult{Task: task}
+		var seconds int64
+		err := rows.Scan(
+			&task.ID, &task.UserID, &task.ServerID, &task.Name, &task.Description,
+			&task.Tags, &task.Completed, &task.Global, &task.CreatedAt,
+			&task.ArchivedAt, &result.OwnerName,
+			&seconds,
+		)
+		if err != nil {
+			return nil, 0, fmt.Errorf("error scanning task: %w", err)
+		}
+		result.TimeSpent = time.Duration(seconds) * time.Second
+		results = append(results, result)
+	}
+	return results, total, rows.Err()
+}
+
+// prefixTSQuery turns free text into a tsquery matching every word as a prefix,
+// e.g. "code rev" becomes "code:* & rev:*"
+func prefixTSQuery(text string) string {
+	words := strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+
+	terms := make([]string, 0, len(words))
+	for _, word := range words {
+		terms = append(terms, word+":*")
+	}
+	return strings.Join(terms, " & ")
+}
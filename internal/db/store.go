@@ -0,0 +1,92 @@
+package db
+
+import (
+	"context"
+	"time"
+
+	"taskbot/internal/db/models"
+
+	"github.com/google/uuid"
+)
+
+// Store is the persistence layer used by the bot. DB implements it on top of
+// Postgres; memstore provides an in-memory implementation.
+type Store interface {
+	// Users
+	GetOrCreateUser(ctx context.Context, discordID string, username string) (*models.User, error)
+	GetUserByDiscordID(ctx context.Context, discordID string) (*models.User, error)
+	GetAllUsers(ctx context.Context) ([]*models.User, error)
+	GetGuildUsers(ctx context.Context, guildID string) ([]*models.User, error)
+	AddUserToGuild(ctx context.Context, userID uuid.UUID, guildID string) error
+	UpdateUserTimezone(ctx context.Context, userID uuid.UUID, serverID string, timezone string) error
+
+	// Tasks
+	CreateTask(ctx context.Context, task *models.Task) error
+	GetTaskByID(ctx context.Context, taskID uuid.UUID) (*models.Task, error)
+	GetUserTasks(ctx context.Context, userID uuid.UUID, serverID string) ([]*models.Task, error)
+	GetTaskSuggestions(ctx context.Context, userID uuid.UUID, serverID string) ([]*models.TaskUsage, error)
+	GetServerTaskSuggestions(ctx context.Context, serverID string) ([]*models.TaskUsage, error)
+	CountOpenSubtasks(ctx context.Context, taskID uuid.UUID) (int, error)
+	UpdateTaskStatus(ctx context.Context, taskID uuid.UUID, completed bool, actorID uuid.UUID, adminAction bool) error
+	SearchTasks(ctx context.Context, filter models.TaskSearchFilter) ([]*models.TaskSearchResult, int, error)
+	ArchiveTask(ctx context.Context, taskID uuid.UUID, actorID uuid.UUID) error
+	ArchiveCompletedTasks(ctx context.Context, serverID string, cutoff time.Time, actorID uuid.UUID) (int, error)
+	DeleteTask(ctx context.Context, taskID uuid.UUID, reassignTo *uuid.UUID, actorID uuid.UUID) (int64, error)
+	MergeTasks(ctx context.Context, sourceID, targetID uuid.UUID, actorID uuid.UUID) (int64, error)
+
+	// Check-ins
+	CreateCheckIn(ctx context.Context, checkIn *models.CheckIn) error
+	SwitchCheckIn(ctx context.Context, checkIn *models.CheckIn) (*models.CheckIn, error)
+	DeclareCheckIn(ctx context.Context, checkIn *models.CheckIn) (*models.CheckIn, error)
+	CheckOut(ctx context.Context, checkInID uuid.UUID) error
+	GetActiveCheckIn(ctx context.Context, userID uuid.UUID, serverID string) (*models.CheckIn, error)
+	GetCheckInByID(ctx context.Context, checkInID uuid.UUID) (*models.CheckIn, error)
+	GetAllActiveCheckIns(ctx context.Context, guildID string) ([]*models.CheckInWithTask, error)
+	CountActiveCheckIns(ctx context.Context) (map[string]int, error)
+	GetAllTaskHistory(ctx context.Context, guildID string, startDate, endDate time.Time) ([]*models.CheckInWithTask, error)
+
+	// Task templates
+	CreateTaskTemplate(ctx context.Context, tmpl *models.TaskTemplate) error
+	GetTaskTemplates(ctx context.Context, serverID string) ([]*models.TaskTemplate, error)
+	GetDueTaskTemplates(ctx context.Context, now time.Time) ([]*models.TaskTemplate, error)
+	DeleteTaskTemplate(ctx context.Context, templateID uuid.UUID, serverID string, actorID uuid.UUID) error
+	RunTaskTemplate(ctx context.Context, templateID uuid.UUID, task *models.Task, nextRunAt time.Time) (bool, error)
+
+	// Role mappings
+	GetRoleMappings(ctx context.Context, serverID string) ([]*models.RoleMapping, error)
+	SetRoleMapping(ctx context.Context, mapping *models.RoleMapping) error
+	DeleteRoleMapping(ctx context.Context, serverID, discordRoleID string, actorID uuid.UUID) error
+
+	// Teams
+	CreateTeam(ctx context.Context, team *models.Team) error
+	GetTeams(ctx context.Context, serverID string) ([]*models.Team, error)
+	DeleteTeam(ctx context.Context, teamID uuid.UUID, serverID string, actorID uuid.UUID) error
+	AddTeamMember(ctx context.Context, teamID uuid.UUID, serverID string, userID, actorID uuid.UUID) error
+	RemoveTeamMember(ctx context.Context, teamID uuid.UUID, serverID string, userID, actorID uuid.UUID) error
+
+	// API tokens
+	CreateAPIToken(ctx context.Context, token *models.APIToken) error
+	GetAPITokens(ctx context.Context, serverID string, userID *uuid.UUID) ([]*models.APIToken, error)
+	UseAPIToken(ctx context.Context, tokenHash string, now time.Time) (*models.APIToken, error)
+	RevokeAPIToken(ctx context.Context, tokenID uuid.UUID, serverID string, actorID uuid.UUID) error
+
+	// Webhooks and their delivery outbox
+	CreateWebhook(ctx context.Context, webhook *models.Webhook) error
+	GetWebhooks(ctx context.Context, serverID string) ([]*models.Webhook, error)
+	DeleteWebhook(ctx context.Context, webhookID uuid.UUID, serverID string, actorID uuid.UUID) error
+	EnqueueWebhookEvent(ctx context.Context, serverID string, webhookID *uuid.UUID, eventType string, payload []byte, at time.Time) (int, error)
+	ClaimDueWebhookDeliveries(ctx context.Context, now time.Time, lease time.Duration, limit int) ([]*models.WebhookDelivery, error)
+	CompleteWebhookDelivery(ctx context.Context, delivery *models.WebhookDelivery, at time.Time, deliveryErr string) error
+	RetryWebhookDelivery(ctx context.Context, deliveryID uuid.UUID, nextAttemptAt time.Time, deliveryErr string) error
+
+	// Server settings and audit log
+	GetOrCreateServerSettings(ctx context.Context, serverID string) (*models.ServerSettings, error)
+	SetLogChannel(ctx context.Context, serverID, channelID string, categories []models.LogCategory, actorID uuid.UUID) error
+	GetAuditEvents(ctx context.Context, filter models.AuditFilter) ([]*models.AuditEvent, error)
+
+	// Ping checks that the store is reachable
+	Ping(ctx context.Context) error
+	Close()
+}
+
+var _ Store = (*DB)(nil)
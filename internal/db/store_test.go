@@ -0,0 +1,381 @@
+package db_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"sort"
+	"testing"
+	"time"
+
+	"taskbot/internal/db"
+	"taskbot/internal/db/memstore"
+	"taskbot/internal/db/models"
+	"taskbot/internal/events"
+	"taskbot/internal/migrate"
+	"taskbot/migrations"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// forEachStore runs a test against the in-memory store and, when DATABASE_URL
+// points at a Postgres database, against Postgres with all migrations applied.
+// Tests use fresh guild and user IDs, so they can share a database.
+func forEachStore(t *testing.T, test func(t *testing.T, store db.Store)) {
+	t.Run("memstore", func(t *testing.T) {
+		test(t, memstore.New())
+	})
+	t.Run("postgres", func(t *testing.T) {
+		test(t, postgresStore(t))
+	})
+}
+
+func postgresStore(t *testing.T) db.Store {
+	t.Helper()
+
+	url := os.Getenv("DATABASE_URL")
+	if url == "" {
+		t.Skip("DATABASE_URL is not set")
+	}
+
+	cfg, err := pgxpool.ParseConfig(url)
+	if err != nil {
+		t.Fatalf("parsing DATABASE_URL: %v", err)
+	}
+	cfg.ConnConfig.DefaultQueryExecMode = pgx.QueryExecModeSimpleProtocol
+
+	ctx := context.Background()
+	pool, err := pgxpool.NewWithConfig(ctx, cfg)
+	if err != nil {
+		t.Fatalf("connecting to Postgres: %v", err)
+	}
+	t.Cleanup(pool.Close)
+
+	migrator, err := migrate.New(pool, migrations.FS)
+	if err != nil {
+		t.Fatalf("loading migrations: %v", err)
+	}
+	if _, err := migrator.Up(ctx, 0); err != nil {
+		t.Fatalf("applying migrations: %v", err)
+	}
+	return &db.DB{Pool: pool}
+}
+
+func newGuildID() string {
+	return "test-" + uuid.NewString()
+}
+
+func newUser(t *testing.T, store db.Store, username string) *models.User {
+	t.Helper()
+
+	user, err := store.GetOrCreateUser(context.Background(), uuid.NewString(), username)
+	if err != nil {
+		t.Fatalf("creating user: %v", err)
+	}
+	return user
+}
+
+func newTask(t *testing.T, store db.Store, guildID string, owner *models.User, name string, global bool) *models.Task {
+	t.Helper()
+
+	task := &models.Task{
+		ID:        uuid.New(),
+		UserID:    owner.ID,
+		ServerID:  guildID,
+		Name:      name,
+		Global:    global,
+		CreatedAt: time.Now(),
+	}
+	if err := store.CreateTask(context.Background(), task); err != nil {
+		t.Fatalf("creating task: %v", err)
+	}
+	return task
+}
+
+// declare logs time to a task that ended now
+func declare(t *testing.T, store db.Store, user *models.User, task *models.Task, spent time.Duration) {
+	t.Helper()
+
+	end := time.Now()
+	_, err := store.DeclareCheckIn(context.Background(), &models.CheckIn{
+		ID:        uuid.New(),
+		UserID:    user.ID,
+		ServerID:  task.ServerID,
+		TaskID:    task.ID,
+		StartTime: end.Add(-spent),
+		EndTime:   &end,
+	})
+	if err != nil {
+		t.Fatalf("declaring time: %v", err)
+	}
+}
+
+func newWebhook(t *testing.T, store db.Store, guildID string, creator *models.User, eventTypes ...string) *models.Webhook {
+	t.Helper()
+
+	webhook := &models.Webhook{
+		ID:        uuid.New(),
+		ServerID:  guildID,
+		URL:       "https://example.com/hook",
+		Secret:    "secret",
+		Events:    eventTypes,
+		CreatedBy: creator.ID,
+		CreatedAt: time.Now(),
+	}
+	if err := store.CreateWebhook(context.Background(), webhook); err != nil {
+		t.Fatalf("creating webhook: %v", err)
+	}
+	return webhook
+}
+
+// claim claims due deliveries and keeps those of the given webhooks, since a
+// shared database may hold deliveries of other tests
+func claim(t *testing.T, store db.Store, now time.Time, webhooks ...*models.Webhook) []*models.WebhookDelivery {
+	t.Helper()
+
+	deliveries, err := store.ClaimDueWebhookDeliveries(context.Background(), now, time.Minute, 1000)
+	if err != nil {
+		t.Fatalf("claiming deliveries: %v", err)
+	}
+	ours := make(map[uuid.UUID]bool, len(webhooks))
+	for _, webhook := range webhooks {
+		ours[webhook.ID] = true
+	}
+	var claimed []*models.WebhookDelivery
+	for _, delivery := range deliveries {
+		if ours[delivery.WebhookID] {
+			claimed = append(claimed, delivery)
+		}
+	}
+	return claimed
+}
+
+func TestWebhookEnqueueAndClaim(t *testing.T) {
+	forEachStore(t, func(t *testing.T, store db.Store) {
+		ctx := context.Background()
+		guildID := newGuildID()
+		admin := newUser(t, store, "admin")
+		subscribed := newWebhook(t, store, guildID, admin, "task.created")
+		other := newWebhook(t, store, guildID, admin, "checkin.started")
+
+		now := time.Now()
+		payload := []byte(`{"type": "task.created", "data": {"name": "Write docs"}}`)
+		queued, err := store.EnqueueWebhookEvent(ctx, guildID, nil, "task.created", payload, now)
+		if err != nil {
+			t.Fatalf("enqueueing event: %v", err)
+		}
+		if queued != 1 {
+			t.Fatalf("queued %d deliveries for subscribers, want 1", queued)
+		}
+		queued, err = store.EnqueueWebhookEvent(ctx, guildID, &other.ID, "ping", []byte(`{"type": "ping"}`), now)
+		if err != nil {
+			t.Fatalf("enqueueing ping: %v", err)
+		}
+		if queued != 1 {
+			t.Fatalf("queued %d deliveries for one webhook, want 1", queued)
+		}
+
+		deliveries := claim(t, store, now, subscribed, other)
+		if len(deliveries) != 2 {
+			t.Fatalf("claimed %d deliveries, want 2", len(deliveries))
+		}
+		for _, delivery := range deliveries {
+			if delivery.ServerID != guildID || delivery.URL == "" || delivery.Secret == "" {
+				t.Fatalf("delivery is missing its webhook: %+v", delivery)
+			}
+			if delivery.WebhookID == subscribed.ID {
+				var got struct {
+					Type string
+					Data struct{ Name string }
+				}
+				if err := json.Unmarshal(delivery.Payload, &got); err != nil {
+					t.Fatalf("stored payload is not JSON: %v", err)
+				}
+				if got.Type != "task.created" || got.Data.Name != "Write docs" {
+					t.Fatalf("payload = %s", delivery.Payload)
+				}
+			}
+		}
+
+		// Claimed deliveries are leased, and due again once the lease runs out
+		if again := claim(t, store, now, subscribed, other); len(again) != 0 {
+			t.Fatalf("claimed %d leased deliveries", len(again))
+		}
+		expired := claim(t, store, now.Add(2*time.Minute), subscribed, other)
+		if len(expired) != 2 {
+			t.Fatalf("claimed %d deliveries after the lease, want 2", len(expired))
+		}
+
+		for _, delivery := range expired {
+			if err := store.CompleteWebhookDelivery(ctx, delivery, now, ""); err != nil {
+				t.Fatalf("completing delivery: %v", err)
+			}
+		}
+		if left := claim(t, store, now.Add(time.Hour), subscribed, other); len(left) != 0 {
+			t.Fatalf("claimed %d completed deliveries", len(left))
+		}
+
+		webhooks, err := store.GetWebhooks(ctx, guildID)
+		if err != nil {
+			t.Fatalf("getting webhooks: %v", err)
+		}
+		for _, webhook := range webhooks {
+			if webhook.Pending != 0 || webhook.LastDeliveryAt == nil || webhook.LastError != "" {
+				t.Fatalf("webhook after delivery = %+v", webhook)
+			}
+		}
+	})
+}
+
+func TestChangesQueueWebhookEvents(t *testing.T) {
+	forEachStore(t, func(t *testing.T, store db.Store) {
+		guildID := newGuildID()
+		user := newUser(t, store, "member")
+		webhook := newWebhook(t, store, guildID, user)
+
+		task := newTask(t, store, guildID, user, "Write docs", false)
+		declare(t, store, user, task, time.Hour)
+
+		var types []string
+		for _, delivery := range claim(t, store, time.Now(), webhook) {
+			types = append(types, delivery.EventType)
+		}
+		sort.Strings(types)
+		want := []string{string(events.TaskCreated), string(events.TimeDeclared)}
+		if len(types) != len(want) || types[0] != want[0] || types[1] != want[1] {
+			t.Fatalf("queued events = %v, want %v", types, want)
+		}
+	})
+}
+
+func TestUnchangedTaskStatusRecordsNothing(t *testing.T) {
+	forEachStore(t, func(t *testing.T, store db.Store) {
+		ctx := context.Background()
+		guildID := newGuildID()
+		user := newUser(t, store, "member")
+		task := newTask(t, store, guildID, user, "Write docs", false)
+		webhook := newWebhook(t, store, guildID, user, string(events.TaskCompleted))
+
+		for i := 0; i < 2; i++ {
+			if err := store.UpdateTaskStatus(ctx, task.ID, true, user.ID, false); err != nil {
+				t.Fatalf("completing task: %v", err)
+			}
+		}
+		if queued := claim(t, store, time.Now(), webhook); len(queued) != 1 {
+			t.Fatalf("queued %d task.completed events, want 1", len(queued))
+		}
+
+		if err := store.UpdateTaskStatus(ctx, uuid.New(), true, user.ID, false); !errors.Is(err, db.ErrTaskNotFound) {
+			t.Fatalf("updating an unknown task returned %v, want ErrTaskNotFound", err)
+		}
+	})
+}
+
+func TestMergeIntoArchivedTask(t *testing.T) {
+	forEachStore(t, func(t *testing.T, store db.Store) {
+		ctx := context.Background()
+		guildID := newGuildID()
+		user := newUser(t, store, "member")
+		source := newTask(t, store, guildID, user, "Write docs", false)
+		target := newTask(t, store, guildID, user, "Docs", false)
+		declare(t, store, user, source, time.Hour)
+
+		if err := store.ArchiveTask(ctx, target.ID, user.ID); err != nil {
+			t.Fatalf("archiving target: %v", err)
+		}
+		if _, err := store.MergeTasks(ctx, source.ID, target.ID, user.ID); !errors.Is(err, db.ErrTaskArchived) {
+			t.Fatalf("merging into an archived task returned %v, want ErrTaskArchived", err)
+		}
+		if kept, err := store.GetTaskByID(ctx, source.ID); err != nil || kept == nil {
+			t.Fatalf("merge source was removed: %v", err)
+		}
+	})
+}
+
+func TestSearchTaskTotals(t *testing.T) {
+	forEachStore(t, func(t *testing.T, store db.Store) {
+		ctx := context.Background()
+		guildID := newGuildID()
+		user := newUser(t, store, "member")
+		for _, name := range []string{"Write docs", "Review docs", "Docs site", "Fix login"} {
+			newTask(t, store, guildID, user, name, false)
+		}
+
+		results, total, err := store.SearchTasks(ctx, models.TaskSearchFilter{ServerID: guildID, Query: "docs", Limit: 2})
+		if err != nil {
+			t.Fatalf("searching: %v", err)
+		}
+		if len(results) != 2 || total != 3 {
+			t.Fatalf("first page has %d results of %d, want 2 of 3", len(results), total)
+		}
+
+		results, total, err = store.SearchTasks(ctx, models.TaskSearchFilter{ServerID: guildID, Query: "docs", Limit: 2, Offset: 4})
+		if err != nil {
+			t.Fatalf("searching past the end: %v", err)
+		}
+		if len(results) != 0 || total != 3 {
+			t.Fatalf("page past the end has %d results of %d, want 0 of 3", len(results), total)
+		}
+
+		results, total, err = store.SearchTasks(ctx, models.TaskSearchFilter{ServerID: guildID, Query: "nothing", Limit: 2})
+		if err != nil {
+			t.Fatalf("searching without matches: %v", err)
+		}
+		if len(results) != 0 || total != 0 {
+			t.Fatalf("search without matches has %d results of %d", len(results), total)
+		}
+	})
+}
+
+func TestSearchTaskVisibility(t *testing.T) {
+	forEachStore(t, func(t *testing.T, store db.Store) {
+		ctx := context.Background()
+		guildID := newGuildID()
+		alice := newUser(t, store, "alice")
+		bob := newUser(t, store, "bob")
+
+		own := newTask(t, store, guildID, alice, "Alice docs", false)
+		hidden := newTask(t, store, guildID, bob, "Bob docs", false)
+		shared := newTask(t, store, guildID, bob, "Shared docs", true)
+		declare(t, store, alice, own, time.Hour)
+		declare(t, store, bob, hidden, time.Hour)
+		declare(t, store, alice, shared, time.Hour)
+		declare(t, store, bob, shared, 2*time.Hour)
+
+		search := func(visible []uuid.UUID) (map[uuid.UUID]time.Duration, int) {
+			results, total, err := store.SearchTasks(ctx, models.TaskSearchFilter{
+				ServerID:       guildID,
+				Query:          "docs",
+				Limit:          10,
+				VisibleUserIDs: visible,
+			})
+			if err != nil {
+				t.Fatalf("searching: %v", err)
+			}
+			spent := make(map[uuid.UUID]time.Duration, len(results))
+			for _, result := range results {
+				spent[result.Task.ID] = result.TimeSpent
+			}
+			return spent, total
+		}
+
+		spent, total := search(nil)
+		if total != 3 || spent[shared.ID] != 3*time.Hour {
+			t.Fatalf("unrestricted search: total %d, shared time %s", total, spent[shared.ID])
+		}
+
+		spent, total = search([]uuid.UUID{alice.ID})
+		if total != 2 || len(spent) != 2 {
+			t.Fatalf("restricted search: total %d, %d results, want 2", total, len(spent))
+		}
+		if _, ok := spent[hidden.ID]; ok {
+			t.Fatal("restricted search returned another user's task")
+		}
+		if spent[own.ID] != time.Hour || spent[shared.ID] != time.Hour {
+			t.Fatalf("restricted search times: own %s, shared %s, want 1h each", spent[own.ID], spent[shared.ID])
+		}
+	})
+}
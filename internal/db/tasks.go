@@ -0,0 +1,282 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"taskbot/internal/db/models"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+)
+
+var (
+	// ErrTaskNotFound is returned when a task does not exist
+	ErrTaskNotFound = errors.New("task not found")
+
+	// ErrTaskHasCheckIns is returned when deleting a task that still has check-ins
+	// and no task to reassign them to was given
+	ErrTaskHasCheckIns = errors.New("task has check-ins")
+
+	// ErrTaskArchived is returned when check-ins would be moved onto an archived task
+	ErrTaskArchived = errors.New("task is archived")
+)
+
+// ArchiveTask hides a task from autocomplete while keeping its history
+func (db *DB) ArchiveTask(ctx context.Context, taskID uuid.UUID, actorID uuid.UUID) error {
+	query := `
+		UPDATE tasks
+		SET archived_at = $1
+		WHERE id = $2 AND archived_at IS NULL
+		RETURNING user_id, server_id`
+
+	return db.withTx(ctx, func(tx pgx.Tx) error {
+		var ownerID uuid.UUID
+		var serverID string
+		err := tx.QueryRow(ctx, query, time.Now(), taskID.String()).Scan(&ownerID, &serverID)
+		if err == pgx.ErrNoRows {
+			return ErrTaskNotFound
+		}
+		if err != nil {
+			return fmt.Errorf("error archiving task: %w", err)
+		}
+
+		return recordAudit(ctx, tx, &models.AuditEvent{
+			ServerID:     serverID,
+			ActorID:      &actorID,
+			TargetUserID: &ownerID,
+			TaskID:       &taskID,
+			Action:       models.AuditTaskArchived,
+		})
+	})
+}
+
+// ArchiveCompletedTasks archives every completed task in a server with no activity
+// since the cutoff and returns how many tasks were archived
+func (db *DB) ArchiveCompletedTasks(ctx context.Context, serverID string, cutoff time.Time, actorID uuid.UUID) (int, error) {
+	query := `
+		UPDATE tasks t
+		SET archived_at = $1
+		WHERE t.server_id = $2
+		AND t.completed = true
+		AND t.archived_at IS NULL
+		AND t.created_at < $3
+		AND NOT EXISTS (
+			SELECT 1 FROM check_ins c
+			WHERE c.task_id = t.id AND (c.end_time IS NULL OR c.end_time >= $3)
+		)
+		RETURNING t.id, t.user_id`
+
+	archived := 0
+	err := db.withTx(ctx, func(tx pgx.Tx) error {
+		rows, err := tx.Query(ctx, query, time.Now(), serverID, cutoff)
+		if err != nil {
+			return fmt.Errorf("error archiving tasks: %w", err)
+		}
+
+		type archivedTask struct {
+			taskID  uuid.UUID
+			ownerID uuid.UUID
+		}
+		var tasks []archivedTask
+		for rows.Next() {
+			var t archivedTask
+			if err := rows.Scan(&t.taskID, &t.ownerID); err != nil {
+				rows.Close()
+				return fmt.Errorf("error scanning archived task: %w", err)
+			}
+			tasks = append(tasks, t)
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return err
+		}
+
+		for _, t := range tasks {
+			err := recordAudit(ctx, tx, &models.AuditEvent{
+				ServerID:     serverID,
+				ActorID:      &actorID,
+				TargetUserID: &t.ownerID,
+				TaskID:       &t.taskID,
+				Action:       models.AuditTaskArchived,
+				Details: map[string]string{
+					"bulk":   "true",
+					"cutoff": cutoff.UTC().Format(time.RFC3339),
+				},
+			})
+			if err != nil {
+				return err
+			}
+		}
+		archived = len(tasks)
+		return nil
+	})
+	return archived, err
+}
+
+// DeleteTask permanently removes a task. If the task has check-ins they are moved
+// to reassignTo, or ErrTaskHasCheckIns is returned when reassignTo is nil.
+// It returns the number of check-ins that were reassigned.
+func (db *DB) DeleteTask(ctx context.Context, taskID uuid.UUID, reassignTo *uuid.UUID, actorID uuid.UUID) (int64, error) {
+	var moved int64
+	err := db.withTx(ctx, func(tx pgx.Tx) error {
+		var ownerID uuid.UUID
+		var serverID, name string
+		err := tx.QueryRow(ctx, `
+			SELECT user_id, server_id, name
+			FROM tasks
+			WHERE id = $1
+			FOR UPDATE`, taskID.String()).Scan(&ownerID, &serverID, &name)
+		if err == pgx.ErrNoRows {
+			return ErrTaskNotFound
+		}
+		if err != nil {
+			return fmt.Errorf("error getting task: %w", err)
+		}
+
+		var checkIns int64
+		err = tx.QueryRow(ctx, `SELECT COUNT(*) FROM check_ins WHERE task_id = $1`, taskID.String()).Scan(&checkIns)
+		if err != nil {
+			return fmt.Errorf("error counting check-ins: %w", err)
+		}
+
+		details := map[string]string{"name": name}
+		if checkIns > 0 {
+			if reassignTo == nil {
+				return ErrTaskHasCheckIns
+			}
+
+			var targetServerID string
+			err := tx.QueryRow(ctx, `SELECT server_id FROM tasks WHERE id = $1 FOR UPDATE`, reassignTo.String()).Scan(&targetServerID)
+			if err == pgx.ErrNoRows {
+				return fmt.Errorf("reassignment target: %w", ErrTaskNotFound)
+			}
+			if err != nil {
+				return fmt.Errorf("error getting reassignment target: %w", err)
+			}
+			if targetServerID != serverID {
+				return fmt.Errorf("reassignment target belongs to another server")
+			}
+
+			result, err := tx.Exec(ctx, `UPDATE check_ins SET task_id = $1 WHERE task_id = $2`, reassignTo.String(), taskID.String())
+			if err != nil {
+				return fmt.Errorf("error reassigning check-ins: %w", err)
+			}
+			moved = result.RowsAffected()
+			details["reassigned_to"] = reassignTo.String()
+			details["check_ins_moved"] = fmt.Sprintf("%d", moved)
+		}
+
+		// Subtasks of a deleted task become top-level tasks
+		if _, err := tx.Exec(ctx, `UPDATE tasks SET parent_id = NULL WHERE parent_id = $1`, taskID.String()); err != nil {
+			return fmt.Errorf("error detaching subtasks: %w", err)
+		}
+
+		if _, err := tx.Exec(ctx, `DELETE FROM tasks WHERE id = $1`, taskID.String()); err != nil {
+			return fmt.Errorf("error deleting task: %w", err)
+		}
+
+		return recordAudit(ctx, tx, &models.AuditEvent{
+			ServerID:     serverID,
+			ActorID:      &actorID,
+			TargetUserID: &ownerID,
+			TaskID:       &taskID,
+			Action:       models.AuditTaskDeleted,
+			Details:      details,
+		})
+	})
+	return moved, err
+}
+
+// MergeTasks moves all check-ins from source to target, adds the source's tags to
+// the target and deletes the source. It returns the number of check-ins moved, or
+// ErrTaskArchived when the target is archived.
+func (db *DB) MergeTasks(ctx context.Context, sourceID, targetID uuid.UUID, actorID uuid.UUID) (int64, error) {
+	if sourceID == targetID {
+		return 0, fmt.Errorf("cannot merge a task into itself")
+	}
+
+	var moved int64
+	err := db.withTx(ctx, func(tx pgx.Tx) error {
+		var sourceOwnerID uuid.UUID
+		var sourceServerID, sourceName string
+		err := tx.QueryRow(ctx, `
+			SELECT user_id, server_id, name
+			FROM tasks
+			WHERE id = $1
+			FOR UPDATE`, sourceID.String()).Scan(&sourceOwnerID, &sourceServerID, &sourceName)
+		if err == pgx.ErrNoRows {
+			return fmt.Errorf("merge source: %w", ErrTaskNotFound)
+		}
+		if err != nil {
+			return fmt.Errorf("error getting merge source: %w", err)
+		}
+
+		var targetServerID string
+		var targetArchivedAt *time.Time
+		err = tx.QueryRow(ctx, `SELECT server_id, archived_at FROM tasks WHERE id = $1 FOR UPDATE`, targetID.String()).Scan(&targetServerID, &targetArchivedAt)
+		if err == pgx.ErrNoRows {
+			return fmt.Errorf("merge target: %w", ErrTaskNotFound)
+		}
+		if err != nil {
+			return fmt.Errorf("error getting merge target: %w", err)
+		}
+		if targetArchivedAt != nil {
+			return fmt.Errorf("merge target: %w", ErrTaskArchived)
+		}
+		if targetServerID != sourceServerID {
+			return fmt.Errorf("cannot merge tasks from different servers")
+		}
+
+		result, err := tx.Exec(ctx, `UPDATE check_ins SET task_id = $1 WHERE task_id = $2`, targetID.String(), sourceID.String())
+		if err != nil {
+			return fmt.Errorf("error moving check-ins: %w", err)
+		}
+		moved = result.RowsAffected()
+
+		_, err = tx.Exec(ctx, `
+			UPDATE tasks
+			SET tags = ARRAY(
+				SELECT DISTINCT tag
+				FROM unnest(COALESCE(tasks.tags, '{}') || COALESCE((SELECT tags FROM tasks WHERE id = $2), '{}')) AS tag
+			)
+			WHERE id = $1`, targetID.String(), sourceID.String())
+		if err != nil {
+			return fmt.Errorf("error merging tags: %w", err)
+		}
+
+		// Subtasks of the source move under the target, or under the target's parent
+		// when the target is itself a subtask, keeping the hierarchy one level deep
+		_, err = tx.Exec(ctx, `UPDATE tasks SET parent_id = NULL WHERE id = $1 AND parent_id = $2`, targetID.String(), sourceID.String())
+		if err != nil {
+			return fmt.Errorf("error detaching merge target: %w", err)
+		}
+		_, err = tx.Exec(ctx, `
+			UPDATE tasks
+			SET parent_id = (SELECT COALESCE(parent_id, id) FROM tasks WHERE id = $1)
+			WHERE parent_id = $2`, targetID.String(), sourceID.String())
+		if err != nil {
+			return fmt.Errorf("error moving subtasks: %w", err)
+		}
+
+		if _, err := tx.Exec(ctx, `DELETE FROM tasks WHERE id = $1`, sourceID.String()); err != nil {
+			return fmt.Errorf("error deleting merge source: %w", err)
+		}
+
+		return recordAudit(ctx, tx, &models.AuditEvent{
+			ServerID:     sourceServerID,
+			ActorID:      &actorID,
+			TargetUserID: &sourceOwnerID,
+			TaskID:       &targetID,
+			Action:       models.AuditTaskMerged,
+			Details: map[string]string{
+				"source_id":       sourceID.String(),
+				"source_name":     sourceName,
+				"check_ins_moved": fmt.Sprintf("%d", moved),
+			},
+		})
+	})
+	return moved, err
+}
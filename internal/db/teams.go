@@ -0,0 +1,224 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"taskbot/internal/db/models"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+// teamNameIndex enforces unique team names per server, ignoring case
+const teamNameIndex = "idx_teams_server_name"
+
+var (
+	// ErrTeamNotFound is returned when a team does not exist in the server
+	ErrTeamNotFound = errors.New("team not found")
+	// ErrTeamExists is returned when creating a team with a name already in use
+	ErrTeamExists = errors.New("a team with that name already exists")
+	// ErrAlreadyTeamMember is returned when adding a user who is already in the team
+	ErrAlreadyTeamMember = errors.New("user is already a member of the team")
+	// ErrNotTeamMember is returned when removing a user who is not in the team
+	ErrNotTeamMember = errors.New("user is not a member of the team")
+)
+
+// CreateTeam creates a new team
+func (db *DB) CreateTeam(ctx context.Context, team *models.Team) error {
+	if team.CreatedAt.IsZero() {
+		team.CreatedAt = time.Now()
+	}
+
+	query := `
+		INSERT INTO teams (id, server_id, name, discord_role_id, created_by, created_at)
+		VALUES ($1, $2, $3, NULLIF($4, ''), $5, $6)`
+
+	return db.withTx(ctx, func(tx pgx.Tx) error {
+		_, err := tx.Exec(ctx, query,
+			team.ID.String(),
+			team.ServerID,
+			team.Name,
+			team.DiscordRoleID,
+			team.CreatedBy.String(),
+			team.CreatedAt,
+		)
+		var pgErr *pgconn.PgError
+		if errors.As(err, &pgErr) && pgErr.Code == "23505" && pgErr.ConstraintName == teamNameIndex {
+			return ErrTeamExists
+		}
+		if err != nil {
+			return fmt.Errorf("error creating team: %w", err)
+		}
+
+		details := map[string]string{
+			"team_id": team.ID.String(),
+			"name":    team.Name,
+		}
+		if team.DiscordRoleID != "" {
+			details["discord_role_id"] = team.DiscordRoleID
+		}
+		return recordAudit(ctx, tx, &models.AuditEvent{
+			ServerID: team.ServerID,
+			ActorID:  &team.CreatedBy,
+			Action:   models.AuditTeamCreated,
+			Details:  details,
+		})
+	})
+}
+
+// GetTeams returns the teams of a server with their bot-managed members
+func (db *DB) GetTeams(ctx context.Context, serverID string) ([]*models.Team, error) {
+	query := `
+		SELECT t.id, t.server_id, t.name, COALESCE(t.discord_role_id, ''), t.created_by, t.created_at,
+			COALESCE(array_agg(m.user_id::text) FILTER (WHERE m.user_id IS NOT NULL), '{}')
+		FROM teams t
+		LEFT JOIN team_members m ON m.team_id = t.id
+		WHERE t.server_id = $1
+		GROUP BY t.id
+		ORDER BY LOWER(t.name) ASC`
+
+	rows, err := db.Query(ctx, query, serverID)
+	if err != nil {
+		return nil, fmt.Errorf("error getting teams: %w", err)
+	}
+	defer rows.Close()
+
+	var teams []*models.Team
+	for rows.Next() {
+		team := &models.Team{}
+		var memberIDs []string
+		err := rows.Scan(
+			&team.ID,
+			&team.ServerID,
+			&team.Name,
+			&team.DiscordRoleID,
+			&team.CreatedBy,
+			&team.CreatedAt,
+			&memberIDs,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("error scanning team: %w", err)
+		}
+		for _, id := range memberIDs {
+			memberID, err := uuid.Parse(id)
+			if err != nil {
+				return nil, fmt.Errorf("error parsing team member ID: %w", err)
+			}
+			team.MemberIDs = append(team.MemberIDs, memberID)
+		}
+		teams = append(teams, team)
+	}
+	return teams, rows.Err()
+}
+
+// DeleteTeam removes a team from a server along with its member list
+func (db *DB) DeleteTeam(ctx context.Context, teamID uuid.UUID, serverID string, actorID uuid.UUID) error {
+	query := `
+		DELETE FROM teams
+		WHERE id = $1 AND server_id = $2
+		RETURNING name`
+
+	return db.withTx(ctx, func(tx pgx.Tx) error {
+		var name string
+		err := tx.QueryRow(ctx, query, teamID.String(), serverID).Scan(&name)
+		if err == pgx.ErrNoRows {
+			return ErrTeamNotFound
+		}
+		if err != nil {
+			return fmt.Errorf("error deleting team: %w", err)
+		}
+
+		return recordAudit(ctx, tx, &models.AuditEvent{
+			ServerID: serverID,
+			ActorID:  &actorID,
+			Action:   models.AuditTeamDeleted,
+			Details: map[string]string{
+				"team_id": teamID.String(),
+				"name":    name,
+			},
+		})
+	})
+}
+
+// AddTeamMember adds a user to a bot-managed team
+func (db *DB) AddTeamMember(ctx context.Context, teamID uuid.UUID, serverID string, userID, actorID uuid.UUID) error {
+	return db.withTx(ctx, func(tx pgx.Tx) error {
+		name, err := lockTeam(ctx, tx, teamID, serverID)
+		if err != nil {
+			return err
+		}
+
+		tag, err := tx.Exec(ctx, `
+			INSERT INTO team_members (team_id, user_id, added_at)
+			VALUES ($1, $2, $3)
+			ON CONFLICT DO NOTHING`, teamID.String(), userID.String(), time.Now())
+		if err != nil {
+			return fmt.Errorf("error adding team member: %w", err)
+		}
+		if tag.RowsAffected() == 0 {
+			return ErrAlreadyTeamMember
+		}
+
+		return recordAudit(ctx, tx, &models.AuditEvent{
+			ServerID:     serverID,
+			ActorID:      &actorID,
+			TargetUserID: &userID,
+			Action:       models.AuditTeamJoined,
+			Details: map[string]string{
+				"team_id": teamID.String(),
+				"name":    name,
+			},
+		})
+	})
+}
+
+// RemoveTeamMember removes a user from a bot-managed team
+func (db *DB) RemoveTeamMember(ctx context.Context, teamID uuid.UUID, serverID string, userID, actorID uuid.UUID) error {
+	return db.withTx(ctx, func(tx pgx.Tx) error {
+		name, err := lockTeam(ctx, tx, teamID, serverID)
+		if err != nil {
+			return err
+		}
+
+		tag, err := tx.Exec(ctx, `
+			DELETE FROM team_members
+			WHERE team_id = $1 AND user_id = $2`, teamID.String(), userID.String())
+		if err != nil {
+			return fmt.Errorf("error removing team member: %w", err)
+		}
+		if tag.RowsAffected() == 0 {
+			return ErrNotTeamMember
+		}
+
+		return recordAudit(ctx, tx, &models.AuditEvent{
+			ServerID:     serverID,
+			ActorID:      &actorID,
+			TargetUserID: &userID,
+			Action:       models.AuditTeamLeft,
+			Details: map[string]string{
+				"team_id": teamID.String(),
+				"name":    name,
+			},
+		})
+	})
+}
+
+// lockTeam locks a team of the server for the rest of the transaction and returns its name
+func lockTeam(ctx context.Context, tx pgx.Tx, teamID uuid.UUID, serverID string) (string, error) {
+	var name string
+	err := tx.QueryRow(ctx, `
+		SELECT name FROM teams
+		WHERE id = $1 AND server_id = $2
+		FOR UPDATE`, teamID.String(), serverID).Scan(&name)
+	if err == pgx.ErrNoRows {
+		return "", ErrTeamNotFound
+	}
+	if err != nil {
+		return "", fmt.Errorf("error getting team: %w", err)
+	}
+	return name, nil
+}
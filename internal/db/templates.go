@@ -0,0 +1,235 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"taskbot/internal/db/models"
+	"taskbot/internal/events"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+)
+
+const templateColumns = `id, server_id, name, description, schedule, timezone, created_by, last_task_id, next_run_at, created_at`
+
+func scanTaskTemplate(row pgx.Row) (*models.TaskTemplate, error) {
+	tmpl := &models.TaskTemplate{}
+	err := row.Scan(
+		&tmpl.ID,
+		&tmpl.ServerID,
+		&tmpl.Name,
+		&tmpl.Description,
+		&tmpl.Schedule,
+		&tmpl.Timezone,
+		&tmpl.CreatedBy,
+		&tmpl.LastTaskID,
+		&tmpl.NextRunAt,
+		&tmpl.CreatedAt,
+	)
+	return tmpl, err
+}
+
+// CreateTaskTemplate creates a new recurring task template
+func (db *DB) CreateTaskTemplate(ctx context.Context, tmpl *models.TaskTemplate) error {
+	query := `
+		INSERT INTO task_templates (id, server_id, name, description, schedule, timezone, created_by, next_run_at, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)`
+
+	return db.withTx(ctx, func(tx pgx.Tx) error {
+		_, err := tx.Exec(ctx, query,
+			tmpl.ID.String(),
+			tmpl.ServerID,
+			tmpl.Name,
+			tmpl.Description,
+			tmpl.Schedule,
+			tmpl.Timezone,
+			tmpl.CreatedBy.String(),
+			tmpl.NextRunAt,
+			tmpl.CreatedAt,
+		)
+		if err != nil {
+			return fmt.Errorf("error creating task template: %w", err)
+		}
+
+		return recordAudit(ctx, tx, &models.AuditEvent{
+			ServerID: tmpl.ServerID,
+			ActorID:  &tmpl.CreatedBy,
+			Action:   models.AuditTemplateCreated,
+			Details: map[string]string{
+				"template_id": tmpl.ID.String(),
+				"name":        tmpl.Name,
+				"schedule":    tmpl.Schedule,
+			},
+		})
+	})
+}
+
+// GetTaskTemplates returns all task templates for a server
+func (db *DB) GetTaskTemplates(ctx context.Context, serverID string) ([]*models.TaskTemplate, error) {
+	query := `SELECT ` + templateColumns + `
+		FROM task_templates
+		WHERE server_id = $1
+		ORDER BY name ASC`
+
+	rows, err := db.Query(ctx, query, serverID)
+	if err != nil {
+		return nil, fmt.Errorf("error getting task templates: %w", err)
+	}
+	defer rows.Close()
+
+	var templates []*models.TaskTemplate
+	for rows.Next() {
+		tmpl, err := scanTaskTemplate(rows)
+		if err != nil {
+			return nil, fmt.Errorf("error scanning task template: %w", err)
+		}
+		templates = append(templates, tmpl)
+	}
+	return templates, rows.Err()
+}
+
+// GetDueTaskTemplates returns templates across all servers whose next run is due
+func (db *DB) GetDueTaskTemplates(ctx context.Context, now time.Time) ([]*models.TaskTemplate, error) {
+	query := `SELECT ` + templateColumns + `
+		FROM task_templates
+		WHERE next_run_at <= $1
+		ORDER BY next_run_at ASC`
+
+	rows, err := db.Query(ctx, query, now)
+	if err != nil {
+		return nil, fmt.Errorf("error getting due task templates: %w", err)
+	}
+	defer rows.Close()
+
+	var templates []*models.TaskTemplate
+	for rows.Next() {
+		tmpl, err := scanTaskTemplate(rows)
+		if err != nil {
+			return nil, fmt.Errorf("error scanning task template: %w", err)
+		}
+		templates = append(templates, tmpl)
+	}
+	return templates, rows.Err()
+}
+
+// DeleteTaskTemplate removes a template from a server. Tasks it already created are kept.
+func (db *DB) DeleteTaskTemplate(ctx context.Context, templateID uuid.UUID, serverID string, actorID uuid.UUID) error {
+	query := `
+		DELETE FROM task_templates
+		WHERE id = $1 AND server_id = $2
+		RETURNING name`
+
+	return db.withTx(ctx, func(tx pgx.Tx) error {
+		var name string
+		err := tx.QueryRow(ctx, query, templateID.String(), serverID).Scan(&name)
+		if err == pgx.ErrNoRows {
+			return fmt.Errorf("template not found")
+		}
+		if err != nil {
+			return fmt.Errorf("error deleting task template: %w", err)
+		}
+
+		return recordAudit(ctx, tx, &models.AuditEvent{
+			ServerID: serverID,
+			ActorID:  &actorID,
+			Action:   models.AuditTemplateDeleted,
+			Details: map[string]string{
+				"template_id": templateID.String(),
+				"name":        name,
+			},
+		})
+	})
+}
+
+// RunTaskTemplate materializes a due template: it completes the task created by the
+// previous run, creates the given task and schedules the next run. It reports false
+// if the template was no longer due, e.g. because another instance already ran it.
+func (db *DB) RunTaskTemplate(ctx context.Context, templateID uuid.UUID, task *models.Task, nextRunAt time.Time) (bool, error) {
+	ran := false
+	err := db.withTx(ctx, func(tx pgx.Tx) error {
+		tmpl, err := scanTaskTemplate(tx.QueryRow(ctx, `SELECT `+templateColumns+`
+			FROM task_templates
+			WHERE id = $1 AND next_run_at <= $2
+			FOR UPDATE SKIP LOCKED`, templateID.String(), time.Now()))
+		if err == pgx.ErrNoRows {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("error locking task template: %w", err)
+		}
+
+		if tmpl.LastTaskID != nil {
+			var ownerID uuid.UUID
+			err := tx.QueryRow(ctx, `
+				UPDATE tasks
+				SET completed = true
+				WHERE id = $1 AND completed = false
+				RETURNING user_id`, tmpl.LastTaskID.String()).Scan(&ownerID)
+			if err != nil && err != pgx.ErrNoRows {
+				return fmt.Errorf("error completing previous task: %w", err)
+			}
+			if err == nil {
+				err = recordAudit(ctx, tx, &models.AuditEvent{
+					ServerID:     tmpl.ServerID,
+					TargetUserID: &ownerID,
+					TaskID:       tmpl.LastTaskID,
+					Action:       models.AuditTaskCompleted,
+					Details:      map[string]string{"template_id": tmpl.ID.String()},
+				})
+				if err != nil {
+					return err
+				}
+				err = recordTaskEvent(ctx, tx, events.TaskCompleted, tmpl.ServerID, *tmpl.LastTaskID, nil)
+				if err != nil {
+					return err
+				}
+			}
+		}
+
+		_, err = tx.Exec(ctx, `
+			INSERT INTO tasks (id, user_id, server_id, name, description, completed, global, created_at)
+			VALUES ($1, $2, $3, $4, $5, false, true, $6)`,
+			task.ID.String(),
+			task.UserID.String(),
+			task.ServerID,
+			task.Name,
+			task.Description,
+			task.CreatedAt,
+		)
+		if err != nil {
+			return fmt.Errorf("error creating task from template: %w", err)
+		}
+
+		err = recordAudit(ctx, tx, &models.AuditEvent{
+			ServerID:     task.ServerID,
+			TargetUserID: &task.UserID,
+			TaskID:       &task.ID,
+			Action:       models.AuditTaskCreated,
+			Details: map[string]string{
+				"name":        task.Name,
+				"global":      "true",
+				"template_id": tmpl.ID.String(),
+			},
+		})
+		if err != nil {
+			return err
+		}
+		if err := recordTaskEvent(ctx, tx, events.TaskCreated, task.ServerID, task.ID, nil); err != nil {
+			return err
+		}
+
+		_, err = tx.Exec(ctx, `
+			UPDATE task_templates
+			SET last_task_id = $1, next_run_at = $2
+			WHERE id = $3`, task.ID.String(), nextRunAt, tmpl.ID.String())
+		if err != nil {
+			return fmt.Errorf("error scheduling next template run: %w", err)
+		}
+
+		ran = true
+		return nil
+	})
+	return ran, err
+}
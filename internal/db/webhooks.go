@@ -0,0 +1,250 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"taskbot/internal/db/models"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+// ErrWebhookNotFound is returned when deleting a webhook that does not exist in the server
+var ErrWebhookNotFound = errors.New("webhook not found")
+
+// CreateWebhook stores a new webhook for a server
+func (db *DB) CreateWebhook(ctx context.Context, webhook *models.Webhook) error {
+	if webhook.CreatedAt.IsZero() {
+		webhook.CreatedAt = time.Now()
+	}
+	if webhook.Events == nil {
+		webhook.Events = []string{}
+	}
+
+	query := `
+		INSERT INTO webhooks (id, server_id, url, secret, events, created_by, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)`
+
+	return db.withTx(ctx, func(tx pgx.Tx) error {
+		_, err := tx.Exec(ctx, query,
+			webhook.ID.String(),
+			webhook.ServerID,
+			webhook.URL,
+			webhook.Secret,
+			webhook.Events,
+			webhook.CreatedBy.String(),
+			webhook.CreatedAt,
+		)
+		if err != nil {
+			return fmt.Errorf("error creating webhook: %w", err)
+		}
+
+		return recordAudit(ctx, tx, &models.AuditEvent{
+			ServerID: webhook.ServerID,
+			ActorID:  &webhook.CreatedBy,
+			Action:   models.AuditWebhookCreated,
+			Details: map[string]string{
+				"webhook_id": webhook.ID.String(),
+				"host":       models.WebhookHost(webhook.URL),
+				"events":     strings.Join(webhook.Events, ","),
+			},
+		})
+	})
+}
+
+// GetWebhooks returns a server's webhooks, oldest first, with the number of
+// deliveries each has waiting in the outbox
+func (db *DB) GetWebhooks(ctx context.Context, serverID string) ([]*models.Webhook, error) {
+	query := `
+		SELECT w.id, w.server_id, w.url, w.secret, w.events, w.created_by, w.created_at,
+			w.last_delivery_at, w.last_error,
+			(SELECT COUNT(*) FROM webhook_deliveries d WHERE d.webhook_id = w.id)
+		FROM webhooks w
+		WHERE w.server_id = $1
+		ORDER BY w.created_at`
+
+	rows, err := db.Query(ctx, query, serverID)
+	if err != nil {
+		return nil, fmt.Errorf("error getting webhooks: %w", err)
+	}
+	defer rows.Close()
+
+	var webhooks []*models.Webhook
+	for rows.Next() {
+		webhook := &models.Webhook{}
+		err := rows.Scan(
+			&webhook.ID,
+			&webhook.ServerID,
+			&webhook.URL,
+			&webhook.Secret,
+			&webhook.Events,
+			&webhook.CreatedBy,
+			&webhook.CreatedAt,
+			&webhook.LastDeliveryAt,
+			&webhook.LastError,
+			&webhook.Pending,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("error scanning webhook: %w", err)
+		}
+		webhooks = append(webhooks, webhook)
+	}
+	return webhooks, rows.Err()
+}
+
+// DeleteWebhook deletes a webhook of a server along with its pending deliveries
+func (db *DB) DeleteWebhook(ctx context.Context, webhookID uuid.UUID, serverID string, actorID uuid.UUID) error {
+	query := `
+		DELETE FROM webhooks
+		WHERE id = $1 AND server_id = $2
+		RETURNING url`
+
+	return db.withTx(ctx, func(tx pgx.Tx) error {
+		var rawURL string
+		err := tx.QueryRow(ctx, query, webhookID.String(), serverID).Scan(&rawURL)
+		if err == pgx.ErrNoRows {
+			return ErrWebhookNotFound
+		}
+		if err != nil {
+			return fmt.Errorf("error deleting webhook: %w", err)
+		}
+
+		return recordAudit(ctx, tx, &models.AuditEvent{
+			ServerID: serverID,
+			ActorID:  &actorID,
+			Action:   models.AuditWebhookDeleted,
+			Details: map[string]string{
+				"webhook_id": webhookID.String(),
+				"host":       models.WebhookHost(rawURL),
+			},
+		})
+	})
+}
+
+// EnqueueWebhookEvent adds an event to the outbox of every webhook in the server
+// subscribed to its type, or only of webhookID when set, whatever its
+// subscriptions. It returns the number of deliveries queued.
+func (db *DB) EnqueueWebhookEvent(ctx context.Context, serverID string, webhookID *uuid.UUID, eventType string, payload []byte, at time.Time) (int, error) {
+	return enqueueWebhookEvent(ctx, db.Pool, serverID, webhookID, eventType, payload, at)
+}
+
+// execer runs statements on the pool or inside a transaction
+type execer interface {
+	Exec(ctx context.Context, sql string, arguments ...any) (pgconn.CommandTag, error)
+}
+
+func enqueueWebhookEvent(ctx context.Context, q execer, serverID string, webhookID *uuid.UUID, eventType string, payload []byte, at time.Time) (int, error) {
+	query := `
+		INSERT INTO webhook_deliveries (id, webhook_id, event_type, payload, next_attempt_at, created_at)
+		SELECT gen_random_uuid(), w.id, $3, $4::jsonb, $5, $5
+		FROM webhooks w
+		WHERE w.server_id = $1 AND (
+			($2::uuid IS NULL AND (cardinality(w.events) = 0 OR $3 = ANY(w.events)))
+			OR w.id = $2::uuid
+		)`
+
+	var webhookParam *string
+	if webhookID != nil {
+		id := webhookID.String()
+		webhookParam = &id
+	}
+	tag, err := q.Exec(ctx, query, serverID, webhookParam, eventType, string(payload), at)
+	if err != nil {
+		return 0, fmt.Errorf("error queueing webhook event: %w", err)
+	}
+	return int(tag.RowsAffected()), nil
+}
+
+// ClaimDueWebhookDeliveries returns up to limit deliveries whose next attempt is
+// due and leases them until now+lease, so that other instances of the bot skip
+// them while they are being sent. A delivery that is neither completed nor
+// retried before the lease runs out is due again.
+func (db *DB) ClaimDueWebhookDeliveries(ctx context.Context, now time.Time, lease time.Duration, limit int) ([]*models.WebhookDelivery, error) {
+	query := `
+		UPDATE webhook_deliveries d
+		SET next_attempt_at = $2
+		FROM webhooks w
+		WHERE w.id = d.webhook_id AND d.id IN (
+			SELECT id FROM webhook_deliveries
+			WHERE next_attempt_at <= $1
+			ORDER BY next_attempt_at, created_at
+			LIMIT $3
+			FOR UPDATE SKIP LOCKED
+		)
+		RETURNING d.id, d.webhook_id, w.server_id, w.url, w.secret, d.event_type, d.payload,
+			d.attempts, d.next_attempt_at, d.last_error, d.created_at`
+
+	rows, err := db.Query(ctx, query, now, now.Add(lease), limit)
+	if err != nil {
+		return nil, fmt.Errorf("error claiming due webhook deliveries: %w", err)
+	}
+	defer rows.Close()
+
+	var deliveries []*models.WebhookDelivery
+	for rows.Next() {
+		delivery := &models.WebhookDelivery{}
+		err := rows.Scan(
+			&delivery.ID,
+			&delivery.WebhookID,
+			&delivery.ServerID,
+			&delivery.URL,
+			&delivery.Secret,
+			&delivery.EventType,
+			&delivery.Payload,
+			&delivery.Attempts,
+			&delivery.NextAttemptAt,
+			&delivery.LastError,
+			&delivery.CreatedAt,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("error scanning webhook delivery: %w", err)
+		}
+		deliveries = append(deliveries, delivery)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error claiming due webhook deliveries: %w", err)
+	}
+
+	sort.Slice(deliveries, func(a, b int) bool {
+		return deliveries[a].CreatedAt.Before(deliveries[b].CreatedAt)
+	})
+	return deliveries, nil
+}
+
+// CompleteWebhookDelivery removes a delivery from the outbox once it succeeded
+// or was given up on, recording the outcome on its webhook. deliveryErr is empty
+// on success.
+func (db *DB) CompleteWebhookDelivery(ctx context.Context, delivery *models.WebhookDelivery, at time.Time, deliveryErr string) error {
+	return db.withTx(ctx, func(tx pgx.Tx) error {
+		if _, err := tx.Exec(ctx, `DELETE FROM webhook_deliveries WHERE id = $1`, delivery.ID.String()); err != nil {
+			return fmt.Errorf("error removing webhook delivery: %w", err)
+		}
+		_, err := tx.Exec(ctx, `
+			UPDATE webhooks SET last_delivery_at = $2, last_error = $3
+			WHERE id = $1`,
+			delivery.WebhookID.String(), at, deliveryErr)
+		if err != nil {
+			return fmt.Errorf("error updating webhook: %w", err)
+		}
+		return nil
+	})
+}
+
+// RetryWebhookDelivery records a failed attempt and schedules the next one
+func (db *DB) RetryWebhookDelivery(ctx context.Context, deliveryID uuid.UUID, nextAttemptAt time.Time, deliveryErr string) error {
+	query := `
+		UPDATE webhook_deliveries
+		SET attempts = attempts + 1, next_attempt_at = $2, last_error = $3
+		WHERE id = $1`
+
+	if _, err := db.Exec(ctx, query, deliveryID.String(), nextAttemptAt, deliveryErr); err != nil {
+		return fmt.Errorf("error rescheduling webhook delivery: %w", err)
+	}
+	return nil
+}
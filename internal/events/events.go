@@ -0,0 +1,151 @@
+// Package events describes the things that happen in the bot, such as check-ins
+// and completed tasks, as they are sent to webhooks, and provides an in-process
+// bus that signals when the store recorded new ones for a guild.
+package events
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"taskbot/internal/db/models"
+
+	"github.com/google/uuid"
+)
+
+// Type identifies what happened
+type Type string
+
+const (
+	CheckInStarted Type = "checkin.started"
+	CheckInEnded   Type = "checkin.ended"
+	TimeDeclared   Type = "time.declared"
+	TaskCreated    Type = "task.created"
+	TaskCompleted  Type = "task.completed"
+	TaskReopened   Type = "task.reopened"
+
+	// Ping is only sent to test a webhook
+	Ping Type = "ping"
+)
+
+// Event is something that happened in a guild. It is serialized as JSON for
+// webhooks, so Data must be too.
+type Event struct {
+	ID      uuid.UUID   `json:"id"`
+	Type    Type        `json:"type"`
+	GuildID string      `json:"guild_id"`
+	Time    time.Time   `json:"created_at"`
+	Data    interface{} `json:"data"`
+}
+
+// Handler reacts to new events recorded for a guild. The events themselves are
+// read from the store. Handlers run on the publisher's goroutine, so they should
+// return quickly.
+type Handler func(ctx context.Context, guildID string)
+
+// Bus signals every subscribed handler when events were recorded for a guild
+type Bus struct {
+	mu       sync.RWMutex
+	handlers []Handler
+}
+
+// NewBus creates a bus without subscribers
+func NewBus() *Bus {
+	return &Bus{}
+}
+
+// Subscribe adds a handler for every signal published from now on
+func (b *Bus) Subscribe(h Handler) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.handlers = append(b.handlers, h)
+}
+
+// Publish signals the subscribed handlers in order that events were recorded
+// for a guild
+func (b *Bus) Publish(ctx context.Context, guildID string) {
+	b.mu.RLock()
+	handlers := b.handlers
+	b.mu.RUnlock()
+
+	for _, h := range handlers {
+		h(ctx, guildID)
+	}
+}
+
+// User identifies who caused an event
+type User struct {
+	ID        uuid.UUID `json:"id"`
+	DiscordID string    `json:"discord_id"`
+	Username  string    `json:"username"`
+}
+
+// Task is the task an event is about
+type Task struct {
+	ID          uuid.UUID  `json:"id"`
+	ParentID    *uuid.UUID `json:"parent_id"`
+	Name        string     `json:"name"`
+	Description string     `json:"description"`
+	Tags        []string   `json:"tags"`
+	Completed   bool       `json:"completed"`
+	Global      bool       `json:"global"`
+}
+
+// CheckIn is a period of work on a task
+type CheckIn struct {
+	ID              uuid.UUID  `json:"id"`
+	StartTime       time.Time  `json:"start_time"`
+	EndTime         *time.Time `json:"end_time"`
+	DurationSeconds int64      `json:"duration_seconds"`
+}
+
+// CheckInData is the data of check-in and declared time events
+type CheckInData struct {
+	User    User    `json:"user"`
+	Task    Task    `json:"task"`
+	CheckIn CheckIn `json:"checkin"`
+}
+
+// TaskData is the data of task events. User is who made the change; it is nil
+// for tasks created from recurring templates.
+type TaskData struct {
+	User *User `json:"user"`
+	Task Task  `json:"task"`
+}
+
+// PingData is the data of ping events; User is who asked for the test
+type PingData struct {
+	User User `json:"user"`
+}
+
+// NewUser converts a stored user to event data
+func NewUser(user *models.User) User {
+	return User{ID: user.ID, DiscordID: user.DiscordID, Username: user.Username}
+}
+
+// NewTask converts a stored task to event data
+func NewTask(task *models.Task) Task {
+	tags := task.Tags
+	if tags == nil {
+		tags = []string{}
+	}
+	return Task{
+		ID:          task.ID,
+		ParentID:    task.ParentID,
+		Name:        task.Name,
+		Description: task.Description,
+		Tags:        tags,
+		Completed:   task.Completed,
+		Global:      task.Global,
+	}
+}
+
+// NewCheckIn converts a stored check-in to event data; the duration of an
+// active check-in is zero
+func NewCheckIn(checkIn *models.CheckIn) CheckIn {
+	data := CheckIn{ID: checkIn.ID, StartTime: checkIn.StartTime, EndTime: checkIn.EndTime}
+	if checkIn.EndTime != nil {
+		data.DurationSeconds = int64(checkIn.EndTime.Sub(checkIn.StartTime).Seconds())
+	}
+	return data
+}
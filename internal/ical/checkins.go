@@ -0,0 +1,53 @@
+package ical
+
+import (
+	"sort"
+	"time"
+
+	"taskbot/internal/db/models"
+)
+
+// CheckInEvents converts ended check-ins to events in each user's timezone,
+// oldest first. Subtasks are named "Parent › Child" like in autocomplete.
+func CheckInEvents(history []*models.CheckInWithTask) []Event {
+	locations := make(map[string]*time.Location)
+	var events []Event
+	for _, ci := range history {
+		if ci.CheckIn.EndTime == nil {
+			continue
+		}
+
+		loc, ok := locations[ci.User.Timezone]
+		if !ok {
+			var err error
+			if loc, err = time.LoadLocation(ci.User.Timezone); err != nil {
+				loc = time.UTC
+			}
+			locations[ci.User.Timezone] = loc
+		}
+
+		summary := ci.Task.Name
+		if ci.Parent != nil {
+			summary = ci.Parent.Name + " › " + ci.Task.Name
+		}
+		description := "User: " + ci.User.Username
+		if ci.Task.Description != "" {
+			description = ci.Task.Description + "\n\n" + description
+		}
+
+		events = append(events, Event{
+			UID:         ci.CheckIn.ID.String() + "@taskbot",
+			Start:       ci.CheckIn.StartTime,
+			End:         *ci.CheckIn.EndTime,
+			Location:    loc,
+			Summary:     summary,
+			Description: description,
+			Categories:  ci.Task.Tags,
+		})
+	}
+
+	sort.Slice(events, func(a, b int) bool {
+		return events[a].Start.Before(events[b].Start)
+	})
+	return events
+}
@@ -0,0 +1,253 @@
+// Package ical writes time entries as iCalendar (RFC 5545) files that calendar
+// apps can import or subscribe to.
+package ical
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+const (
+	// maxLineLength is the longest content line, in octets, before it is folded
+	maxLineLength = 75
+
+	utcFormat   = "20060102T150405Z"
+	localFormat = "20060102T150405"
+)
+
+// Calendar is a named collection of events
+type Calendar struct {
+	Name string
+	// Created is used as the DTSTAMP of every event
+	Created time.Time
+	Events  []Event
+}
+
+// Event is a period of time spent on something. Times are written in Location,
+// with a VTIMEZONE describing it, or in UTC when Location is nil or UTC.
+type Event struct {
+	UID         string
+	Start       time.Time
+	End         time.Time
+	Location    *time.Location
+	Summary     string
+	Description string
+	Categories  []string
+}
+
+// Write writes the calendar in iCalendar format
+func Write(w io.Writer, cal Calendar) error {
+	bw := bufio.NewWriter(w)
+	line := func(name, value string) {
+		writeLine(bw, name+":"+value)
+	}
+
+	line("BEGIN", "VCALENDAR")
+	line("VERSION", "2.0")
+	line("PRODID", "-//taskbot//time entries//EN")
+	line("CALSCALE", "GREGORIAN")
+	line("METHOD", "PUBLISH")
+	if cal.Name != "" {
+		line("X-WR-CALNAME", escapeText(cal.Name))
+	}
+
+	for _, tz := range timezones(cal.Events) {
+		writeTimezone(bw, tz.loc, tz.from, tz.to)
+	}
+
+	stamp := cal.Created.UTC().Format(utcFormat)
+	for _, e := range cal.Events {
+		line("BEGIN", "VEVENT")
+		line("UID", escapeText(e.UID))
+		line("DTSTAMP", stamp)
+		writeLine(bw, "DTSTART"+formatTime(e.Start, e.Location))
+		writeLine(bw, "DTEND"+formatTime(e.End, e.Location))
+		line("SUMMARY", escapeText(e.Summary))
+		if e.Description != "" {
+			line("DESCRIPTION", escapeText(e.Description))
+		}
+		if len(e.Categories) > 0 {
+			categories := make([]string, len(e.Categories))
+			for i, c := range e.Categories {
+				categories[i] = escapeText(c)
+			}
+			line("CATEGORIES", strings.Join(categories, ","))
+		}
+		line("TRANSP", "OPAQUE")
+		line("END", "VEVENT")
+	}
+
+	line("END", "VCALENDAR")
+	return bw.Flush()
+}
+
+// isUTC reports whether times in loc are written in UTC
+func isUTC(loc *time.Location) bool {
+	return loc == nil || loc == time.UTC || loc.String() == "UTC"
+}
+
+// formatTime returns the parameters and value of a date-time property, e.g.
+// ";TZID=Europe/London:20240101T090000"
+func formatTime(t time.Time, loc *time.Location) string {
+	if isUTC(loc) {
+		return ":" + t.UTC().Format(utcFormat)
+	}
+	return ";TZID=" + loc.String() + ":" + t.In(loc).Format(localFormat)
+}
+
+type timezoneRange struct {
+	loc      *time.Location
+	from, to time.Time
+}
+
+// timezones returns the time zones used by events with the period each must
+// describe, sorted by name
+func timezones(events []Event) []timezoneRange {
+	ranges := make(map[string]*timezoneRange)
+	for _, e := range events {
+		if isUTC(e.Location) {
+			continue
+		}
+		r, ok := ranges[e.Location.String()]
+		if !ok {
+			r = &timezoneRange{loc: e.Location, from: e.Start, to: e.End}
+			ranges[e.Location.String()] = r
+		}
+		if e.Start.Before(r.from) {
+			r.from = e.Start
+		}
+		if e.End.After(r.to) {
+			r.to = e.End
+		}
+	}
+
+	result := make([]timezoneRange, 0, len(ranges))
+	for _, r := range ranges {
+		result = append(result, *r)
+	}
+	sort.Slice(result, func(a, b int) bool {
+		return result[a].loc.String() < result[b].loc.String()
+	})
+	return result
+}
+
+// writeTimezone writes a VTIMEZONE for loc with one observance for the offset in
+// effect at from and one for each offset change up to to
+func writeTimezone(w *bufio.Writer, loc *time.Location, from, to time.Time) {
+	writeLine(w, "BEGIN:VTIMEZONE")
+	writeLine(w, "TZID:"+loc.String())
+
+	t := from.In(loc)
+	_, offset := t.Zone()
+	writeObservance(w, t, offset)
+
+	for t.Before(to) {
+		next := nextTransition(t, to)
+		if next.IsZero() {
+			break
+		}
+		writeObservance(w, next, offset)
+		_, offset = next.Zone()
+		t = next
+	}
+
+	writeLine(w, "END:VTIMEZONE")
+}
+
+// writeObservance writes the STANDARD or DAYLIGHT period starting at t, which
+// follows a period with offsetFrom
+func writeObservance(w *bufio.Writer, t time.Time, offsetFrom int) {
+	name, offsetTo := t.Zone()
+	kind := "STANDARD"
+	if t.IsDST() {
+		kind = "DAYLIGHT"
+	}
+
+	// The onset is given in the local time of the period before it
+	onset := t.UTC().Add(time.Duration(offsetFrom) * time.Second)
+	writeLine(w, "BEGIN:"+kind)
+	writeLine(w, "DTSTART:"+onset.Format(localFormat))
+	writeLine(w, "TZOFFSETFROM:"+formatOffset(offsetFrom))
+	writeLine(w, "TZOFFSETTO:"+formatOffset(offsetTo))
+	writeLine(w, "TZNAME:"+escapeText(name))
+	writeLine(w, "END:"+kind)
+}
+
+// nextTransition returns the first instant after t and no later than limit at
+// which the UTC offset of t's location changes, or the zero time if there is none
+func nextTransition(t, limit time.Time) time.Time {
+	_, offset := t.Zone()
+	loc := t.Location()
+
+	// Find a day on which the offset differs, then narrow it down to the second
+	lo := t
+	var hi time.Time
+	for day := t.Add(24 * time.Hour); ; day = day.Add(24 * time.Hour) {
+		if day.After(limit) {
+			day = limit.In(loc)
+		}
+		if _, o := day.Zone(); o != offset {
+			hi = day
+			break
+		}
+		if !day.Before(limit) {
+			return time.Time{}
+		}
+		lo = day
+	}
+	for hi.Sub(lo) > time.Second {
+		mid := lo.Add(hi.Sub(lo) / 2).Truncate(time.Second)
+		if _, o := mid.Zone(); o == offset {
+			lo = mid
+		} else {
+			hi = mid
+		}
+	}
+	return hi
+}
+
+// formatOffset formats a UTC offset in seconds as +HHMM
+func formatOffset(seconds int) string {
+	sign := "+"
+	if seconds < 0 {
+		sign = "-"
+		seconds = -seconds
+	}
+	return fmt.Sprintf("%s%02d%02d", sign, seconds/3600, seconds%3600/60)
+}
+
+// escapeText escapes a TEXT value
+func escapeText(s string) string {
+	return strings.NewReplacer(
+		`\`, `\\`,
+		";", `\;`,
+		",", `\,`,
+		"\r\n", `\n`,
+		"\n", `\n`,
+		"\r", `\n`,
+	).Replace(s)
+}
+
+// writeLine writes a content line, folding it into lines of at most 75 octets
+// without splitting UTF-8 characters
+func writeLine(w *bufio.Writer, line string) {
+	limit := maxLineLength
+	for len(line) > limit {
+		cut := limit
+		for cut > 0 && !utf8.RuneStart(line[cut]) {
+			cut--
+		}
+		w.WriteString(line[:cut])
+		w.WriteString("\r\n ")
+		line = line[cut:]
+		// Continuation lines start with a space, which counts toward the limit
+		limit = maxLineLength - 1
+	}
+	w.WriteString(line)
+	w.WriteString("\r\n")
+}
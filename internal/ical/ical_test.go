@@ -0,0 +1,177 @@
+package ical
+
+import (
+	"bufio"
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+	_ "time/tzdata"
+	"unicode/utf8"
+)
+
+func TestEscapeText(t *testing.T) {
+	tests := []struct {
+		in   string
+		want string
+	}{
+		{"Write docs", "Write docs"},
+		{"a,b;c", `a\,b\;c`},
+		{`C:\path`, `C:\\path`},
+		{"one\ntwo", `one\ntwo`},
+		{"one\r\ntwo\rthree", `one\ntwo\nthree`},
+	}
+	for _, tt := range tests {
+		if got := escapeText(tt.in); got != tt.want {
+			t.Errorf("escapeText(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestWriteLineFolding(t *testing.T) {
+	tests := []struct {
+		name string
+		line string
+	}{
+		{"short", "SUMMARY:Write docs"},
+		{"exact", "SUMMARY:" + strings.Repeat("x", maxLineLength-len("SUMMARY:"))},
+		{"ascii", "DESCRIPTION:" + strings.Repeat("x", 200)},
+		{"multi-byte", "SUMMARY:" + strings.Repeat("é", 100)},
+		{"emoji", "SUMMARY:" + strings.Repeat("🚀", 60)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			w := bufio.NewWriter(&buf)
+			writeLine(w, tt.line)
+			w.Flush()
+
+			out := buf.String()
+			if !strings.HasSuffix(out, "\r\n") {
+				t.Fatalf("line does not end with CRLF: %q", out)
+			}
+			lines := strings.Split(strings.TrimSuffix(out, "\r\n"), "\r\n")
+			for i, l := range lines {
+				if len(l) > maxLineLength {
+					t.Errorf("line %d has %d octets", i, len(l))
+				}
+				if !utf8.ValidString(l) {
+					t.Errorf("line %d splits a character: %q", i, l)
+				}
+				if i > 0 && !strings.HasPrefix(l, " ") {
+					t.Errorf("continuation line %d does not start with a space", i)
+				}
+			}
+
+			// Unfolding restores the original line
+			if unfolded := strings.ReplaceAll(strings.TrimSuffix(out, "\r\n"), "\r\n ", ""); unfolded != tt.line {
+				t.Fatalf("unfolded line = %q, want %q", unfolded, tt.line)
+			}
+		})
+	}
+}
+
+func TestFormatOffset(t *testing.T) {
+	tests := []struct {
+		seconds int
+		want    string
+	}{
+		{0, "+0000"},
+		{3600, "+0100"},
+		{19800, "+0530"},
+		{-18000, "-0500"},
+		{-9000, "-0230"},
+	}
+	for _, tt := range tests {
+		if got := formatOffset(tt.seconds); got != tt.want {
+			t.Errorf("formatOffset(%d) = %q, want %q", tt.seconds, got, tt.want)
+		}
+	}
+}
+
+func TestWriteTimezones(t *testing.T) {
+	london, err := time.LoadLocation("Europe/London")
+	if err != nil {
+		t.Fatalf("loading timezone: %v", err)
+	}
+
+	tests := []struct {
+		name   string
+		events []Event
+		want   []string
+		absent []string
+	}{
+		{
+			name: "utc",
+			events: []Event{{
+				UID:   "1@taskbot",
+				Start: time.Date(2024, 1, 10, 9, 0, 0, 0, time.UTC),
+				End:   time.Date(2024, 1, 10, 10, 0, 0, 0, time.UTC),
+			}},
+			want:   []string{"DTSTART:20240110T090000Z", "DTEND:20240110T100000Z"},
+			absent: []string{"BEGIN:VTIMEZONE"},
+		},
+		{
+			name: "winter only",
+			events: []Event{{
+				UID:      "1@taskbot",
+				Start:    time.Date(2024, 1, 10, 9, 0, 0, 0, london),
+				End:      time.Date(2024, 1, 10, 10, 0, 0, 0, london),
+				Location: london,
+			}},
+			want: []string{
+				"TZID:Europe/London",
+				"BEGIN:STANDARD",
+				"TZOFFSETTO:+0000",
+				"DTSTART;TZID=Europe/London:20240110T090000",
+			},
+			absent: []string{"BEGIN:DAYLIGHT"},
+		},
+		{
+			name: "across both transitions",
+			events: []Event{
+				{
+					UID:      "1@taskbot",
+					Start:    time.Date(2024, 3, 1, 9, 0, 0, 0, london),
+					End:      time.Date(2024, 3, 1, 10, 0, 0, 0, london),
+					Location: london,
+				},
+				{
+					UID:      "2@taskbot",
+					Start:    time.Date(2024, 11, 1, 9, 0, 0, 0, london),
+					End:      time.Date(2024, 11, 1, 10, 0, 0, 0, london),
+					Location: london,
+				},
+			},
+			want: []string{
+				// Onsets are in the local time of the period before them
+				"BEGIN:DAYLIGHT\r\nDTSTART:20240331T010000\r\nTZOFFSETFROM:+0000\r\nTZOFFSETTO:+0100\r\nTZNAME:BST",
+				"BEGIN:STANDARD\r\nDTSTART:20241027T020000\r\nTZOFFSETFROM:+0100\r\nTZOFFSETTO:+0000\r\nTZNAME:GMT",
+				"DTSTART;TZID=Europe/London:20241101T090000",
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			err := Write(&buf, Calendar{Name: "Time", Created: time.Date(2024, 12, 1, 0, 0, 0, 0, time.UTC), Events: tt.events})
+			if err != nil {
+				t.Fatalf("writing calendar: %v", err)
+			}
+			out := buf.String()
+			for _, want := range tt.want {
+				if !strings.Contains(out, want) {
+					t.Errorf("calendar is missing %q:\n%s", want, out)
+				}
+			}
+			for _, absent := range tt.absent {
+				if strings.Contains(out, absent) {
+					t.Errorf("calendar contains %q:\n%s", absent, out)
+				}
+			}
+			if n := strings.Count(out, "BEGIN:VTIMEZONE"); n > 1 {
+				t.Errorf("calendar has %d VTIMEZONE components, want at most 1", n)
+			}
+		})
+	}
+}
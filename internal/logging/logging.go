@@ -0,0 +1,84 @@
+// Package logging configures the structured logger used across the bot.
+package logging
+
+import (
+	"fmt"
+	"io"
+	"log/slog"
+	"strings"
+)
+
+// redacted replaces the value of sensitive attributes
+const redacted = "[REDACTED]"
+
+// sensitiveKeys are attribute key fragments whose values are never logged
+var sensitiveKeys = []string{"token", "password", "secret", "authorization", "api_key", "dsn"}
+
+// New returns a logger writing to w at the given level ("debug", "info", "warn"
+// or "error") in the given format ("text" or "json"). Empty values default to
+// info and text. Any occurrence of the given secrets in a logged string is
+// replaced, in addition to attributes whose key looks sensitive.
+func New(w io.Writer, level, format string, secrets ...string) (*slog.Logger, error) {
+	var lvl slog.Level
+	if level != "" {
+		if err := lvl.UnmarshalText([]byte(level)); err != nil {
+			return nil, fmt.Errorf("invalid log level %q: %w", level, err)
+		}
+	}
+
+	opts := &slog.HandlerOptions{
+		Level:       lvl,
+		ReplaceAttr: redactor(secrets),
+	}
+
+	switch strings.ToLower(format) {
+	case "", "text":
+		return slog.New(slog.NewTextHandler(w, opts)), nil
+	case "json":
+		return slog.New(slog.NewJSONHandler(w, opts)), nil
+	default:
+		return nil, fmt.Errorf("invalid log format %q: must be text or json", format)
+	}
+}
+
+// redactor returns a ReplaceAttr function that hides the values of attributes
+// whose key looks sensitive and masks the secrets in string values
+func redactor(secrets []string) func(groups []string, attr slog.Attr) slog.Attr {
+	var pairs []string
+	for _, secret := range secrets {
+		if secret != "" {
+			pairs = append(pairs, secret, redacted)
+		}
+	}
+	replacer := strings.NewReplacer(pairs...)
+
+	return func(groups []string, attr slog.Attr) slog.Attr {
+		if attr.Value.Kind() == slog.KindGroup {
+			return attr
+		}
+		key := strings.ToLower(attr.Key)
+		for _, sensitive := range sensitiveKeys {
+			if strings.Contains(key, sensitive) {
+				return slog.String(attr.Key, redacted)
+			}
+		}
+		if len(pairs) == 0 {
+			return attr
+		}
+
+		value := attr.Value.Resolve()
+		var text string
+		switch v := value.Any().(type) {
+		case string:
+			text = v
+		case error:
+			text = v.Error()
+		default:
+			return attr
+		}
+		if masked := replacer.Replace(text); masked != text {
+			return slog.String(attr.Key, masked)
+		}
+		return attr
+	}
+}
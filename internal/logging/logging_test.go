@@ -0,0 +1,99 @@
+package logging
+
+import (
+	"bytes"
+	"errors"
+	"log/slog"
+	"strings"
+	"testing"
+)
+
+const secret = "discord-bot-token-123"
+
+func TestRedaction(t *testing.T) {
+	tests := []struct {
+		name string
+		log  func(l *slog.Logger)
+		want string
+	}{
+		{"sensitive key", func(l *slog.Logger) { l.Info("connecting", "password", "hunter2") }, "password=[REDACTED]"},
+		{"key fragment", func(l *slog.Logger) { l.Info("connecting", "DATABASE_DSN", "postgres://x") }, "DATABASE_DSN=[REDACTED]"},
+		{"non-string value", func(l *slog.Logger) { l.Info("loaded", "api_key_count", 3) }, "api_key_count=[REDACTED]"},
+		{"key in group", func(l *slog.Logger) { l.Info("request", slog.Group("http", "authorization", "Bearer abc")) }, "http.authorization=[REDACTED]"},
+		{"secret in value", func(l *slog.Logger) { l.Info("request", "url", "https://x/?t="+secret) }, `url="https://x/?t=[REDACTED]"`},
+		{"secret in error", func(l *slog.Logger) { l.Error("failed", "error", errors.New("bad token "+secret)) }, `error="bad token [REDACTED]"`},
+		{"secret in message", func(l *slog.Logger) { l.Info("using " + secret) }, `msg="using [REDACTED]"`},
+		{"unrelated value kept", func(l *slog.Logger) { l.Info("checked in", "task", "Write docs") }, `task="Write docs"`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			logger, err := New(&buf, "debug", "text", secret, "")
+			if err != nil {
+				t.Fatalf("creating logger: %v", err)
+			}
+			tt.log(logger)
+
+			out := buf.String()
+			if !strings.Contains(out, tt.want) {
+				t.Fatalf("log line %q does not contain %q", out, tt.want)
+			}
+			for _, leaked := range []string{secret, "hunter2", "postgres://x", "Bearer abc"} {
+				if strings.Contains(out, leaked) {
+					t.Fatalf("log line leaks %q: %q", leaked, out)
+				}
+			}
+		})
+	}
+}
+
+func TestRedactionJSON(t *testing.T) {
+	var buf bytes.Buffer
+	logger, err := New(&buf, "", "json", secret)
+	if err != nil {
+		t.Fatalf("creating logger: %v", err)
+	}
+	logger.Info("starting", "token", secret, "note", "key "+secret)
+
+	out := buf.String()
+	if strings.Contains(out, secret) {
+		t.Fatalf("log line leaks the secret: %s", out)
+	}
+	if !strings.Contains(out, `"token":"[REDACTED]"`) || !strings.Contains(out, `"note":"key [REDACTED]"`) {
+		t.Fatalf("log line = %s", out)
+	}
+}
+
+func TestNewOptions(t *testing.T) {
+	tests := []struct {
+		level  string
+		format string
+		valid  bool
+	}{
+		{"", "", true},
+		{"debug", "text", true},
+		{"WARN", "JSON", true},
+		{"error", "json", true},
+		{"verbose", "text", false},
+		{"info", "xml", false},
+	}
+	for _, tt := range tests {
+		_, err := New(&bytes.Buffer{}, tt.level, tt.format)
+		if (err == nil) != tt.valid {
+			t.Errorf("New(%q, %q) error = %v, want valid %v", tt.level, tt.format, err, tt.valid)
+		}
+	}
+}
+
+func TestLevel(t *testing.T) {
+	var buf bytes.Buffer
+	logger, err := New(&buf, "warn", "text")
+	if err != nil {
+		t.Fatalf("creating logger: %v", err)
+	}
+	logger.Info("hidden")
+	logger.Warn("shown")
+	if out := buf.String(); strings.Contains(out, "hidden") || !strings.Contains(out, "shown") {
+		t.Fatalf("warn-level output = %q", out)
+	}
+}
@@ -0,0 +1,301 @@
+// Package metrics implements the small subset of Prometheus metric types the bot
+// needs and serves them in the Prometheus text exposition format.
+package metrics
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// collectTimeout bounds the gauge functions run for a single scrape
+const collectTimeout = 5 * time.Second
+
+// DefaultBuckets are latency buckets in seconds, from 5ms to 2 minutes
+var DefaultBuckets = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30, 60, 120}
+
+// Sample is a single value of a metric with its label values
+type Sample struct {
+	Labels []string
+	Value  float64
+}
+
+// collector writes one metric family in the text exposition format
+type collector interface {
+	write(ctx context.Context, w io.Writer)
+}
+
+// Registry holds the metrics exposed by Handler
+type Registry struct {
+	mu         sync.Mutex
+	collectors []collector
+}
+
+// NewRegistry creates an empty registry
+func NewRegistry() *Registry {
+	return &Registry{}
+}
+
+// MustRegister adds metrics to the registry
+func (r *Registry) MustRegister(metrics ...interface{}) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, m := range metrics {
+		c, ok := m.(collector)
+		if !ok {
+			panic(fmt.Sprintf("metrics: cannot register %T", m))
+		}
+		r.collectors = append(r.collectors, c)
+	}
+}
+
+// Handler serves all registered metrics
+func (r *Registry) Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		ctx, cancel := context.WithTimeout(req.Context(), collectTimeout)
+		defer cancel()
+
+		r.mu.Lock()
+		collectors := append([]collector(nil), r.collectors...)
+		r.mu.Unlock()
+
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		for _, c := range collectors {
+			c.write(ctx, w)
+		}
+	})
+}
+
+type desc struct {
+	name   string
+	help   string
+	kind   string
+	labels []string
+}
+
+func (d desc) writeHeader(w io.Writer) {
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", d.name, escapeHelp(d.help), d.name, d.kind)
+}
+
+// labelKey joins label values into a map key
+func labelKey(values []string) string {
+	return strings.Join(values, "\xff")
+}
+
+func (d desc) checkLabels(values []string) {
+	if len(values) != len(d.labels) {
+		panic(fmt.Sprintf("metrics: %s expects %d label values, got %d", d.name, len(d.labels), len(values)))
+	}
+}
+
+// formatLabels renders {name="value",...}, adding an extra pair when extraName is set
+func formatLabels(names, values []string, extraName, extraValue string) string {
+	var pairs []string
+	for idx, name := range names {
+		pairs = append(pairs, fmt.Sprintf(`%s="%s"`, name, escapeLabel(values[idx])))
+	}
+	if extraName != "" {
+		pairs = append(pairs, fmt.Sprintf(`%s="%s"`, extraName, extraValue))
+	}
+	if len(pairs) == 0 {
+		return ""
+	}
+	return "{" + strings.Join(pairs, ",") + "}"
+}
+
+func escapeHelp(s string) string {
+	return strings.NewReplacer(`\`, `\\`, "\n", `\n`).Replace(s)
+}
+
+func escapeLabel(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(strings.ToValidUTF8(s, "\uFFFD"))
+}
+
+func formatFloat(v float64) string {
+	switch {
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	case math.IsNaN(v):
+		return "NaN"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+// sortedKeys returns the keys of a label-keyed map in a stable order
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// CounterVec is a monotonically increasing value per label combination
+type CounterVec struct {
+	desc
+	mu     sync.Mutex
+	values map[string]*Sample
+}
+
+// NewCounterVec creates a counter with the given label names
+func NewCounterVec(name, help string, labels ...string) *CounterVec {
+	return &CounterVec{
+		desc:   desc{name: name, help: help, kind: "counter", labels: labels},
+		values: make(map[string]*Sample),
+	}
+}
+
+// Inc adds one to the counter for the given label values
+func (c *CounterVec) Inc(labelValues ...string) {
+	c.Add(1, labelValues...)
+}
+
+// Add adds a non-negative value to the counter for the given label values
+func (c *CounterVec) Add(v float64, labelValues ...string) {
+	c.checkLabels(labelValues)
+	if v < 0 {
+		panic(fmt.Sprintf("metrics: counter %s cannot decrease", c.name))
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	key := labelKey(labelValues)
+	sample, ok := c.values[key]
+	if !ok {
+		sample = &Sample{Labels: append([]string(nil), labelValues...)}
+		c.values[key] = sample
+	}
+	sample.Value += v
+}
+
+func (c *CounterVec) write(ctx context.Context, w io.Writer) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.writeHeader(w)
+	for _, key := range sortedKeys(c.values) {
+		sample := c.values[key]
+		fmt.Fprintf(w, "%s%s %s\n", c.name, formatLabels(c.labels, sample.Labels, "", ""), formatFloat(sample.Value))
+	}
+}
+
+// HistogramVec counts observations in cumulative buckets per label combination
+type HistogramVec struct {
+	desc
+	buckets []float64
+	mu      sync.Mutex
+	values  map[string]*histogram
+}
+
+type histogram struct {
+	labels []string
+	counts []uint64 // per bucket, not cumulative
+	count  uint64
+	sum    float64
+}
+
+// NewHistogramVec creates a histogram with the given upper bucket bounds
+func NewHistogramVec(name, help string, buckets []float64, labels ...string) *HistogramVec {
+	sorted := append([]float64(nil), buckets...)
+	sort.Float64s(sorted)
+	return &HistogramVec{
+		desc:    desc{name: name, help: help, kind: "histogram", labels: labels},
+		buckets: sorted,
+		values:  make(map[string]*histogram),
+	}
+}
+
+// Observe records a value for the given label values
+func (h *HistogramVec) Observe(v float64, labelValues ...string) {
+	h.checkLabels(labelValues)
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	key := labelKey(labelValues)
+	hist, ok := h.values[key]
+	if !ok {
+		hist = &histogram{
+			labels: append([]string(nil), labelValues...),
+			counts: make([]uint64, len(h.buckets)),
+		}
+		h.values[key] = hist
+	}
+	if idx := sort.SearchFloat64s(h.buckets, v); idx < len(h.buckets) {
+		hist.counts[idx]++
+	}
+	hist.count++
+	hist.sum += v
+}
+
+func (h *HistogramVec) write(ctx context.Context, w io.Writer) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.writeHeader(w)
+	for _, key := range sortedKeys(h.values) {
+		hist := h.values[key]
+		var cumulative uint64
+		for idx, bound := range h.buckets {
+			cumulative += hist.counts[idx]
+			fmt.Fprintf(w, "%s_bucket%s %d\n", h.name, formatLabels(h.labels, hist.labels, "le", formatFloat(bound)), cumulative)
+		}
+		fmt.Fprintf(w, "%s_bucket%s %d\n", h.name, formatLabels(h.labels, hist.labels, "le", "+Inf"), hist.count)
+		fmt.Fprintf(w, "%s_sum%s %s\n", h.name, formatLabels(h.labels, hist.labels, "", ""), formatFloat(hist.sum))
+		fmt.Fprintf(w, "%s_count%s %d\n", h.name, formatLabels(h.labels, hist.labels, "", ""), hist.count)
+	}
+}
+
+// Func reports values computed at scrape time, such as database counts or
+// statistics kept by another library
+type Func struct {
+	desc
+	collect func(ctx context.Context) ([]Sample, error)
+}
+
+// NewGaugeFunc creates a gauge whose samples are returned by collect on every
+// scrape. When collect fails the gauge is left out of that scrape.
+func NewGaugeFunc(name, help string, labels []string, collect func(ctx context.Context) ([]Sample, error)) *Func {
+	return &Func{
+		desc:    desc{name: name, help: help, kind: "gauge", labels: labels},
+		collect: collect,
+	}
+}
+
+// NewCounterFunc is like NewGaugeFunc for values that only ever increase
+func NewCounterFunc(name, help string, labels []string, collect func(ctx context.Context) ([]Sample, error)) *Func {
+	return &Func{
+		desc:    desc{name: name, help: help, kind: "counter", labels: labels},
+		collect: collect,
+	}
+}
+
+func (g *Func) write(ctx context.Context, w io.Writer) {
+	samples, err := g.collect(ctx)
+	if err != nil {
+		slog.Warn("Error collecting metric", "metric", g.name, "error", err)
+		return
+	}
+	sort.Slice(samples, func(a, b int) bool {
+		return labelKey(samples[a].Labels) < labelKey(samples[b].Labels)
+	})
+
+	g.writeHeader(w)
+	for _, sample := range samples {
+		g.checkLabels(sample.Labels)
+		fmt.Fprintf(w, "%s%s %s\n", g.name, formatLabels(g.labels, sample.Labels, "", ""), formatFloat(sample.Value))
+	}
+}
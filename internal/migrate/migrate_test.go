@@ -0,0 +1,289 @@
+package migrate
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"taskbot/migrations"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+func file(content string) *fstest.MapFile {
+	return &fstest.MapFile{Data: []byte(content)}
+}
+
+func TestLoad(t *testing.T) {
+	tests := []struct {
+		name     string
+		files    fstest.MapFS
+		versions []int64
+		err      string
+	}{
+		{
+			name: "ordered by version",
+			files: fstest.MapFS{
+				"010_later.up.sql":   file("SELECT 10"),
+				"002_second.up.sql":  file("SELECT 2"),
+				"001_first.up.sql":   file("SELECT 1"),
+				"001_first.down.sql": file("SELECT -1"),
+			},
+			versions: []int64{1, 2, 10},
+		},
+		{
+			name: "other files ignored",
+			files: fstest.MapFS{
+				"001_first.up.sql":  file("SELECT 1"),
+				"README.md":         file("notes"),
+				"001_first.sql":     file("SELECT 1"),
+				"drafts/002.up.sql": file("SELECT 2"),
+			},
+			versions: []int64{1},
+		},
+		{
+			name: "conflicting names",
+			files: fstest.MapFS{
+				"001_first.up.sql":   file("SELECT 1"),
+				"001_other.down.sql": file("SELECT -1"),
+			},
+			err: "conflicting names",
+		},
+		{
+			name:  "down without up",
+			files: fstest.MapFS{"001_first.down.sql": file("SELECT -1")},
+			err:   "has no up file",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			loaded, err := Load(tt.files)
+			if tt.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.err) {
+					t.Fatalf("Load error = %v, want %q", err, tt.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Load: %v", err)
+			}
+			if len(loaded) != len(tt.versions) {
+				t.Fatalf("loaded %d migrations, want %d", len(loaded), len(tt.versions))
+			}
+			for i, m := range loaded {
+				if m.Version != tt.versions[i] {
+					t.Errorf("migration %d has version %d, want %d", i, m.Version, tt.versions[i])
+				}
+				if len(m.Checksum) != 64 {
+					t.Errorf("migration %d has checksum %q", m.Version, m.Checksum)
+				}
+			}
+		})
+	}
+}
+
+func TestChecksumCoversUpFileOnly(t *testing.T) {
+	load := func(up, down string) string {
+		loaded, err := Load(fstest.MapFS{"001_first.up.sql": file(up), "001_first.down.sql": file(down)})
+		if err != nil {
+			t.Fatalf("Load: %v", err)
+		}
+		return loaded[0].Checksum
+	}
+
+	base := load("CREATE TABLE a ()", "DROP TABLE a")
+	if load("CREATE TABLE a ()", "DROP TABLE IF EXISTS a") != base {
+		t.Error("changing the down file changed the checksum")
+	}
+	if load("CREATE TABLE b ()", "DROP TABLE a") == base {
+		t.Error("changing the up file kept the checksum")
+	}
+}
+
+func TestEmbeddedMigrations(t *testing.T) {
+	loaded, err := Load(migrations.FS)
+	if err != nil {
+		t.Fatalf("loading embedded migrations: %v", err)
+	}
+	for i, m := range loaded {
+		if m.Version != int64(i+1) {
+			t.Errorf("migration %03d_%s is out of sequence, want version %d", m.Version, m.Name, i+1)
+		}
+		if m.Down == "" {
+			t.Errorf("migration %03d_%s has no down file", m.Version, m.Name)
+		}
+	}
+}
+
+func TestVerify(t *testing.T) {
+	m := &Migrator{migrations: []*Migration{
+		{Version: 1, Name: "first", Checksum: "aaa"},
+		{Version: 2, Name: "second", Checksum: "bbb"},
+	}}
+
+	tests := []struct {
+		name    string
+		applied map[int64]*appliedMigration
+		err     string
+	}{
+		{"nothing applied", map[int64]*appliedMigration{}, ""},
+		{"unchanged", map[int64]*appliedMigration{
+			1: {Version: 1, Name: "first", Checksum: "aaa"},
+			2: {Version: 2, Name: "second", Checksum: "bbb"},
+		}, ""},
+		{"modified", map[int64]*appliedMigration{
+			1: {Version: 1, Name: "first", Checksum: "aaa"},
+			2: {Version: 2, Name: "second", Checksum: "changed"},
+		}, "002_second was modified after it was applied"},
+		{"file missing", map[int64]*appliedMigration{
+			1: {Version: 1, Name: "first", Checksum: "aaa"},
+			3: {Version: 3, Name: "third", Checksum: "ccc"},
+		}, "003_third is applied but its file is missing"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := m.verify(tt.applied)
+			if tt.err == "" {
+				if err != nil {
+					t.Fatalf("verify: %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Fatalf("verify error = %v, want %q", err, tt.err)
+			}
+		})
+	}
+}
+
+// testPool connects to DATABASE_URL with a fresh schema on the search path, so
+// migrations run against empty tables and never touch shared ones
+func testPool(t *testing.T) *pgxpool.Pool {
+	t.Helper()
+
+	url := os.Getenv("DATABASE_URL")
+	if url == "" {
+		t.Skip("DATABASE_URL is not set")
+	}
+
+	ctx := context.Background()
+	schema := "migrate_test_" + strings.ReplaceAll(uuid.NewString(), "-", "")
+	conn, err := pgx.Connect(ctx, url)
+	if err != nil {
+		t.Fatalf("connecting to Postgres: %v", err)
+	}
+	defer conn.Close(ctx)
+	if _, err := conn.Exec(ctx, "CREATE SCHEMA "+schema); err != nil {
+		t.Fatalf("creating schema: %v", err)
+	}
+	t.Cleanup(func() {
+		conn, err := pgx.Connect(context.Background(), url)
+		if err != nil {
+			return
+		}
+		defer conn.Close(context.Background())
+		conn.Exec(context.Background(), "DROP SCHEMA "+schema+" CASCADE")
+	})
+
+	cfg, err := pgxpool.ParseConfig(url)
+	if err != nil {
+		t.Fatalf("parsing DATABASE_URL: %v", err)
+	}
+	cfg.ConnConfig.RuntimeParams["search_path"] = schema
+	pool, err := pgxpool.NewWithConfig(ctx, cfg)
+	if err != nil {
+		t.Fatalf("connecting to Postgres: %v", err)
+	}
+	t.Cleanup(pool.Close)
+	return pool
+}
+
+func TestUpDownRedo(t *testing.T) {
+	pool := testPool(t)
+	ctx := context.Background()
+
+	files := fstest.MapFS{
+		"001_notes.up.sql":     file("CREATE TABLE notes (id INT)"),
+		"001_notes.down.sql":   file("DROP TABLE notes"),
+		"002_authors.up.sql":   file("CREATE TABLE authors (id INT)"),
+		"002_authors.down.sql": file("DROP TABLE authors"),
+	}
+	migrator, err := New(pool, files)
+	if err != nil {
+		t.Fatalf("loading migrations: %v", err)
+	}
+
+	tableExists := func(name string) bool {
+		var exists bool
+		err := pool.QueryRow(ctx, `SELECT to_regclass($1) IS NOT NULL`, name).Scan(&exists)
+		if err != nil {
+			t.Fatalf("checking table %s: %v", name, err)
+		}
+		return exists
+	}
+
+	if applied, err := migrator.Up(ctx, 1); err != nil || len(applied) != 1 {
+		t.Fatalf("Up(1) applied %d migrations: %v", len(applied), err)
+	}
+	if applied, err := migrator.Up(ctx, 0); err != nil || len(applied) != 1 || applied[0].Version != 2 {
+		t.Fatalf("Up(0) applied %v: %v", applied, err)
+	}
+	if !tableExists("notes") || !tableExists("authors") {
+		t.Fatal("tables missing after Up")
+	}
+
+	redone, err := migrator.Redo(ctx)
+	if err != nil || redone.Version != 2 {
+		t.Fatalf("Redo = %v, %v", redone, err)
+	}
+	if !tableExists("authors") {
+		t.Fatal("authors missing after Redo")
+	}
+
+	if rolledBack, err := migrator.Down(ctx, 2); err != nil || len(rolledBack) != 2 {
+		t.Fatalf("Down(2) rolled back %d migrations: %v", len(rolledBack), err)
+	}
+	if tableExists("notes") || tableExists("authors") {
+		t.Fatal("tables left after Down")
+	}
+	if _, err := migrator.Redo(ctx); err == nil {
+		t.Fatal("Redo with nothing applied succeeded")
+	}
+
+	// Editing an applied migration is refused
+	if _, err := migrator.Up(ctx, 0); err != nil {
+		t.Fatalf("Up: %v", err)
+	}
+	files["001_notes.up.sql"] = file("CREATE TABLE notes (id BIGINT)")
+	edited, err := New(pool, files)
+	if err != nil {
+		t.Fatalf("loading edited migrations: %v", err)
+	}
+	if _, err := edited.Up(ctx, 0); err == nil || !strings.Contains(err.Error(), "checksum mismatch") {
+		t.Fatalf("Up after editing an applied migration = %v, want checksum mismatch", err)
+	}
+	statuses, err := edited.Status(ctx)
+	if err != nil {
+		t.Fatalf("Status: %v", err)
+	}
+	if len(statuses) != 2 || !statuses[0].Modified || statuses[1].Modified {
+		t.Fatalf("statuses = %s", formatStatuses(statuses))
+	}
+	if time.Since(statuses[0].AppliedAt) > time.Hour {
+		t.Fatalf("applied_at = %v", statuses[0].AppliedAt)
+	}
+}
+
+func formatStatuses(statuses []*Status) string {
+	var parts []string
+	for _, s := range statuses {
+		parts = append(parts, fmt.Sprintf("%03d_%s applied=%v modified=%v", s.Version, s.Name, s.Applied, s.Modified))
+	}
+	return strings.Join(parts, ", ")
+}
@@ -0,0 +1,127 @@
+// Package server runs the bot's optional HTTP listener for health checks and metrics.
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+)
+
+const (
+	// checkTimeout bounds a single health check
+	checkTimeout = 3 * time.Second
+
+	// shutdownTimeout bounds how long in-flight requests may run on shutdown
+	shutdownTimeout = 5 * time.Second
+)
+
+// Server is an HTTP server with a request multiplexer
+type Server struct {
+	mux    *http.ServeMux
+	server *http.Server
+}
+
+// New creates a server listening on addr, e.g. ":8080"
+func New(addr string) *Server {
+	mux := http.NewServeMux()
+	return &Server{
+		mux: mux,
+		server: &http.Server{
+			Addr:              addr,
+			Handler:           mux,
+			ReadHeaderTimeout: 10 * time.Second,
+		},
+	}
+}
+
+// Handle registers a handler for a ServeMux pattern such as "GET /healthz"
+func (s *Server) Handle(pattern string, handler http.Handler) {
+	s.mux.Handle(pattern, handler)
+}
+
+// Run serves requests until ctx is cancelled, then shuts down gracefully
+func (s *Server) Run(ctx context.Context) error {
+	listener, err := net.Listen("tcp", s.server.Addr)
+	if err != nil {
+		return fmt.Errorf("error listening on %s: %w", s.server.Addr, err)
+	}
+	slog.Info("HTTP server listening", "addr", listener.Addr().String())
+
+	errCh := make(chan error, 1)
+	go func() {
+		errCh <- s.server.Serve(listener)
+	}()
+
+	select {
+	case err := <-errCh:
+		return fmt.Errorf("error serving HTTP: %w", err)
+	case <-ctx.Done():
+	}
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+	if err := s.server.Shutdown(shutdownCtx); err != nil {
+		return fmt.Errorf("error shutting down HTTP server: %w", err)
+	}
+	if err := <-errCh; err != nil && !errors.Is(err, http.ErrServerClosed) {
+		return fmt.Errorf("error serving HTTP: %w", err)
+	}
+	return nil
+}
+
+type healthResponse struct {
+	Status string            `json:"status"`
+	Checks map[string]string `json:"checks"`
+}
+
+// HealthHandler runs every check concurrently and responds with 200 when all
+// pass or 503 when any fails, with each check's result in the body
+func HealthHandler(checks map[string]func(ctx context.Context) error) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		names := make([]string, 0, len(checks))
+		for name := range checks {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+
+		results := make([]error, len(names))
+		var wg sync.WaitGroup
+		for idx, name := range names {
+			wg.Add(1)
+			go func(idx int, check func(ctx context.Context) error) {
+				defer wg.Done()
+				ctx, cancel := context.WithTimeout(r.Context(), checkTimeout)
+				defer cancel()
+				results[idx] = check(ctx)
+			}(idx, checks[name])
+		}
+		wg.Wait()
+
+		resp := healthResponse{Status: "ok", Checks: make(map[string]string, len(names))}
+		status := http.StatusOK
+		for idx, name := range names {
+			if err := results[idx]; err != nil {
+				slog.Warn("Health check failed", "check", name, "error", err)
+				resp.Checks[name] = err.Error()
+				resp.Status = "unavailable"
+				status = http.StatusServiceUnavailable
+				continue
+			}
+			resp.Checks[name] = "ok"
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Cache-Control", "no-store")
+		w.WriteHeader(status)
+		if err := json.NewEncoder(w).Encode(resp); err != nil {
+			slog.Debug("Error writing health response", "error", err)
+		}
+	})
+}
@@ -0,0 +1,195 @@
+// Package webhook posts queued events to external URLs, signed so that receivers
+// can check they came from the bot.
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"strconv"
+	"syscall"
+	"time"
+
+	"taskbot/internal/db/models"
+)
+
+const (
+	// Timeout bounds a single delivery attempt
+	Timeout = 10 * time.Second
+
+	// secretPrefix marks webhook secrets so they are easy to recognise
+	secretPrefix = "whsec_"
+
+	// Headers sent with every delivery
+	HeaderEvent     = "X-Taskbot-Event"
+	HeaderDelivery  = "X-Taskbot-Delivery"
+	HeaderTimestamp = "X-Taskbot-Timestamp"
+	HeaderSignature = "X-Taskbot-Signature"
+)
+
+var (
+	// ErrInvalidURL is returned for webhook URLs that are not absolute http or https URLs
+	ErrInvalidURL = errors.New("webhook URL must be an absolute http or https URL")
+
+	// ErrForbiddenAddress is returned for webhook URLs that point at the bot's own
+	// host or network rather than the public internet
+	ErrForbiddenAddress = errors.New("webhook URL must not point to a loopback, private or link-local address")
+)
+
+// Client posts deliveries. Redirects are not followed, so a webhook must be
+// registered with its final URL. It connects directly, without proxies, and
+// refuses addresses that ValidateURL would reject, so a host name that resolves
+// to a public address when registered cannot later be pointed at an internal one.
+var Client = &http.Client{
+	Timeout: Timeout,
+	CheckRedirect: func(req *http.Request, via []*http.Request) error {
+		return http.ErrUseLastResponse
+	},
+	Transport: &http.Transport{
+		DialContext: (&net.Dialer{
+			Timeout: Timeout,
+			Control: dialControl,
+		}).DialContext,
+		ForceAttemptHTTP2:   true,
+		TLSHandshakeTimeout: Timeout,
+		MaxIdleConns:        10,
+		IdleConnTimeout:     90 * time.Second,
+	},
+}
+
+// Ranges that are not covered by the net/netip predicates but are still not
+// the public internet
+var forbiddenPrefixes = []netip.Prefix{
+	netip.MustParsePrefix("0.0.0.0/8"),
+	netip.MustParsePrefix("100.64.0.0/10"),
+	netip.MustParsePrefix("192.0.0.0/24"),
+	netip.MustParsePrefix("198.18.0.0/15"),
+	netip.MustParsePrefix("240.0.0.0/4"),
+	netip.MustParsePrefix("64:ff9b::/96"),
+}
+
+// allowedAddr reports whether deliveries may be sent to addr
+func allowedAddr(addr netip.Addr) bool {
+	addr = addr.Unmap()
+	if !addr.IsValid() || addr.IsLoopback() || addr.IsPrivate() || addr.IsUnspecified() ||
+		addr.IsLinkLocalUnicast() || addr.IsLinkLocalMulticast() ||
+		addr.IsInterfaceLocalMulticast() || addr.IsMulticast() {
+		return false
+	}
+	for _, prefix := range forbiddenPrefixes {
+		if prefix.Contains(addr) {
+			return false
+		}
+	}
+	return true
+}
+
+// dialControl refuses connections to addresses that are not allowed, checked
+// after DNS resolution
+func dialControl(network, address string, c syscall.RawConn) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	addr, err := netip.ParseAddr(host)
+	if err != nil || !allowedAddr(addr) {
+		return ErrForbiddenAddress
+	}
+	return nil
+}
+
+// NewSecret returns a random secret for signing a webhook's deliveries
+func NewSecret() (string, error) {
+	buf := make([]byte, 24)
+	if _, err := rand.Read(buf); err != nil {
+		return "", fmt.Errorf("error generating webhook secret: %w", err)
+	}
+	return secretPrefix + base64.RawURLEncoding.EncodeToString(buf), nil
+}
+
+// ValidateURL checks that a webhook URL is an absolute http or https URL whose
+// host resolves only to public addresses
+func ValidateURL(ctx context.Context, rawURL string) error {
+	u, err := url.Parse(rawURL)
+	if err != nil || (u.Scheme != "https" && u.Scheme != "http") || u.Hostname() == "" {
+		return ErrInvalidURL
+	}
+
+	if addr, err := netip.ParseAddr(u.Hostname()); err == nil {
+		if !allowedAddr(addr) {
+			return ErrForbiddenAddress
+		}
+		return nil
+	}
+
+	addrs, err := net.DefaultResolver.LookupNetIP(ctx, "ip", u.Hostname())
+	if err != nil {
+		return fmt.Errorf("error resolving webhook host %s: %w", u.Hostname(), err)
+	}
+	for _, addr := range addrs {
+		if !allowedAddr(addr) {
+			return ErrForbiddenAddress
+		}
+	}
+	return nil
+}
+
+// Sign returns the signature header value for a body sent at timestamp: the
+// hex HMAC-SHA256 of "<timestamp>.<body>" keyed with the secret
+func Sign(secret string, timestamp int64, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(strconv.FormatInt(timestamp, 10)))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// Deliver posts a delivery's payload to its webhook. Any response other than
+// 2xx is an error.
+func Deliver(ctx context.Context, client *http.Client, delivery *models.WebhookDelivery, now time.Time) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, delivery.URL, bytes.NewReader(delivery.Payload))
+	if err != nil {
+		return fmt.Errorf("error creating webhook request: %w", withoutURL(err))
+	}
+
+	timestamp := now.Unix()
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "taskbot-webhook")
+	req.Header.Set(HeaderEvent, delivery.EventType)
+	req.Header.Set(HeaderDelivery, delivery.ID.String())
+	req.Header.Set(HeaderTimestamp, strconv.FormatInt(timestamp, 10))
+	req.Header.Set(HeaderSignature, Sign(delivery.Secret, timestamp, delivery.Payload))
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("error posting webhook: %w", withoutURL(err))
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("webhook responded with %s", resp.Status)
+	}
+	return nil
+}
+
+// withoutURL strips the URL that url.Error adds to request errors, since the
+// errors are stored and shown to admins and the URL may carry credentials
+func withoutURL(err error) error {
+	var urlErr *url.Error
+	if errors.As(err, &urlErr) {
+		return urlErr.Err
+	}
+	return err
+}
@@ -0,0 +1,157 @@
+package webhook
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"taskbot/internal/db/models"
+
+	"github.com/google/uuid"
+)
+
+func TestSign(t *testing.T) {
+	// Computed independently with Python's hmac module
+	got := Sign("whsec_test", 1700000000, []byte(`{"event":"task.completed"}`))
+	want := "sha256=72d60e3c2ab752b968d31a79e53de5d105671d4180995b39eaca9508bececd25"
+	if got != want {
+		t.Fatalf("Sign = %q, want %q", got, want)
+	}
+
+	if Sign("whsec_other", 1700000000, []byte(`{}`)) == Sign("whsec_test", 1700000000, []byte(`{}`)) {
+		t.Fatal("signature does not depend on the secret")
+	}
+	if Sign("whsec_test", 1700000001, []byte(`{}`)) == Sign("whsec_test", 1700000000, []byte(`{}`)) {
+		t.Fatal("signature does not depend on the timestamp")
+	}
+}
+
+func TestAllowedAddr(t *testing.T) {
+	tests := []struct {
+		addr    string
+		allowed bool
+	}{
+		{"93.184.216.34", true},
+		{"2606:2800:220:1:248:1893:25c8:1946", true},
+		{"127.0.0.1", false},
+		{"::1", false},
+		{"10.1.2.3", false},
+		{"172.16.0.1", false},
+		{"192.168.1.1", false},
+		{"169.254.169.254", false},
+		{"fe80::1", false},
+		{"fd00::1", false},
+		{"0.0.0.0", false},
+		{"::", false},
+		{"100.64.0.1", false},
+		{"198.18.0.1", false},
+		{"224.0.0.1", false},
+		{"255.255.255.255", false},
+		{"::ffff:127.0.0.1", false},
+		{"::ffff:10.0.0.1", false},
+		{"64:ff9b::a00:1", false},
+	}
+	for _, tt := range tests {
+		if got := allowedAddr(netip.MustParseAddr(tt.addr)); got != tt.allowed {
+			t.Errorf("allowedAddr(%s) = %v, want %v", tt.addr, got, tt.allowed)
+		}
+	}
+}
+
+func TestValidateURL(t *testing.T) {
+	tests := []struct {
+		url  string
+		want error
+	}{
+		{"https://93.184.216.34/hook", nil},
+		{"ftp://93.184.216.34/hook", ErrInvalidURL},
+		{"/hook", ErrInvalidURL},
+		{"https://", ErrInvalidURL},
+		{"http://127.0.0.1:8080/hook", ErrForbiddenAddress},
+		{"http://[::1]/hook", ErrForbiddenAddress},
+		{"http://169.254.169.254/latest/meta-data", ErrForbiddenAddress},
+	}
+	for _, tt := range tests {
+		if err := ValidateURL(context.Background(), tt.url); !errors.Is(err, tt.want) {
+			t.Errorf("ValidateURL(%q) = %v, want %v", tt.url, err, tt.want)
+		}
+	}
+}
+
+func TestClientRefusesInternalAddresses(t *testing.T) {
+	called := false
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		called = true
+	}))
+	defer srv.Close()
+
+	// The dial guard applies after resolution, whatever URL was registered
+	delivery := &models.WebhookDelivery{ID: uuid.New(), URL: srv.URL, Secret: "whsec_test", Payload: []byte(`{}`)}
+	err := Deliver(context.Background(), Client, delivery, time.Now())
+	if !errors.Is(err, ErrForbiddenAddress) {
+		t.Fatalf("Deliver to loopback = %v, want ErrForbiddenAddress", err)
+	}
+	if called {
+		t.Fatal("request reached the loopback server")
+	}
+	if strings.Contains(err.Error(), srv.URL) {
+		t.Fatalf("error includes the webhook URL: %v", err)
+	}
+}
+
+func TestDeliver(t *testing.T) {
+	tests := []struct {
+		name   string
+		status int
+		ok     bool
+	}{
+		{"ok", http.StatusOK, true},
+		{"no content", http.StatusNoContent, true},
+		{"redirect", http.StatusFound, false},
+		{"server error", http.StatusInternalServerError, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got *http.Request
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				got = r
+				if tt.status == http.StatusFound {
+					w.Header().Set("Location", "/elsewhere")
+				}
+				w.WriteHeader(tt.status)
+			}))
+			defer srv.Close()
+
+			// Client would refuse the loopback test server, so keep its redirect policy only
+			client := &http.Client{CheckRedirect: Client.CheckRedirect}
+			now := time.Unix(1700000000, 0)
+			delivery := &models.WebhookDelivery{
+				ID:        uuid.New(),
+				URL:       srv.URL,
+				EventType: "task.completed",
+				Secret:    "whsec_test",
+				Payload:   []byte(`{"event":"task.completed"}`),
+			}
+			err := Deliver(context.Background(), client, delivery, now)
+			if (err == nil) != tt.ok {
+				t.Fatalf("Deliver error = %v, want ok %v", err, tt.ok)
+			}
+
+			if got.Header.Get(HeaderEvent) != "task.completed" || got.Header.Get(HeaderDelivery) != delivery.ID.String() {
+				t.Errorf("event headers = %q, %q", got.Header.Get(HeaderEvent), got.Header.Get(HeaderDelivery))
+			}
+			if got.Header.Get(HeaderTimestamp) != strconv.FormatInt(now.Unix(), 10) {
+				t.Errorf("timestamp header = %q", got.Header.Get(HeaderTimestamp))
+			}
+			if got.Header.Get(HeaderSignature) != Sign(delivery.Secret, now.Unix(), delivery.Payload) {
+				t.Errorf("signature header = %q", got.Header.Get(HeaderSignature))
+			}
+		})
+	}
+}
@@ -0,0 +1,5 @@
+-- Drop initial schema
+DROP TABLE IF EXISTS server_settings;
+DROP TABLE IF EXISTS check_ins;
+DROP TABLE IF EXISTS tasks;
+DROP TABLE IF EXISTS users;
@@ -0,0 +1 @@
+-- The active column is part of the initial schema, so there is nothing to undo here
@@ -0,0 +1,5 @@
+-- Drop server_id indexes and columns
+DROP INDEX IF EXISTS idx_check_ins_server_id;
+DROP INDEX IF EXISTS idx_tasks_server_id;
+ALTER TABLE check_ins DROP COLUMN IF EXISTS server_id;
+ALTER TABLE tasks DROP COLUMN IF EXISTS server_id;
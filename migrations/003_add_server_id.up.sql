@@ -1,3 +1,7 @@
+-- Add server_id columns to tasks and check_ins
+ALTER TABLE tasks ADD COLUMN IF NOT EXISTS server_id VARCHAR(64);
+ALTER TABLE check_ins ADD COLUMN IF NOT EXISTS server_id VARCHAR(64);
+
 -- Set default server_id for existing records (using the first server from server_settings)
 WITH first_server AS (
     SELECT server_id FROM server_settings LIMIT 1
@@ -0,0 +1,2 @@
+-- Drop guild_users table
+DROP TABLE IF EXISTS guild_users;
@@ -0,0 +1,29 @@
+-- Create audit_events table to record who changed what and when
+CREATE TABLE IF NOT EXISTS audit_events (
+    id UUID PRIMARY KEY,
+    server_id VARCHAR(64) NOT NULL DEFAULT '',
+    actor_id UUID REFERENCES users(id),
+    target_user_id UUID REFERENCES users(id),
+    task_id UUID,
+    action VARCHAR(64) NOT NULL,
+    details JSONB NOT NULL DEFAULT '{}',
+    created_at TIMESTAMP NOT NULL DEFAULT NOW()
+);
+
+-- Audit events are append-only
+CREATE OR REPLACE FUNCTION audit_events_append_only() RETURNS trigger AS $$
+BEGIN
+    RAISE EXCEPTION 'audit_events is append-only';
+END;
+$$ LANGUAGE plpgsql;
+
+DROP TRIGGER IF EXISTS audit_events_no_modify ON audit_events;
+CREATE TRIGGER audit_events_no_modify
+    BEFORE UPDATE OR DELETE ON audit_events
+    FOR EACH ROW EXECUTE FUNCTION audit_events_append_only();
+
+-- Create indexes for the /audit filters
+CREATE INDEX IF NOT EXISTS idx_audit_events_server_created ON audit_events(server_id, created_at);
+CREATE INDEX IF NOT EXISTS idx_audit_events_actor_id ON audit_events(actor_id);
+CREATE INDEX IF NOT EXISTS idx_audit_events_target_user_id ON audit_events(target_user_id);
+CREATE INDEX IF NOT EXISTS idx_audit_events_task_id ON audit_events(task_id);
@@ -0,0 +1,5 @@
+-- Drop full-text search vector
+DROP INDEX IF EXISTS idx_tasks_search_vector;
+DROP TRIGGER IF EXISTS tasks_search_vector_trigger ON tasks;
+DROP FUNCTION IF EXISTS tasks_search_vector_update();
+ALTER TABLE tasks DROP COLUMN IF EXISTS search_vector;
@@ -0,0 +1,27 @@
+-- Add full-text search vector over task name, tags and description
+ALTER TABLE tasks ADD COLUMN IF NOT EXISTS search_vector tsvector;
+
+CREATE OR REPLACE FUNCTION tasks_search_vector_update() RETURNS trigger AS $$
+BEGIN
+    NEW.search_vector :=
+        setweight(to_tsvector('simple', coalesce(NEW.name, '')), 'A') ||
+        setweight(to_tsvector('simple', coalesce(array_to_string(NEW.tags, ' '), '')), 'B') ||
+        setweight(to_tsvector('simple', coalesce(NEW.description, '')), 'C');
+    RETURN NEW;
+END;
+$$ LANGUAGE plpgsql;
+
+DROP TRIGGER IF EXISTS tasks_search_vector_trigger ON tasks;
+CREATE TRIGGER tasks_search_vector_trigger
+    BEFORE INSERT OR UPDATE OF name, description, tags ON tasks
+    FOR EACH ROW EXECUTE FUNCTION tasks_search_vector_update();
+
+-- Backfill existing tasks
+UPDATE tasks SET search_vector =
+    setweight(to_tsvector('simple', coalesce(name, '')), 'A') ||
+    setweight(to_tsvector('simple', coalesce(array_to_string(tags, ' '), '')), 'B') ||
+    setweight(to_tsvector('simple', coalesce(description, '')), 'C')
+WHERE search_vector IS NULL;
+
+-- Create index for search
+CREATE INDEX IF NOT EXISTS idx_tasks_search_vector ON tasks USING GIN(search_vector);
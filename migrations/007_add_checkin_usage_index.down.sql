@@ -0,0 +1,2 @@
+-- Drop per-user task usage index
+DROP INDEX IF EXISTS idx_check_ins_user_server_task;
@@ -0,0 +1,2 @@
+-- Create index for per-user task usage statistics used by autocomplete ranking
+CREATE INDEX IF NOT EXISTS idx_check_ins_user_server_task ON check_ins(user_id, server_id, task_id, start_time);
@@ -0,0 +1,7 @@
+-- Restore the original task foreign key and drop archived_at
+ALTER TABLE check_ins DROP CONSTRAINT IF EXISTS check_ins_task_id_fkey;
+ALTER TABLE check_ins ADD CONSTRAINT check_ins_task_id_fkey
+    FOREIGN KEY (task_id) REFERENCES tasks(id);
+
+DROP INDEX IF EXISTS idx_tasks_server_archived;
+ALTER TABLE tasks DROP COLUMN IF EXISTS archived_at;
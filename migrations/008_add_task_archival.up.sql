@@ -0,0 +1,10 @@
+-- Add archived_at column so tasks can be hidden while keeping their history
+ALTER TABLE tasks ADD COLUMN IF NOT EXISTS archived_at TIMESTAMP;
+
+-- Refuse to delete tasks that still have check-ins
+ALTER TABLE check_ins DROP CONSTRAINT IF EXISTS check_ins_task_id_fkey;
+ALTER TABLE check_ins ADD CONSTRAINT check_ins_task_id_fkey
+    FOREIGN KEY (task_id) REFERENCES tasks(id) ON DELETE RESTRICT;
+
+-- Create index for filtering out archived tasks
+CREATE INDEX IF NOT EXISTS idx_tasks_server_archived ON tasks(server_id) WHERE archived_at IS NULL;
@@ -0,0 +1,3 @@
+-- Drop subtask relation
+DROP INDEX IF EXISTS idx_tasks_parent_id;
+ALTER TABLE tasks DROP COLUMN IF EXISTS parent_id;
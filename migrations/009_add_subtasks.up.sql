@@ -0,0 +1,5 @@
+-- Add parent_id column so tasks can have subtasks
+ALTER TABLE tasks ADD COLUMN IF NOT EXISTS parent_id UUID REFERENCES tasks(id) ON DELETE RESTRICT;
+
+-- Create index for subtask lookups
+CREATE INDEX IF NOT EXISTS idx_tasks_parent_id ON tasks(parent_id);
@@ -0,0 +1,2 @@
+-- Drop task_templates table
+DROP TABLE IF EXISTS task_templates;
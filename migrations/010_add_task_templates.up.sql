@@ -0,0 +1,17 @@
+-- Create task_templates table for recurring global tasks
+CREATE TABLE IF NOT EXISTS task_templates (
+    id UUID PRIMARY KEY,
+    server_id VARCHAR(64) NOT NULL,
+    name VARCHAR(128) NOT NULL,
+    description TEXT NOT NULL DEFAULT '',
+    schedule VARCHAR(16) NOT NULL,
+    timezone VARCHAR(32) NOT NULL DEFAULT 'UTC',
+    created_by UUID NOT NULL REFERENCES users(id),
+    last_task_id UUID REFERENCES tasks(id) ON DELETE SET NULL,
+    next_run_at TIMESTAMP NOT NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT NOW()
+);
+
+-- Create indexes
+CREATE INDEX IF NOT EXISTS idx_task_templates_server_id ON task_templates(server_id);
+CREATE INDEX IF NOT EXISTS idx_task_templates_next_run_at ON task_templates(next_run_at);
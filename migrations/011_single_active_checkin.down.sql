@@ -0,0 +1 @@
+DROP INDEX IF EXISTS idx_check_ins_one_active;
@@ -0,0 +1,22 @@
+-- Declared check-ins were stored as active even though they have an end time
+UPDATE check_ins SET active = false WHERE active AND end_time IS NOT NULL;
+
+-- Close all but the most recent active check-in per user and server
+UPDATE check_ins c
+SET end_time = GREATEST(latest.start_time, c.start_time + INTERVAL '1 second'),
+    active = false
+FROM (
+    SELECT DISTINCT ON (user_id, server_id) id, user_id, server_id, start_time
+    FROM check_ins
+    WHERE active
+    ORDER BY user_id, server_id, start_time DESC, id
+) latest
+WHERE c.active
+  AND c.user_id = latest.user_id
+  AND c.server_id = latest.server_id
+  AND c.id <> latest.id;
+
+-- Allow at most one active check-in per user per server
+CREATE UNIQUE INDEX IF NOT EXISTS idx_check_ins_one_active
+    ON check_ins(user_id, server_id)
+    WHERE active;
@@ -0,0 +1,9 @@
+-- Map Discord roles to bot roles per guild
+CREATE TABLE IF NOT EXISTS role_mappings (
+    server_id VARCHAR(64) NOT NULL,
+    discord_role_id VARCHAR(64) NOT NULL,
+    role VARCHAR(16) NOT NULL CHECK (role IN ('member', 'lead', 'admin')),
+    created_by UUID NOT NULL REFERENCES users(id),
+    created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (server_id, discord_role_id)
+);
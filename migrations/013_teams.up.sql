@@ -0,0 +1,19 @@
+-- Teams group the users whose reports a lead may see. A team either follows a
+-- Discord role or lists its members in team_members.
+CREATE TABLE IF NOT EXISTS teams (
+    id UUID PRIMARY KEY,
+    server_id VARCHAR(64) NOT NULL,
+    name VARCHAR(64) NOT NULL,
+    discord_role_id VARCHAR(64),
+    created_by UUID NOT NULL REFERENCES users(id),
+    created_at TIMESTAMP NOT NULL DEFAULT NOW()
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_teams_server_name ON teams(server_id, LOWER(name));
+
+CREATE TABLE IF NOT EXISTS team_members (
+    team_id UUID NOT NULL REFERENCES teams(id) ON DELETE CASCADE,
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    added_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (team_id, user_id)
+);
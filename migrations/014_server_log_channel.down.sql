@@ -0,0 +1,3 @@
+ALTER TABLE server_settings
+    DROP COLUMN IF EXISTS log_categories,
+    DROP COLUMN IF EXISTS log_channel_id;
@@ -0,0 +1,4 @@
+-- Per-guild channel for error and admin events
+ALTER TABLE server_settings
+    ADD COLUMN IF NOT EXISTS log_channel_id VARCHAR(64),
+    ADD COLUMN IF NOT EXISTS log_categories TEXT[] NOT NULL DEFAULT '{errors,admin}';
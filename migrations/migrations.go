@@ -0,0 +1,10 @@
+// Package migrations embeds the SQL migration files so binaries can apply them
+// without the source tree.
+package migrations
+
+import "embed"
+
+// FS holds every NNN_name.up.sql and NNN_name.down.sql file in this directory
+//
+//go:embed *.sql
+var FS embed.FS
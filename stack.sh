@@ -16,7 +16,7 @@ usage() {
     echo "  ps             - Show running services"
     echo "  local          - Run taskbot locally (requires Go)"
     echo "  local-db       - Run taskbot locally with database"
-    echo "  migrate        - Run database migrations"
+    echo "  migrate [cmd]  - Run database migrations (up, down [n], status, redo)"
     exit 1
 }
 
@@ -68,7 +68,7 @@ case "$1" in
         go run cmd/taskbot/main.go
         ;;
     "migrate")
-        go run cmd/migrate/main.go
+        go run ./cmd/migrate "${@:2}"
         ;;
     *)
         usage